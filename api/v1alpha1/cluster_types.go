@@ -87,6 +87,12 @@ type OpenTelemetry struct {
 	// +kubebuilder:default="true"
 	// +optional
 	Insecure string `json:"insecure,omitempty"`
+
+	// Sets the OTEL_METRIC_EXPORT_INTERVAL environment variable, the interval in milliseconds
+	// between exports of metrics to the collector.
+	// +kubebuilder:validation:Pattern="^[0-9]+$"
+	// +optional
+	MetricExportInterval string `json:"metricExportInterval,omitempty"`
 }
 
 // MessageBus describes the deployment of messagesbuses for ETOS.
@@ -331,6 +337,11 @@ type ETOSConfig struct {
 	// timestamps in ETOS.
 	// +optional
 	Timezone string `json:"timezone,omitempty"`
+
+	// UserLogLevel describes the minimum level of the logs that are shown to users, unless a
+	// testrun has a level of its own. Defaults to info if not set.
+	// +optional
+	UserLogLevel UserLogLevel `json:"userLogLevel,omitempty"`
 }
 
 // ETOS describes the deployment of an ETOS cluster.
@@ -102,6 +102,53 @@ type Image struct {
 	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
 }
 
+// JobSettings configure the jobs that ETOS runs for providers and environment requests.
+type JobSettings struct {
+	// Resources describes the compute resources of the container. ETOS applies a limit of
+	// 250m CPU and 256Mi memory, and a request of 100m CPU and 128Mi memory, if not set.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// ImagePullSecrets are the secrets to use when pulling the image.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// NodeSelector describes the labels of the nodes that the jobs may be scheduled on.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations describes the taints that the jobs tolerate.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// SecurityContext describes the security options of the container.
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+}
+
+// ApplyToContainer applies the resources and security context to the container of a job. Settings
+// that are not set are left as they are in the container.
+func (s JobSettings) ApplyToContainer(container *corev1.Container) {
+	if s.Resources != nil {
+		container.Resources = *s.Resources.DeepCopy()
+	}
+	if s.SecurityContext != nil {
+		container.SecurityContext = s.SecurityContext.DeepCopy()
+	}
+}
+
+// ApplyToPod applies the image pull secrets, node selector and tolerations to the pod of a job.
+func (s JobSettings) ApplyToPod(pod *corev1.PodSpec) {
+	pod.ImagePullSecrets = append(pod.ImagePullSecrets, s.ImagePullSecrets...)
+	if len(s.NodeSelector) > 0 {
+		if pod.NodeSelector == nil {
+			pod.NodeSelector = make(map[string]string, len(s.NodeSelector))
+		}
+		for key, value := range s.NodeSelector {
+			pod.NodeSelector[key] = value
+		}
+	}
+	for _, toleration := range s.Tolerations {
+		pod.Tolerations = append(pod.Tolerations, *toleration.DeepCopy())
+	}
+}
+
 // Ingress configuration.
 type Ingress struct {
 	// Enabled describes whether to create an ingress for the service. Defaults to false.
@@ -119,12 +166,52 @@ type Ingress struct {
 	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
+// UserLogLevel describes the minimum level of the logs that are shown to users.
+// +kubebuilder:validation:Enum=debug;info;warning;error
+type UserLogLevel string
+
+const (
+	// UserLogLevelDebug shows all logs to users.
+	UserLogLevelDebug UserLogLevel = "debug"
+	// UserLogLevelInfo shows informational logs, warnings and errors to users.
+	UserLogLevelInfo UserLogLevel = "info"
+	// UserLogLevelWarning shows warnings and errors to users.
+	UserLogLevelWarning UserLogLevel = "warning"
+	// UserLogLevelError shows errors to users.
+	UserLogLevelError UserLogLevel = "error"
+)
+
+// MessageBusBackend describes the kind of message bus that messages are published to.
+// +kubebuilder:validation:Enum=stream;amqp;nats;file
+type MessageBusBackend string
+
+const (
+	// MessageBusBackendStream publishes messages to a RabbitMQ stream.
+	MessageBusBackendStream MessageBusBackend = "stream"
+	// MessageBusBackendAMQP publishes messages to a classic RabbitMQ exchange.
+	MessageBusBackendAMQP MessageBusBackend = "amqp"
+	// MessageBusBackendNATS publishes messages to a NATS JetStream stream.
+	MessageBusBackendNATS MessageBusBackend = "nats"
+	// MessageBusBackendFile appends messages to a local file.
+	MessageBusBackendFile MessageBusBackend = "file"
+)
+
 // RabbitMQ configuration.
 type RabbitMQ struct {
 	// Deploy describes whether to deploy a RabbitMQ instance for the service. Defaults to true.
 	// +kubebuilder:default=true
 	// +optional
 	Deploy bool `json:"deploy,omitempty"`
+	// Backend describes the kind of message bus to publish messages to. "stream" publishes to the
+	// RabbitMQ stream StreamName, "amqp" to the RabbitMQ exchange Exchange, "nats" to the NATS
+	// JetStream stream StreamName on Host and Port and "file" appends messages to the file Path.
+	// Only the ETOS message bus supports other backends than "stream". Defaults to "stream".
+	// +kubebuilder:default=stream
+	// +optional
+	Backend MessageBusBackend `json:"backend,omitempty"`
+	// Path describes the file to append messages to with the "file" backend.
+	// +optional
+	Path string `json:"path,omitempty"`
 	// Host describes the host to use for RabbitMQ. Only used if Deploy is false.
 	// +kubebuilder:default="rabbitmq"
 	// +optional
@@ -19,6 +19,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
 )
 
 // EnvironmentSpec defines the desired state of Environment
@@ -63,6 +65,10 @@ type EnvironmentStatus struct {
 	EnvironmentReleasers []corev1.ObjectReference `json:"environmentReleasers,omitempty"`
 
 	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Release is the status of the release of the environment.
+	// +optional
+	Release *etosv1alpha2.ReleaseStatus `json:"release,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -24,15 +24,24 @@ import (
 
 type IutProvider struct {
 	ID string `json:"id"`
+	// Failover describes which providers to fall back to if this provider cannot be used.
+	// +optional
+	Failover *ProviderFailover `json:"failover,omitempty"`
 }
 
 type LogAreaProvider struct {
 	ID string `json:"id"`
+	// Failover describes which providers to fall back to if this provider cannot be used.
+	// +optional
+	Failover *ProviderFailover `json:"failover,omitempty"`
 }
 
 type ExecutionSpaceProvider struct {
-	ID         string `json:"id"`
-	TestRunner string `json:"testRunner"`
+	ID string `json:"id"`
+	// Failover describes which providers to fall back to if this provider cannot be used.
+	// +optional
+	Failover   *ProviderFailover `json:"failover,omitempty"`
+	TestRunner string            `json:"testRunner"`
 	// TestRunnerImage describes the container image to run in an execution space
 	TestRunnerImage string `json:"testrunnerImage"`
 }
@@ -41,6 +50,19 @@ type EnvironmentProviders struct {
 	IUT            IutProvider            `json:"iut,omitempty"`
 	ExecutionSpace ExecutionSpaceProvider `json:"executionSpace,omitempty"`
 	LogArea        LogAreaProvider        `json:"logArea,omitempty"`
+
+	// WaitTimeout is how long to wait for unavailable providers to become available again
+	// before failing. Fails immediately if not set.
+	// Also limits how long an environment request waits for providers to have enough
+	// available capacity, which is one hour if not set.
+	// +optional
+	WaitTimeout *metav1.Duration `json:"waitTimeout,omitempty"`
+
+	// LeaseDuration is how long the IUTs, execution spaces and log areas are leased for. The user
+	// of a leased resource renews the lease while using it, and the resource is kept past its
+	// deadline for as long as the lease is renewed. Resources are not leased if not set.
+	// +optional
+	LeaseDuration *metav1.Duration `json:"leaseDuration,omitempty"`
 }
 
 type Splitter struct {
@@ -72,7 +94,11 @@ type EnvironmentRequestSpec struct {
 	ID   string `json:"id,omitempty"`
 	Name string `json:"name,omitempty"`
 
-	*Image        `json:",inline"`
+	*Image `json:",inline"`
+	// JobSettings configure the jobs that provision and release the environments of the request.
+	// +optional
+	JobSettings *JobSettings `json:"jobSettings,omitempty"`
+
 	Identifier    string `json:"identifier,omitempty"`
 	Artifact      string `json:"artifact,omitempty"`
 	Identity      string `json:"identity,omitempty"`
@@ -98,6 +124,29 @@ type EnvironmentRequestSpec struct {
 	Splitter           Splitter                     `json:"splitter"`
 	ServiceAccountName string                       `json:"serviceaccountname,omitempty"`
 	Config             EnvironmentProviderJobConfig `json:"Config,omitempty"`
+
+	// UserLogLevel is the minimum level of the logs of the providers that are shown to users.
+	// Defaults to info if not set.
+	// +optional
+	UserLogLevel UserLogLevel `json:"userLogLevel,omitempty"`
+
+	// Debug describes whether the providers and the test runner log at the debug level.
+	// +optional
+	Debug bool `json:"debug,omitempty"`
+}
+
+// LogEnvironment returns the environment variables that tell the jobs of the EnvironmentRequest,
+// I.e. the environment provider, the providers and the ETOS test runner, how to log.
+func (e EnvironmentRequestSpec) LogEnvironment() []corev1.EnvVar {
+	level := e.UserLogLevel
+	if level == "" {
+		level = UserLogLevelInfo
+	}
+	env := []corev1.EnvVar{{Name: "ETOS_USER_LOG_LEVEL", Value: string(level)}}
+	if e.Debug {
+		env = append(env, corev1.EnvVar{Name: "ETOS_DEBUG", Value: "true"})
+	}
+	return env
 }
 
 // EnvironmentRequestStatus defines the observed state of EnvironmentRequest
@@ -106,6 +155,11 @@ type EnvironmentRequestStatus struct {
 
 	EnvironmentProviders []corev1.ObjectReference `json:"environmentProviders,omitempty"`
 
+	// FailedProviders are the providers that have failed to provision for this environment request.
+	// They are not tried again when falling back to another provider.
+	// +optional
+	FailedProviders []string `json:"failedProviders,omitempty"`
+
 	StartTime      *metav1.Time `json:"startTime,omitempty"`
 	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
 }
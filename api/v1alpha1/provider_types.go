@@ -84,6 +84,22 @@ type JSONTas struct {
 	LogArea        *JSONTasLogArea        `json:"log,omitempty"`
 }
 
+// ReleasePolicy describes how failed releases of resources are retried.
+type ReleasePolicy struct {
+	// Retries is how many times a failed release is retried before the resource is considered leaked.
+	// +kubebuilder:default=0
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Retries int32 `json:"retries,omitempty"`
+
+	// BackoffSeconds is how long to wait before the first retry. The wait is doubled for every
+	// following retry, up to an hour.
+	// +kubebuilder:default=10
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	BackoffSeconds int32 `json:"backoffSeconds,omitempty"`
+}
+
 // Healthcheck defines the health check endpoint and interval for providers.
 // The defaults of this should work most of the time.
 type Healthcheck struct {
@@ -93,6 +109,74 @@ type Healthcheck struct {
 	// +kubebuilder:default=30
 	// +optional
 	IntervalSeconds int `json:"intervalSeconds"`
+
+	// Protocol is how the health of the provider is checked. 'http' sends a request to the Endpoint
+	// at Host, 'grpc' uses the gRPC health checking protocol at Host and 'exec' runs the provider
+	// Image, in a Job, with the -healthcheck flag.
+	// +kubebuilder:validation:Enum=http;grpc;exec
+	// +kubebuilder:default=http
+	// +optional
+	Protocol string `json:"protocol,omitempty"`
+
+	// Method is the HTTP method of the health check request.
+	// +kubebuilder:validation:Enum=GET;HEAD;POST
+	// +kubebuilder:default=GET
+	// +optional
+	Method string `json:"method,omitempty"`
+
+	// ExpectedStatus are the HTTP status codes, or ranges of status codes such as "200-299",
+	// that a healthy provider responds with. Defaults to 204.
+	// +kubebuilder:validation:items:Pattern=`^[1-5][0-9]{2}(-[1-5][0-9]{2})?$`
+	// +optional
+	ExpectedStatus []string `json:"expectedStatus,omitempty"`
+
+	// Service is the name of the service to check with the gRPC health checking protocol.
+	// The health of the whole server is checked if empty.
+	// +optional
+	Service string `json:"service,omitempty"`
+
+	// TimeoutSeconds is the time that a health check is allowed to take. An 'exec' health check
+	// Job is given more time, to start its pod, and the check itself is canceled after this time.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=10
+	// +optional
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+
+	// FailureThreshold is the number of health checks in a row that must fail before the
+	// provider is no longer available.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=3
+	// +optional
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+
+	// TLS configures the client of 'http' and 'grpc' health checks.
+	// +optional
+	TLS *HealthcheckTLS `json:"tls,omitempty"`
+
+	// BearerToken is sent as a bearer token in the authorization header of 'http' and 'grpc'
+	// health checks.
+	// +optional
+	BearerToken *Var `json:"bearerToken,omitempty"`
+}
+
+// HealthcheckTLS configures TLS for health checks.
+type HealthcheckTLS struct {
+	// CA is a bundle of PEM encoded certificates to verify the provider with, instead of the
+	// certificates of the system.
+	// +optional
+	CA *Var `json:"ca,omitempty"`
+
+	// ClientCertificate is a PEM encoded certificate to authenticate with. Requires ClientKey.
+	// +optional
+	ClientCertificate *Var `json:"clientCertificate,omitempty"`
+
+	// ClientKey is the PEM encoded private key of the ClientCertificate.
+	// +optional
+	ClientKey *Var `json:"clientKey,omitempty"`
+
+	// InsecureSkipVerify disables verification of the certificate of the provider.
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
 }
 
 // ProviderSpec defines the desired state of Provider
@@ -102,10 +186,26 @@ type ProviderSpec struct {
 	// +optional
 	Host string `json:"host,omitempty"`
 
+	// API is the version of the remote provider API that the provider serves at Host.
+	// If set, ETOS calls the provider service at Host when provisioning and releasing
+	// instead of running Image in a Job for every request.
+	// +kubebuilder:validation:Enum=v1
+	// +optional
+	API string `json:"api,omitempty"`
+
+	// Token authenticates ETOS to a provider that serves the remote provider API. It is sent as
+	// a bearer token and must be the token that the provider is started with. Required if API is set.
+	// +optional
+	Token *Var `json:"token,omitempty"`
+
 	// +kubebuilder:default={}
 	// +optional
 	Healthcheck *Healthcheck `json:"healthCheck,omitempty"`
 
+	// Release describes how failed releases of the resources of this provider are retried.
+	// +optional
+	Release *ReleasePolicy `json:"release,omitempty"`
+
 	// These are pointers so that they become nil in the Provider object in Kubernetes
 	// and don't muddle up the yaml with empty data.
 	JSONTas       *JSONTas   `json:"jsontas,omitempty"`
@@ -114,6 +214,12 @@ type ProviderSpec struct {
 	// Image describes the docker image to run when providing a resource.
 	Image string `json:"image,omitempty"`
 
+	// BatchRelease declares that Image releases several resources in one run when it is given one
+	// -name argument for each resource. Only then does ETOS release the resources of this provider
+	// in batches, otherwise every resource is released in a job of its own.
+	// +optional
+	BatchRelease bool `json:"batchRelease,omitempty"`
+
 	// Env describes environment variables to be passed to the provider container.
 	// +optional
 	Env []corev1.EnvVar `json:"env,omitempty"`
@@ -121,6 +227,22 @@ type ProviderSpec struct {
 	// +optional
 	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
 
+	// The fields below configure the jobs that run Image, I.e. the jobs that provision, release and
+	// health check resources.
+
+	JobSettings `json:",inline"`
+	// ImagePullPolicy describes the pull policy to use for the image. ETOS applies PullIfNotPresent
+	// if empty.
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	// +optional
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// Volumes describes extra volumes to add to the jobs, mounted by VolumeMounts.
+	// +optional
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+	// VolumeMounts describes where to mount Volumes in the provider container.
+	// +optional
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+
 	// IutProviderConfig describe the configuration for an IUT provider.
 	// +optional
 	IutProviderConfig *IutProviderConfig `json:"iutProviderConfig,omitempty"`
@@ -134,14 +256,45 @@ type ProviderSpec struct {
 	LogAreaProviderConfig *LogAreaProviderConfig `json:"logAreaProviderConfig,omitempty"`
 }
 
+// ApplyToContainer applies the job settings, image pull policy and volume mounts of the provider to
+// a container that runs its image. Settings that the provider does not have are left as they are
+// in the container.
+func (s ProviderSpec) ApplyToContainer(container *corev1.Container) {
+	s.JobSettings.ApplyToContainer(container)
+	if s.ImagePullPolicy != "" {
+		container.ImagePullPolicy = s.ImagePullPolicy
+	}
+	for _, mount := range s.VolumeMounts {
+		container.VolumeMounts = append(container.VolumeMounts, *mount.DeepCopy())
+	}
+}
+
+// ApplyToPod applies the job settings and volumes of the provider to the pod of a job that runs its
+// image.
+func (s ProviderSpec) ApplyToPod(pod *corev1.PodSpec) {
+	s.JobSettings.ApplyToPod(pod)
+	for _, volume := range s.Volumes {
+		pod.Volumes = append(pod.Volumes, *volume.DeepCopy())
+	}
+}
+
 // LogAreaProviderConfig describes the configuration for a log area provider.
 type LogAreaProviderConfig struct {
 	// LiveLogs is a URI to where live logs of an execution can be found.
 	// +kubebuilder:validation:Format="uri"
-	LiveLogs string `json:"livelogs"`
+	// +optional
+	LiveLogs string `json:"livelogs,omitempty"`
 
 	// Upload defines the log upload instructions for the ETR.
-	Upload etosv1alpha2.Upload `json:"upload"`
+	// +optional
+	Upload etosv1alpha2.Upload `json:"upload,omitzero"`
+
+	// The configuration of a provider is very implementation-specific and we cannot give
+	// a perfectly generic configuration for all cases. The following field allows any
+	// data-structure to be added to this configuration and it is expected that providers
+	// can handle the data they require themselves.
+	// +optional
+	Custom apiextensionsv1.JSON `json:"custom,omitempty"`
 }
 
 // IutProviderConfig describe the configuration for an IUT provider.
@@ -165,6 +318,8 @@ type ExecutionSpaceProviderConfig struct {
 
 	// Dev describes whether or not this provider should run the ETR in dev mode.
 	// While using dev mode the ETR can be installed from github using ETRBranch and ETRRepository.
+	// This is the default for all EnvironmentRequests and it can be overridden by the 'dev' key
+	// in the dataset of an EnvironmentRequest.
 	// +kubebuilder:default="false"
 	// +optional
 	Dev string `json:"dev"`
@@ -172,19 +327,44 @@ type ExecutionSpaceProviderConfig struct {
 	// ETRBranch describes a git branch to use when running the ETR in dev mode.
 	// Can be used in conjunction with ETRRepository to test a fork, otherwise the
 	// ETRRepository defaults to github.com/eiffel-community/etos.
+	// Can be overridden by the 'ETR_BRANCH' key in the dataset of an EnvironmentRequest.
 	// +optional
 	ETRBranch string `json:"ETR_BRANCH,omitempty"`
 
 	// ETRRepository describes the git repository to fetch an ETR from when running in
 	// dev mode. Defaults to github.com/eiffel-community/etos
+	// Can be overridden by the 'ETR_REPO' key in the dataset of an EnvironmentRequest.
 	// +optional
 	ETRRepository string `json:"ETR_REPOSITORY,omitempty"`
 }
 
+// ProviderCapacity describes the amount of resources that a provider can provide.
+type ProviderCapacity struct {
+	// Total is the total amount of resources that the provider has.
+	Total int `json:"total"`
+	// Available is the amount of resources that can be provisioned right now.
+	Available int `json:"available"`
+	// Reserved is the amount of resources that are provisioned and not yet released.
+	Reserved int `json:"reserved"`
+}
+
 // ProviderStatus defines the observed state of Provider
 type ProviderStatus struct {
 	Conditions          []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
 	LastHealthCheckTime *metav1.Time       `json:"lastHealthCheckTime,omitempty"`
+
+	// ConsecutiveFailures is the number of health checks in a row that have failed.
+	// +optional
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+
+	// Capacity is the capacity that the provider advertised at the last health check.
+	// Only providers that serve the remote provider API advertise their capacity.
+	// +optional
+	Capacity *ProviderCapacity `json:"capacity,omitempty"`
+
+	// Capabilities are the features that the provider advertised at the last health check.
+	// +optional
+	Capabilities []string `json:"capabilities,omitempty"`
 }
 
 // +kubebuilder:object:root=true
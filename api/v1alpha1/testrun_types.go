@@ -28,6 +28,47 @@ type Providers struct {
 	IUT            string `json:"iut"`
 	LogArea        string `json:"logArea"`
 	ExecutionSpace string `json:"executionSpace"`
+
+	// Failover describes which providers to fall back to, per resource type, when a provider
+	// is not available or fails to provision.
+	// +optional
+	Failover *ProvidersFailover `json:"failover,omitempty"`
+
+	// WaitTimeout is how long to wait for unavailable providers to become available again
+	// before failing. Fails immediately if not set.
+	// Also limits how long an environment request waits for providers to have enough
+	// available capacity, which is one hour if not set.
+	// +optional
+	WaitTimeout *metav1.Duration `json:"waitTimeout,omitempty"`
+
+	// LeaseDuration is how long the IUTs, execution spaces and log areas are leased for. The user
+	// of a leased resource renews the lease while using it, and the resource is kept past its
+	// deadline for as long as the lease is renewed. Resources are not leased if not set.
+	// +optional
+	LeaseDuration *metav1.Duration `json:"leaseDuration,omitempty"`
+}
+
+// ProvidersFailover describes which providers to fall back to for each resource type.
+type ProvidersFailover struct {
+	// +optional
+	IUT *ProviderFailover `json:"iut,omitempty"`
+	// +optional
+	LogArea *ProviderFailover `json:"logArea,omitempty"`
+	// +optional
+	ExecutionSpace *ProviderFailover `json:"executionSpace,omitempty"`
+}
+
+// ProviderFailover lists the providers to fall back to, in order, when a provider is not
+// available or fails to provision.
+type ProviderFailover struct {
+	// Providers are the names of Provider kinds to fall back to, tried in order.
+	// +optional
+	Providers []string `json:"providers,omitempty"`
+
+	// Selector selects Provider kinds, of the same type, to fall back to when none of the
+	// Providers can be used. The selected providers are tried in order of name.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
 }
 
 // TestCase metadata.
@@ -88,6 +129,10 @@ type LogListener struct {
 
 type EnvironmentProvider struct {
 	*Image `json:",inline"`
+
+	// JobSettings configure the jobs that provision and release the environment of the testrun.
+	// +optional
+	JobSettings *JobSettings `json:"jobSettings,omitempty"`
 }
 
 // Retention describes the failure and success retentions for testruns.
@@ -126,6 +171,16 @@ type TestRunSpec struct {
 	// It is used to set batchesUri in the TERCC event.
 	// +optional
 	SuiteSource string `json:"suiteSource,omitempty"`
+
+	// UserLogLevel is the minimum level of the logs that are shown to the users of the testrun.
+	// Defaults to the userLogLevel of the cluster.
+	// +optional
+	UserLogLevel UserLogLevel `json:"userLogLevel,omitempty"`
+
+	// Debug describes whether the providers and the test runner of the testrun log at the debug
+	// level, and show the debug logs to users, for debugging a testrun.
+	// +optional
+	Debug bool `json:"debug,omitempty"`
 }
 
 // TestRunStatus defines the observed state of TestRun
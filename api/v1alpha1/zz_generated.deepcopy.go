@@ -21,6 +21,7 @@
 package v1alpha1
 
 import (
+	"github.com/eiffel-community/etos/api/v1alpha2"
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -406,6 +407,11 @@ func (in *EnvironmentProvider) DeepCopyInto(out *EnvironmentProvider) {
 		*out = new(Image)
 		**out = **in
 	}
+	if in.JobSettings != nil {
+		in, out := &in.JobSettings, &out.JobSettings
+		*out = new(JobSettings)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvironmentProvider.
@@ -439,9 +445,19 @@ func (in *EnvironmentProviderJobConfig) DeepCopy() *EnvironmentProviderJobConfig
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EnvironmentProviders) DeepCopyInto(out *EnvironmentProviders) {
 	*out = *in
-	out.IUT = in.IUT
-	out.ExecutionSpace = in.ExecutionSpace
-	out.LogArea = in.LogArea
+	in.IUT.DeepCopyInto(&out.IUT)
+	in.ExecutionSpace.DeepCopyInto(&out.ExecutionSpace)
+	in.LogArea.DeepCopyInto(&out.LogArea)
+	if in.WaitTimeout != nil {
+		in, out := &in.WaitTimeout, &out.WaitTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.LeaseDuration != nil {
+		in, out := &in.LeaseDuration, &out.LeaseDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvironmentProviders.
@@ -521,12 +537,17 @@ func (in *EnvironmentRequestSpec) DeepCopyInto(out *EnvironmentRequestSpec) {
 		*out = new(Image)
 		**out = **in
 	}
+	if in.JobSettings != nil {
+		in, out := &in.JobSettings, &out.JobSettings
+		*out = new(JobSettings)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Dataset != nil {
 		in, out := &in.Dataset, &out.Dataset
 		*out = new(apiextensionsv1.JSON)
 		(*in).DeepCopyInto(*out)
 	}
-	out.Providers = in.Providers
+	in.Providers.DeepCopyInto(&out.Providers)
 	in.Splitter.DeepCopyInto(&out.Splitter)
 	in.Config.DeepCopyInto(&out.Config)
 }
@@ -556,6 +577,11 @@ func (in *EnvironmentRequestStatus) DeepCopyInto(out *EnvironmentRequestStatus)
 		*out = make([]corev1.ObjectReference, len(*in))
 		copy(*out, *in)
 	}
+	if in.FailedProviders != nil {
+		in, out := &in.FailedProviders, &out.FailedProviders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.StartTime != nil {
 		in, out := &in.StartTime, &out.StartTime
 		*out = (*in).DeepCopy()
@@ -582,7 +608,7 @@ func (in *EnvironmentSpec) DeepCopyInto(out *EnvironmentSpec) {
 	if in.Providers != nil {
 		in, out := &in.Providers, &out.Providers
 		*out = new(Providers)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.Tests != nil {
 		in, out := &in.Tests, &out.Tests
@@ -637,6 +663,11 @@ func (in *EnvironmentStatus) DeepCopyInto(out *EnvironmentStatus) {
 		in, out := &in.CompletionTime, &out.CompletionTime
 		*out = (*in).DeepCopy()
 	}
+	if in.Release != nil {
+		in, out := &in.Release, &out.Release
+		*out = new(v1alpha2.ReleaseStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvironmentStatus.
@@ -758,6 +789,11 @@ func (in *Execution) DeepCopy() *Execution {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExecutionSpaceProvider) DeepCopyInto(out *ExecutionSpaceProvider) {
 	*out = *in
+	if in.Failover != nil {
+		in, out := &in.Failover, &out.Failover
+		*out = new(ProviderFailover)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecutionSpaceProvider.
@@ -789,6 +825,21 @@ func (in *ExecutionSpaceProviderConfig) DeepCopy() *ExecutionSpaceProviderConfig
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Healthcheck) DeepCopyInto(out *Healthcheck) {
 	*out = *in
+	if in.ExpectedStatus != nil {
+		in, out := &in.ExpectedStatus, &out.ExpectedStatus
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(HealthcheckTLS)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BearerToken != nil {
+		in, out := &in.BearerToken, &out.BearerToken
+		*out = new(Var)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Healthcheck.
@@ -801,6 +852,36 @@ func (in *Healthcheck) DeepCopy() *Healthcheck {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HealthcheckTLS) DeepCopyInto(out *HealthcheckTLS) {
+	*out = *in
+	if in.CA != nil {
+		in, out := &in.CA, &out.CA
+		*out = new(Var)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientCertificate != nil {
+		in, out := &in.ClientCertificate, &out.ClientCertificate
+		*out = new(Var)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientKey != nil {
+		in, out := &in.ClientKey, &out.ClientKey
+		*out = new(Var)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HealthcheckTLS.
+func (in *HealthcheckTLS) DeepCopy() *HealthcheckTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(HealthcheckTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Image) DeepCopyInto(out *Image) {
 	*out = *in
@@ -841,6 +922,11 @@ func (in *Ingress) DeepCopy() *Ingress {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IutProvider) DeepCopyInto(out *IutProvider) {
 	*out = *in
+	if in.Failover != nil {
+		in, out := &in.Failover, &out.Failover
+		*out = new(ProviderFailover)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IutProvider.
@@ -1037,9 +1123,58 @@ func (in *JSONTasPrepareStages) DeepCopy() *JSONTasPrepareStages {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobSettings) DeepCopyInto(out *JobSettings) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(corev1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobSettings.
+func (in *JobSettings) DeepCopy() *JobSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(JobSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LogAreaProvider) DeepCopyInto(out *LogAreaProvider) {
 	*out = *in
+	if in.Failover != nil {
+		in, out := &in.Failover, &out.Failover
+		*out = new(ProviderFailover)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogAreaProvider.
@@ -1056,6 +1191,7 @@ func (in *LogAreaProvider) DeepCopy() *LogAreaProvider {
 func (in *LogAreaProviderConfig) DeepCopyInto(out *LogAreaProviderConfig) {
 	*out = *in
 	in.Upload.DeepCopyInto(&out.Upload)
+	in.Custom.DeepCopyInto(&out.Custom)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogAreaProviderConfig.
@@ -1167,6 +1303,46 @@ func (in *Provider) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderCapacity) DeepCopyInto(out *ProviderCapacity) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderCapacity.
+func (in *ProviderCapacity) DeepCopy() *ProviderCapacity {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderCapacity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderFailover) DeepCopyInto(out *ProviderFailover) {
+	*out = *in
+	if in.Providers != nil {
+		in, out := &in.Providers, &out.Providers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderFailover.
+func (in *ProviderFailover) DeepCopy() *ProviderFailover {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderFailover)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProviderList) DeepCopyInto(out *ProviderList) {
 	*out = *in
@@ -1202,9 +1378,19 @@ func (in *ProviderList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProviderSpec) DeepCopyInto(out *ProviderSpec) {
 	*out = *in
+	if in.Token != nil {
+		in, out := &in.Token, &out.Token
+		*out = new(Var)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Healthcheck != nil {
 		in, out := &in.Healthcheck, &out.Healthcheck
 		*out = new(Healthcheck)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Release != nil {
+		in, out := &in.Release, &out.Release
+		*out = new(ReleasePolicy)
 		**out = **in
 	}
 	if in.JSONTas != nil {
@@ -1231,6 +1417,21 @@ func (in *ProviderSpec) DeepCopyInto(out *ProviderSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	in.JobSettings.DeepCopyInto(&out.JobSettings)
+	if in.Volumes != nil {
+		in, out := &in.Volumes, &out.Volumes
+		*out = make([]corev1.Volume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VolumeMounts != nil {
+		in, out := &in.VolumeMounts, &out.VolumeMounts
+		*out = make([]corev1.VolumeMount, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.IutProviderConfig != nil {
 		in, out := &in.IutProviderConfig, &out.IutProviderConfig
 		*out = new(IutProviderConfig)
@@ -1272,6 +1473,16 @@ func (in *ProviderStatus) DeepCopyInto(out *ProviderStatus) {
 		in, out := &in.LastHealthCheckTime, &out.LastHealthCheckTime
 		*out = (*in).DeepCopy()
 	}
+	if in.Capacity != nil {
+		in, out := &in.Capacity, &out.Capacity
+		*out = new(ProviderCapacity)
+		**out = **in
+	}
+	if in.Capabilities != nil {
+		in, out := &in.Capabilities, &out.Capabilities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderStatus.
@@ -1287,6 +1498,21 @@ func (in *ProviderStatus) DeepCopy() *ProviderStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Providers) DeepCopyInto(out *Providers) {
 	*out = *in
+	if in.Failover != nil {
+		in, out := &in.Failover, &out.Failover
+		*out = new(ProvidersFailover)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WaitTimeout != nil {
+		in, out := &in.WaitTimeout, &out.WaitTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.LeaseDuration != nil {
+		in, out := &in.LeaseDuration, &out.LeaseDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Providers.
@@ -1299,6 +1525,36 @@ func (in *Providers) DeepCopy() *Providers {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProvidersFailover) DeepCopyInto(out *ProvidersFailover) {
+	*out = *in
+	if in.IUT != nil {
+		in, out := &in.IUT, &out.IUT
+		*out = new(ProviderFailover)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LogArea != nil {
+		in, out := &in.LogArea, &out.LogArea
+		*out = new(ProviderFailover)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExecutionSpace != nil {
+		in, out := &in.ExecutionSpace, &out.ExecutionSpace
+		*out = new(ProviderFailover)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProvidersFailover.
+func (in *ProvidersFailover) DeepCopy() *ProvidersFailover {
+	if in == nil {
+		return nil
+	}
+	out := new(ProvidersFailover)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RabbitMQ) DeepCopyInto(out *RabbitMQ) {
 	*out = *in
@@ -1319,6 +1575,21 @@ func (in *RabbitMQ) DeepCopy() *RabbitMQ {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReleasePolicy) DeepCopyInto(out *ReleasePolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReleasePolicy.
+func (in *ReleasePolicy) DeepCopy() *ReleasePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ReleasePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Retention) DeepCopyInto(out *Retention) {
 	*out = *in
@@ -1564,7 +1835,7 @@ func (in *TestRunSpec) DeepCopyInto(out *TestRunSpec) {
 		*out = new(EnvironmentProvider)
 		(*in).DeepCopyInto(*out)
 	}
-	out.Providers = in.Providers
+	in.Providers.DeepCopyInto(&out.Providers)
 	if in.Suites != nil {
 		in, out := &in.Suites, &out.Suites
 		*out = make([]Suite, len(*in))
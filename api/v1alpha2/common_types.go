@@ -0,0 +1,50 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ForceFinalizeAnnotation is the annotation that an administrator sets to "true" on a resource that is
+// being deleted to remove it without waiting for it to be released.
+const ForceFinalizeAnnotation = "etos.eiffel-community.github.io/force-finalize"
+
+// LeaseRenewTimeAnnotation is the annotation that the user of a resource sets to renew the lease
+// of the resource. The value is the time of the renewal, in RFC 3339 format.
+const LeaseRenewTimeAnnotation = "etos.eiffel-community.github.io/lease-renew-time"
+
+// Lease is a reservation of a resource which is kept for as long as the user of the resource
+// renews it. A resource is released when its lease lapses.
+type Lease struct {
+	// DurationSeconds is how long the lease lasts after the resource was created or the lease
+	// was last renewed.
+	// +kubebuilder:validation:Minimum=1
+	// +required
+	DurationSeconds int64 `json:"durationSeconds"`
+}
+
+// ReleaseStatus is the status of the release of a resource.
+type ReleaseStatus struct {
+	// Attempts is the number of failed attempts to release the resource.
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+
+	// RetryTime is the earliest time that the failed release is retried.
+	// +optional
+	RetryTime *metav1.Time `json:"retryTime,omitempty"`
+}
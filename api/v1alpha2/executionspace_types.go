@@ -32,6 +32,11 @@ type ExecutionSpaceSpec struct {
 	// +optional
 	Deadline int64 `json:"deadline"`
 
+	// Lease is the reservation of the ExecutionSpace, which has to be renewed while the ExecutionSpace is in use.
+	// The ExecutionSpace is released when the lease lapses.
+	// +optional
+	Lease *Lease `json:"lease,omitempty"`
+
 	// TestRunner describes the test runner that is launched in this execution space.
 	// +required
 	TestRunner string `json:"test_runner"`
@@ -94,6 +99,14 @@ type ExecutionSpaceStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 
 	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// RenewTime is the time that the lease of the ExecutionSpace was last renewed.
+	// +optional
+	RenewTime *metav1.Time `json:"renewTime,omitempty"`
+
+	// Release is the status of the release of the ExecutionSpace.
+	// +optional
+	Release *ReleaseStatus `json:"release,omitempty"`
 }
 
 // +kubebuilder:object:root=true
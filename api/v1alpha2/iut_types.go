@@ -33,6 +33,11 @@ type IutSpec struct {
 	// +optional
 	Deadline int64 `json:"deadline"`
 
+	// Lease is the reservation of the IUT, which has to be renewed while the IUT is in use.
+	// The IUT is released when the lease lapses.
+	// +optional
+	Lease *Lease `json:"lease,omitempty"`
+
 	// Identity is the PackageURL definition of the IUT.
 	// +required
 	Identity string `json:"identity"`
@@ -70,6 +75,14 @@ type IutStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 
 	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// RenewTime is the time that the lease of the IUT was last renewed.
+	// +optional
+	RenewTime *metav1.Time `json:"renewTime,omitempty"`
+
+	// Release is the status of the release of the IUT.
+	// +optional
+	Release *ReleaseStatus `json:"release,omitempty"`
 }
 
 // +kubebuilder:object:root=true
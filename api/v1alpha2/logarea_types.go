@@ -32,6 +32,11 @@ type LogAreaSpec struct {
 	// +optional
 	Deadline int64 `json:"deadline"`
 
+	// Lease is the reservation of the LogArea, which has to be renewed while the LogArea is in use.
+	// The LogArea is released when the lease lapses.
+	// +optional
+	Lease *Lease `json:"lease,omitempty"`
+
 	// EnvironmentRequest is the ID of the environmentrequest which requested this log area.
 	// +required
 	EnvironmentRequest string `json:"environmentRequest"`
@@ -128,6 +133,14 @@ type LogAreaStatus struct {
 
 	// CompletionTime defines the time that a LogArea was completed.
 	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// RenewTime is the time that the lease of the LogArea was last renewed.
+	// +optional
+	RenewTime *metav1.Time `json:"renewTime,omitempty"`
+
+	// Release is the status of the release of the LogArea.
+	// +optional
+	Release *ReleaseStatus `json:"release,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,190 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/pkg/logarea"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/fernet/fernet-go"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const clusterLabel = "etos.eiffel-community.github.io/cluster"
+
+type clusterLogAreaProvider struct{}
+
+// clusterConfig is the optional configuration of the cluster log area provider, read from the
+// custom field of the LogAreaProviderConfig in the Provider resource.
+type clusterConfig struct {
+	// Cluster is the name of the Cluster whose log area service to use. Defaults to the cluster
+	// of the EnvironmentRequest.
+	Cluster string `json:"cluster,omitempty"`
+	// Scheme is the scheme of the ingress of the Cluster, used for the live logs URL. Defaults to http.
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// main creates LogAreas that upload logs to the ETOS log area service of a Cluster.
+func main() {
+	provider.RunLogAreaProvider(&clusterLogAreaProvider{})
+}
+
+// Provision provisions new LogAreas, each with its own path in the log area service.
+func (p *clusterLogAreaProvider) Provision(
+	ctx context.Context, cfg provider.ProvisionConfig,
+) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	environmentRequest := cfg.EnvironmentRequest
+	if cfg.MinimumAmount <= 0 {
+		return errors.New("minimum amount of LogAreas requested is less than or equal to 0")
+	}
+	logger.Info("Provisioning a new cluster LogArea for EnvironmentRequest",
+		"EnvironmentRequest", environmentRequest.Name,
+		"Namespace", environmentRequest.Namespace,
+		"Amount", cfg.MinimumAmount,
+	)
+	logAreaProvider, err := provider.GetProvider(ctx, environmentRequest.Spec.Providers.LogArea.ID, cfg.Namespace)
+	if err != nil {
+		return err
+	}
+	clusterCfg := clusterConfig{Scheme: "http"}
+	providerConfig := logAreaProvider.Spec.LogAreaProviderConfig
+	if providerConfig != nil && len(providerConfig.Custom.Raw) > 0 {
+		if err := json.Unmarshal(providerConfig.Custom.Raw, &clusterCfg); err != nil {
+			return err
+		}
+	}
+	cluster, err := p.cluster(ctx, environmentRequest, clusterCfg.Cluster)
+	if err != nil {
+		return err
+	}
+	logger.Info("Using the log area service of cluster", "cluster", cluster.Name)
+	key, err := p.clusterKey(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	// The internal URL is used by test runners in the cluster, while the live logs shall be reachable
+	// by users, i.e. through the ingress of the cluster if there is one.
+	internalURL := fmt.Sprintf("http://%s-etos-logarea.%s%s", cluster.Name, cluster.Namespace, logarea.BasePath)
+	externalURL := internalURL
+	if ingress := cluster.Spec.ETOS.Ingress; ingress.Enabled && ingress.Host != "" {
+		externalURL = fmt.Sprintf("%s://%s%s", clusterCfg.Scheme, ingress.Host, logarea.BasePath)
+	}
+
+	for range cfg.MinimumAmount {
+		id := uuid.NewString()
+		logAreaPath := path.Join(environmentRequest.Spec.Identifier, id)
+		logger.Info("Creating a cluster LogArea", "id", id, "path", logAreaPath)
+		// The token only allows uploads under the path of the LogArea, and is verified by the log
+		// area service with the encryption key of the cluster.
+		token, err := logarea.NewToken(key, logAreaPath)
+		if err != nil {
+			return err
+		}
+		password, err := provider.Encrypt(ctx, environmentRequest, []byte(token))
+		if err != nil {
+			return err
+		}
+		if _, err := provider.CreateLogArea(ctx, environmentRequest, cfg.Namespace, "", v1alpha2.LogAreaSpec{
+			ID:       id,
+			LiveLogs: fmt.Sprintf("%s/logarea/%s/", externalURL, logAreaPath),
+			Logs:     map[string]string{},
+			Upload: v1alpha2.Upload{
+				URL:    fmt.Sprintf("%s/upload/%s/{name}", internalURL, logAreaPath),
+				Method: "PUT",
+				Auth: &v1alpha2.Auth{
+					Username: id,
+					Password: v1alpha2.Decrypt{Decrypt: v1alpha2.DecryptValue{Value: password}},
+					AuthType: "basic",
+				},
+			},
+		}); err != nil {
+			return err
+		}
+		logger.Info("LogArea created")
+	}
+	return nil
+}
+
+// cluster gets the Cluster to use, either by name or from the cluster label of the EnvironmentRequest.
+// If neither is set and there is exactly one Cluster in the namespace, that Cluster is used.
+func (p *clusterLogAreaProvider) cluster(
+	ctx context.Context, environmentRequest *v1alpha1.EnvironmentRequest, name string,
+) (*v1alpha1.Cluster, error) {
+	cli, err := provider.KubernetesClientFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = environmentRequest.Labels[clusterLabel]
+	}
+	if name != "" {
+		var cluster v1alpha1.Cluster
+		namespacedName := types.NamespacedName{Name: name, Namespace: environmentRequest.Namespace}
+		if err := cli.Get(ctx, namespacedName, &cluster); err != nil {
+			return nil, err
+		}
+		return &cluster, nil
+	}
+	var clusters v1alpha1.ClusterList
+	if err := cli.List(ctx, &clusters, client.InNamespace(environmentRequest.Namespace)); err != nil {
+		return nil, err
+	}
+	if len(clusters.Items) != 1 {
+		return nil, fmt.Errorf(
+			"found %d clusters in namespace %s and the EnvironmentRequest has no cluster label",
+			len(clusters.Items), environmentRequest.Namespace,
+		)
+	}
+	return &clusters.Items[0], nil
+}
+
+// clusterKey gets the encryption key of a Cluster, which is also used by its log area service.
+func (p *clusterLogAreaProvider) clusterKey(ctx context.Context, cluster *v1alpha1.Cluster) (*fernet.Key, error) {
+	cli, err := provider.KubernetesClientFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := provider.GetSecret(ctx, cli, &cluster.Spec.ETOS.Config.EncryptionKey, cluster.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return fernet.DecodeKey(string(key))
+}
+
+// Release releases a LogArea. The logs are kept in the log area service.
+func (p *clusterLogAreaProvider) Release(ctx context.Context, cfg provider.ReleaseConfig) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info("Releasing LogArea", "Name", cfg.Name, "Namespace", cfg.Namespace)
+	logArea, err := provider.GetLogArea(ctx, cfg.Name, cfg.Namespace)
+	if err != nil {
+		return err
+	}
+	if cfg.NoDelete {
+		return nil
+	}
+	return provider.DeleteLogArea(ctx, logArea)
+}
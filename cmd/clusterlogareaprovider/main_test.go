@@ -0,0 +1,138 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/fernet/fernet-go"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/pkg/logarea"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+var _ = Describe("Cluster log area provider", func() {
+	const namespace = "etos"
+	var (
+		clusterKey  *fernet.Key
+		testrunKey  *fernet.Key
+		cluster     *v1alpha1.Cluster
+		environment *v1alpha1.EnvironmentRequest
+		server      *httptest.Server
+	)
+
+	BeforeEach(func() {
+		clusterKey = &fernet.Key{}
+		Expect(clusterKey.Generate()).To(Succeed())
+		testrunKey = &fernet.Key{}
+		Expect(testrunKey.Generate()).To(Succeed())
+		cluster = &v1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: namespace}}
+		cluster.Spec.ETOS.Config.EncryptionKey = v1alpha1.Var{Value: clusterKey.Encode()}
+		environment = providertest.NewEnvironmentRequest("environment-request", namespace).
+			WithLogAreaProvider("cluster").
+			WithEncryptionKey(v1alpha1.Var{Value: testrunKey.Encode()}).
+			Build()
+		environment.Labels = map[string]string{clusterLabel: cluster.Name}
+		// The log area service of the cluster, which verifies the tokens with the key of the cluster.
+		server = httptest.NewServer(logarea.NewServer(
+			logarea.NewDirectoryStorage(GinkgoT().TempDir()), clusterKey, 0, logr.Discard(),
+		))
+		DeferCleanup(server.Close)
+	})
+
+	// provision provisions a LogArea using the cluster log area provider.
+	provision := func(ctx context.Context) v1alpha2.LogArea {
+		logAreaProvider := providertest.NewProvider("cluster", namespace, "log-area").Build()
+		// The amount of LogAreas to provision is the amount of IUTs of the EnvironmentRequest.
+		iut := &v1alpha2.Iut{ObjectMeta: metav1.ObjectMeta{
+			Name:      "iut",
+			Namespace: namespace,
+			Labels:    map[string]string{"etos.eiffel-community.github.io/environment-request-id": environment.Spec.ID},
+		}}
+		cli := providertest.NewFakeClient(environment, logAreaProvider, cluster, iut)
+		runner := providertest.Runner{Client: cli, ProviderType: provider.ProviderTypeLogArea}
+		_, err := runner.Provision(ctx, &clusterLogAreaProvider{}, environment)
+		Expect(err).NotTo(HaveOccurred())
+		var logAreas v1alpha2.LogAreaList
+		Expect(cli.List(ctx, &logAreas, client.InNamespace(namespace))).To(Succeed())
+		Expect(logAreas.Items).To(HaveLen(1))
+		return logAreas.Items[0]
+	}
+
+	// toServer rewrites a URL of the log area service of the cluster to the test server.
+	toServer := func(url, serviceURL string) string {
+		Expect(url).To(HavePrefix(serviceURL))
+		return server.URL + strings.TrimPrefix(url, serviceURL)
+	}
+
+	It("should upload logs to the log area service of the cluster", func(ctx context.Context) {
+		logArea := provision(ctx)
+		serviceURL := "http://cluster-etos-logarea.etos"
+		Expect(logArea.Spec.Upload.URL).To(HavePrefix(serviceURL + "/logarea/v1alpha/upload/"))
+		Expect(logArea.Spec.Upload.URL).To(HaveSuffix("/{name}"))
+
+		By("uploading a log the way the ETR does")
+		token := fernet.VerifyAndDecrypt(
+			[]byte(logArea.Spec.Upload.Auth.Password.Decrypt.Value), 0, []*fernet.Key{testrunKey},
+		)
+		Expect(token).NotTo(BeNil())
+		uploadURL := toServer(strings.ReplaceAll(logArea.Spec.Upload.URL, "{name}", "test.log"), serviceURL)
+		request, err := http.NewRequest(logArea.Spec.Upload.Method, uploadURL, strings.NewReader("hello"))
+		Expect(err).NotTo(HaveOccurred())
+		request.SetBasicAuth(logArea.Spec.Upload.Auth.Username, string(token))
+		response, err := http.DefaultClient.Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(response.StatusCode).To(Equal(http.StatusCreated))
+
+		By("browsing the live logs")
+		response, err = http.Get(toServer(logArea.Spec.LiveLogs, serviceURL))
+		Expect(err).NotTo(HaveOccurred())
+		page, err := io.ReadAll(response.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(string(page)).To(ContainSubstring("test.log"))
+	})
+
+	It("should not allow uploads to the path of another LogArea", func(ctx context.Context) {
+		logArea := provision(ctx)
+		token := fernet.VerifyAndDecrypt(
+			[]byte(logArea.Spec.Upload.Auth.Password.Decrypt.Value), 0, []*fernet.Key{testrunKey},
+		)
+		Expect(logarea.VerifyToken(clusterKey, string(token), 0, "other/logarea/test.log")).
+			To(MatchError(logarea.ErrInvalidToken))
+	})
+
+	It("should point the live logs to the ingress of the cluster", func(ctx context.Context) {
+		cluster.Spec.ETOS.Ingress = v1alpha1.Ingress{Enabled: true, Host: "etos.example.com"}
+		logArea := provision(ctx)
+		Expect(logArea.Spec.LiveLogs).To(HavePrefix("http://etos.example.com/logarea/v1alpha/logarea/"))
+		Expect(logArea.Spec.Upload.URL).To(HavePrefix("http://cluster-etos-logarea.etos/logarea/v1alpha/upload/"))
+	})
+})
@@ -25,15 +25,23 @@ import (
 	"github.com/eiffel-community/etos/api/v1alpha1"
 	"github.com/eiffel-community/etos/api/v1alpha2"
 	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/pkg/events"
+	"github.com/eiffel-community/etos/pkg/opentelemetry/semconv"
 	providerHelper "github.com/eiffel-community/etos/pkg/provider"
 	"github.com/eiffel-community/etos/pkg/splitter"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
+// tracerName is the name of the OpenTelemetry tracer used for the spans of the EnvironmentProvider.
+const tracerName = "github.com/eiffel-community/etos/cmd/environmentprovider"
+
 type environmentProvider struct {
 	environmentRequestName string
 	namespace              string
@@ -54,10 +62,20 @@ func main() {
 	flag.StringVar(&provider.name, "name", "", "The name of the resource to release.")
 	flag.StringVar(&provider.namespace, "namespace", "", "The namespace of the environment request.")
 	opts.BindFlags(flag.CommandLine)
+	providerHelper.BindTelemetryFlags(flag.CommandLine)
 	flag.Parse()
-	logger := zap.New(zap.UseFlagOptions(&opts))
 
-	ctx := logr.NewContext(context.Background(), logger)
+	ctx := context.Background()
+	var environmentRequest *v1alpha1.EnvironmentRequest
+	if provider.environmentRequestName != "" && provider.namespace != "" {
+		// Errors are returned by runProvider, which gets the EnvironmentRequest again.
+		environmentRequest, _ = providerHelper.EnvironmentRequest(
+			ctx, provider.environmentRequestName, provider.namespace,
+		)
+	}
+	ctx, telemetry := providerHelper.StartTelemetry(ctx, opts, "Environment", environmentRequest)
+	defer telemetry.Shutdown(ctx)
+	logger := logr.FromContextOrDiscard(ctx)
 
 	if provider.releaseEnvironment {
 		if err := runReleaser(provider); err != nil {
@@ -81,7 +99,7 @@ func main() {
 			panic(err)
 		}
 	} else {
-		if err := runProvider(ctx, provider); err != nil {
+		if err := provision(ctx, provider); err != nil {
 			if writeErr := providerHelper.WriteResult(logger,
 				jobs.Result{
 					Conclusion:  jobs.ConclusionFailed,
@@ -109,6 +127,21 @@ func runReleaser(_ environmentProvider) error {
 	return nil
 }
 
+// provision runs the EnvironmentProvider in a span.
+func provision(ctx context.Context, provider environmentProvider) error {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "provision Environment", trace.WithAttributes(
+		semconv.ETOSProviderEnvironmentRequest(provider.environmentRequestName),
+		semconv.ETOSProviderNamespace(provider.namespace),
+	))
+	defer span.End()
+	err := runProvider(ctx, provider)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
 // runProvider is the base provider for the EnvironmentProvider.
 func runProvider(ctx context.Context, provider environmentProvider) error {
 	logger := logr.FromContextOrDiscard(ctx)
@@ -119,7 +152,7 @@ func runProvider(ctx context.Context, provider environmentProvider) error {
 		return errors.New("must set -namespace")
 	}
 
-	cli, err := providerHelper.KubernetesClient()
+	cli, err := providerHelper.KubernetesClientFromContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -218,7 +251,7 @@ func CreateEnvironment(
 	executionSpace v1alpha2.ExecutionSpace,
 	logArea v1alpha2.LogArea,
 ) error {
-	cli, err := providerHelper.KubernetesClient()
+	cli, err := providerHelper.KubernetesClientFromContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -254,7 +287,7 @@ func CreateEnvironment(
 	isController := false
 	blockOwnerDeletion := true
 	// TODO: No Eiffel events are being sent.
-	return cli.Create(ctx, &v1alpha1.Environment{
+	environment := &v1alpha1.Environment{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels:    labels,
 			Name:      executionSpace.Spec.ID,
@@ -288,5 +321,19 @@ func CreateEnvironment(
 			Iut:         &apiextensionsv1.JSON{Raw: iutJson},
 			Tests:       tests,
 		},
+	}
+	if err := cli.Create(ctx, environment); err != nil {
+		return err
+	}
+	providerHelper.PublishEvent(ctx, events.EnvironmentCreated{
+		EnvironmentRequest: environmentrequest.Name,
+		Environment:        environment.Name,
+		SubSuiteID:         environment.Spec.SubSuiteID,
+		Name:               environment.Spec.Name,
+		IUT:                iut.Name,
+		LogArea:            logArea.Name,
+		ExecutionSpace:     executionSpace.Name,
+		Tests:              len(tests),
 	})
+	return nil
 }
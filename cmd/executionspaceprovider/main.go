@@ -17,22 +17,19 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"maps"
 
 	"github.com/eiffel-community/etos/api/v1alpha1"
 	"github.com/eiffel-community/etos/api/v1alpha2"
 	"github.com/eiffel-community/etos/pkg/provider"
-	"github.com/fernet/fernet-go"
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
@@ -43,90 +40,36 @@ func main() {
 	provider.RunExecutionSpaceProvider(&genericExecutionSpaceProvider{})
 }
 
-type dataset struct {
-	Dev       bool   `json:"dev,omitempty"`
-	ETRRepo   string `json:"ETR_REPO,omitempty"`
-	ETRBranch string `json:"ETR_BRANCH,omitempty"`
-}
-
 // Provision provisions a new ExecutionSpace.
 func (p *genericExecutionSpaceProvider) Provision(
 	ctx context.Context, cfg provider.ProvisionConfig,
 ) error {
 
 	logger := logr.FromContextOrDiscard(ctx)
-	cli, err := provider.KubernetesClient()
-	if err != nil {
-		return err
-	}
 	environmentRequest := cfg.EnvironmentRequest
 	if cfg.MinimumAmount <= 0 {
 		return errors.New("minimum amount of ExecutionSpaces requested is less than or equal to 0")
 	}
-	key, err := environmentRequest.Spec.Config.EncryptionKey.Get(ctx, cli, environmentRequest.Namespace)
-	if err != nil {
-		return err
-	}
-	encryptionKey, err := fernet.DecodeKey(string(key))
-	if err != nil {
-		return err
-	}
-	hostname, err := os.Hostname()
-	if err != nil {
-		return err
-	}
 	logger.Info("Provisioning a new ExecutionSpace for EnvironmentRequest",
 		"EnvironmentRequest", environmentRequest.Name,
 		"Namespace", environmentRequest.Namespace,
 		"Amount", cfg.MinimumAmount,
 	)
-	etosMessagebusPassword, err := getAndEncrypt(ctx,
-		cli, environmentRequest.Spec.Config.EtosMessageBus.Password,
-		environmentRequest.Namespace, encryptionKey,
-	)
+	environment, err := provider.TestRunnerEnvironment(ctx, environmentRequest)
 	if err != nil {
 		return err
 	}
-	eiffelMessagebusPassword, err := getAndEncrypt(ctx,
-		cli, environmentRequest.Spec.Config.EiffelMessageBus.Password,
-		environmentRequest.Namespace, encryptionKey,
+	executionSpaceProvider, err := provider.GetProvider(
+		ctx, environmentRequest.Spec.Providers.ExecutionSpace.ID, cfg.Namespace,
 	)
 	if err != nil {
 		return err
 	}
-	environment := map[string]string{
-		"SOURCE_HOST":            hostname,
-		"ETOS_API":               environmentRequest.Spec.Config.EtosApi,
-		"ETR_VERSION":            environmentRequest.Spec.Providers.ExecutionSpace.TestRunner,
-		"ETOS_GRAPHQL_SERVER":    environmentRequest.Spec.Config.GraphQlServer,
-		"ETOS_RABBITMQ_EXCHANGE": environmentRequest.Spec.Config.EtosMessageBus.Exchange,
-		"ETOS_RABBITMQ_HOST":     environmentRequest.Spec.Config.EtosMessageBus.Host,
-		"ETOS_RABBITMQ_PASSWORD": string(etosMessagebusPassword),
-		"ETOS_RABBITMQ_PORT":     environmentRequest.Spec.Config.EtosMessageBus.Port,
-		"ETOS_RABBITMQ_USERNAME": environmentRequest.Spec.Config.EtosMessageBus.Username,
-		"ETOS_RABBITMQ_VHOST":    environmentRequest.Spec.Config.EtosMessageBus.Vhost,
-		"ETOS_RABBITMQ_SSL":      environmentRequest.Spec.Config.EtosMessageBus.SSL,
-		"RABBITMQ_EXCHANGE":      environmentRequest.Spec.Config.EiffelMessageBus.Exchange,
-		"RABBITMQ_HOST":          environmentRequest.Spec.Config.EiffelMessageBus.Host,
-		"RABBITMQ_PASSWORD":      string(eiffelMessagebusPassword),
-		"RABBITMQ_PORT":          environmentRequest.Spec.Config.EiffelMessageBus.Port,
-		"RABBITMQ_USERNAME":      environmentRequest.Spec.Config.EiffelMessageBus.Username,
-		"RABBITMQ_VHOST":         environmentRequest.Spec.Config.EiffelMessageBus.Vhost,
-		"RABBITMQ_SSL":           environmentRequest.Spec.Config.EiffelMessageBus.SSL,
-	}
-	ds := dataset{}
-	if err := json.Unmarshal(environmentRequest.Spec.Dataset.Raw, &ds); err != nil {
+	devEnvironment, err := provider.TestRunnerDevEnvironment(executionSpaceProvider, environmentRequest)
+	if err != nil {
 		return err
 	}
-	if ds.Dev {
-		environment["DEV"] = "true"
-	}
-	if ds.ETRBranch != "" {
-		environment["ETR_BRANCH"] = ds.ETRBranch
-	}
-	if ds.ETRRepo != "" {
-		environment["ETR_REPOSITORY"] = ds.ETRRepo
-	}
+	maps.Copy(environment, devEnvironment)
 
 	for range cfg.MinimumAmount {
 		id := uuid.NewString()
@@ -163,7 +106,7 @@ func (p *genericExecutionSpaceProvider) Provision(
 func (p *genericExecutionSpaceProvider) start(
 	ctx context.Context, environmentrequest *v1alpha1.EnvironmentRequest, executionSpace *v1alpha2.ExecutionSpace,
 ) error {
-	cli, err := provider.KubernetesClient()
+	cli, err := provider.KubernetesClientFromContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -273,22 +216,3 @@ func (p *genericExecutionSpaceProvider) Release(
 	}
 	return provider.DeleteExecutionSpace(ctx, executionSpace)
 }
-
-// encrypt encrypts a string using the provided Fernet key.
-func encrypt(s []byte, key *fernet.Key) ([]byte, error) {
-	return fernet.EncryptAndSign(s, key)
-}
-
-// getAndEncrypt gets a value from a Var struct and encrypts it using the provided Fernet key.
-func getAndEncrypt(
-	ctx context.Context, cli client.Client, s *v1alpha1.Var, namespace string, key *fernet.Key,
-) ([]byte, error) {
-	if s == nil {
-		return nil, errors.New("no value provided")
-	}
-	value, err := s.Get(ctx, cli, namespace)
-	if err != nil {
-		return nil, err
-	}
-	return encrypt(value, key)
-}
@@ -0,0 +1,156 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/eiffel-community/etos/pkg/logarea"
+	"github.com/fernet/fernet-go"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// main serves the ETOS log area API, storing files in a directory or, if LOGAREA_S3_ENDPOINT is
+// set, in a bucket of an S3-compatible object storage.
+//
+// Upload tokens are verified with the ETOS_ENCRYPTION_KEY of the Cluster and expire after
+// -token-ttl, or LOGAREA_TOKEN_TTL, which must be longer than the longest testrun.
+//
+// Downloads are not authenticated. Logs are browsed through the live logs URLs that ETOS sends to
+// users, so anyone that can reach the server can read the logs; restrict access to it in front of
+// the server, in an ingress for example, if the logs must not be public.
+func main() {
+	var address, storagePath string
+	var tokenTTL time.Duration
+	defaultTokenTTL, err := time.ParseDuration(envOrDefault("LOGAREA_TOKEN_TTL", "24h"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LOGAREA_TOKEN_TTL is not a valid duration: %v\n", err)
+		os.Exit(1)
+	}
+	flag.StringVar(&address, "address", os.Getenv("SERVICE_HOST")+":8080", "The address to serve the log area API on.")
+	flag.StringVar(&storagePath, "storage-path", envOrDefault("LOGAREA_STORAGE_PATH", "/data"),
+		"The directory to store files in, unless an object storage is configured.")
+	flag.DurationVar(&tokenTTL, "token-ttl", defaultTokenTTL,
+		"How long upload tokens are valid after they are created. Set explicitly to 0 for tokens that never expire.")
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+	logger := zap.New(zap.UseFlagOptions(&opts))
+
+	if err := validateTokenTTL(tokenTTL, isFlagSet("token-ttl")); err != nil {
+		logger.Error(err, "invalid token TTL")
+		os.Exit(1)
+	}
+	if tokenTTL == 0 {
+		logger.Info("Upload tokens never expire, since the token TTL is set to 0")
+	}
+
+	key, err := fernet.DecodeKey(os.Getenv("ETOS_ENCRYPTION_KEY"))
+	if err != nil {
+		logger.Error(err, "ETOS_ENCRYPTION_KEY is not a valid encryption key")
+		os.Exit(1)
+	}
+	storage, err := newStorage(storagePath)
+	if err != nil {
+		logger.Error(err, "failed to create the storage of the log area")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{
+		Addr:              address,
+		Handler:           logarea.NewServer(storage, key, tokenTTL, logger),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error(err, "failed to shut down the log area API")
+		}
+	}()
+	logger.Info("Serving the log area API", "address", address)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		logger.Error(err, "failed to serve the log area API")
+		os.Exit(1)
+	}
+}
+
+// newStorage creates the storage of the log area from the environment.
+func newStorage(storagePath string) (logarea.Storage, error) {
+	endpoint := os.Getenv("LOGAREA_S3_ENDPOINT")
+	if endpoint == "" {
+		return logarea.NewDirectoryStorage(storagePath), nil
+	}
+	bucket := os.Getenv("LOGAREA_S3_BUCKET")
+	if bucket == "" {
+		return nil, errors.New("LOGAREA_S3_BUCKET is required when LOGAREA_S3_ENDPOINT is set")
+	}
+	insecure, _ := strconv.ParseBool(os.Getenv("LOGAREA_S3_INSECURE"))
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(os.Getenv("LOGAREA_S3_ACCESS_KEY"), os.Getenv("LOGAREA_S3_SECRET_KEY"), ""),
+		Secure: !insecure,
+		Region: os.Getenv("LOGAREA_S3_REGION"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return logarea.NewS3Storage(client, bucket), nil
+}
+
+// validateTokenTTL validates the time that upload tokens are valid. A TTL of 0 means that tokens
+// never expire, which is only allowed when it is set explicitly on the command line.
+func validateTokenTTL(ttl time.Duration, explicit bool) error {
+	if ttl < 0 {
+		return fmt.Errorf("token TTL %s must not be negative", ttl)
+	}
+	if ttl == 0 && !explicit {
+		return errors.New("a token TTL of 0 makes upload tokens never expire, set -token-ttl=0 explicitly to allow it")
+	}
+	return nil
+}
+
+// isFlagSet checks if a flag was set on the command line.
+func isFlagSet(name string) bool {
+	var set bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// envOrDefault gets an environment variable, or a default value if it is not set.
+func envOrDefault(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,38 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Token TTL", func() {
+	It("should accept a bounded TTL", func() {
+		Expect(validateTokenTTL(24*time.Hour, false)).To(Succeed())
+	})
+
+	It("should only accept tokens that never expire when the TTL is set explicitly", func() {
+		Expect(validateTokenTTL(0, false)).To(MatchError(ContainSubstring("explicitly")))
+		Expect(validateTokenTTL(0, true)).To(Succeed())
+	})
+
+	It("should not accept a negative TTL", func() {
+		Expect(validateTokenTTL(-time.Second, true)).To(MatchError(ContainSubstring("negative")))
+	})
+})
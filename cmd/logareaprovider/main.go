@@ -53,6 +53,9 @@ func (p *genericLogAreaProvider) Provision(
 	if logAreaProvider.Spec.LogAreaProviderConfig == nil {
 		return fmt.Errorf("%s has no LogAreaProviderConfig", logAreaProvider.Name)
 	}
+	if logAreaProvider.Spec.LogAreaProviderConfig.Upload.URL == "" {
+		return fmt.Errorf("%s has no upload URL in its LogAreaProviderConfig", logAreaProvider.Name)
+	}
 	for range cfg.MinimumAmount {
 		logger.Info("Creating a generic LogArea")
 		if _, err := provider.CreateLogArea(ctx, environmentRequest, cfg.Namespace, "", v1alpha2.LogAreaSpec{
@@ -17,6 +17,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
@@ -26,6 +27,7 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/utils/clock"
 
+	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -38,10 +40,13 @@ import (
 
 	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
 	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/audit"
 	"github.com/eiffel-community/etos/internal/config"
 	"github.com/eiffel-community/etos/internal/controller"
 	webhookv1alpha1 "github.com/eiffel-community/etos/internal/webhook/v1alpha1"
 	webhookv1alpha2 "github.com/eiffel-community/etos/internal/webhook/v1alpha2"
+	"github.com/eiffel-community/etos/pkg/logging"
+	"github.com/eiffel-community/etos/pkg/opentelemetry"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -67,6 +72,7 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var auditNamespace string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -85,14 +91,25 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&auditNamespace, "audit-namespace", "",
+		"The namespace to store the audit trail in. Defaults to the namespace of the audited resources.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	// Secrets are redacted from the logs of the controller.
+	opts = logging.Redacted(opts)
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	// Reconciles are traced when an OpenTelemetry collector is set in OTEL_EXPORTER_OTLP_ENDPOINT.
+	tracer := opentelemetry.New("etos-controller-manager", "etos")
+	if err := tracer.Start(logr.NewContext(context.Background(), setupLog)); err != nil {
+		setupLog.Error(err, "Failed to start OpenTelemetry tracer")
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -223,8 +240,9 @@ func main() {
 		os.Exit(1)
 	}
 	if err := (&controller.EnvironmentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorder("environment"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "Failed to create controller", "controller", "Environment")
 		os.Exit(1)
@@ -244,16 +262,21 @@ func main() {
 		setupLog.Error(err, "Failed to create controller", "controller", "EnvironmentRequest")
 		os.Exit(1)
 	}
+	// The audit trail is read without the cache of the manager, since records are appended to it with
+	// optimistic concurrency.
+	auditStore := audit.NewConfigMapStore(mgr.GetAPIReader(), mgr.GetClient())
+	auditStore.Namespace = auditNamespace
+	auditRecorder := audit.NewRecorder(auditStore)
 	// nolint:goconst
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err := webhookv1alpha1.SetupTestRunWebhookWithManager(mgr, cfg); err != nil {
+		if err := webhookv1alpha1.SetupTestRunWebhookWithManager(mgr, cfg, auditRecorder); err != nil {
 			setupLog.Error(err, "Failed to create webhook", "webhook", "TestRun")
 			os.Exit(1)
 		}
 	}
 	// nolint:goconst
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err := webhookv1alpha1.SetupProviderWebhookWithManager(mgr); err != nil {
+		if err := webhookv1alpha1.SetupProviderWebhookWithManager(mgr, auditRecorder); err != nil {
 			setupLog.Error(err, "Failed to create webhook", "webhook", "Provider")
 			os.Exit(1)
 		}
@@ -265,44 +288,54 @@ func main() {
 			os.Exit(1)
 		}
 	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := webhookv1alpha1.SetupEnvironmentWebhookWithManager(mgr, auditRecorder); err != nil {
+			setupLog.Error(err, "Failed to create webhook", "webhook", "Environment")
+			os.Exit(1)
+		}
+	}
 	if err := (&controller.IutReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorder("iut"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Iut")
 		os.Exit(1)
 	}
 	// nolint:goconst
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err := webhookv1alpha2.SetupIutWebhookWithManager(mgr); err != nil {
+		if err := webhookv1alpha2.SetupIutWebhookWithManager(mgr, auditRecorder); err != nil {
 			setupLog.Error(err, "Failed to create webhook", "webhook", "Iut")
 			os.Exit(1)
 		}
 	}
 	if err := (&controller.ExecutionSpaceReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorder("executionspace"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ExecutionSpace")
 		os.Exit(1)
 	}
 	// nolint:goconst
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err := webhookv1alpha2.SetupExecutionSpaceWebhookWithManager(mgr); err != nil {
+		if err := webhookv1alpha2.SetupExecutionSpaceWebhookWithManager(mgr, auditRecorder); err != nil {
 			setupLog.Error(err, "Failed to create webhook", "webhook", "ExecutionSpace")
 			os.Exit(1)
 		}
 	}
 	if err := (&controller.LogAreaReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorder("logarea"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LogArea")
 		os.Exit(1)
 	}
 	// nolint:goconst
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err := webhookv1alpha2.SetupLogAreaWebhookWithManager(mgr); err != nil {
+		if err := webhookv1alpha2.SetupLogAreaWebhookWithManager(mgr, auditRecorder); err != nil {
 			setupLog.Error(err, "Failed to create webhook", "webhook", "LogArea")
 			os.Exit(1)
 		}
@@ -319,8 +352,12 @@ func main() {
 	}
 
 	setupLog.Info("Starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
-		setupLog.Error(err, "Failed to run manager")
+	managerErr := mgr.Start(ctrl.SetupSignalHandler())
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		setupLog.Error(err, "Failed to shut down OpenTelemetry tracer")
+	}
+	if managerErr != nil {
+		setupLog.Error(managerErr, "Failed to run manager")
 		os.Exit(1)
 	}
 }
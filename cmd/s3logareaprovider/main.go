@@ -0,0 +1,190 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path"
+
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/pkg/logarea"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const prefixAnnotation = "etos.eiffel-community.github.io/s3-prefix"
+
+type s3LogAreaProvider struct{}
+
+// main creates LogAreas in an S3-compatible object storage based on data in an EnvironmentRequest.
+func main() {
+	provider.RunLogAreaProvider(&s3LogAreaProvider{})
+}
+
+// Provision provisions new LogAreas, each with its own prefix in the bucket. The ETR uploads logs
+// through the log area server of the provider, which stores them in the bucket.
+func (p *s3LogAreaProvider) Provision(
+	ctx context.Context, cfg provider.ProvisionConfig,
+) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	environmentRequest := cfg.EnvironmentRequest
+	if cfg.MinimumAmount <= 0 {
+		return errors.New("minimum amount of LogAreas requested is less than or equal to 0")
+	}
+	logger.Info("Provisioning a new object storage LogArea for EnvironmentRequest",
+		"EnvironmentRequest", environmentRequest.Name,
+		"Namespace", environmentRequest.Namespace,
+		"Amount", cfg.MinimumAmount,
+	)
+	cli, err := provider.KubernetesClientFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	logAreaProvider, err := provider.GetProvider(ctx, environmentRequest.Spec.Providers.LogArea.ID, cfg.Namespace)
+	if err != nil {
+		return err
+	}
+	s3Cfg, err := loadConfig(logAreaProvider)
+	if err != nil {
+		return err
+	}
+	storage, err := newClient(ctx, cli, cfg.Namespace, s3Cfg)
+	if err != nil {
+		return err
+	}
+	tokenKey, err := s3Cfg.tokenKey(ctx, cli, cfg.Namespace)
+	if err != nil {
+		return err
+	}
+	for range cfg.MinimumAmount {
+		id := uuid.NewString()
+		prefix := path.Join(s3Cfg.Prefix, environmentRequest.Spec.Identifier, id)
+		logger.Info("Creating an object storage LogArea", "id", id, "bucket", s3Cfg.Bucket, "prefix", prefix)
+		// An empty object marks the prefix so that it can be browsed before any logs are uploaded.
+		if _, err := storage.PutObject(
+			ctx, s3Cfg.Bucket, prefix+"/", bytes.NewReader(nil), 0, minio.PutObjectOptions{},
+		); err != nil {
+			return err
+		}
+		// The token only allows uploads under the prefix of the LogArea, and is encrypted with the
+		// encryption key of the testrun so that only the ETR can use it.
+		token, err := logarea.NewToken(tokenKey, prefix)
+		if err != nil {
+			return err
+		}
+		password, err := provider.Encrypt(ctx, environmentRequest, []byte(token))
+		if err != nil {
+			return err
+		}
+		logArea, err := provider.CreateLogArea(ctx, environmentRequest, cfg.Namespace, "", v1alpha2.LogAreaSpec{
+			ID:       id,
+			LiveLogs: s3Cfg.liveLogsURL(prefix),
+			Logs:     map[string]string{},
+			Upload: v1alpha2.Upload{
+				URL:    s3Cfg.uploadURL(prefix),
+				Method: "PUT",
+				Auth: &v1alpha2.Auth{
+					Username: id,
+					Password: v1alpha2.Decrypt{Decrypt: v1alpha2.DecryptValue{Value: password}},
+					AuthType: "basic",
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		patch := client.MergeFrom(logArea.DeepCopy())
+		logArea.Annotations = map[string]string{prefixAnnotation: prefix}
+		if err := cli.Patch(ctx, logArea, patch); err != nil {
+			return err
+		}
+		logger.Info("LogArea created")
+	}
+	return nil
+}
+
+// Release applies the retention tag to all objects uploaded to a LogArea and releases it.
+func (p *s3LogAreaProvider) Release(ctx context.Context, cfg provider.ReleaseConfig) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info("Releasing LogArea", "Name", cfg.Name, "Namespace", cfg.Namespace)
+	logArea, err := provider.GetLogArea(ctx, cfg.Name, cfg.Namespace)
+	if err != nil {
+		return err
+	}
+	if err := p.applyRetention(ctx, logArea); err != nil {
+		return err
+	}
+	if cfg.NoDelete {
+		return nil
+	}
+	return provider.DeleteLogArea(ctx, logArea)
+}
+
+// applyRetention tags all objects under the prefix of a LogArea with the retention tag of the provider.
+func (p *s3LogAreaProvider) applyRetention(ctx context.Context, logArea *v1alpha2.LogArea) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	prefix := logArea.Annotations[prefixAnnotation]
+	if prefix == "" {
+		logger.Info("LogArea has no prefix, nothing to apply retention to", "name", logArea.Name)
+		return nil
+	}
+	cli, err := provider.KubernetesClientFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	logAreaProvider, err := provider.GetProvider(ctx, logArea.Spec.ProviderID, logArea.Namespace)
+	if err != nil {
+		return err
+	}
+	s3Cfg, err := loadConfig(logAreaProvider)
+	if err != nil {
+		return err
+	}
+	if s3Cfg.Retention == nil {
+		return nil
+	}
+	storage, err := newClient(ctx, cli, logArea.Namespace, s3Cfg)
+	if err != nil {
+		return err
+	}
+	logger.Info("Applying retention tag", "prefix", prefix, "key", s3Cfg.Retention.Key, "value", s3Cfg.Retention.Value)
+	for object := range storage.ListObjects(ctx, s3Cfg.Bucket, minio.ListObjectsOptions{
+		Prefix:    prefix + "/",
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		objectTags, err := storage.GetObjectTagging(ctx, s3Cfg.Bucket, object.Key, minio.GetObjectTaggingOptions{})
+		if err != nil {
+			return err
+		}
+		if err := objectTags.Set(s3Cfg.Retention.Key, s3Cfg.Retention.Value); err != nil {
+			return err
+		}
+		if err := storage.PutObjectTagging(
+			ctx, s3Cfg.Bucket, object.Key, objectTags, minio.PutObjectTaggingOptions{},
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+
+	"github.com/fernet/fernet-go"
+	"github.com/go-logr/logr"
+	"github.com/minio/minio-go/v7"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/pkg/logarea"
+	"github.com/eiffel-community/etos/pkg/logarea/logareatest"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+var _ = Describe("Object storage log area provider", func() {
+	const (
+		namespace = "default"
+		bucket    = "etos-logs"
+	)
+	var (
+		storage     *minio.Client
+		server      *httptest.Server
+		testrunKey  *fernet.Key
+		cli         client.Client
+		runner      providertest.Runner
+		environment *v1alpha1.EnvironmentRequest
+	)
+
+	// secretKey returns a reference to a key of the secret of the provider.
+	secretKey := func(key string) v1alpha1.VarSource {
+		return v1alpha1.VarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "s3"},
+			Key:                  key,
+		}}
+	}
+
+	BeforeEach(func(ctx context.Context) {
+		minIO, err := logareatest.StartMinIO(ctx, GinkgoT().TempDir())
+		if errors.Is(err, logareatest.ErrNoMinIO) {
+			Skip(err.Error())
+		}
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(minIO.Stop)
+		storage, err = minIO.Client()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(storage.MakeBucket(ctx, bucket, minio.MakeBucketOptions{})).To(Succeed())
+
+		serverKey := &fernet.Key{}
+		Expect(serverKey.Generate()).To(Succeed())
+		server = httptest.NewServer(logarea.NewServer(logarea.NewS3Storage(storage, bucket), serverKey, 0, logr.Discard()))
+		DeferCleanup(server.Close)
+
+		testrunKey = &fernet.Key{}
+		Expect(testrunKey.Generate()).To(Succeed())
+		custom, err := json.Marshal(s3Config{
+			Endpoint:  minIO.Endpoint,
+			Insecure:  true,
+			Bucket:    bucket,
+			Prefix:    "testruns",
+			AccessKey: secretKey("accessKey"),
+			SecretKey: secretKey("secretKey"),
+			Server:    server.URL,
+			TokenKey:  secretKey("tokenKey"),
+			Retention: &retentionTag{Key: "etos-retention", Value: "released"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		logAreaProvider := providertest.NewProvider("s3", namespace, "log-area").
+			WithLogAreaProviderConfig(v1alpha1.LogAreaProviderConfig{}).
+			Build()
+		logAreaProvider.Spec.LogAreaProviderConfig.Custom.Raw = custom
+		environment = providertest.NewEnvironmentRequest("environment-request", namespace).
+			WithLogAreaProvider("s3").
+			WithEncryptionKey(v1alpha1.Var{Value: testrunKey.Encode()}).
+			Build()
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "s3", Namespace: namespace},
+			Data: map[string][]byte{
+				"accessKey": []byte(logareatest.AccessKey),
+				"secretKey": []byte(logareatest.SecretKey),
+				"tokenKey":  []byte(serverKey.Encode()),
+			},
+		}
+		// The amount of LogAreas to provision is the amount of IUTs of the EnvironmentRequest.
+		iut := &v1alpha2.Iut{ObjectMeta: metav1.ObjectMeta{
+			Name:      "iut",
+			Namespace: namespace,
+			Labels:    map[string]string{"etos.eiffel-community.github.io/environment-request-id": environment.Spec.ID},
+		}}
+		cli = providertest.NewFakeClient(environment, logAreaProvider, secret, iut)
+		runner = providertest.Runner{Client: cli, ProviderType: provider.ProviderTypeLogArea}
+	})
+
+	// upload uploads a file the way the ETR does, using the upload instructions of a LogArea.
+	upload := func(logArea v1alpha2.LogArea, name, body string) int {
+		instructions := logArea.Spec.Upload
+		token := fernet.VerifyAndDecrypt(
+			[]byte(instructions.Auth.Password.Decrypt.Value), 0, []*fernet.Key{testrunKey},
+		)
+		Expect(token).NotTo(BeNil())
+		request, err := http.NewRequest(
+			instructions.Method, strings.ReplaceAll(instructions.URL, "{name}", name), strings.NewReader(body),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		request.SetBasicAuth(instructions.Auth.Username, string(token))
+		response, err := http.DefaultClient.Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		return response.StatusCode
+	}
+
+	It("should upload logs to the prefix of a LogArea and tag them on release", func(ctx context.Context) {
+		_, err := runner.Provision(ctx, &s3LogAreaProvider{}, environment)
+		Expect(err).NotTo(HaveOccurred())
+
+		var logAreas v1alpha2.LogAreaList
+		Expect(cli.List(ctx, &logAreas)).To(Succeed())
+		Expect(logAreas.Items).To(HaveLen(1))
+		logArea := logAreas.Items[0]
+		prefix := logArea.Annotations[prefixAnnotation]
+		Expect(prefix).To(HavePrefix(path.Join("testruns", environment.Spec.Identifier) + "/"))
+		Expect(logArea.Spec.Upload.Auth.AuthType).To(Equal("basic"))
+
+		By("uploading a log through the log area server")
+		Expect(upload(logArea, "test.log", "hello")).To(Equal(http.StatusCreated))
+		object, err := storage.GetObject(ctx, bucket, prefix+"/test.log", minio.GetObjectOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		content, err := io.ReadAll(object)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("hello"))
+
+		By("not allowing uploads outside of the prefix")
+		Expect(upload(logArea, "../other/test.log", "hello")).To(Equal(http.StatusForbidden))
+
+		By("browsing the live logs")
+		Expect(logArea.Spec.LiveLogs).To(Equal(server.URL + "/logarea/v1alpha/logarea/" + prefix + "/"))
+		response, err := http.Get(logArea.Spec.LiveLogs)
+		Expect(err).NotTo(HaveOccurred())
+		page, err := io.ReadAll(response.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(string(page)).To(ContainSubstring("test.log"))
+
+		By("tagging the logs with the retention tag on release")
+		_, err = runner.Release(ctx, &s3LogAreaProvider{}, provider.ReleaseConfig{Name: logArea.Name, Namespace: namespace})
+		Expect(err).NotTo(HaveOccurred())
+		tags, err := storage.GetObjectTagging(ctx, bucket, prefix+"/test.log", minio.GetObjectTaggingOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tags.ToMap()).To(HaveKeyWithValue("etos-retention", "released"))
+		err = cli.Get(ctx, types.NamespacedName{Name: logArea.Name, Namespace: namespace}, &logArea)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,152 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/pkg/logarea"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/fernet/fernet-go"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const defaultRegion = "us-east-1"
+
+// s3Config is the configuration of the object storage log area provider, read from the custom
+// field of the LogAreaProviderConfig in the Provider resource.
+type s3Config struct {
+	// Endpoint is the host, and optionally port, of the S3-compatible object storage.
+	Endpoint string `json:"endpoint"`
+	// Insecure makes the provider use HTTP instead of HTTPS.
+	Insecure bool `json:"insecure,omitempty"`
+	// Region is the region of the bucket. Defaults to us-east-1.
+	Region string `json:"region,omitempty"`
+	// Bucket is the bucket to store logs in. It must already exist.
+	Bucket string `json:"bucket"`
+	// Prefix is prepended to the prefix of each LogArea.
+	Prefix string `json:"prefix,omitempty"`
+	// AccessKey is the access key of a user that is allowed to put and tag objects.
+	AccessKey v1alpha1.VarSource `json:"accessKey"`
+	// SecretKey is the secret key of a user that is allowed to put and tag objects.
+	SecretKey v1alpha1.VarSource `json:"secretKey"`
+	// Server is the URL of the ETOS log area server that stores files in the bucket. The ETR
+	// uploads logs through it, and users browse the logs in it.
+	Server string `json:"server"`
+	// TokenKey is the encryption key that the log area server verifies upload tokens with.
+	TokenKey v1alpha1.VarSource `json:"tokenKey"`
+	// LiveLogs is a URL template to where the logs can be browsed. '{bucket}' and '{prefix}' are
+	// replaced with the bucket and the prefix of the LogArea.
+	// Defaults to the listing of the prefix in the log area server.
+	LiveLogs string `json:"livelogs,omitempty"`
+	// Retention is an object tag that is applied to all objects of a LogArea when it is released,
+	// so that a lifecycle rule of the bucket can expire them.
+	Retention *retentionTag `json:"retention,omitempty"`
+}
+
+// retentionTag is an object tag used to apply a lifecycle rule to objects.
+type retentionTag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// loadConfig loads the object storage provider configuration from a Provider resource and sets defaults.
+func loadConfig(logAreaProvider *v1alpha1.Provider) (*s3Config, error) {
+	providerConfig := logAreaProvider.Spec.LogAreaProviderConfig
+	if providerConfig == nil || len(providerConfig.Custom.Raw) == 0 {
+		return nil, fmt.Errorf("%s has no custom LogAreaProviderConfig", logAreaProvider.Name)
+	}
+	cfg := &s3Config{}
+	if err := json.Unmarshal(providerConfig.Custom.Raw, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("%s has no object storage endpoint configured", logAreaProvider.Name)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("%s has no object storage bucket configured", logAreaProvider.Name)
+	}
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("%s has no log area server configured", logAreaProvider.Name)
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion
+	}
+	cfg.Server = strings.TrimSuffix(cfg.Server, "/")
+	if cfg.Retention != nil && cfg.Retention.Key == "" {
+		return nil, fmt.Errorf("%s has a retention tag without a key", logAreaProvider.Name)
+	}
+	return cfg, nil
+}
+
+// uploadURL returns the URL that the ETR uploads files to for a prefix. The ETR replaces '{name}'
+// with the name of the file to upload.
+func (c *s3Config) uploadURL(prefix string) string {
+	return fmt.Sprintf("%s%s/upload/%s/{name}", c.Server, logarea.BasePath, prefix)
+}
+
+// liveLogsURL returns the URL where the logs of a prefix can be browsed.
+func (c *s3Config) liveLogsURL(prefix string) string {
+	if c.LiveLogs == "" {
+		return fmt.Sprintf("%s%s/logarea/%s/", c.Server, logarea.BasePath, prefix)
+	}
+	return strings.NewReplacer(
+		"{bucket}", c.Bucket,
+		"{prefix}", url.PathEscape(prefix),
+	).Replace(c.LiveLogs)
+}
+
+// keys gets the access and secret key of the provider from the namespace.
+func (c *s3Config) keys(ctx context.Context, cli client.Client, namespace string) (string, string, error) {
+	accessKey, err := provider.GetSecret(ctx, cli, &v1alpha1.Var{ValueFrom: c.AccessKey}, namespace)
+	if err != nil {
+		return "", "", err
+	}
+	secretKey, err := provider.GetSecret(ctx, cli, &v1alpha1.Var{ValueFrom: c.SecretKey}, namespace)
+	if err != nil {
+		return "", "", err
+	}
+	return string(accessKey), string(secretKey), nil
+}
+
+// tokenKey gets the encryption key of the log area server from the namespace.
+func (c *s3Config) tokenKey(ctx context.Context, cli client.Client, namespace string) (*fernet.Key, error) {
+	key, err := provider.GetSecret(ctx, cli, &v1alpha1.Var{ValueFrom: c.TokenKey}, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return fernet.DecodeKey(string(key))
+}
+
+// newClient creates a new object storage client using the keys of the provider.
+func newClient(ctx context.Context, cli client.Client, namespace string, cfg *s3Config) (*minio.Client, error) {
+	accessKey, secretKey, err := cfg.keys(ctx, cli, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+}
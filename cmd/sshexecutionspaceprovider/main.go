@@ -0,0 +1,301 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"strings"
+
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	hostAnnotation    = "etos.eiffel-community.github.io/ssh-host"
+	pidAnnotation     = "etos.eiffel-community.github.io/ssh-pid"
+	workDirAnnotation = "etos.eiffel-community.github.io/ssh-workdir"
+)
+
+type sshExecutionSpaceProvider struct{}
+
+// main creates ExecutionSpaces that run the ETOS test runner on remote hosts over SSH.
+func main() {
+	provider.RunExecutionSpaceProvider(&sshExecutionSpaceProvider{})
+}
+
+// Provision provisions new ExecutionSpaces on the agents configured in the Provider.
+func (p *sshExecutionSpaceProvider) Provision(
+	ctx context.Context, cfg provider.ProvisionConfig,
+) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	environmentRequest := cfg.EnvironmentRequest
+	if cfg.MinimumAmount <= 0 {
+		return errors.New("minimum amount of ExecutionSpaces requested is less than or equal to 0")
+	}
+	logger.Info("Provisioning a new SSH ExecutionSpace for EnvironmentRequest",
+		"EnvironmentRequest", environmentRequest.Name,
+		"Namespace", environmentRequest.Namespace,
+		"Amount", cfg.MinimumAmount,
+	)
+	cli, err := provider.KubernetesClientFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	executionSpaceProvider, err := provider.GetProvider(
+		ctx, environmentRequest.Spec.Providers.ExecutionSpace.ID, cfg.Namespace,
+	)
+	if err != nil {
+		return err
+	}
+	sshCfg, err := loadConfig(executionSpaceProvider)
+	if err != nil {
+		return err
+	}
+	environment, err := provider.TestRunnerEnvironment(ctx, environmentRequest)
+	if err != nil {
+		return err
+	}
+	devEnvironment, err := provider.TestRunnerDevEnvironment(executionSpaceProvider, environmentRequest)
+	if err != nil {
+		return err
+	}
+	maps.Copy(environment, devEnvironment)
+	key, err := provider.GetSecret(ctx, cli, &environmentRequest.Spec.Config.EncryptionKey, environmentRequest.Namespace)
+	if err != nil {
+		return err
+	}
+
+	for range cfg.MinimumAmount {
+		id := uuid.NewString()
+		testrunner := environmentRequest.Spec.Providers.ExecutionSpace.TestRunnerImage
+		logger.Info("Creating an SSH ExecutionSpace",
+			"id", id, "image", testrunner, "identifier", environmentRequest.Spec.Identifier,
+		)
+		environment["ENVIRONMENT_ID"] = id
+		environment["ENVIRONMENT_URL"] = fmt.Sprintf("%s/v1alpha/testrun/%s", environmentRequest.Spec.Config.EtosApi, id)
+		executionSpace, err := provider.CreateExecutionSpace(ctx, environmentRequest, cfg.Namespace, "",
+			v1alpha2.ExecutionSpaceSpec{
+				ID:         id,
+				TestRunner: testrunner,
+				Instructions: v1alpha2.Instructions{
+					Identifier:  environmentRequest.Spec.Identifier,
+					Image:       testrunner,
+					Parameters:  map[string]string{},
+					Environment: environment,
+				},
+			})
+		if err != nil {
+			return err
+		}
+		a, slot, err := claim(ctx, cli, executionSpace, executionSpaceProvider.Name, sshCfg)
+		if err != nil {
+			logger.Error(err, "failed to claim a session on a host, deleting ExecutionSpace")
+			if deleteErr := provider.DeleteExecutionSpace(ctx, executionSpace); deleteErr != nil {
+				logger.Error(deleteErr, "failed to delete ExecutionSpace")
+			}
+			return err
+		}
+		workDir := path.Join(sshCfg.WorkDir, id)
+		// The host is annotated before starting so that a release can free the session and clean up
+		// the work directory even if the start fails halfway.
+		if err := annotate(ctx, cli, executionSpace, map[string]string{
+			hostAnnotation:    a.Host,
+			slotAnnotation:    slot,
+			workDirAnnotation: workDir,
+		}); err != nil {
+			logger.Error(err, "failed to annotate ExecutionSpace, deleting ExecutionSpace", "host", a.Host)
+			// The slot annotation was never written, so free the session by the name of the claimed slot.
+			if freeErr := freeSlot(ctx, cli, executionSpace.Namespace, slot); freeErr != nil {
+				logger.Error(freeErr, "failed to free the session on the host")
+			}
+			if deleteErr := provider.DeleteExecutionSpace(ctx, executionSpace); deleteErr != nil {
+				logger.Error(deleteErr, "failed to delete ExecutionSpace")
+			}
+			return err
+		}
+		logger.Info("ExecutionSpace created, launching ETR", "host", a.Host)
+		pid, err := p.start(ctx, cli, a, sshCfg, executionSpace, workDir, key)
+		if err != nil {
+			logger.Error(err, "failed to launch ETR, deleting ExecutionSpace", "host", a.Host)
+			if freeErr := free(ctx, cli, executionSpace); freeErr != nil {
+				logger.Error(freeErr, "failed to free the session on the host")
+			}
+			if deleteErr := provider.DeleteExecutionSpace(ctx, executionSpace); deleteErr != nil {
+				logger.Error(deleteErr, "failed to delete ExecutionSpace")
+			}
+			return err
+		}
+		if err := annotate(ctx, cli, executionSpace, map[string]string{pidAnnotation: pid}); err != nil {
+			return err
+		}
+		logger.Info("ETR launched", "host", a.Host, "pid", pid)
+	}
+	return nil
+}
+
+// start writes the environment to the agent and starts the ETOS test runner in the background.
+// Returns the process ID of the started process.
+//
+// The encryption key is never written to the agent, it is read from stdin by the shell that starts the
+// test runner and is only passed on in the environment of the test runner.
+func (p *sshExecutionSpaceProvider) start(
+	ctx context.Context,
+	cli client.Client,
+	a agent,
+	cfg *sshConfig,
+	executionSpace *v1alpha2.ExecutionSpace,
+	workDir string,
+	encryptionKey []byte,
+) (string, error) {
+	conn, err := dial(ctx, cli, executionSpace.Namespace, a)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close() // nolint:errcheck
+
+	environment := maps.Clone(executionSpace.Spec.Instructions.Environment)
+	delete(environment, "ETOS_ENCRYPTION_KEY")
+	if _, err := run(
+		conn,
+		fmt.Sprintf("umask 077 && mkdir -p %[1]s && cat > %[1]s/environment", quote(workDir)),
+		environmentFile(cfg.Runtime, environment),
+	); err != nil {
+		return "", err
+	}
+
+	args := strings.Join(arguments(executionSpace.Spec.Instructions.Parameters), " ")
+	var command string
+	switch cfg.Runtime {
+	case runtimeShell:
+		command = fmt.Sprintf("set -a; . ./environment; set +a; exec %s %s", cfg.Command, args)
+	default:
+		command = fmt.Sprintf(
+			"exec docker run --rm --name %s --env-file environment --env ETOS_ENCRYPTION_KEY %s %s",
+			quote(containerName(executionSpace)), quote(executionSpace.Spec.Instructions.Image), args,
+		)
+	}
+	// setsid makes the started process a session leader so that the whole process group can be
+	// killed on release.
+	return run(conn, fmt.Sprintf(
+		"IFS= read -r ETOS_ENCRYPTION_KEY; export ETOS_ENCRYPTION_KEY; "+
+			"cd %s || exit 1; setsid nohup sh -c %s > etr.log 2>&1 < /dev/null & echo $!",
+		quote(workDir), quote(command),
+	), append(encryptionKey, '\n'))
+}
+
+// Release stops the ETOS test runner on the remote host, cleans up and releases the ExecutionSpace.
+func (p *sshExecutionSpaceProvider) Release(
+	ctx context.Context, cfg provider.ReleaseConfig,
+) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info("Releasing ExecutionSpace", "Name", cfg.Name, "Namespace", cfg.Namespace)
+	executionSpace, err := provider.GetExecutionSpace(ctx, cfg.Name, cfg.Namespace)
+	if err != nil {
+		return err
+	}
+	if err := p.stop(ctx, executionSpace); err != nil {
+		return err
+	}
+	cli, err := provider.KubernetesClientFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if err := free(ctx, cli, executionSpace); err != nil {
+		return err
+	}
+	if cfg.NoDelete {
+		return nil
+	}
+	return provider.DeleteExecutionSpace(ctx, executionSpace)
+}
+
+// stop kills the ETOS test runner process on the remote host and removes its work directory.
+func (p *sshExecutionSpaceProvider) stop(ctx context.Context, executionSpace *v1alpha2.ExecutionSpace) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	host := executionSpace.Annotations[hostAnnotation]
+	if host == "" {
+		logger.Info("ExecutionSpace was never started on a host, nothing to stop", "name", executionSpace.Name)
+		return nil
+	}
+	cli, err := provider.KubernetesClientFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	executionSpaceProvider, err := provider.GetProvider(ctx, executionSpace.Spec.ProviderID, executionSpace.Namespace)
+	if err != nil {
+		return err
+	}
+	sshCfg, err := loadConfig(executionSpaceProvider)
+	if err != nil {
+		return err
+	}
+	a, err := sshCfg.agent(host)
+	if errors.Is(err, errUnknownHost) {
+		// The host has been removed from the provider, there is nothing left to stop that we can reach.
+		logger.Info("Host is no longer configured in the provider, treating ExecutionSpace as stopped",
+			"name", executionSpace.Name, "host", host)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	conn, err := dial(ctx, cli, executionSpace.Namespace, a)
+	if err != nil {
+		return err
+	}
+	defer conn.Close() // nolint:errcheck
+
+	var commands []string
+	if pid := executionSpace.Annotations[pidAnnotation]; pid != "" {
+		commands = append(commands, fmt.Sprintf("kill -TERM -- -%s 2>/dev/null || true", quote(pid)))
+	}
+	if sshCfg.Runtime == runtimeDocker {
+		commands = append(commands,
+			fmt.Sprintf("docker rm -f %s >/dev/null 2>&1 || true", quote(containerName(executionSpace))),
+		)
+	}
+	if workDir := executionSpace.Annotations[workDirAnnotation]; workDir != "" {
+		commands = append(commands, fmt.Sprintf("rm -rf %s", quote(workDir)))
+	}
+	logger.Info("Stopping ETR", "host", host, "pid", executionSpace.Annotations[pidAnnotation])
+	// The process may already have exited, which is not an error, so only the cleanup result matters.
+	_, err = run(conn, strings.Join(commands, "; "), nil)
+	return err
+}
+
+// containerName returns the name of the docker container running the ETR for an ExecutionSpace.
+func containerName(executionSpace *v1alpha2.ExecutionSpace) string {
+	return fmt.Sprintf("etr-%s", executionSpace.Spec.ID)
+}
+
+// annotate adds annotations to an ExecutionSpace.
+func annotate(
+	ctx context.Context, cli client.Client, executionSpace *v1alpha2.ExecutionSpace, annotations map[string]string,
+) error {
+	patch := client.MergeFrom(executionSpace.DeepCopy())
+	if executionSpace.Annotations == nil {
+		executionSpace.Annotations = map[string]string{}
+	}
+	maps.Copy(executionSpace.Annotations, annotations)
+	return cli.Patch(ctx, executionSpace, patch)
+}
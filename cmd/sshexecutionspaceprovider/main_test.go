@@ -0,0 +1,248 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fernet/fernet-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+var _ = Describe("SSH execution space provider", func() {
+	const (
+		namespace = "default"
+		username  = "etos"
+		password  = "hunter2hunter2"
+	)
+	var (
+		server  *sshd
+		workDir string
+		key     string
+		cli     client.Client
+		runner  providertest.Runner
+	)
+
+	// providerWith creates the Provider of the SSH execution space provider with a single agent.
+	providerWith := func(cfg sshConfig) *v1alpha1.Provider {
+		custom, err := json.Marshal(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		executionSpaceProvider := providertest.NewProvider("ssh", namespace, "execution-space").Build()
+		executionSpaceProvider.Spec.ExecutionSpaceProviderConfig = &v1alpha1.ExecutionSpaceProviderConfig{}
+		executionSpaceProvider.Spec.ExecutionSpaceProviderConfig.Custom.Raw = custom
+		return executionSpaceProvider
+	}
+
+	// localAgent returns the configuration of the sshd as an agent.
+	localAgent := func(maxSessions int) agent {
+		return agent{
+			Host:     "127.0.0.1",
+			Port:     server.Port(),
+			Username: username,
+			Password: &v1alpha1.VarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "agent"},
+				Key:                  "password",
+			}},
+			HostKey:     server.HostKey,
+			MaxSessions: maxSessions,
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		server, err = startSSHD(username, password)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(server.Close)
+		workDir = GinkgoT().TempDir()
+		var fernetKey fernet.Key
+		Expect(fernetKey.Generate()).To(Succeed())
+		key = fernetKey.Encode()
+	})
+
+	setup := func(cfg sshConfig) *v1alpha1.EnvironmentRequest {
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", namespace).
+			WithExecutionSpaceProvider("ssh", "5.0.0").
+			WithEncryptionKey(v1alpha1.Var{Value: key}).
+			Build()
+		environmentRequest.Spec.Config.EtosMessageBus.Password = &v1alpha1.Var{Value: "etos"}
+		environmentRequest.Spec.Config.EiffelMessageBus.Password = &v1alpha1.Var{Value: "eiffel"}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: namespace},
+			Data:       map[string][]byte{"password": []byte(password)},
+		}
+		// The amount of ExecutionSpaces to provision is the amount of IUTs of the EnvironmentRequest.
+		iut := &v1alpha2.Iut{ObjectMeta: metav1.ObjectMeta{
+			Name:      "iut",
+			Namespace: namespace,
+			Labels:    map[string]string{"etos.eiffel-community.github.io/environment-request-id": environmentRequest.Spec.ID},
+		}}
+		cli = providertest.NewFakeClient(environmentRequest, providerWith(cfg), secret, iut)
+		runner = providertest.Runner{Client: cli, ProviderType: provider.ProviderTypeExecutionSpace}
+		return environmentRequest
+	}
+
+	It("should start the test runner on the agent and stop it on release", func() {
+		ctx := context.Background()
+		environmentRequest := setup(sshConfig{
+			Hosts:   []agent{localAgent(1)},
+			Runtime: runtimeShell,
+			Command: `sh -c 'printenv ETOS_ENCRYPTION_KEY > key; exec sleep 60'`,
+			WorkDir: workDir,
+		})
+
+		_, err := runner.Provision(ctx, &sshExecutionSpaceProvider{}, environmentRequest)
+		Expect(err).NotTo(HaveOccurred())
+
+		var executionSpaces v1alpha2.ExecutionSpaceList
+		Expect(cli.List(ctx, &executionSpaces)).To(Succeed())
+		Expect(executionSpaces.Items).To(HaveLen(1))
+		executionSpace := executionSpaces.Items[0]
+		Expect(executionSpace.Annotations).To(HaveKeyWithValue(hostAnnotation, "127.0.0.1"))
+		Expect(executionSpace.Annotations).To(HaveKey(pidAnnotation))
+		dir := executionSpace.Annotations[workDirAnnotation]
+		Expect(dir).To(Equal(filepath.Join(workDir, executionSpace.Spec.ID)))
+
+		By("passing the encryption key to the test runner without writing it to the agent")
+		Eventually(func() (string, error) {
+			b, err := os.ReadFile(filepath.Join(dir, "key"))
+			return string(b), err
+		}).Should(Equal(key + "\n"))
+		environment, err := os.ReadFile(filepath.Join(dir, "environment"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(environment)).To(ContainSubstring("ENVIRONMENT_ID="))
+		Expect(string(environment)).NotTo(ContainSubstring(key))
+
+		By("claiming a session on the agent")
+		var lease coordinationv1.Lease
+		name := types.NamespacedName{Name: executionSpace.Annotations[slotAnnotation], Namespace: namespace}
+		Expect(cli.Get(ctx, name, &lease)).To(Succeed())
+		Expect(*lease.Spec.HolderIdentity).To(Equal(executionSpace.Name))
+
+		By("releasing the session and removing the work directory")
+		_, err = runner.Release(ctx, &sshExecutionSpaceProvider{}, provider.ReleaseConfig{
+			Name: executionSpace.Name, Namespace: namespace,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dir).NotTo(BeADirectory())
+		Expect(apierrors.IsNotFound(cli.Get(ctx, name, &lease))).To(BeTrue())
+		err = cli.Get(ctx, types.NamespacedName{Name: executionSpace.Name, Namespace: namespace}, &executionSpace)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should fail and delete the ExecutionSpace when all agents are busy", func() {
+		ctx := context.Background()
+		environmentRequest := setup(sshConfig{
+			Hosts:   []agent{localAgent(1)},
+			Runtime: runtimeShell,
+			Command: "sleep 60",
+			WorkDir: workDir,
+		})
+		_, err := runner.Provision(ctx, &sshExecutionSpaceProvider{}, environmentRequest)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = runner.Provision(ctx, &sshExecutionSpaceProvider{}, environmentRequest)
+		Expect(err).To(MatchError(ContainSubstring("busy")))
+		var executionSpaces v1alpha2.ExecutionSpaceList
+		Expect(cli.List(ctx, &executionSpaces)).To(Succeed())
+		Expect(executionSpaces.Items).To(HaveLen(1))
+
+		_, err = runner.Release(ctx, &sshExecutionSpaceProvider{}, provider.ReleaseConfig{
+			Name: executionSpaces.Items[0].Name, Namespace: namespace,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should release ExecutionSpaces on hosts that are no longer configured in the provider", func() {
+		ctx := context.Background()
+		environmentRequest := setup(sshConfig{
+			Hosts:   []agent{localAgent(1)},
+			Runtime: runtimeShell,
+			Command: "true",
+			WorkDir: workDir,
+		})
+		_, err := runner.Provision(ctx, &sshExecutionSpaceProvider{}, environmentRequest)
+		Expect(err).NotTo(HaveOccurred())
+		var executionSpaces v1alpha2.ExecutionSpaceList
+		Expect(cli.List(ctx, &executionSpaces)).To(Succeed())
+		Expect(executionSpaces.Items).To(HaveLen(1))
+		executionSpace := executionSpaces.Items[0]
+
+		By("removing the host from the provider")
+		executionSpace.Annotations[hostAnnotation] = "10.0.0.2"
+		Expect(cli.Update(ctx, &executionSpace)).To(Succeed())
+
+		_, err = runner.Release(ctx, &sshExecutionSpaceProvider{}, provider.ReleaseConfig{
+			Name: executionSpace.Name, Namespace: namespace,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		var lease coordinationv1.Lease
+		name := types.NamespacedName{Name: executionSpace.Annotations[slotAnnotation], Namespace: namespace}
+		Expect(apierrors.IsNotFound(cli.Get(ctx, name, &lease))).To(BeTrue())
+		err = cli.Get(ctx, types.NamespacedName{Name: executionSpace.Name, Namespace: namespace}, &executionSpace)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should never claim more sessions than an agent has, even when provisioning concurrently", func() {
+		ctx := context.Background()
+		cfg := &sshConfig{Hosts: []agent{localAgent(2), {Host: "10.0.0.2", MaxSessions: 1}}}
+		cli = providertest.NewFakeClient()
+
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		claimed := map[string]int{}
+		var failures int
+		for i := range 6 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				executionSpace := &v1alpha2.ExecutionSpace{ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("execution-space-%d", i),
+					Namespace: namespace,
+				}}
+				Expect(cli.Create(ctx, executionSpace)).To(Succeed())
+				a, _, err := claim(ctx, cli, executionSpace, "ssh", cfg)
+				mutex.Lock()
+				defer mutex.Unlock()
+				if err != nil {
+					failures++
+					return
+				}
+				claimed[a.Host]++
+			}()
+		}
+		wg.Wait()
+		Expect(claimed).To(Equal(map[string]int{"127.0.0.1": 2, "10.0.0.2": 1}))
+		Expect(failures).To(Equal(3))
+	})
+})
@@ -0,0 +1,97 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/eiffel-community/etos/api/v1alpha2"
+)
+
+const (
+	slotAnnotation = "etos.eiffel-community.github.io/ssh-slot"
+	providerLabel  = "etos.eiffel-community.github.io/provider"
+)
+
+// slotName returns the name of the Lease of a session slot on an agent.
+//
+// Host names are not always valid object names, so the host is hashed.
+func slotName(providerName string, a agent, slot int) string {
+	hash := sha256.Sum256([]byte(a.Host))
+	return fmt.Sprintf("etos-ssh-%s-%s-%d", providerName, hex.EncodeToString(hash[:])[:12], slot)
+}
+
+// claim claims a session slot on the first agent, in order of preference, that has a free slot.
+//
+// Each session slot of an agent is a Lease that is held by the ExecutionSpace running in it. Creating a
+// Lease that already exists fails, so concurrent provisioners can never claim the same slot. The Lease is
+// owned by the ExecutionSpace so that the slot is freed by the garbage collector if the ExecutionSpace is
+// deleted without being released.
+func claim(
+	ctx context.Context, cli client.Client, executionSpace *v1alpha2.ExecutionSpace, providerName string, cfg *sshConfig,
+) (agent, string, error) {
+	for _, a := range cfg.Hosts {
+		for slot := range a.MaxSessions {
+			lease := &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      slotName(providerName, a, slot),
+					Namespace: executionSpace.Namespace,
+					Labels: map[string]string{
+						providerLabel:               providerName,
+						"app.kubernetes.io/part-of": "etos",
+					},
+				},
+				Spec: coordinationv1.LeaseSpec{HolderIdentity: &executionSpace.Name},
+			}
+			if err := controllerutil.SetOwnerReference(executionSpace, lease, cli.Scheme()); err != nil {
+				return agent{}, "", err
+			}
+			err := cli.Create(ctx, lease)
+			if apierrors.IsAlreadyExists(err) {
+				continue
+			}
+			if err != nil {
+				return agent{}, "", err
+			}
+			return a, lease.Name, nil
+		}
+	}
+	return agent{}, "", fmt.Errorf("all %d hosts in provider %s are busy", len(cfg.Hosts), providerName)
+}
+
+// free frees the session slot claimed by an ExecutionSpace.
+func free(ctx context.Context, cli client.Client, executionSpace *v1alpha2.ExecutionSpace) error {
+	name := executionSpace.Annotations[slotAnnotation]
+	if name == "" {
+		return nil
+	}
+	return freeSlot(ctx, cli, executionSpace.Namespace, name)
+}
+
+// freeSlot frees a session slot by the name of its Lease.
+func freeSlot(ctx context.Context, cli client.Client, namespace, name string) error {
+	lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	return client.IgnoreNotFound(cli.Delete(ctx, lease))
+}
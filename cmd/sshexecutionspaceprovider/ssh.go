@@ -0,0 +1,230 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"golang.org/x/crypto/ssh"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	runtimeDocker  = "docker"
+	runtimeShell   = "shell"
+	defaultWorkDir = "/tmp/etos"
+	dialTimeout    = 30 * time.Second
+)
+
+// sshConfig is the configuration of the SSH execution space provider, read from the
+// custom field of the ExecutionSpaceProviderConfig in the Provider resource.
+type sshConfig struct {
+	// Hosts is the list of agents that the provider can select from, in order of preference.
+	Hosts []agent `json:"hosts"`
+	// Runtime decides how the ETR is started on the agent, either 'docker' or 'shell'.
+	Runtime string `json:"runtime,omitempty"`
+	// Command is the command that starts the ETR when the runtime is 'shell'.
+	Command string `json:"command,omitempty"`
+	// WorkDir is the directory on the agent in which each ExecutionSpace gets a directory.
+	WorkDir string `json:"workDir,omitempty"`
+}
+
+// agent is a remote host, reachable over SSH, that can run the ETOS test runner.
+type agent struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username"`
+	// PrivateKey is a PEM encoded private key used for authenticating with the agent.
+	PrivateKey *v1alpha1.VarSource `json:"privateKey,omitempty"`
+	// Password is used for authenticating with the agent if no private key is set.
+	Password *v1alpha1.VarSource `json:"password,omitempty"`
+	// HostKey is the public key of the agent, in authorized_keys format.
+	HostKey string `json:"hostKey,omitempty"`
+	// InsecureIgnoreHostKey disables host key verification, should only be used for testing.
+	InsecureIgnoreHostKey bool `json:"insecureIgnoreHostKey,omitempty"`
+	// MaxSessions is the maximum number of ExecutionSpaces that can run on the agent at once.
+	MaxSessions int `json:"maxSessions,omitempty"`
+}
+
+// address returns the host:port address of the agent.
+func (a agent) address() string {
+	return net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+}
+
+// loadConfig loads the SSH provider configuration from a Provider resource and sets defaults.
+func loadConfig(executionSpaceProvider *v1alpha1.Provider) (*sshConfig, error) {
+	providerConfig := executionSpaceProvider.Spec.ExecutionSpaceProviderConfig
+	if providerConfig == nil || len(providerConfig.Custom.Raw) == 0 {
+		return nil, fmt.Errorf("%s has no custom ExecutionSpaceProviderConfig", executionSpaceProvider.Name)
+	}
+	cfg := &sshConfig{}
+	if err := json.Unmarshal(providerConfig.Custom.Raw, cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Hosts) == 0 {
+		return nil, fmt.Errorf("%s has no hosts configured", executionSpaceProvider.Name)
+	}
+	if cfg.Runtime == "" {
+		cfg.Runtime = runtimeDocker
+	}
+	switch cfg.Runtime {
+	case runtimeDocker:
+	case runtimeShell:
+		if cfg.Command == "" {
+			return nil, errors.New("a command is required when the runtime is 'shell'")
+		}
+	default:
+		return nil, fmt.Errorf("unknown runtime %q, must be one of 'docker' or 'shell'", cfg.Runtime)
+	}
+	if cfg.WorkDir == "" {
+		cfg.WorkDir = defaultWorkDir
+	}
+	for i := range cfg.Hosts {
+		if cfg.Hosts[i].Port == 0 {
+			cfg.Hosts[i].Port = 22
+		}
+		if cfg.Hosts[i].MaxSessions == 0 {
+			cfg.Hosts[i].MaxSessions = 1
+		}
+	}
+	return cfg, nil
+}
+
+// errUnknownHost is returned when a host is not configured in the provider.
+var errUnknownHost = errors.New("host is not configured in the provider")
+
+// agent returns the agent configuration for a host.
+func (c *sshConfig) agent(host string) (agent, error) {
+	for _, a := range c.Hosts {
+		if a.Host == host {
+			return a, nil
+		}
+	}
+	return agent{}, fmt.Errorf("host %s: %w", host, errUnknownHost)
+}
+
+// dial connects to an agent, fetching credentials from the namespace.
+func dial(ctx context.Context, cli client.Client, namespace string, a agent) (*ssh.Client, error) {
+	var auth []ssh.AuthMethod
+	if a.PrivateKey != nil {
+		key, err := provider.GetSecret(ctx, cli, &v1alpha1.Var{ValueFrom: *a.PrivateKey}, namespace)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if a.Password != nil {
+		password, err := provider.GetSecret(ctx, cli, &v1alpha1.Var{ValueFrom: *a.Password}, namespace)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.Password(string(password)))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("no privateKey or password configured for host %s", a.Host)
+	}
+	hostKeyCallback, err := a.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	return ssh.Dial("tcp", a.address(), &ssh.ClientConfig{
+		User:            a.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         dialTimeout,
+	})
+}
+
+// hostKeyCallback returns the host key verification method configured for the agent.
+func (a agent) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if a.HostKey != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(a.HostKey))
+		if err != nil {
+			return nil, err
+		}
+		return ssh.FixedHostKey(key), nil
+	}
+	if a.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	return nil, fmt.Errorf("no hostKey configured for host %s and insecureIgnoreHostKey is not set", a.Host)
+}
+
+// run runs a command on the remote host, writing stdin to the command if not nil, and returns stdout.
+func run(conn *ssh.Client, command string, stdin []byte) (string, error) {
+	session, err := conn.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close() // nolint:errcheck
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if stdin != nil {
+		session.Stdin = bytes.NewReader(stdin)
+	}
+	if err := session.Run(command); err != nil {
+		return "", fmt.Errorf("%q failed: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// environmentFile creates the file content of an environment file for the runtime.
+//
+// Docker environment files do not support quoting so values are written as is, while the
+// shell runtime sources the file and values must therefore be quoted.
+func environmentFile(runtime string, environment map[string]string) []byte {
+	var b bytes.Buffer
+	for _, key := range slices.Sorted(maps.Keys(environment)) {
+		value := environment[key]
+		if runtime == runtimeShell {
+			value = quote(value)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", key, value)
+	}
+	return b.Bytes()
+}
+
+// arguments creates a sorted list of quoted key=value arguments from parameters.
+func arguments(parameters map[string]string) []string {
+	args := []string{}
+	for key, value := range parameters {
+		args = append(args, quote(fmt.Sprintf("%s=%s", key, value)))
+	}
+	slices.Sort(args)
+	return args
+}
+
+// quote quotes a string for use in a POSIX shell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
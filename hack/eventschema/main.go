@@ -0,0 +1,42 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command eventschema writes the JSON schema of the events on the ETOS message bus to a file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/eiffel-community/etos/pkg/events"
+)
+
+func main() {
+	var output string
+	flag.StringVar(&output, "output", "docs/schemas/events/"+events.Version+".json", "File to write the schema to.")
+	flag.Parse()
+
+	schema, err := events.Schema()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(output, append(schema, '\n'), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
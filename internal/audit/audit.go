@@ -0,0 +1,154 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit records who created, changed and deleted ETOS resources, I.e. who launched and
+// who aborted a TestRun, in an append-only store that can be queried by the ID of a TestRun.
+//
+// Records are made by the admission webhooks of ETOS with a Recorder, from the user of the
+// admission request.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// idLabel is the label with the ID of the TestRun that a resource belongs to.
+const idLabel = "etos.eiffel-community.github.io/id"
+
+// Operation is an operation on a resource.
+type Operation string
+
+const (
+	// OperationCreate is the creation of a resource, I.e. launching a TestRun.
+	OperationCreate Operation = "create"
+	// OperationUpdate is a change of a resource.
+	OperationUpdate Operation = "update"
+	// OperationDelete is the deletion of a resource, I.e. aborting a TestRun or releasing an IUT.
+	OperationDelete Operation = "delete"
+)
+
+// Record is an entry in the audit trail.
+type Record struct {
+	// UID is the UID of the admission request that the record was made from.
+	UID string `json:"uid"`
+	// Time is when the record was made.
+	Time time.Time `json:"time"`
+	// User is the name of the user that made the request.
+	User string `json:"user"`
+	// Groups are the groups of the user that made the request.
+	Groups []string `json:"groups,omitempty"`
+	// Operation is the operation that the user made.
+	Operation Operation `json:"operation"`
+	// Kind is the kind of resource, I.e. "TestRun".
+	Kind string `json:"kind"`
+	// Name is the name of the resource.
+	Name string `json:"name"`
+	// Namespace is the namespace of the resource.
+	Namespace string `json:"namespace"`
+	// TestRun is the ID of the TestRun that the resource belongs to, if any.
+	TestRun string `json:"testrun,omitempty"`
+	// Changes is a summary of the changes of an update.
+	Changes []string `json:"changes,omitempty"`
+}
+
+// Store is an append-only store of audit records.
+type Store interface {
+	// Append appends a record to the store.
+	Append(ctx context.Context, namespace string, record Record) error
+	// List lists the records of a TestRun, oldest first.
+	List(ctx context.Context, namespace, testrun string) ([]Record, error)
+}
+
+// Recorder records the operations of admission requests in a Store. A nil Recorder records nothing.
+type Recorder struct {
+	store Store
+	now   func() time.Time
+}
+
+// NewRecorder creates a Recorder that records in store.
+func NewRecorder(store Store) *Recorder {
+	return &Recorder{store: store, now: time.Now}
+}
+
+// Record records the operation of the admission request in ctx on obj. The old object is only
+// required for updates, whose changes are summarized in the record. Updates which do not change the
+// spec, labels or annotations of a resource, I.e. adding a finalizer, are not recorded, and neither
+// are dry runs.
+func (r *Recorder) Record(ctx context.Context, obj, old client.Object) error {
+	if r == nil {
+		return nil
+	}
+	request, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the admission request to audit: %w", err)
+	}
+	if request.DryRun != nil && *request.DryRun {
+		return nil
+	}
+	record := Record{
+		UID:       string(request.UID),
+		Time:      r.now().UTC(),
+		User:      request.UserInfo.Username,
+		Groups:    request.UserInfo.Groups,
+		Kind:      request.Kind.Kind,
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+		TestRun:   obj.GetLabels()[idLabel],
+	}
+	switch request.Operation {
+	case admissionv1.Create:
+		record.Operation = OperationCreate
+	case admissionv1.Update:
+		record.Operation = OperationUpdate
+		changes, err := Changes(old, obj)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		record.Changes = changes
+	case admissionv1.Delete:
+		record.Operation = OperationDelete
+	default:
+		return nil
+	}
+	if err := r.store.Append(ctx, record.Namespace, record); err != nil {
+		return fmt.Errorf("failed to record %s of %s %s in the audit trail: %w",
+			record.Operation, record.Kind, record.Name, err)
+	}
+	logf.FromContext(ctx).Info("Recorded in the audit trail",
+		"operation", record.Operation, "kind", record.Kind, "name", record.Name, "user", record.User)
+	return nil
+}
+
+// RecordOrWarn records like Record, but does not fail the admission request when the record cannot
+// be made. The error is logged and returned as a warning instead, so that a failing store never
+// blocks ETOS itself, I.e. from releasing resources.
+func (r *Recorder) RecordOrWarn(ctx context.Context, obj, old client.Object) admission.Warnings {
+	if err := r.Record(ctx, obj, old); err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to record in the audit trail, allowing the request")
+		return admission.Warnings{fmt.Sprintf("not recorded in the audit trail: %s", err)}
+	}
+	return nil
+}
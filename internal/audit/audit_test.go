@@ -0,0 +1,253 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package audit_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/audit"
+)
+
+// request returns a context with an admission request by a user.
+func request(operation admissionv1.Operation, uid string) context.Context {
+	return admission.NewContextWithRequest(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       types.UID(uid),
+			Kind:      metav1.GroupVersionKind{Group: "etos.eiffel-community.github.io", Version: "v1alpha1", Kind: "TestRun"},
+			Operation: operation,
+			UserInfo:  authenticationv1.UserInfo{Username: "jane", Groups: []string{"testers"}},
+		},
+	})
+}
+
+// testrun returns a TestRun with an ID.
+func testrun(id string) *v1alpha1.TestRun {
+	return &v1alpha1.TestRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testrun-" + id,
+			Namespace: "default",
+			Labels:    map[string]string{"etos.eiffel-community.github.io/id": id},
+		},
+		Spec: v1alpha1.TestRunSpec{ID: id, Cluster: "etos"},
+	}
+}
+
+var _ = Describe("Audit", func() {
+	var (
+		cli   client.Client
+		store *audit.ConfigMapStore
+	)
+
+	BeforeEach(func() {
+		cli = fake.NewClientBuilder().Build()
+		store = audit.NewConfigMapStore(cli, cli)
+	})
+
+	Describe("Recorder", func() {
+		It("should record who launched and who aborted a TestRun", func() {
+			recorder := audit.NewRecorder(store)
+			Expect(recorder.Record(request(admissionv1.Create, "1"), testrun("abc"), nil)).To(Succeed())
+			Expect(recorder.Record(request(admissionv1.Delete, "2"), testrun("abc"), nil)).To(Succeed())
+
+			records, err := store.List(context.Background(), "default", "abc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(2))
+			Expect(records[0].Operation).To(Equal(audit.OperationCreate))
+			Expect(records[1].Operation).To(Equal(audit.OperationDelete))
+			for _, record := range records {
+				Expect(record.User).To(Equal("jane"))
+				Expect(record.Groups).To(Equal([]string{"testers"}))
+				Expect(record.Kind).To(Equal("TestRun"))
+				Expect(record.Name).To(Equal("testrun-abc"))
+				Expect(record.TestRun).To(Equal("abc"))
+				Expect(record.Time).NotTo(BeZero())
+			}
+		})
+
+		It("should record the changes of an update", func() {
+			recorder := audit.NewRecorder(store)
+			old := testrun("abc")
+			updated := testrun("abc")
+			updated.Spec.Debug = true
+			Expect(recorder.Record(request(admissionv1.Update, "1"), updated, old)).To(Succeed())
+
+			records, err := store.List(context.Background(), "default", "abc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].Changes).To(Equal([]string{"spec.debug: added true"}))
+		})
+
+		It("should not record updates without changes", func() {
+			recorder := audit.NewRecorder(store)
+			old := testrun("abc")
+			updated := testrun("abc")
+			updated.Finalizers = []string{"etos.eiffel-community.github.io/cleanup"}
+			Expect(recorder.Record(request(admissionv1.Update, "1"), updated, old)).To(Succeed())
+
+			records, err := store.List(context.Background(), "default", "abc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(BeEmpty())
+		})
+
+		It("should not record dry runs", func() {
+			recorder := audit.NewRecorder(store)
+			ctx := admission.NewContextWithRequest(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Create, DryRun: ptr.To(true)},
+			})
+			Expect(recorder.Record(ctx, testrun("abc"), nil)).To(Succeed())
+
+			records, err := store.List(context.Background(), "default", "abc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(BeEmpty())
+		})
+
+		It("should fail without an admission request", func() {
+			recorder := audit.NewRecorder(store)
+			Expect(recorder.Record(context.Background(), testrun("abc"), nil)).NotTo(Succeed())
+		})
+
+		It("should record nothing when nil", func() {
+			var recorder *audit.Recorder
+			Expect(recorder.Record(context.Background(), testrun("abc"), nil)).To(Succeed())
+		})
+	})
+
+	Describe("ConfigMapStore", func() {
+		record := func(uid string) audit.Record {
+			return audit.Record{
+				UID:       uid,
+				Time:      time.Now().UTC(),
+				User:      "jane",
+				Operation: audit.OperationCreate,
+				Kind:      "Iut",
+				Name:      "iut-" + uid,
+				Namespace: "default",
+				TestRun:   "abc",
+			}
+		}
+
+		It("should only append a record once", func() {
+			ctx := context.Background()
+			Expect(store.Append(ctx, "default", record("1"))).To(Succeed())
+			Expect(store.Append(ctx, "default", record("1"))).To(Succeed())
+
+			records, err := store.List(ctx, "default", "abc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(1))
+		})
+
+		It("should start a new chunk when a chunk is full", func() {
+			ctx := context.Background()
+			store.MaxChunkRecords = 2
+			for i := range 5 {
+				Expect(store.Append(ctx, "default", record(fmt.Sprint(i)))).To(Succeed())
+			}
+
+			var chunks corev1.ConfigMapList
+			Expect(cli.List(ctx, &chunks, client.MatchingLabels{"etos.eiffel-community.github.io/id": "abc"})).To(Succeed())
+			Expect(chunks.Items).To(HaveLen(3))
+			for _, chunk := range chunks.Items {
+				if chunk.Name == "etos-audit-abc-2" {
+					Expect(chunk.Immutable).To(BeNil())
+				} else {
+					Expect(chunk.Immutable).To(Equal(ptr.To(true)))
+				}
+			}
+
+			records, err := store.List(ctx, "default", "abc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(5))
+			for i, r := range records {
+				Expect(r.UID).To(Equal(fmt.Sprint(i)))
+			}
+		})
+
+		It("should store records without a TestRun separately", func() {
+			ctx := context.Background()
+			r := record("1")
+			r.TestRun = ""
+			Expect(store.Append(ctx, "default", r)).To(Succeed())
+
+			records, err := store.List(ctx, "default", "abc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(BeEmpty())
+			records, err = store.List(ctx, "default", "resources")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(1))
+		})
+
+		It("should store the chunks of all namespaces in the namespace of the store", func() {
+			ctx := context.Background()
+			store.Namespace = "etos-audit"
+			for _, namespace := range []string{"default", "team-b"} {
+				r := record(namespace)
+				r.TestRun = ""
+				r.Namespace = namespace
+				Expect(store.Append(ctx, namespace, r)).To(Succeed())
+			}
+
+			var chunks corev1.ConfigMapList
+			Expect(cli.List(ctx, &chunks, client.InNamespace("default"))).To(Succeed())
+			Expect(chunks.Items).To(BeEmpty())
+			Expect(cli.List(ctx, &chunks, client.InNamespace("etos-audit"))).To(Succeed())
+			var names []string
+			for _, chunk := range chunks.Items {
+				names = append(names, chunk.Name)
+			}
+			Expect(names).To(ConsistOf("etos-audit-default-resources-0", "etos-audit-team-b-resources-0"))
+
+			records, err := store.List(ctx, "team-b", "resources")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].Namespace).To(Equal("team-b"))
+		})
+	})
+
+	Describe("Changes", func() {
+		It("should summarize the changes of the spec, labels and annotations", func() {
+			old := testrun("abc")
+			old.Annotations = map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"}
+			updated := testrun("abc")
+			updated.Spec.Cluster = "other"
+			updated.Spec.Artifact = "artifact"
+			updated.Labels["team"] = "a"
+			updated.Annotations = map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{\"a\": 1}"}
+
+			changes, err := audit.Changes(old, updated)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(Equal([]string{
+				"metadata.labels.team: added \"a\"",
+				"spec.artifact: \"\" -> \"artifact\"",
+				"spec.cluster: \"etos\" -> \"other\"",
+			}))
+		})
+	})
+})
@@ -0,0 +1,140 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/eiffel-community/etos/pkg/redact"
+)
+
+// maxChanges is the number of changes that are summarized in a record.
+const maxChanges = 50
+
+// ignoredAnnotations are annotations that change without the resource changing.
+var ignoredAnnotations = []string{"kubectl.kubernetes.io/last-applied-configuration"}
+
+// Changes summarizes the changes of the spec, labels and annotations of a resource, one change per
+// changed field, I.e. `spec.debug: false -> true`. Lists are summarized as a whole and secrets are
+// redacted.
+func Changes(old, obj client.Object) ([]string, error) {
+	before, err := auditedFields(old)
+	if err != nil {
+		return nil, err
+	}
+	after, err := auditedFields(obj)
+	if err != nil {
+		return nil, err
+	}
+	var changes []string
+	diff("", before, after, &changes)
+	slices.Sort(changes)
+	if len(changes) > maxChanges {
+		more := len(changes) - maxChanges
+		changes = append(changes[:maxChanges], fmt.Sprintf("... and %d more", more))
+	}
+	return changes, nil
+}
+
+// auditedFields returns the fields of a resource whose changes are audited.
+func auditedFields(obj client.Object) (map[string]any, error) {
+	if obj == nil || reflect.ValueOf(obj).IsNil() {
+		return map[string]any{}, nil
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", obj.GetName(), err)
+	}
+	var fields struct {
+		Metadata struct {
+			Labels      map[string]any `json:"labels"`
+			Annotations map[string]any `json:"annotations"`
+		} `json:"metadata"`
+		Spec any `json:"spec"`
+	}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", obj.GetName(), err)
+	}
+	for _, annotation := range ignoredAnnotations {
+		delete(fields.Metadata.Annotations, annotation)
+	}
+	return map[string]any{
+		"metadata.labels":      fields.Metadata.Labels,
+		"metadata.annotations": fields.Metadata.Annotations,
+		"spec":                 fields.Spec,
+	}, nil
+}
+
+// diff appends the changes between two decoded JSON values at path to changes.
+func diff(path string, before, after any, changes *[]string) {
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+	beforeMap, beforeIsMap := before.(map[string]any)
+	afterMap, afterIsMap := after.(map[string]any)
+	if (beforeIsMap || before == nil) && (afterIsMap || after == nil) && (beforeIsMap || afterIsMap) {
+		for key, value := range afterMap {
+			diff(join(path, key), beforeMap[key], value, changes)
+		}
+		for key, value := range beforeMap {
+			if _, ok := afterMap[key]; !ok {
+				diff(join(path, key), value, nil, changes)
+			}
+		}
+		return
+	}
+	switch {
+	case before == nil:
+		*changes = append(*changes, fmt.Sprintf("%s: added %s", path, summarize(path, after)))
+	case after == nil:
+		*changes = append(*changes, fmt.Sprintf("%s: removed", path))
+	default:
+		*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, summarize(path, before), summarize(path, after)))
+	}
+}
+
+// join joins a path and a key.
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// summarize returns a short description of a value, with secrets redacted.
+func summarize(path string, value any) string {
+	keys := strings.Split(path, ".")
+	if redact.Default().Key(keys[len(keys)-1]) {
+		return redact.Replacement
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		return fmt.Sprintf("object with %d fields", len(v))
+	case []any:
+		return fmt.Sprintf("list of %d items", len(v))
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return redact.String(string(b))
+}
@@ -0,0 +1,236 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// auditLabel is the label of the ConfigMaps of the audit trail, with the subject of the records
+	// as value, which is the ID of a TestRun or resourcesSubject.
+	auditLabel = "etos.eiffel-community.github.io/audit"
+	// chunkLabel is the label with the index of a chunk of the audit trail of a subject.
+	chunkLabel = "etos.eiffel-community.github.io/audit-chunk"
+	// namespaceLabel is the label with the namespace of the resources of the records, on the chunks
+	// that are stored in the namespace of the ConfigMapStore.
+	namespaceLabel = "etos.eiffel-community.github.io/audit-namespace"
+	// resourcesSubject is the subject of records of resources that do not belong to a TestRun, I.e.
+	// Providers.
+	resourcesSubject = "resources"
+)
+
+const (
+	// DefaultMaxChunkSize is the size, in bytes, of the records in a chunk of the audit trail before a
+	// new chunk is started. ConfigMaps are limited to 1MiB.
+	DefaultMaxChunkSize = 512 * 1024
+	// DefaultMaxChunkRecords is the number of records in a chunk of the audit trail before a new chunk
+	// is started.
+	DefaultMaxChunkRecords = 1000
+)
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;create;update
+
+// ConfigMapStore stores the audit trail in chunks of ConfigMaps, one chain of chunks per TestRun.
+//
+// Records are only ever added to the last chunk of a TestRun, and chunks are made immutable when
+// they are full, so records cannot be changed through ETOS. The chunks are not owned by the TestRun
+// and are kept when the TestRun is deleted.
+//
+// Anyone who may update or delete ConfigMaps where the chunks are stored may change the audit trail.
+// By default the chunks are stored in the namespace of the resources, which users with ConfigMap
+// rights in that namespace can modify. Set Namespace to store them in a namespace that only the
+// controller manager and the administrators of the cluster have access to.
+type ConfigMapStore struct {
+	reader client.Reader
+	writer client.Writer
+
+	// Namespace is the namespace that the chunks are stored in. If empty, the chunks are stored in
+	// the namespace of the resources of the records.
+	Namespace string
+
+	// MaxChunkSize is the size, in bytes, of the records in a chunk before a new chunk is started.
+	MaxChunkSize int
+	// MaxChunkRecords is the number of records in a chunk before a new chunk is started.
+	MaxChunkRecords int
+}
+
+// NewConfigMapStore creates a ConfigMapStore. Chunks are read with reader, which shall not be a
+// cached client, since records are appended with optimistic concurrency.
+func NewConfigMapStore(reader client.Reader, writer client.Writer) *ConfigMapStore {
+	return &ConfigMapStore{
+		reader:          reader,
+		writer:          writer,
+		MaxChunkSize:    DefaultMaxChunkSize,
+		MaxChunkRecords: DefaultMaxChunkRecords,
+	}
+}
+
+// Append appends a record to the last chunk of the TestRun of the record, starting a new chunk if
+// the last chunk is full. A record is only appended once, if the same admission request is audited
+// again.
+func (s *ConfigMapStore) Append(ctx context.Context, namespace string, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	subject := record.TestRun
+	if subject == "" {
+		subject = resourcesSubject
+	}
+	retriable := func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}
+	return retry.OnError(retry.DefaultRetry, retriable, func() error {
+		chunks, err := s.chunks(ctx, namespace, subject)
+		if err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return s.writer.Create(ctx, s.newChunk(namespace, subject, record.TestRun, 0, data))
+		}
+		last := chunks[len(chunks)-1]
+		if contains(last, record.UID) {
+			return nil
+		}
+		if !s.full(last, data) {
+			last.Data[key(len(last.Data))] = string(data)
+			return s.writer.Update(ctx, &last)
+		}
+		if last.Immutable == nil || !*last.Immutable {
+			immutable := true
+			last.Immutable = &immutable
+			if err := s.writer.Update(ctx, &last); err != nil {
+				return err
+			}
+		}
+		return s.writer.Create(ctx, s.newChunk(namespace, subject, record.TestRun, index(last)+1, data))
+	})
+}
+
+// List lists the records of a TestRun, oldest first.
+func (s *ConfigMapStore) List(ctx context.Context, namespace, testrun string) ([]Record, error) {
+	chunks, err := s.chunks(ctx, namespace, testrun)
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, chunk := range chunks {
+		for i := range len(chunk.Data) {
+			var record Record
+			if err := json.Unmarshal([]byte(chunk.Data[key(i)]), &record); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal audit record %d of %s: %w", i, chunk.Name, err)
+			}
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// chunks lists the chunks of a subject of a namespace, in order.
+func (s *ConfigMapStore) chunks(ctx context.Context, namespace, subject string) ([]corev1.ConfigMap, error) {
+	labels := client.MatchingLabels{auditLabel: subject}
+	if s.Namespace != "" {
+		labels[namespaceLabel] = namespace
+		namespace = s.Namespace
+	}
+	var configMaps corev1.ConfigMapList
+	if err := s.reader.List(ctx, &configMaps, client.InNamespace(namespace), labels); err != nil {
+		return nil, fmt.Errorf("failed to list the audit trail: %w", err)
+	}
+	chunks := configMaps.Items
+	slices.SortFunc(chunks, func(a, b corev1.ConfigMap) int { return index(a) - index(b) })
+	return chunks, nil
+}
+
+// newChunk creates a chunk of the audit trail of a subject with a first record.
+func (s *ConfigMapStore) newChunk(namespace, subject, testrun string, index int, record []byte) *corev1.ConfigMap {
+	labels := map[string]string{
+		auditLabel:                  subject,
+		chunkLabel:                  strconv.Itoa(index),
+		"app.kubernetes.io/name":    "audit",
+		"app.kubernetes.io/part-of": "etos",
+	}
+	if testrun != "" {
+		labels[idLabel] = testrun
+	}
+	name := fmt.Sprintf("etos-audit-%s-%d", subject, index)
+	if s.Namespace != "" {
+		// The chunks of subjects of all namespaces are stored together, I.e. those of Providers.
+		labels[namespaceLabel] = namespace
+		name = fmt.Sprintf("etos-audit-%s-%s-%d", namespace, subject, index)
+		namespace = s.Namespace
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Data: map[string]string{key(0): string(record)},
+	}
+}
+
+// full returns whether a record does not fit in a chunk.
+func (s *ConfigMapStore) full(chunk corev1.ConfigMap, record []byte) bool {
+	if chunk.Immutable != nil && *chunk.Immutable {
+		return true
+	}
+	if len(chunk.Data) >= s.MaxChunkRecords {
+		return true
+	}
+	size := len(record)
+	for _, value := range chunk.Data {
+		size += len(value)
+	}
+	return size > s.MaxChunkSize
+}
+
+// contains returns whether a chunk contains the record of an admission request.
+func contains(chunk corev1.ConfigMap, uid string) bool {
+	if uid == "" {
+		return false
+	}
+	for _, value := range chunk.Data {
+		var record Record
+		if json.Unmarshal([]byte(value), &record) == nil && record.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// index returns the index of a chunk.
+func index(chunk corev1.ConfigMap) int {
+	i, _ := strconv.Atoi(chunk.Labels[chunkLabel])
+	return i
+}
+
+// key returns the key of the record at position i in a chunk, which sorts in the order of the
+// records.
+func key(i int) string {
+	return fmt.Sprintf("%06d", i)
+}
@@ -0,0 +1,359 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/internal/controller/status"
+	"github.com/eiffel-community/etos/internal/release"
+)
+
+// batchReleaseAnnotation is set on the resources that an Environment, which is deleted on its own, has
+// handed over to be released in batches. The value is the name of the Environment.
+const batchReleaseAnnotation = "etos.eiffel-community.github.io/batch-release"
+
+// batchable returns true if the resources of a provider are released in batches. This requires that the
+// provider runs its releases in jobs and that its image releases every resource it is given.
+func batchable(provider *etosv1alpha1.Provider) bool {
+	return provider.Spec.API == "" && provider.Spec.BatchRelease
+}
+
+// awaitsBatchRelease returns true if a resource will be released in a batch by its EnvironmentRequest, or
+// by the Environment that handed it over, instead of in a release job of its own. This is the case when
+// the EnvironmentRequest, or the Environment, is being deleted and the provider of the resource is batchable.
+func (s standaloneResource) awaitsBatchRelease(ctx context.Context, c client.Reader) (bool, error) {
+	provider, err := getProvider(ctx, c, s.provider, s.obj.GetNamespace())
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	if !batchable(provider) {
+		return false, nil
+	}
+	if name := s.obj.GetAnnotations()[batchReleaseAnnotation]; name != "" {
+		environment := &etosv1alpha1.Environment{}
+		err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: s.obj.GetNamespace()}, environment)
+		if err == nil && !environment.DeletionTimestamp.IsZero() {
+			return true, nil
+		}
+		if client.IgnoreNotFound(err) != nil {
+			return false, err
+		}
+	}
+	environmentrequest := &etosv1alpha1.EnvironmentRequest{}
+	if err := c.Get(ctx, types.NamespacedName{Name: s.environmentRequest, Namespace: s.obj.GetNamespace()}, environmentrequest); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return !environmentrequest.DeletionTimestamp.IsZero(), nil
+}
+
+// releasable returns true if a resource is waiting to be released and is not already being released.
+func (s standaloneResource) releasable(ctx context.Context, c client.Reader) (bool, error) {
+	if s.obj.GetDeletionTimestamp().IsZero() || !controllerutil.ContainsFinalizer(s.obj, providerFinalizer) {
+		return false, nil
+	}
+	if *s.completionTime != nil || retrying(*s.release) {
+		return false, nil
+	}
+	if isStatusReason(*s.conditions, status.StatusActive, status.ReasonFailed) ||
+		isStatusReason(*s.conditions, status.StatusActive, status.ReasonLeaked) {
+		return false, nil
+	}
+	var releaseJobs batchv1.JobList
+	if err := c.List(ctx, &releaseJobs, client.InNamespace(s.obj.GetNamespace()), client.MatchingFields{s.ownerKey: s.obj.GetName()}); err != nil {
+		return false, err
+	}
+	return len(releaseJobs.Items) == 0, nil
+}
+
+// standaloneResources returns the IUTs, execution spaces and log areas that were provisioned for an
+// EnvironmentRequest but are not owned by an Environment.
+func standaloneResources(ctx context.Context, c client.Reader, environmentrequest *etosv1alpha1.EnvironmentRequest) ([]standaloneResource, error) {
+	return environmentRequestResources(ctx, c, environmentrequest, false)
+}
+
+// environmentRequestResources returns the IUTs, execution spaces and log areas that were provisioned for
+// an EnvironmentRequest and that are, or are not, owned by an Environment.
+func environmentRequestResources(
+	ctx context.Context,
+	c client.Reader,
+	environmentrequest *etosv1alpha1.EnvironmentRequest,
+	ownedByEnvironments bool,
+) ([]standaloneResource, error) {
+	namespace := client.InNamespace(environmentrequest.Namespace)
+	var resources []standaloneResource
+	var iuts etosv1alpha2.IutList
+	if err := c.List(ctx, &iuts, namespace); err != nil {
+		return nil, err
+	}
+	for i, iut := range iuts.Items {
+		if iut.Spec.EnvironmentRequest == environmentrequest.Name && ownedByEnvironment(iut.OwnerReferences) == ownedByEnvironments {
+			resources = append(resources, standaloneIut(&iuts.Items[i]))
+		}
+	}
+	var executionSpaces etosv1alpha2.ExecutionSpaceList
+	if err := c.List(ctx, &executionSpaces, namespace); err != nil {
+		return nil, err
+	}
+	for i, executionSpace := range executionSpaces.Items {
+		if executionSpace.Spec.EnvironmentRequest == environmentrequest.Name &&
+			ownedByEnvironment(executionSpace.OwnerReferences) == ownedByEnvironments {
+			resources = append(resources, standaloneExecutionSpace(&executionSpaces.Items[i]))
+		}
+	}
+	var logAreas etosv1alpha2.LogAreaList
+	if err := c.List(ctx, &logAreas, namespace); err != nil {
+		return nil, err
+	}
+	for i, logArea := range logAreas.Items {
+		if logArea.Spec.EnvironmentRequest == environmentrequest.Name && ownedByEnvironment(logArea.OwnerReferences) == ownedByEnvironments {
+			resources = append(resources, standaloneLogArea(&logAreas.Items[i]))
+		}
+	}
+	return resources, nil
+}
+
+// adoptEnvironmentResources hands the IUTs, execution spaces and log areas of the Environments of an
+// EnvironmentRequest over to their own controllers, before the Environments are deleted. They are then
+// released in batches together with the standalone resources of the EnvironmentRequest, instead of one
+// Environment at a time.
+//
+// The resources of Environments that are already being deleted are released with their Environments.
+func adoptEnvironmentResources(ctx context.Context, c client.Client, environmentrequest *etosv1alpha1.EnvironmentRequest) error {
+	logger := logf.FromContext(ctx)
+	resources, err := environmentRequestResources(ctx, c, environmentrequest, true)
+	if err != nil {
+		return err
+	}
+	var allErr error
+	for _, resource := range resources {
+		references := resource.obj.GetOwnerReferences()
+		index := slices.IndexFunc(references, func(reference metav1.OwnerReference) bool {
+			return reference.Kind == "Environment"
+		})
+		environment := &etosv1alpha1.Environment{}
+		if err := c.Get(ctx, types.NamespacedName{Name: references[index].Name, Namespace: environmentrequest.Namespace}, environment); err != nil {
+			allErr = errors.Join(allErr, client.IgnoreNotFound(err))
+			continue
+		}
+		if !environment.DeletionTimestamp.IsZero() {
+			continue
+		}
+		logger.Info("Adopting resource from Environment", "kind", resource.kind, "name", resource.obj.GetName(), "environment", environment.Name)
+		resource.obj.SetOwnerReferences(slices.Delete(references, index, index+1))
+		controllerutil.AddFinalizer(resource.obj, providerFinalizer)
+		if err := c.Update(ctx, resource.obj); err != nil {
+			allErr = errors.Join(allErr, client.IgnoreNotFound(err))
+		}
+	}
+	return allErr
+}
+
+// releaseEnvironmentInBatches releases the resources of an Environment that is deleted on its own in
+// batches, like releaseInBatches does for an EnvironmentRequest. The resources of batchable providers are
+// handed over to their own controllers, with the batchReleaseAnnotation, and the resources of other
+// providers are released with the Environment.
+//
+// Returns the number of handed over resources that are left to release.
+func releaseEnvironmentInBatches(
+	ctx context.Context,
+	c client.Client,
+	scheme *runtime.Scheme,
+	environmentrequest *etosv1alpha1.EnvironmentRequest,
+	environment *etosv1alpha1.Environment,
+) (int, error) {
+	logger := logf.FromContext(ctx)
+	owned, err := environmentRequestResources(ctx, c, environmentrequest, true)
+	if err != nil {
+		return -1, err
+	}
+	var allErr error
+	adopted := 0
+	for _, resource := range owned {
+		references := resource.obj.GetOwnerReferences()
+		index := slices.IndexFunc(references, func(reference metav1.OwnerReference) bool {
+			return reference.Kind == "Environment" && reference.Name == environment.Name
+		})
+		if index < 0 {
+			continue
+		}
+		provider, err := getProvider(ctx, c, resource.provider, environment.Namespace)
+		if err != nil {
+			allErr = errors.Join(allErr, client.IgnoreNotFound(err))
+			continue
+		}
+		if !batchable(provider) {
+			continue
+		}
+		logger.Info("Adopting resource from Environment", "kind", resource.kind, "name", resource.obj.GetName(), "environment", environment.Name)
+		resource.obj.SetOwnerReferences(slices.Delete(references, index, index+1))
+		controllerutil.AddFinalizer(resource.obj, providerFinalizer)
+		annotations := resource.obj.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[batchReleaseAnnotation] = environment.Name
+		resource.obj.SetAnnotations(annotations)
+		if err := c.Update(ctx, resource.obj); err != nil {
+			allErr = errors.Join(allErr, client.IgnoreNotFound(err))
+			continue
+		}
+		adopted++
+	}
+	if allErr != nil {
+		return -1, allErr
+	}
+	standalone, err := standaloneResources(ctx, c, environmentrequest)
+	if err != nil {
+		return -1, err
+	}
+	var resources []standaloneResource
+	for _, resource := range standalone {
+		if resource.obj.GetAnnotations()[batchReleaseAnnotation] == environment.Name {
+			resources = append(resources, resource)
+		}
+	}
+	remaining, err := releaseResourcesInBatches(ctx, c, scheme, environmentrequest, resources)
+	if err != nil {
+		return -1, err
+	}
+	// Resources adopted in this call may not be listed yet.
+	return max(remaining, adopted), nil
+}
+
+// releaseInBatches deletes the standalone resources of an EnvironmentRequest and releases them with one
+// release job for each provider, instead of one release job for each resource.
+//
+// The batch job is owned by all resources in it, the controllers of the resources read their results
+// from it just like from their own release jobs. Resources of providers that are not batchable are
+// released by their controllers, as are resources whose release is retried after the EnvironmentRequest
+// is gone.
+//
+// Returns the number of resources that are left to release. Resources that have failed or leaked are
+// not counted, they are kept until an administrator force-finalizes them.
+func releaseInBatches(ctx context.Context, c client.Client, scheme *runtime.Scheme, environmentrequest *etosv1alpha1.EnvironmentRequest) (int, error) {
+	resources, err := standaloneResources(ctx, c, environmentrequest)
+	if err != nil {
+		return -1, err
+	}
+	return releaseResourcesInBatches(ctx, c, scheme, environmentrequest, resources)
+}
+
+// releaseResourcesInBatches deletes resources of an EnvironmentRequest and releases those of batchable
+// providers with one release job for each provider. The resources of other providers are released by
+// their controllers, one release job for each resource.
+//
+// Returns the number of resources that are left to release.
+func releaseResourcesInBatches(
+	ctx context.Context,
+	c client.Client,
+	scheme *runtime.Scheme,
+	environmentrequest *etosv1alpha1.EnvironmentRequest,
+	resources []standaloneResource,
+) (int, error) {
+	logger := logf.FromContext(ctx)
+	var allErr error
+	remaining := 0
+	batches := make(map[string][]standaloneResource)
+	for _, resource := range resources {
+		if isStatusReason(*resource.conditions, status.StatusActive, status.ReasonFailed) ||
+			isStatusReason(*resource.conditions, status.StatusActive, status.ReasonLeaked) {
+			continue
+		}
+		remaining++
+		if resource.obj.GetDeletionTimestamp().IsZero() {
+			if err := c.Delete(ctx, resource.obj); err != nil && !apierrors.IsNotFound(err) {
+				allErr = errors.Join(allErr, err)
+			}
+			continue
+		}
+		releasable, err := resource.releasable(ctx, c)
+		if err != nil {
+			allErr = errors.Join(allErr, err)
+			continue
+		}
+		if releasable {
+			key := fmt.Sprintf("%s/%s", resource.kind, resource.provider)
+			batches[key] = append(batches[key], resource)
+		}
+	}
+	for _, batch := range batches {
+		provider, err := getProvider(ctx, c, batch[0].provider, environmentrequest.Namespace)
+		if err != nil {
+			// Orphaned resources are reaped by their controllers.
+			allErr = errors.Join(allErr, client.IgnoreNotFound(err))
+			continue
+		}
+		if !batchable(provider) {
+			continue
+		}
+		job, err := batchReleaseJob(scheme, environmentrequest, provider, batch)
+		if err != nil {
+			allErr = errors.Join(allErr, err)
+			continue
+		}
+		logger.Info("Releasing resources in a batch", "job", job.Name, "provider", provider.Name, "resources", len(batch))
+		jobs.InjectTraceContext(ctx, job)
+		if err := c.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+			allErr = errors.Join(allErr, err)
+		}
+	}
+	return remaining, allErr
+}
+
+// batchReleaseJob returns a job that releases a batch of resources of the same kind and provider.
+//
+// The name of the job is derived from the names of the resources, so that the same batch is never
+// created twice.
+func batchReleaseJob(scheme *runtime.Scheme, environmentrequest *etosv1alpha1.EnvironmentRequest, provider *etosv1alpha1.Provider, batch []standaloneResource) (*batchv1.Job, error) {
+	names := make([]string, 0, len(batch))
+	for _, resource := range batch {
+		names = append(names, resource.obj.GetName())
+	}
+	slices.Sort(names)
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(strings.Join(names, ",")))
+	jobName := fmt.Sprintf("%s-release-%08x", strings.ToLower(batch[0].kind), hash.Sum32())
+
+	job, err := release.BatchReleaser(jobName, batch[0].releaserName, names, environmentrequest.Namespace, environmentrequest, provider)
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range batch {
+		if err := controllerutil.SetOwnerReference(resource.obj, job, scheme); err != nil {
+			return nil, err
+		}
+	}
+	return job, nil
+}
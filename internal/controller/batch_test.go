@@ -0,0 +1,284 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controller
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/internal/release"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+var _ = Describe("Batch release", func() {
+	const namespace = "default"
+	var (
+		ctx                context.Context
+		cli                client.Client
+		environmentrequest *etosv1alpha1.EnvironmentRequest
+	)
+
+	// newIut creates an IUT for the EnvironmentRequest, owned by the owners.
+	newIut := func(name string, owners ...metav1.OwnerReference) *etosv1alpha2.Iut {
+		iut := &etosv1alpha2.Iut{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       namespace,
+				UID:             types.UID(uuid.NewString()),
+				Finalizers:      []string{providerFinalizer},
+				OwnerReferences: owners,
+			},
+			Spec: etosv1alpha2.IutSpec{
+				ID:                 uuid.NewString(),
+				EnvironmentRequest: environmentrequest.Name,
+				ProviderID:         "iut-provider",
+			},
+		}
+		Expect(cli.Create(ctx, iut)).To(Succeed())
+		return iut
+	}
+
+	// releaseJobs returns the release jobs that an IUT is an owner of.
+	releaseJobs := func(iut *etosv1alpha2.Iut) []batchv1.Job {
+		var releaseJobs batchv1.JobList
+		Expect(cli.List(ctx, &releaseJobs, client.MatchingFields{IutOwnerKey: iut.Name})).To(Succeed())
+		return releaseJobs.Items
+	}
+
+	// finish makes a release job fail with a termination-log message, as a releaser does.
+	finish := func(job *batchv1.Job, message string) {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+		Expect(cli.Status().Update(ctx, job)).To(Succeed())
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: job.Name, Namespace: namespace, Labels: map[string]string{"job-name": job.Name}},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  release.IutReleaserName,
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}},
+			}}},
+		}
+		Expect(cli.Create(ctx, pod)).To(Succeed())
+	}
+
+	// owner returns an owner reference to an Environment.
+	owner := func(environment *etosv1alpha1.Environment) metav1.OwnerReference {
+		return metav1.OwnerReference{
+			APIVersion: etosv1alpha1.GroupVersion.String(),
+			Kind:       "Environment",
+			Name:       environment.Name,
+			UID:        environment.UID,
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		provider := providertest.NewProvider("iut-provider", namespace, "iut").WithImage("iut-provider:latest").Build()
+		provider.Spec.BatchRelease = true
+		cli = fake.NewClientBuilder().
+			WithScheme(providertest.NewFakeClient().Scheme()).
+			WithStatusSubresource(&etosv1alpha1.EnvironmentRequest{}, &etosv1alpha2.Iut{}, &batchv1.Job{}).
+			WithIndex(&batchv1.Job{}, IutOwnerKey, func(obj client.Object) []string {
+				var owners []string
+				for _, owner := range obj.GetOwnerReferences() {
+					if owner.Kind == "Iut" {
+						owners = append(owners, owner.Name)
+					}
+				}
+				return owners
+			}).
+			WithObjects(provider).
+			Build()
+		environmentrequest = providertest.NewEnvironmentRequest("environment-request", namespace).Build()
+		environmentrequest.Finalizers = []string{releaseFinalizer}
+		Expect(cli.Create(ctx, environmentrequest)).To(Succeed())
+		Expect(cli.Delete(ctx, environmentrequest)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(environmentrequest), environmentrequest)).To(Succeed())
+	})
+
+	It("should release the resources of a provider in one job", func() {
+		iutA := newIut("iut-a")
+		iutB := newIut("iut-b")
+
+		By("deleting the resources")
+		remaining, err := releaseInBatches(ctx, cli, cli.Scheme(), environmentrequest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(Equal(2))
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iutA), iutA)).To(Succeed())
+		Expect(iutA.DeletionTimestamp.IsZero()).To(BeFalse())
+		Expect(releaseJobs(iutA)).To(BeEmpty())
+
+		By("releasing the deleted resources in a batch")
+		remaining, err = releaseInBatches(ctx, cli, cli.Scheme(), environmentrequest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(Equal(2))
+		Expect(releaseJobs(iutA)).To(HaveLen(1))
+		Expect(releaseJobs(iutB)).To(Equal(releaseJobs(iutA)))
+		job := releaseJobs(iutA)[0]
+		Expect(job.Spec.Template.Spec.Containers[0].Args).To(ContainElements("-name=iut-a", "-name=iut-b"))
+
+		By("not creating the batch again")
+		_, err = releaseInBatches(ctx, cli, cli.Scheme(), environmentrequest)
+		Expect(err).NotTo(HaveOccurred())
+		var all batchv1.JobList
+		Expect(cli.List(ctx, &all)).To(Succeed())
+		Expect(all.Items).To(HaveLen(1))
+	})
+
+	It("should give each owner of a shared job its own result", func() {
+		iutA := newIut("iut-a")
+		iutB := newIut("iut-b")
+		Expect(cli.Delete(ctx, iutA)).To(Succeed())
+		Expect(cli.Delete(ctx, iutB)).To(Succeed())
+		_, err := releaseInBatches(ctx, cli, cli.Scheme(), environmentrequest)
+		Expect(err).NotTo(HaveOccurred())
+		job := releaseJobs(iutA)[0]
+		message, err := json.Marshal(jobs.Result{
+			Conclusion:      jobs.ConclusionFailed,
+			Description:     "Failed to release 1 Iut resources",
+			FailedResources: map[string]string{"iut-b": "iut is busy"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		finish(&job, string(message))
+
+		jobA := jobs.NewSharedJob(cli, IutOwnerKey, iutA)
+		Expect(jobA.Status(ctx)).To(Equal(jobs.StatusFailed))
+		Expect(jobA.Result(ctx, release.IutReleaserName).Conclusion).To(Equal(jobs.ConclusionSuccessful))
+		jobB := jobs.NewSharedJob(cli, IutOwnerKey, iutB)
+		Expect(jobB.Status(ctx)).To(Equal(jobs.StatusFailed))
+		resultB := jobB.Result(ctx, release.IutReleaserName)
+		Expect(resultB.Conclusion).To(Equal(jobs.ConclusionFailed))
+		Expect(resultB.Description).To(Equal("iut is busy"))
+
+		By("removing an owner from the job until the last owner deletes it")
+		Expect(jobA.Delete(ctx)).To(Succeed())
+		Expect(releaseJobs(iutA)).To(BeEmpty())
+		Expect(releaseJobs(iutB)).To(HaveLen(1))
+		Expect(jobB.Status(ctx)).To(Equal(jobs.StatusFailed))
+		Expect(jobB.Delete(ctx)).To(Succeed())
+		Expect(apierrors.IsNotFound(cli.Get(ctx, client.ObjectKeyFromObject(&job), &job))).To(BeTrue())
+	})
+
+	It("should fail every owner of a failed shared job without failed resources", func() {
+		iutA := newIut("iut-a")
+		iutB := newIut("iut-b")
+		Expect(cli.Delete(ctx, iutA)).To(Succeed())
+		Expect(cli.Delete(ctx, iutB)).To(Succeed())
+		_, err := releaseInBatches(ctx, cli, cli.Scheme(), environmentrequest)
+		Expect(err).NotTo(HaveOccurred())
+		job := releaseJobs(iutA)[0]
+		finish(&job, `{"conclusion":"Failed","description":"Failed to rel`)
+
+		for _, iut := range []*etosv1alpha2.Iut{iutA, iutB} {
+			shared := jobs.NewSharedJob(cli, IutOwnerKey, iut)
+			Expect(shared.Status(ctx)).To(Equal(jobs.StatusFailed))
+			Expect(shared.Result(ctx, release.IutReleaserName).Conclusion).To(Equal(jobs.ConclusionFailed))
+		}
+	})
+
+	It("should release the resources of a provider without batch release in jobs of their own", func() {
+		provider, err := getProvider(ctx, cli, "iut-provider", namespace)
+		Expect(err).NotTo(HaveOccurred())
+		provider.Spec.BatchRelease = false
+		Expect(cli.Update(ctx, provider)).To(Succeed())
+		iut := newIut("iut")
+		Expect(cli.Delete(ctx, iut)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+
+		remaining, err := releaseInBatches(ctx, cli, cli.Scheme(), environmentrequest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(Equal(1))
+		Expect(releaseJobs(iut)).To(BeEmpty())
+		Expect(standaloneIut(iut).awaitsBatchRelease(ctx, cli)).To(BeFalse())
+
+		By("refusing to pass several names to the image of the provider")
+		_, err = release.BatchReleaser("batch", release.IutReleaserName, []string{"iut-a", "iut-b"}, namespace, environmentrequest, provider)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should release the resources of an environment that is deleted on its own in batches", func() {
+		environment := &etosv1alpha1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "environment", Namespace: namespace, Finalizers: []string{releaseFinalizer}},
+		}
+		Expect(cli.Create(ctx, environment)).To(Succeed())
+		Expect(cli.Delete(ctx, environment)).To(Succeed())
+		other := &etosv1alpha1.Environment{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: namespace}}
+		Expect(cli.Create(ctx, other)).To(Succeed())
+		iutA := newIut("iut-a", owner(environment))
+		iutB := newIut("iut-b", owner(environment))
+		kept := newIut("kept", owner(other))
+
+		By("adopting and deleting the resources of the environment")
+		remaining, err := releaseEnvironmentInBatches(ctx, cli, cli.Scheme(), environmentrequest, environment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(Equal(2))
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iutA), iutA)).To(Succeed())
+		Expect(ownedByEnvironment(iutA.OwnerReferences)).To(BeFalse())
+		Expect(iutA.Annotations).To(HaveKeyWithValue(batchReleaseAnnotation, environment.Name))
+		Expect(iutA.DeletionTimestamp.IsZero()).To(BeFalse())
+		Expect(standaloneIut(iutA).awaitsBatchRelease(ctx, cli)).To(BeTrue())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(kept), kept)).To(Succeed())
+		Expect(ownedByEnvironment(kept.OwnerReferences)).To(BeTrue())
+		Expect(kept.DeletionTimestamp.IsZero()).To(BeTrue())
+
+		By("releasing the deleted resources in a batch")
+		remaining, err = releaseEnvironmentInBatches(ctx, cli, cli.Scheme(), environmentrequest, environment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(Equal(2))
+		Expect(releaseJobs(iutA)).To(HaveLen(1))
+		Expect(releaseJobs(iutB)).To(Equal(releaseJobs(iutA)))
+		Expect(releaseJobs(iutA)[0].Spec.Template.Spec.Containers[0].Args).To(ContainElements("-name=iut-a", "-name=iut-b"))
+	})
+
+	It("should adopt the resources of environments that are not being deleted", func() {
+		active := &etosv1alpha1.Environment{ObjectMeta: metav1.ObjectMeta{Name: "active", Namespace: namespace}}
+		Expect(cli.Create(ctx, active)).To(Succeed())
+		deleting := &etosv1alpha1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "deleting", Namespace: namespace, Finalizers: []string{releaseFinalizer}},
+		}
+		Expect(cli.Create(ctx, deleting)).To(Succeed())
+		Expect(cli.Delete(ctx, deleting)).To(Succeed())
+		adopted := newIut("adopted", owner(active))
+		controllerutil.RemoveFinalizer(adopted, providerFinalizer)
+		Expect(cli.Update(ctx, adopted)).To(Succeed())
+		kept := newIut("kept", owner(deleting))
+
+		Expect(adoptEnvironmentResources(ctx, cli, environmentrequest)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(adopted), adopted)).To(Succeed())
+		Expect(ownedByEnvironment(adopted.OwnerReferences)).To(BeFalse())
+		Expect(controllerutil.ContainsFinalizer(adopted, providerFinalizer)).To(BeTrue())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(kept), kept)).To(Succeed())
+		Expect(ownedByEnvironment(kept.OwnerReferences)).To(BeTrue())
+
+		resources, err := standaloneResources(ctx, cli, environmentrequest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resources).To(HaveLen(1))
+		Expect(resources[0].obj.GetName()).To(Equal("adopted"))
+	})
+})
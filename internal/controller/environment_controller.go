@@ -30,12 +30,14 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
 	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
 	"github.com/eiffel-community/etos/internal/controller/jobs"
 	"github.com/eiffel-community/etos/internal/controller/status"
 )
@@ -43,7 +45,8 @@ import (
 // EnvironmentReconciler reconciles a Environment object
 type EnvironmentReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder events.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=environments,verbs=get;list;watch;create;update;patch;delete
@@ -51,6 +54,7 @@ type EnvironmentReconciler struct {
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=environments/finalizers,verbs=update
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=providers,verbs=get
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=providers/status,verbs=get
+// +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=iuts;executionspaces;logareas,verbs=get;list;watch;update;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -66,6 +70,10 @@ func (r *EnvironmentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	// An administrator can remove an environment that cannot be released, e.g. after it has leaked.
+	if finalized, err := forceFinalize(ctx, r.Client, r.Recorder, environment, releaseFinalizer); finalized || err != nil {
+		return expiryResult(0, err)
+	}
 	// If the environment is considered 'Completed', it has been released. Check that the object is
 	// being deleted and contains the finalizer and remove the finalizer.
 	if environment.Status.CompletionTime != nil {
@@ -83,7 +91,8 @@ func (r *EnvironmentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
-	if err := r.reconcile(ctx, environment); err != nil {
+	retryAfter, err := r.reconcile(ctx, environment)
+	if err != nil {
 		if apierrors.IsConflict(err) {
 			logger.Error(err, "Environment reconciliation conflict, requeueing")
 			return ctrl.Result{Requeue: true}, nil
@@ -91,10 +100,22 @@ func (r *EnvironmentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		logger.Error(err, "Environment reconciliation failed")
 		return ctrl.Result{}, err
 	}
+	// Retry a failed release when its backoff has passed, or check on resources that are released in batches.
+	if retryAfter > 0 {
+		return ctrl.Result{RequeueAfter: retryAfter}, nil
+	}
 
 	// Check deadline and delete if exceeded
 	if environment.Spec.Deadline != 0 && environment.DeletionTimestamp.IsZero() {
 		convertedDeadline := time.Unix(environment.Spec.Deadline, 0)
+		// The deadline defers to the leases of the resources, they release the environment when they lapse.
+		lease, err := environmentLeaseRemaining(ctx, r, environment)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if lease > 0 {
+			return ctrl.Result{RequeueAfter: lease}, nil
+		}
 		if time.Now().After(convertedDeadline) {
 			logger.Info("Environment deadline exceeded, deleting environment", "deadline", convertedDeadline)
 			if meta.SetStatusCondition(&environment.Status.Conditions,
@@ -118,7 +139,7 @@ func (r *EnvironmentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 }
 
 // reconcile an environment resource to its desired state.
-func (r *EnvironmentReconciler) reconcile(ctx context.Context, environment *etosv1alpha1.Environment) error {
+func (r *EnvironmentReconciler) reconcile(ctx context.Context, environment *etosv1alpha1.Environment) (time.Duration, error) {
 	// Set initial statuses if not set.
 	if active := meta.FindStatusCondition(environment.Status.Conditions, status.StatusActive); active == nil {
 		meta.SetStatusCondition(&environment.Status.Conditions,
@@ -128,17 +149,21 @@ func (r *EnvironmentReconciler) reconcile(ctx context.Context, environment *etos
 				Reason:  status.ReasonPending,
 				Message: "Waiting for environment to become ready",
 			})
-		return r.Status().Update(ctx, environment)
+		return 0, r.Status().Update(ctx, environment)
 	}
 	if environment.DeletionTimestamp.IsZero() {
 		if !controllerutil.ContainsFinalizer(environment, releaseFinalizer) {
 			controllerutil.AddFinalizer(environment, releaseFinalizer)
-			return r.Update(ctx, environment)
+			return 0, r.Update(ctx, environment)
 		}
 	}
 
-	if isStatusReason(environment.Status.Conditions, status.StatusActive, status.ReasonPending) {
-		return r.reconcileEnvironment(ctx, environment)
+	if environment.DeletionTimestamp.IsZero() && isStatusReason(environment.Status.Conditions, status.StatusActive, status.ReasonPending) {
+		return 0, r.reconcileEnvironment(ctx, environment)
+	}
+	if isStatusReason(environment.Status.Conditions, status.StatusActive, status.ReasonLeaked) {
+		logf.FromContext(ctx).Info("Environment release has leaked, reconciliation canceled")
+		return 0, nil
 	}
 
 	conditions := &environment.Status.Conditions
@@ -150,51 +175,27 @@ func (r *EnvironmentReconciler) reconcile(ctx context.Context, environment *etos
 
 	jobStatus, err := jobManager.Status(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	switch jobStatus {
-	case jobs.StatusFailed:
+	case jobs.StatusFailed, jobs.StatusSuccessful:
 		result := jobManager.Result(ctx, environment.Name)
-		if reason == "" {
-			reason = status.ReasonFailed
+		if jobStatus == jobs.StatusFailed || result.Conclusion == jobs.ConclusionFailed {
+			return r.releaseFailed(ctx, environment, jobManager, result.Description)
 		}
-		if meta.SetStatusCondition(conditions,
-			metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  reason,
-				Message: result.Description,
-			}) {
-			return r.Status().Update(ctx, environment)
+		if reason == "" {
+			reason = status.ReasonCompleted
 		}
-	case jobs.StatusSuccessful:
-		result := jobManager.Result(ctx, environment.Name)
-		var condition metav1.Condition
-		if result.Conclusion == jobs.ConclusionFailed {
-			if reason == "" {
-				reason = status.ReasonFailed
-			}
-			condition = metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  reason,
-				Message: result.Description,
-			}
-		} else {
-			if reason == "" {
-				reason = status.ReasonCompleted
-			}
-			condition = metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  reason,
-				Message: result.Description,
-			}
+		condition := metav1.Condition{
+			Type:    status.StatusActive,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: result.Description,
 		}
 		environmentCondition := meta.FindStatusCondition(environment.Status.Conditions, status.StatusActive)
 		environment.Status.CompletionTime = &environmentCondition.LastTransitionTime
 		if meta.SetStatusCondition(conditions, condition) {
-			return errors.Join(r.Status().Update(ctx, environment), jobManager.Delete(ctx))
+			return 0, errors.Join(r.Status().Update(ctx, environment), jobManager.Delete(ctx))
 		}
 	case jobs.StatusActive:
 		if reason == "" {
@@ -207,12 +208,25 @@ func (r *EnvironmentReconciler) reconcile(ctx context.Context, environment *etos
 				Reason:  reason,
 				Message: "Release job is running",
 			}) {
-			return r.Status().Update(ctx, environment)
+			return 0, r.Status().Update(ctx, environment)
 		}
 	default:
 		// Since this is a release job, we don't want to release if we are not deleting.
 		if environment.GetDeletionTimestamp().IsZero() {
-			return nil
+			return 0, nil
+		}
+		// Wait for the backoff of a failed release to pass before retrying it.
+		if retrying(environment.Status.Release) {
+			return retryRemaining(environment.Status.Release), nil
+		}
+		// The resources of batchable providers are released in batches before the environment is released.
+		remaining, err := r.releaseResourcesInBatches(ctx, environment)
+		if err != nil {
+			return 0, err
+		}
+		if remaining > 0 {
+			logf.FromContext(ctx).Info("Waiting for resources to get released", "resources", remaining)
+			return 5 * time.Second, nil
 		}
 		if err := jobManager.Create(ctx, environment, r.releaseJob); err != nil {
 			// When we create a job the job gets a unique name. If there's an error for that unique name the error
@@ -230,13 +244,72 @@ func (r *EnvironmentReconciler) reconcile(ctx context.Context, environment *etos
 						Reason:  reason,
 						Message: err.Error(),
 					}) {
-					return r.Status().Update(ctx, environment)
+					return 0, r.Status().Update(ctx, environment)
 				}
 			}
-			return err
+			return 0, err
 		}
 	}
-	return nil
+	return 0, nil
+}
+
+// releaseResourcesInBatches releases the resources of an environment in batches, unless the EnvironmentRequest
+// of the environment is gone. Returns the number of resources that are left to release.
+func (r *EnvironmentReconciler) releaseResourcesInBatches(ctx context.Context, environment *etosv1alpha1.Environment) (int, error) {
+	environmentRequest, err := r.environmentRequest(ctx, environment)
+	if err != nil {
+		return 0, client.IgnoreNotFound(err)
+	}
+	return releaseEnvironmentInBatches(ctx, r.Client, r.Scheme, environmentRequest, environment)
+}
+
+// releaseFailed retries a failed release of an environment with the release policy of the providers of its
+// resources, until the environment has leaked.
+func (r *EnvironmentReconciler) releaseFailed(
+	ctx context.Context,
+	environment *etosv1alpha1.Environment,
+	jobManager jobs.Job,
+	description string,
+) (time.Duration, error) {
+	attempt := releaseAttempt{
+		obj:        environment,
+		kind:       "Environment",
+		conditions: &environment.Status.Conditions,
+		release:    &environment.Status.Release,
+	}
+	return attempt.failed(ctx, r.Client, r.Recorder, jobManager, r.releasePolicy(ctx, environment), description)
+}
+
+// releasePolicy returns the release policy of an environment, which is the most lenient of the release
+// policies of the providers of its IUT, execution space and log area.
+func (r *EnvironmentReconciler) releasePolicy(ctx context.Context, environment *etosv1alpha1.Environment) etosv1alpha1.ReleasePolicy {
+	if environment.Spec.Providers == nil {
+		return defaultReleasePolicy
+	}
+	namespace := environment.Namespace
+	var providers []string
+	iut := &etosv1alpha2.Iut{}
+	if err := r.Get(ctx, types.NamespacedName{Name: environment.Spec.Providers.IUT, Namespace: namespace}, iut); err == nil {
+		providers = append(providers, iut.Spec.ProviderID)
+	}
+	executionSpace := &etosv1alpha2.ExecutionSpace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: environment.Spec.Providers.ExecutionSpace, Namespace: namespace}, executionSpace); err == nil {
+		providers = append(providers, executionSpace.Spec.ProviderID)
+	}
+	logArea := &etosv1alpha2.LogArea{}
+	if err := r.Get(ctx, types.NamespacedName{Name: environment.Spec.Providers.LogArea, Namespace: namespace}, logArea); err == nil {
+		providers = append(providers, logArea.Spec.ProviderID)
+	}
+	if len(providers) == 0 {
+		return defaultReleasePolicy
+	}
+	var policy etosv1alpha1.ReleasePolicy
+	for _, name := range providers {
+		providerPolicy := releasePolicy(ctx, r, name, namespace)
+		policy.Retries = max(policy.Retries, providerPolicy.Retries)
+		policy.BackoffSeconds = max(policy.BackoffSeconds, providerPolicy.BackoffSeconds)
+	}
+	return policy
 }
 
 // reconcileEnvironment sets the active status on an environment.
@@ -347,6 +420,12 @@ func (r EnvironmentReconciler) releaseJob(ctx context.Context, obj client.Object
 			Name:  "OTEL_EXPORTER_OTLP_INSECURE",
 			Value: cluster.Spec.OpenTelemetry.Insecure,
 		})
+		if cluster.Spec.OpenTelemetry.MetricExportInterval != "" {
+			envList = append(envList, corev1.EnvVar{
+				Name:  "OTEL_METRIC_EXPORT_INTERVAL",
+				Value: cluster.Spec.OpenTelemetry.MetricExportInterval,
+			})
+		}
 	}
 
 	jobSpec := &batchv1.Job{
@@ -404,6 +483,10 @@ func (r EnvironmentReconciler) releaseJob(ctx context.Context, obj client.Object
 			},
 		},
 	}
+	if settings := environmentRequest.Spec.JobSettings; settings != nil {
+		settings.ApplyToContainer(&jobSpec.Spec.Template.Spec.Containers[0])
+		settings.ApplyToPod(&jobSpec.Spec.Template.Spec)
+	}
 	return jobSpec, ctrl.SetControllerReference(environment, jobSpec, r.Scheme)
 }
 
@@ -436,5 +519,5 @@ func (r *EnvironmentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&etosv1alpha1.Environment{}).
 		Named("environment").
 		Owns(&batchv1.Job{}).
-		Complete(r)
+		Complete(traced(r.Client, &etosv1alpha1.Environment{}, r))
 }
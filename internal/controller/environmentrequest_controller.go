@@ -20,6 +20,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
@@ -41,12 +43,16 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
 	"github.com/eiffel-community/etos/internal/controller/jobs"
 	"github.com/eiffel-community/etos/internal/controller/status"
 )
 
 const environmentRequestKind = "EnvironmentRequest"
 
+// errReleasingFailedAttempt is returned while the resources of a failed provisioning are being released.
+var errReleasingFailedAttempt = errors.New("releasing the resources of a failed provisioning")
+
 // EnvironmentRequestReconciler reconciles a EnvironmentRequest object
 type EnvironmentRequestReconciler struct {
 	client.Client
@@ -59,7 +65,8 @@ type EnvironmentRequestReconciler struct {
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=environments,verbs=get;list;watch;delete
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=providers,verbs=get;watch
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=providers/status,verbs=get
-// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=iuts;executionspaces;logareas,verbs=get;list;watch;update;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=get
 // +kubebuilder:rbac:groups=*,resources=pods,verbs=get;list
 
@@ -105,6 +112,11 @@ func (r *EnvironmentRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 		// Delete job after the environment request has completed.
 		jobManager := jobs.NewJob(r.Client, EnvironmentRequestOwnerKey, environmentrequest.GetName(), environmentrequest.GetNamespace())
 		_ = jobManager.Delete(ctx)
+		if provisioners, err := remoteProvisioners(ctx, r.Client, environmentrequest); err == nil {
+			for _, provisioner := range provisioners {
+				_ = provisioner.Delete(ctx)
+			}
+		}
 		return ctrl.Result{}, nil
 	}
 	if err := r.reconcile(ctx, environmentrequest); err != nil {
@@ -112,9 +124,20 @@ func (r *EnvironmentRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 			logger.Error(err, "Reconciliation conflict, requeuing")
 			return ctrl.Result{Requeue: true}, nil
 		}
+		if errors.Is(err, errReleasingFailedAttempt) {
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
 		logger.Error(err, "Reconciliation failed")
 		return ctrl.Result{}, err
 	}
+	// Providers are watched, but the wait for them must time out even if they never change.
+	if remaining := providerWaitRemaining(environmentrequest.Status.Conditions, environmentrequest.Spec.Providers.WaitTimeout); remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+	// Provisioning by remote providers cannot be watched like jobs, poll them until done.
+	if isStatusReason(environmentrequest.Status.Conditions, status.StatusReady, status.ReasonActive) {
+		return ctrl.Result{RequeueAfter: remotePollInterval}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
@@ -135,6 +158,49 @@ func (r *EnvironmentRequestReconciler) reconcile(ctx context.Context, environmen
 		return nil
 	}
 
+	// Select providers before provisioning starts, falling back to other providers if a provider
+	// is not available or has failed to provision.
+	amount := min(environmentrequest.Spec.MinimumAmount, environmentrequest.Spec.MaximumAmount)
+	if isStatusReason(environmentrequest.Status.Conditions, status.StatusReady, status.ReasonPending) &&
+		len(environmentrequest.Status.FailedProviders) > 0 {
+		remaining, err := r.releaseFailedAttempt(ctx, environmentrequest)
+		if err != nil {
+			return err
+		}
+		if remaining > 0 {
+			logger.Info("Waiting for the resources of the failed provisioning to get released", "resources", remaining)
+			return errReleasingFailedAttempt
+		}
+	}
+	if isStatusReason(environmentrequest.Status.Conditions, status.StatusReady, status.ReasonPending) {
+		changed, err := selectProviders(
+			ctx, r, environmentrequest.Namespace, &environmentrequest.Spec.Providers, environmentrequest.Status.FailedProviders, amount,
+		)
+		if err != nil {
+			if held, changed := holdForProviders(
+				&environmentrequest.Status.Conditions, environmentrequest.Spec.Providers.WaitTimeout, err,
+			); held {
+				logger.Info("Waiting for providers to become available", "reason", err.Error())
+				if changed {
+					return r.Status().Update(ctx, environmentrequest)
+				}
+				return nil
+			}
+			meta.SetStatusCondition(&environmentrequest.Status.Conditions,
+				metav1.Condition{
+					Type:    status.StatusReady,
+					Status:  metav1.ConditionFalse,
+					Reason:  status.ReasonFailed,
+					Message: fmt.Sprintf("Provider check failed: %s", err.Error()),
+				})
+			return r.Status().Update(ctx, environmentrequest)
+		}
+		if changed {
+			logger.Info("Falling back to other providers", "providers", environmentrequest.Spec.Providers)
+			return r.Update(ctx, environmentrequest)
+		}
+	}
+
 	// Check providers availability
 	providers := etosv1alpha1.Providers{
 		IUT:            environmentrequest.Spec.Providers.IUT.ID,
@@ -142,6 +208,15 @@ func (r *EnvironmentRequestReconciler) reconcile(ctx context.Context, environmen
 		LogArea:        environmentrequest.Spec.Providers.LogArea.ID,
 	}
 	if err := checkProviders(ctx, r, environmentrequest.Namespace, providers); err != nil {
+		if held, changed := holdForProviders(
+			&environmentrequest.Status.Conditions, environmentrequest.Spec.Providers.WaitTimeout, err,
+		); held {
+			logger.Info("Waiting for providers to become available", "reason", err.Error())
+			if changed {
+				return r.Status().Update(ctx, environmentrequest)
+			}
+			return nil
+		}
 		meta.SetStatusCondition(&environmentrequest.Status.Conditions,
 			metav1.Condition{
 				Type:    status.StatusReady,
@@ -152,6 +227,42 @@ func (r *EnvironmentRequestReconciler) reconcile(ctx context.Context, environmen
 		return r.Status().Update(ctx, environmentrequest)
 	}
 
+	// Only check the capacity before provisioning starts, provisioning reduces the available capacity.
+	if isStatusReason(environmentrequest.Status.Conditions, status.StatusReady, status.ReasonPending) {
+		message, err := checkProviderCapacity(ctx, r, environmentrequest.Namespace, providers, amount)
+		if err == nil && message != "" {
+			// Providers are watched, a change in their capacity will trigger a new reconciliation.
+			held, changed := holdForCapacity(
+				&environmentrequest.Status.Conditions, environmentrequest.Spec.Providers.WaitTimeout, message,
+			)
+			if held {
+				logger.Info("Waiting for providers to have enough available capacity", "reason", message)
+				if changed {
+					return r.Status().Update(ctx, environmentrequest)
+				}
+				return nil
+			}
+			err = fmt.Errorf("timed out: %s", message)
+		}
+		if err != nil {
+			meta.SetStatusCondition(&environmentrequest.Status.Conditions,
+				metav1.Condition{
+					Type:    status.StatusReady,
+					Status:  metav1.ConditionFalse,
+					Reason:  status.ReasonFailed,
+					Message: fmt.Sprintf("Provider capacity check failed: %s", err.Error()),
+				})
+			return r.Status().Update(ctx, environmentrequest)
+		}
+	}
+	if releaseProviderHold(&environmentrequest.Status.Conditions) {
+		return r.Status().Update(ctx, environmentrequest)
+	}
+
+	if done, err := r.reconcileRemoteProviders(ctx, environmentrequest); err != nil || !done {
+		return err
+	}
+
 	if err := r.reconcileEnvironmentProvider(ctx, environmentrequest); err != nil {
 		return err
 	}
@@ -159,6 +270,68 @@ func (r *EnvironmentRequestReconciler) reconcile(ctx context.Context, environmen
 	return nil
 }
 
+// reconcileRemoteProviders provisions resources with the providers that serve the remote provider API,
+// one provider at a time. Returns true when all remote providers have provisioned successfully.
+func (r *EnvironmentRequestReconciler) reconcileRemoteProviders(ctx context.Context, environmentrequest *etosv1alpha1.EnvironmentRequest) (bool, error) {
+	logger := logf.FromContext(ctx)
+	conditions := &environmentrequest.Status.Conditions
+	provisioners, err := remoteProvisioners(ctx, r.Client, environmentrequest)
+	if err != nil {
+		return false, err
+	}
+	for _, provisioner := range provisioners {
+		jobStatus, err := provisioner.Status(ctx)
+		if err != nil {
+			logger.Error(err, "error getting remote provider status", "provider", provisioner.name)
+			return false, err
+		}
+		switch jobStatus {
+		case jobs.StatusSuccessful, jobs.StatusFailed:
+			result := provisioner.Result(ctx, provisioner.name)
+			if jobStatus == jobs.StatusSuccessful && result.Conclusion != jobs.ConclusionFailed {
+				continue
+			}
+			if r.failover(ctx, environmentrequest, []string{provisioner.name}, result.Description) {
+				return false, r.Status().Update(ctx, environmentrequest)
+			}
+			if meta.SetStatusCondition(conditions,
+				metav1.Condition{
+					Type:    status.StatusReady,
+					Status:  metav1.ConditionFalse,
+					Reason:  status.ReasonFailed,
+					Message: result.Description,
+				}) {
+				environmentRequestCondition := meta.FindStatusCondition(*conditions, status.StatusReady)
+				environmentrequest.Status.CompletionTime = &environmentRequestCondition.LastTransitionTime
+				recordProvisioned(ctx, environmentrequest)
+				return false, r.Status().Update(ctx, environmentrequest)
+			}
+			return false, nil
+		case jobs.StatusActive:
+			return false, nil
+		default:
+			if !environmentrequest.GetDeletionTimestamp().IsZero() {
+				return false, nil
+			}
+			if err := provisioner.Create(ctx, environmentrequest, nil); err != nil {
+				logger.Error(err, "Failed to start provisioning with remote provider", "provider", provisioner.name)
+				return false, err
+			}
+			if meta.SetStatusCondition(conditions,
+				metav1.Condition{
+					Type:    status.StatusReady,
+					Status:  metav1.ConditionFalse,
+					Reason:  status.ReasonActive,
+					Message: fmt.Sprintf("Provisioning with remote provider %s", provisioner.name),
+				}) {
+				return false, r.Status().Update(ctx, environmentrequest)
+			}
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 // reconcileEnvironmentProvider will check the status of environment providers, create new ones if necessary.
 func (r *EnvironmentRequestReconciler) reconcileEnvironmentProvider(ctx context.Context, environmentrequest *etosv1alpha1.EnvironmentRequest) error {
 	logger := logf.FromContext(ctx)
@@ -169,9 +342,22 @@ func (r *EnvironmentRequestReconciler) reconcileEnvironmentProvider(ctx context.
 		logger.Error(err, "error getting job status")
 		return err
 	}
+	if (jobStatus == jobs.StatusFailed || jobStatus == jobs.StatusSuccessful) &&
+		isStatusReason(*conditions, status.StatusReady, status.ReasonPending) {
+		// A finished job from before falling back to other providers, it shall be removed before
+		// a new job is created.
+		logger.Info("Removing environment provider job from before falling back to other providers")
+		return jobManager.Delete(ctx)
+	}
 	switch jobStatus {
 	case jobs.StatusFailed:
 		result := jobManager.Result(ctx, environmentrequest.Name)
+		if r.failoverJob(ctx, environmentrequest, result.Description) {
+			if err := jobManager.Delete(ctx); err != nil {
+				return err
+			}
+			return r.Status().Update(ctx, environmentrequest)
+		}
 		if meta.SetStatusCondition(conditions,
 			metav1.Condition{
 				Type:    status.StatusReady,
@@ -181,11 +367,18 @@ func (r *EnvironmentRequestReconciler) reconcileEnvironmentProvider(ctx context.
 			}) {
 			environmentRequestCondition := meta.FindStatusCondition(environmentrequest.Status.Conditions, status.StatusReady)
 			environmentrequest.Status.CompletionTime = &environmentRequestCondition.LastTransitionTime
+			recordProvisioned(ctx, environmentrequest)
 			return r.Status().Update(ctx, environmentrequest)
 		}
 	case jobs.StatusSuccessful:
 		result := jobManager.Result(ctx, environmentrequest.Name)
 		var condition metav1.Condition
+		if result.Conclusion == jobs.ConclusionFailed && r.failoverJob(ctx, environmentrequest, result.Description) {
+			if err := jobManager.Delete(ctx); err != nil {
+				return err
+			}
+			return r.Status().Update(ctx, environmentrequest)
+		}
 		if result.Conclusion == jobs.ConclusionFailed {
 			condition = metav1.Condition{
 				Type:    status.StatusReady,
@@ -204,6 +397,7 @@ func (r *EnvironmentRequestReconciler) reconcileEnvironmentProvider(ctx context.
 		if meta.SetStatusCondition(conditions, condition) {
 			environmentRequestCondition := meta.FindStatusCondition(environmentrequest.Status.Conditions, status.StatusReady)
 			environmentrequest.Status.CompletionTime = &environmentRequestCondition.LastTransitionTime
+			recordProvisioned(ctx, environmentrequest)
 			// Update status only; job deletion is deferred to the next reconcile.
 			return r.Status().Update(ctx, environmentrequest)
 		}
@@ -257,6 +451,114 @@ func (r *EnvironmentRequestReconciler) reconcileEnvironmentProvider(ctx context.
 	return nil
 }
 
+// failoverJob falls back to other providers after the environment provider job has failed. The job does not
+// tell which provider failed, but it runs the providers in order and stops at the first one that fails, so
+// the provider that failed is the first one that has not provisioned the requested amount. Returns false if
+// no provider failed, I.e. the job failed after provisioning, or if there is no provider to fall back to.
+func (r *EnvironmentRequestReconciler) failoverJob(ctx context.Context, environmentrequest *etosv1alpha1.EnvironmentRequest, message string) bool {
+	logger := logf.FromContext(ctx)
+	amount := min(environmentrequest.Spec.MinimumAmount, environmentrequest.Spec.MaximumAmount)
+	for _, choice := range environmentProviderChoices(&environmentrequest.Spec.Providers) {
+		provider, err := getProvider(ctx, r, *choice.id, environmentrequest.Namespace)
+		if err != nil || provider.Spec.API != "" {
+			continue
+		}
+		provisioned, err := provisionedAmount(ctx, r, environmentrequest, choice.providerType, *choice.id)
+		if err != nil {
+			logger.Error(err, "Failed to count the provisioned resources", "provider", *choice.id)
+			return false
+		}
+		if provisioned < amount {
+			return r.failover(ctx, environmentrequest, []string{*choice.id}, message)
+		}
+	}
+	return false
+}
+
+// provisionedAmount returns the amount of resources of a type that a provider has provisioned for an
+// EnvironmentRequest. Resources that are being deleted are not counted.
+func provisionedAmount(
+	ctx context.Context, c client.Reader, environmentrequest *etosv1alpha1.EnvironmentRequest, providerType, name string,
+) (int, error) {
+	namespace := client.InNamespace(environmentrequest.Namespace)
+	amount := 0
+	switch providerType {
+	case "iut":
+		var iuts etosv1alpha2.IutList
+		if err := c.List(ctx, &iuts, namespace); err != nil {
+			return 0, err
+		}
+		for _, iut := range iuts.Items {
+			if iut.Spec.EnvironmentRequest == environmentrequest.Name && iut.Spec.ProviderID == name &&
+				iut.DeletionTimestamp.IsZero() {
+				amount++
+			}
+		}
+	case "log-area":
+		var logAreas etosv1alpha2.LogAreaList
+		if err := c.List(ctx, &logAreas, namespace); err != nil {
+			return 0, err
+		}
+		for _, logArea := range logAreas.Items {
+			if logArea.Spec.EnvironmentRequest == environmentrequest.Name && logArea.Spec.ProviderID == name &&
+				logArea.DeletionTimestamp.IsZero() {
+				amount++
+			}
+		}
+	case "execution-space":
+		var executionSpaces etosv1alpha2.ExecutionSpaceList
+		if err := c.List(ctx, &executionSpaces, namespace); err != nil {
+			return 0, err
+		}
+		for _, executionSpace := range executionSpaces.Items {
+			if executionSpace.Spec.EnvironmentRequest == environmentrequest.Name && executionSpace.Spec.ProviderID == name &&
+				executionSpace.DeletionTimestamp.IsZero() {
+				amount++
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unknown provider type %q", providerType)
+	}
+	return amount, nil
+}
+
+// failover marks providers as failed and resets the environment request to pending, so that the failed
+// providers are replaced by the next providers to fall back to. Only providers that have a provider to fall
+// back to are marked. Returns false, without changing the environment request, if no provider was marked.
+//
+// The remote providers forget their provisionings, so that they provision again after the resources of the
+// failed attempt have been released by releaseFailedAttempt.
+func (r *EnvironmentRequestReconciler) failover(ctx context.Context, environmentrequest *etosv1alpha1.EnvironmentRequest, names []string, message string) bool {
+	logger := logf.FromContext(ctx)
+	var failed []string
+	for _, name := range names {
+		exclude := append(slices.Clone(environmentrequest.Status.FailedProviders), name)
+		if hasFailover(ctx, r, environmentrequest.Namespace, &environmentrequest.Spec.Providers, name, exclude) {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) == 0 {
+		return false
+	}
+	logger.Info("Providers failed to provision, falling back to other providers", "failed", failed, "message", message)
+	if provisioners, err := remoteProvisioners(ctx, r.Client, environmentrequest); err == nil {
+		for _, provisioner := range provisioners {
+			if err := provisioner.Delete(ctx); err != nil {
+				logger.Error(err, "Failed to remove the provisioning from the remote provider", "provider", provisioner.name)
+			}
+		}
+	}
+	environmentrequest.Status.FailedProviders = append(environmentrequest.Status.FailedProviders, failed...)
+	meta.SetStatusCondition(&environmentrequest.Status.Conditions,
+		metav1.Condition{
+			Type:    status.StatusReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  status.ReasonPending,
+			Message: fmt.Sprintf("Falling back from providers %s: %s", strings.Join(failed, ", "), message),
+		})
+	return true
+}
+
 // envVarListFrom creates a list of EnvVar key-value pairs from an EnvironmentRequest instance
 func (r EnvironmentRequestReconciler) envVarListFrom(ctx context.Context, environmentrequest *etosv1alpha1.EnvironmentRequest, cluster *etosv1alpha1.Cluster) ([]corev1.EnvVar, error) {
 	etosEncryptionKey, err := environmentrequest.Spec.Config.EncryptionKey.Get(ctx, r.Client, environmentrequest.Namespace)
@@ -426,12 +728,62 @@ func (r EnvironmentRequestReconciler) envVarListFrom(ctx context.Context, enviro
 			Name:  "OTEL_EXPORTER_OTLP_INSECURE",
 			Value: cluster.Spec.OpenTelemetry.Insecure,
 		})
+		if cluster.Spec.OpenTelemetry.MetricExportInterval != "" {
+			envList = append(envList, corev1.EnvVar{
+				Name:  "OTEL_METRIC_EXPORT_INTERVAL",
+				Value: cluster.Spec.OpenTelemetry.MetricExportInterval,
+			})
+		}
 	}
 	return envList, nil
 }
 
+// releaseFailedAttempt deletes the Environments, and the resources not handed over to an Environment, that a
+// failed provisioning has created for an EnvironmentRequest. Their controllers release them. The environment
+// provider lists resources by EnvironmentRequest, so they must be gone before provisioning again.
+//
+// Returns the number of Environments and resources that are left to release. Resources that have failed or
+// leaked are not counted, they are kept until an administrator force-finalizes them.
+func (r *EnvironmentRequestReconciler) releaseFailedAttempt(ctx context.Context, environmentrequest *etosv1alpha1.EnvironmentRequest) (int, error) {
+	var environments etosv1alpha1.EnvironmentList
+	if err := r.List(ctx, &environments, client.InNamespace(environmentrequest.Namespace)); err != nil {
+		return -1, err
+	}
+	objects := []client.Object{}
+	for i, environment := range environments.Items {
+		// The environment provider does not make the EnvironmentRequest the controller of its Environments.
+		for _, owner := range environment.OwnerReferences {
+			if owner.UID == environmentrequest.UID {
+				objects = append(objects, &environments.Items[i])
+				break
+			}
+		}
+	}
+	resources, err := standaloneResources(ctx, r, environmentrequest)
+	if err != nil {
+		return -1, err
+	}
+	for _, resource := range resources {
+		if isStatusReason(*resource.conditions, status.StatusActive, status.ReasonFailed) ||
+			isStatusReason(*resource.conditions, status.StatusActive, status.ReasonLeaked) {
+			continue
+		}
+		objects = append(objects, resource.obj)
+	}
+	var allErr error
+	for _, obj := range objects {
+		if obj.GetDeletionTimestamp().IsZero() {
+			if err := r.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+				allErr = errors.Join(allErr, err)
+			}
+		}
+	}
+	return len(objects), allErr
+}
+
 // reconcileDeletion checks for active environments and deletes them, causing them to clean up, and then, when all environments
-// are deleted, this function will remove the finalizer on the environmentrequest and the environmentrequest will be removed.
+// are deleted, releases the resources that were never handed over to an environment in batches. When those are released as well,
+// this function will remove the finalizer on the environmentrequest and the environmentrequest will be removed.
 func (r EnvironmentRequestReconciler) reconcileDeletion(ctx context.Context, environmentrequest *etosv1alpha1.EnvironmentRequest) (ctrl.Result, error) {
 	logger := logf.FromContext(ctx)
 
@@ -454,6 +806,11 @@ func (r EnvironmentRequestReconciler) reconcileDeletion(ctx context.Context, env
 		}
 	}
 
+	// The resources of the environments are released in batches, together with the standalone resources.
+	if err := adoptEnvironmentResources(ctx, r.Client, environmentrequest); err != nil {
+		logger.Error(err, "failed to adopt the resources of the environments")
+		return ctrl.Result{Requeue: true}, nil
+	}
 	var allErr error
 	environments, err := r.deleteEnvironments(ctx, *environmentrequest)
 	allErr = errors.Join(allErr, err)
@@ -465,6 +822,15 @@ func (r EnvironmentRequestReconciler) reconcileDeletion(ctx context.Context, env
 		logger.Info("Waiting for Environments to get deleted", "environments", environments)
 		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
 	}
+	resources, err := releaseInBatches(ctx, r.Client, r.Scheme, environmentrequest)
+	if err != nil {
+		logger.Error(err, "failed to release resources")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if resources != 0 {
+		logger.Info("Waiting for resources to get released", "resources", resources)
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
 
 	if controllerutil.RemoveFinalizer(environmentrequest, releaseFinalizer) {
 		if err := r.Update(ctx, environmentrequest); err != nil {
@@ -538,6 +904,7 @@ func (r EnvironmentRequestReconciler) environmentProviderJob(ctx context.Context
 		logger.Error(err, "Failed to create environment variable list for environment provider")
 		return nil, err
 	}
+	envVarList = append(envVarList, environmentrequest.Spec.LogEnvironment()...)
 
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
@@ -579,6 +946,10 @@ func (r EnvironmentRequestReconciler) environmentProviderJob(ctx context.Context
 			},
 		},
 	}
+	if settings := environmentrequest.Spec.JobSettings; settings != nil {
+		settings.ApplyToContainer(&job.Spec.Template.Spec.Containers[0])
+		settings.ApplyToPod(&job.Spec.Template.Spec)
+	}
 	return job, ctrl.SetControllerReference(environmentrequest, job, r.Scheme)
 }
 
@@ -623,19 +994,19 @@ func (r *EnvironmentRequestReconciler) registerOwnerIndexForEnvironment(mgr ctrl
 // findEnvironmentRequestsForIUTProvider will return reconciliation requests for each Provider object that an environment request has stored
 // in its spec as IUT. This will cause reconciliations whenever a Provider gets updated, created, deleted etc.
 func (r *EnvironmentRequestReconciler) findEnvironmentRequestsForIUTProvider(ctx context.Context, provider client.Object) []reconcile.Request {
-	return r.findEnvironmentRequestsForObject(ctx, iutProvider, provider)
+	return r.findEnvironmentRequestsForProvider(ctx, iutProvider, provider)
 }
 
 // findEnvironmentRequestsForIUTProvider will return reconciliation requests for each Provider object that an environment request has stored
 // in its spec as execution space. This will cause reconciliations whenever a Provider gets updated, created, deleted etc.
 func (r *EnvironmentRequestReconciler) findEnvironmentRequestsForExecutionSpaceProvider(ctx context.Context, provider client.Object) []reconcile.Request {
-	return r.findEnvironmentRequestsForObject(ctx, executionSpaceProvider, provider)
+	return r.findEnvironmentRequestsForProvider(ctx, executionSpaceProvider, provider)
 }
 
 // findEnvironmentRequestsForIUTProvider will return reconciliation requests for each Provider object that an environment request has stored
 // in its spec as log area. This will cause reconciliations whenever a Provider gets updated, created, deleted etc.
 func (r *EnvironmentRequestReconciler) findEnvironmentRequestsForLogAreaProvider(ctx context.Context, provider client.Object) []reconcile.Request {
-	return r.findEnvironmentRequestsForObject(ctx, logAreaProvider, provider)
+	return r.findEnvironmentRequestsForProvider(ctx, logAreaProvider, provider)
 }
 
 // findEnvironmentRequestsForTestrun will return reconciliation requests for each testrun object that an environment request has stored
@@ -644,6 +1015,45 @@ func (r *EnvironmentRequestReconciler) FindEnvironmentRequestsForTestrun(ctx con
 	return r.findEnvironmentRequestsForObject(ctx, ".spec.testrun", testrun)
 }
 
+// findEnvironmentRequestsForProvider will find environment requests that use, or fall back to, a provider.
+// The index is the field index of the type of provider, I.e. iutProvider.
+func (r *EnvironmentRequestReconciler) findEnvironmentRequestsForProvider(ctx context.Context, index string, provider client.Object) []reconcile.Request {
+	requests := r.findEnvironmentRequestsForObject(ctx, index, provider)
+
+	// Providers to fall back to can also be selected by their labels, which cannot be indexed.
+	environmentRequestList := &etosv1alpha1.EnvironmentRequestList{}
+	listOps := &client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(index, failoverSelectorIndexValue),
+		Namespace:     provider.GetNamespace(),
+	}
+	if err := r.List(ctx, environmentRequestList, listOps); err != nil {
+		return requests
+	}
+	for _, environmentRequest := range environmentRequestList.Items {
+		choice, _ := providerChoiceFor(environmentProviderChoices(&environmentRequest.Spec.Providers), index)
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      environmentRequest.GetName(),
+				Namespace: environmentRequest.GetNamespace(),
+			},
+		}
+		if choice.selects(provider) && !slices.Contains(requests, request) {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// environmentRequestProviderIndex indexes environment requests by the provider, and the providers to
+// fall back to, of the type of provider with a field index, I.e. iutProvider.
+func environmentRequestProviderIndex(index string) client.IndexerFunc {
+	return func(rawObj client.Object) []string {
+		environmentRequest := rawObj.(*etosv1alpha1.EnvironmentRequest)
+		choice, _ := providerChoiceFor(environmentProviderChoices(&environmentRequest.Spec.Providers), index)
+		return choice.indexValues()
+	}
+}
+
 // findEnvironmentRequestsForObject will find environment requests for a kubernetes object.
 func (r *EnvironmentRequestReconciler) findEnvironmentRequestsForObject(ctx context.Context, name string, obj client.Object) []reconcile.Request {
 	environmentRequestList := &etosv1alpha1.EnvironmentRequestList{}
@@ -677,22 +1087,13 @@ func (r *EnvironmentRequestReconciler) SetupWithManager(mgr ctrl.Manager) error
 	if err := r.registerOwnerIndexForEnvironment(mgr); err != nil {
 		return err
 	}
-	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.EnvironmentRequest{}, iutProvider, func(rawObj client.Object) []string {
-		environmentRequest := rawObj.(*etosv1alpha1.EnvironmentRequest)
-		return []string{environmentRequest.Spec.Providers.IUT.ID}
-	}); err != nil {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.EnvironmentRequest{}, iutProvider, environmentRequestProviderIndex(iutProvider)); err != nil {
 		return err
 	}
-	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.EnvironmentRequest{}, logAreaProvider, func(rawObj client.Object) []string {
-		environmentRequest := rawObj.(*etosv1alpha1.EnvironmentRequest)
-		return []string{environmentRequest.Spec.Providers.LogArea.ID}
-	}); err != nil {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.EnvironmentRequest{}, logAreaProvider, environmentRequestProviderIndex(logAreaProvider)); err != nil {
 		return err
 	}
-	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.EnvironmentRequest{}, executionSpaceProvider, func(rawObj client.Object) []string {
-		environmentRequest := rawObj.(*etosv1alpha1.EnvironmentRequest)
-		return []string{environmentRequest.Spec.Providers.ExecutionSpace.ID}
-	}); err != nil {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.EnvironmentRequest{}, executionSpaceProvider, environmentRequestProviderIndex(executionSpaceProvider)); err != nil {
 		return err
 	}
 
@@ -716,5 +1117,5 @@ func (r *EnvironmentRequestReconciler) SetupWithManager(mgr ctrl.Manager) error
 			handler.TypedEnqueueRequestsFromMapFunc(r.findEnvironmentRequestsForExecutionSpaceProvider),
 			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
 		).
-		Complete(r)
+		Complete(traced(r.Client, &etosv1alpha1.EnvironmentRequest{}, r))
 }
@@ -18,16 +18,23 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/status"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
 )
 
 var _ = Describe("EnvironmentRequest Controller", func() {
@@ -99,3 +106,119 @@ var _ = Describe("EnvironmentRequest Controller", func() {
 		})
 	})
 })
+
+var _ = Describe("EnvironmentRequest failover", func() {
+	const namespace = "default"
+	var (
+		ctx                context.Context
+		cli                client.Client
+		reconciler         *EnvironmentRequestReconciler
+		environmentRequest *etosv1alpha1.EnvironmentRequest
+	)
+
+	// provisioned creates the resources that a provider of a type has provisioned for the EnvironmentRequest.
+	provisioned := func(providerType, providerName string, amount int) {
+		for i := range amount {
+			meta := metav1.ObjectMeta{Name: fmt.Sprintf("%s-%s-%d", providerType, providerName, i), Namespace: namespace}
+			var obj client.Object
+			switch providerType {
+			case "iut":
+				obj = &etosv1alpha2.Iut{ObjectMeta: meta, Spec: etosv1alpha2.IutSpec{
+					ID: uuid.NewString(), EnvironmentRequest: environmentRequest.Name, ProviderID: providerName,
+				}}
+			case "log-area":
+				obj = &etosv1alpha2.LogArea{ObjectMeta: meta, Spec: etosv1alpha2.LogAreaSpec{
+					ID: uuid.NewString(), EnvironmentRequest: environmentRequest.Name, ProviderID: providerName,
+				}}
+			case "execution-space":
+				obj = &etosv1alpha2.ExecutionSpace{ObjectMeta: meta, Spec: etosv1alpha2.ExecutionSpaceSpec{
+					ID: uuid.NewString(), EnvironmentRequest: environmentRequest.Name, ProviderID: providerName,
+				}}
+			}
+			Expect(cli.Create(ctx, obj)).To(Succeed())
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		environmentRequest = providertest.NewEnvironmentRequest("environment-request", namespace).
+			WithAmount(2, 2).
+			WithIutProvider("iut").
+			WithLogAreaProvider("log-area").
+			WithExecutionSpaceProvider("execution-space", "1.0.0").
+			Build()
+		environmentRequest.Spec.Providers.IUT.Failover = &etosv1alpha1.ProviderFailover{Providers: []string{"iut-fallback"}}
+		environmentRequest.Spec.Providers.LogArea.Failover = &etosv1alpha1.ProviderFailover{
+			Providers: []string{"log-area-fallback"},
+		}
+		cli = providertest.NewFakeClient(
+			environmentRequest,
+			providertest.NewProvider("iut", namespace, "iut").WithAvailable().Build(),
+			providertest.NewProvider("iut-fallback", namespace, "iut").WithAvailable().Build(),
+			providertest.NewProvider("log-area", namespace, "log-area").WithAvailable().Build(),
+			providertest.NewProvider("log-area-fallback", namespace, "log-area").WithAvailable().Build(),
+			providertest.NewProvider("execution-space", namespace, "execution-space").WithAvailable().Build(),
+		)
+		reconciler = &EnvironmentRequestReconciler{Client: cli, Scheme: cli.Scheme()}
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(environmentRequest), environmentRequest)).To(Succeed())
+	})
+
+	It("should only fall back from the provider that failed in the environment provider job", func() {
+		provisioned("iut", "iut", 2)
+		provisioned("log-area", "log-area", 1)
+		Expect(reconciler.failoverJob(ctx, environmentRequest, "log area provider failed")).To(BeTrue())
+		Expect(environmentRequest.Status.FailedProviders).To(Equal([]string{"log-area"}))
+		Expect(isStatusReason(environmentRequest.Status.Conditions, status.StatusReady, status.ReasonPending)).To(BeTrue())
+	})
+
+	It("should not fall back when the environment provider job failed after provisioning", func() {
+		provisioned("iut", "iut", 2)
+		provisioned("log-area", "log-area", 2)
+		provisioned("execution-space", "execution-space", 2)
+		Expect(reconciler.failoverJob(ctx, environmentRequest, "failed to create environment")).To(BeFalse())
+		Expect(environmentRequest.Status.FailedProviders).To(BeEmpty())
+	})
+
+	It("should not fall back from a provider that has no provider to fall back to", func() {
+		provisioned("iut", "iut", 2)
+		provisioned("log-area", "log-area", 2)
+		Expect(reconciler.failoverJob(ctx, environmentRequest, "execution space provider failed")).To(BeFalse())
+		Expect(reconciler.failover(ctx, environmentRequest, []string{"execution-space"}, "failed")).To(BeFalse())
+		Expect(environmentRequest.Status.FailedProviders).To(BeEmpty())
+	})
+
+	It("should release the resources of the failed attempt before provisioning again", func() {
+		provisioned("iut", "iut", 2)
+		provisioned("log-area", "log-area", 1)
+		environment := &etosv1alpha1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "environment", Namespace: namespace},
+		}
+		Expect(controllerutil.SetOwnerReference(environmentRequest, environment, cli.Scheme())).To(Succeed())
+		Expect(cli.Create(ctx, environment)).To(Succeed())
+		otherEnvironment := &etosv1alpha1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "other-environment", Namespace: namespace},
+		}
+		Expect(cli.Create(ctx, otherEnvironment)).To(Succeed())
+
+		Expect(reconciler.failoverJob(ctx, environmentRequest, "log area provider failed")).To(BeTrue())
+		Expect(cli.Status().Update(ctx, environmentRequest)).To(Succeed())
+
+		Expect(reconciler.reconcile(ctx, environmentRequest)).To(MatchError(errReleasingFailedAttempt))
+		var iuts etosv1alpha2.IutList
+		Expect(cli.List(ctx, &iuts)).To(Succeed())
+		Expect(iuts.Items).To(BeEmpty())
+		var logAreas etosv1alpha2.LogAreaList
+		Expect(cli.List(ctx, &logAreas)).To(Succeed())
+		Expect(logAreas.Items).To(BeEmpty())
+		var environments etosv1alpha1.EnvironmentList
+		Expect(cli.List(ctx, &environments)).To(Succeed())
+		Expect(environments.Items).To(HaveLen(1))
+		Expect(environments.Items[0].Name).To(Equal(otherEnvironment.Name))
+
+		By("falling back to other providers when everything is released")
+		Expect(reconciler.reconcile(ctx, environmentRequest)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(environmentRequest), environmentRequest)).To(Succeed())
+		Expect(environmentRequest.Spec.Providers.IUT.ID).To(Equal("iut"))
+		Expect(environmentRequest.Spec.Providers.LogArea.ID).To(Equal("log-area-fallback"))
+	})
+})
@@ -19,19 +19,20 @@ package controller
 import (
 	"context"
 	"errors"
+	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
-	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
 	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
 	"github.com/eiffel-community/etos/internal/controller/jobs"
 	"github.com/eiffel-community/etos/internal/controller/status"
@@ -41,7 +42,8 @@ import (
 // ExecutionSpaceReconciler reconciles a ExecutionSpace object
 type ExecutionSpaceReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder events.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=executionspaces,verbs=get;list;watch;create;update;patch;delete
@@ -110,7 +112,13 @@ func (r *ExecutionSpaceReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 			}
 		}
 		logger.Info("ExecutionSpace is being managed by Environment", "executionSpace", executionSpace.Name)
-		return ctrl.Result{}, nil
+		return expiryResult(reconcileLease(
+			ctx, r.Client, executionSpace, executionSpace.Spec.Lease, &executionSpace.Status.RenewTime, &executionSpace.Status.Conditions,
+		))
+	}
+	// An administrator can remove a resource that cannot be released, e.g. after it has leaked.
+	if finalized, err := forceFinalize(ctx, r.Client, r.Recorder, executionSpace, providerFinalizer); finalized || err != nil {
+		return expiryResult(0, err)
 	}
 	// If the ExecutionSpace is considered 'Completed', it has been released. Check that the object is
 	// being deleted and contains the finalizer and remove the finalizer.
@@ -127,21 +135,36 @@ func (r *ExecutionSpaceReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 			}
 		}
 		// Delete job after the execution space has completed.
-		jobManager := jobs.NewJob(r.Client, ExecutionSpaceOwnerKey, executionSpace.GetName(), executionSpace.GetNamespace())
+		jobManager := newReleaseManager(ctx, r.Client, ExecutionSpaceOwnerKey, executionSpace, executionSpace.Spec.ProviderID)
 		_ = jobManager.Delete(ctx)
 		return ctrl.Result{}, nil
 	}
-	if err := r.reconcile(ctx, executionSpace); err != nil {
+	// Release the ExecutionSpace if it has passed its deadline or has been orphaned.
+	deadline, reaped, err := reap(ctx, r.Client, r.Recorder, standaloneExecutionSpace(executionSpace))
+	if reaped || err != nil {
+		return expiryResult(0, err)
+	}
+	retryAfter, err := r.reconcile(ctx, executionSpace)
+	if err != nil {
 		if apierrors.IsConflict(err) {
 			return ctrl.Result{Requeue: true}, nil
 		}
 		return ctrl.Result{}, err
 	}
-	return ctrl.Result{}, nil
+	// Retry a failed release when its backoff has passed.
+	if retryAfter > 0 {
+		return ctrl.Result{RequeueAfter: retryAfter}, nil
+	}
+	// Releases by remote providers cannot be watched like release jobs, poll them until done.
+	if !executionSpace.DeletionTimestamp.IsZero() && isStatusReason(executionSpace.Status.Conditions, status.StatusActive, status.ReasonPending) {
+		return ctrl.Result{RequeueAfter: remotePollInterval}, nil
+	}
+	lease, err := reconcileLease(ctx, r.Client, executionSpace, executionSpace.Spec.Lease, &executionSpace.Status.RenewTime, &executionSpace.Status.Conditions)
+	return expiryResult(earliest(deadline, lease), err)
 }
 
 // reconcile an ExecutionSpace resource to its desired state.
-func (r *ExecutionSpaceReconciler) reconcile(ctx context.Context, executionSpace *etosv1alpha2.ExecutionSpace) error {
+func (r *ExecutionSpaceReconciler) reconcile(ctx context.Context, executionSpace *etosv1alpha2.ExecutionSpace) (time.Duration, error) {
 	logger := logf.FromContext(ctx)
 
 	// Set initial statuses if not set.
@@ -153,68 +176,52 @@ func (r *ExecutionSpaceReconciler) reconcile(ctx context.Context, executionSpace
 				Reason:  status.ReasonPending,
 				Message: "Waiting for environment",
 			})
-		return r.Status().Update(ctx, executionSpace)
-	} else if active.Reason == status.ReasonFailed {
+		return 0, r.Status().Update(ctx, executionSpace)
+	} else if active.Reason == status.ReasonFailed || active.Reason == status.ReasonLeaked {
 		logger.Info("Execution space failed, reconciliation canceled")
-		return nil
+		return 0, nil
 	}
 	if executionSpace.DeletionTimestamp.IsZero() {
 		if !controllerutil.ContainsFinalizer(executionSpace, providerFinalizer) {
 			controllerutil.AddFinalizer(executionSpace, providerFinalizer)
 			logger.Info("ExecutionSpace is being managed by ExecutionSpace controller", "executionSpace", executionSpace.Name)
-			return r.Update(ctx, executionSpace)
+			return 0, r.Update(ctx, executionSpace)
 		}
 	}
 
 	if !executionSpace.DeletionTimestamp.IsZero() {
 		return r.reconcileExecutionSpaceReleaser(ctx, executionSpace)
 	}
-	return nil
+	return 0, nil
 }
 
 // reconcileExecutionSpaceReleaser gets the status of a release job, creating a new release job if necessary.
-func (r *ExecutionSpaceReconciler) reconcileExecutionSpaceReleaser(ctx context.Context, executionSpace *etosv1alpha2.ExecutionSpace) error {
+func (r *ExecutionSpaceReconciler) reconcileExecutionSpaceReleaser(ctx context.Context, executionSpace *etosv1alpha2.ExecutionSpace) (time.Duration, error) {
 	conditions := &executionSpace.Status.Conditions
-	jobManager := jobs.NewJob(r.Client, ExecutionSpaceOwnerKey, executionSpace.GetName(), executionSpace.GetNamespace())
+	jobManager := newReleaseManager(ctx, r.Client, ExecutionSpaceOwnerKey, executionSpace, executionSpace.Spec.ProviderID)
 	jobStatus, err := jobManager.Status(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	switch jobStatus {
-	case jobs.StatusFailed:
+	case jobs.StatusFailed, jobs.StatusSuccessful:
+		// A release job may be shared by several resources, the result is the result of this resource.
 		result := jobManager.Result(ctx, release.ExecutionSpaceReleaserName)
-		if meta.SetStatusCondition(conditions,
-			metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  status.ReasonFailed,
-				Message: result.Description,
-			}) {
-			return r.Status().Update(ctx, executionSpace)
-		}
-	case jobs.StatusSuccessful:
-		result := jobManager.Result(ctx, release.ExecutionSpaceReleaserName)
-		var condition metav1.Condition
 		if result.Conclusion == jobs.ConclusionFailed {
-			condition = metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  status.ReasonFailed,
-				Message: result.Description,
-			}
-		} else {
-			condition = metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  status.ReasonCompleted,
-				Message: result.Description,
-			}
+			return standaloneExecutionSpace(executionSpace).releaseFailed(ctx, r.Client, r.Recorder, jobManager, result.Description)
+		}
+		condition := metav1.Condition{
+			Type:    status.StatusActive,
+			Status:  metav1.ConditionFalse,
+			Reason:  status.ReasonCompleted,
+			Message: result.Description,
 		}
 		now := metav1.Now()
 		executionSpace.Status.CompletionTime = &now
 		if meta.SetStatusCondition(conditions, condition) {
+			recordReleased(ctx, "ExecutionSpace", status.ReasonCompleted)
 			// Update status only; job deletion is deferred to the next reconcile.
-			return r.Status().Update(ctx, executionSpace)
+			return 0, r.Status().Update(ctx, executionSpace)
 		}
 	case jobs.StatusActive:
 		if meta.SetStatusCondition(conditions,
@@ -224,12 +231,32 @@ func (r *ExecutionSpaceReconciler) reconcileExecutionSpaceReleaser(ctx context.C
 				Reason:  status.ReasonPending,
 				Message: "Releasing ExecutionSpace",
 			}) {
-			return r.Status().Update(ctx, executionSpace)
+			return 0, r.Status().Update(ctx, executionSpace)
 		}
 	default:
 		// Since this is a release job, we don't want to release if we are not deleting.
 		if executionSpace.GetDeletionTimestamp().IsZero() {
-			return nil
+			return 0, nil
+		}
+		// Wait for the backoff of a failed release to pass before retrying it.
+		if retrying(executionSpace.Status.Release) {
+			return retryRemaining(executionSpace.Status.Release), nil
+		}
+		// Wait for the EnvironmentRequest to release this resource together with its other resources.
+		batched, err := standaloneExecutionSpace(executionSpace).awaitsBatchRelease(ctx, r.Client)
+		if err != nil {
+			return 0, err
+		}
+		if batched {
+			if meta.SetStatusCondition(conditions, metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Type:    status.StatusActive,
+				Reason:  status.ReasonPending,
+				Message: "Waiting for batch release",
+			}) {
+				return 0, r.Status().Update(ctx, executionSpace)
+			}
+			return 0, nil
 		}
 		if err := jobManager.Create(ctx, executionSpace, r.releaseJob); err != nil {
 			// When we create a job the job gets a unique name. If there's an error for that unique name the error
@@ -243,9 +270,9 @@ func (r *ExecutionSpaceReconciler) reconcileExecutionSpaceReleaser(ctx context.C
 					Reason:  status.ReasonFailed,
 					Message: err.Error(),
 				}) {
-				return r.Status().Update(ctx, executionSpace)
+				return 0, r.Status().Update(ctx, executionSpace)
 			}
-			return err
+			return 0, err
 		}
 		if meta.SetStatusCondition(conditions, metav1.Condition{
 			Status:  metav1.ConditionFalse,
@@ -253,10 +280,27 @@ func (r *ExecutionSpaceReconciler) reconcileExecutionSpaceReleaser(ctx context.C
 			Reason:  status.ReasonPending,
 			Message: "Releasing ExecutionSpace",
 		}) {
-			return r.Status().Update(ctx, executionSpace)
+			return 0, r.Status().Update(ctx, executionSpace)
 		}
 	}
-	return nil
+	return 0, nil
+}
+
+// standaloneExecutionSpace returns the ExecutionSpace as a resource that is not owned by an Environment.
+func standaloneExecutionSpace(executionSpace *etosv1alpha2.ExecutionSpace) standaloneResource {
+	return standaloneResource{
+		obj:                executionSpace,
+		kind:               "ExecutionSpace",
+		ownerKey:           ExecutionSpaceOwnerKey,
+		releaserName:       release.ExecutionSpaceReleaserName,
+		deadline:           executionSpace.Spec.Deadline,
+		lease:              executionSpace.Spec.Lease,
+		environmentRequest: executionSpace.Spec.EnvironmentRequest,
+		provider:           executionSpace.Spec.ProviderID,
+		conditions:         &executionSpace.Status.Conditions,
+		completionTime:     &executionSpace.Status.CompletionTime,
+		release:            &executionSpace.Status.Release,
+	}
 }
 
 // releaseJob is the job definition for an execution space releaser.
@@ -270,8 +314,8 @@ func (r ExecutionSpaceReconciler) releaseJob(ctx context.Context, obj client.Obj
 	if err != nil {
 		return nil, err
 	}
-	environmentrequest := &etosv1alpha1.EnvironmentRequest{}
-	if err := r.Get(ctx, types.NamespacedName{Name: executionSpace.Spec.EnvironmentRequest, Namespace: executionSpace.Namespace}, environmentrequest); err != nil {
+	environmentrequest, err := releaseEnvironmentRequest(ctx, r, executionSpace, executionSpace.Spec.EnvironmentRequest)
+	if err != nil {
 		return nil, err
 	}
 
@@ -286,15 +330,14 @@ func (r ExecutionSpaceReconciler) releaseJob(ctx context.Context, obj client.Obj
 func (r *ExecutionSpaceReconciler) registerOwnerIndexForJob(mgr ctrl.Manager) error {
 	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &batchv1.Job{}, ExecutionSpaceOwnerKey, func(rawObj client.Object) []string {
 		job := rawObj.(*batchv1.Job)
-		owner := metav1.GetControllerOf(job)
-		if owner == nil {
-			return nil
-		}
-		if owner.APIVersion != APIv2GroupVersionString || owner.Kind != "ExecutionSpace" {
-			return nil
+		// Jobs that release several resources in a batch are owned by all of them.
+		var owners []string
+		for _, owner := range job.GetOwnerReferences() {
+			if owner.APIVersion == APIv2GroupVersionString && owner.Kind == "ExecutionSpace" {
+				owners = append(owners, owner.Name)
+			}
 		}
-
-		return []string{owner.Name}
+		return owners
 	}); err != nil {
 		return err
 	}
@@ -310,6 +353,6 @@ func (r *ExecutionSpaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&etosv1alpha2.ExecutionSpace{}).
 		Named("executionspace").
-		Owns(&batchv1.Job{}). // Release job
-		Complete(r)
+		Owns(&batchv1.Job{}, builder.MatchEveryOwner). // Release jobs, which may be shared
+		Complete(traced(r.Client, &etosv1alpha2.ExecutionSpace{}, r))
 }
@@ -0,0 +1,341 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+)
+
+const (
+	defaultHealthcheckTimeout   = 10 * time.Second
+	defaultHealthcheckThreshold = 3
+	// healthcheckPollInterval is how often a running 'exec' health check is polled.
+	healthcheckPollInterval = 5 * time.Second
+	// healthcheckJobStartup is the time, on top of the health check timeout, that an 'exec' health check
+	// Job is given to schedule its pod and pull the provider image.
+	healthcheckJobStartup    = 5 * time.Minute
+	healthcheckContainerName = "healthcheck"
+)
+
+// errHealthcheckRunning is returned while an 'exec' health check is running.
+var errHealthcheckRunning = errors.New("health check is running")
+
+// healthcheckTimeout returns the time that a health check is allowed to take.
+func healthcheckTimeout(healthcheck *etosv1alpha1.Healthcheck) time.Duration {
+	if healthcheck.TimeoutSeconds <= 0 {
+		return defaultHealthcheckTimeout
+	}
+	return time.Duration(healthcheck.TimeoutSeconds) * time.Second
+}
+
+// healthcheckThreshold returns the number of health checks in a row that must fail before a
+// provider is no longer available.
+func healthcheckThreshold(healthcheck *etosv1alpha1.Healthcheck) int {
+	if healthcheck.FailureThreshold <= 0 {
+		return defaultHealthcheckThreshold
+	}
+	return healthcheck.FailureThreshold
+}
+
+// checkHealth checks the health of a provider with the protocol of its health check.
+//
+// Returns errHealthcheckRunning if the health check has been started, but is not yet done.
+func (r *ProviderReconciler) checkHealth(ctx context.Context, provider *etosv1alpha1.Provider, healthcheck *etosv1alpha1.Healthcheck) error {
+	if healthcheck.Protocol == "exec" {
+		return r.execHealthcheck(ctx, provider, healthcheck)
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthcheckTimeout(healthcheck))
+	defer cancel()
+	tlsConfig, err := healthcheckTLSConfig(ctx, r.Client, provider.Namespace, healthcheck.TLS)
+	if err != nil {
+		return err
+	}
+	var token string
+	if healthcheck.BearerToken != nil {
+		value, err := healthcheck.BearerToken.Get(ctx, r.Client, provider.Namespace)
+		if err != nil {
+			return fmt.Errorf("failed to get bearer token: %w", err)
+		}
+		token = strings.TrimSpace(string(value))
+	}
+	if healthcheck.Protocol == "grpc" {
+		return grpcHealthcheck(ctx, provider.Spec.Host, healthcheck, tlsConfig, token)
+	}
+	return httpHealthcheck(ctx, provider.Spec.Host, healthcheck, tlsConfig, token)
+}
+
+// healthcheckTLSConfig creates the TLS configuration for a health check. Returns nil if TLS is not configured.
+func healthcheckTLSConfig(ctx context.Context, c client.Client, namespace string, config *etosv1alpha1.HealthcheckTLS) (*tls.Config, error) {
+	if config == nil {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: config.InsecureSkipVerify, // #nosec G402 -- Explicitly requested in the Provider.
+	}
+	if config.CA != nil {
+		ca, err := config.CA.Get(ctx, c, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get CA bundle: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New("found no certificates in CA bundle")
+		}
+	}
+	if config.ClientCertificate != nil {
+		if config.ClientKey == nil {
+			return nil, errors.New("a client key is required with a client certificate")
+		}
+		certificate, err := config.ClientCertificate.Get(ctx, c, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client certificate: %w", err)
+		}
+		key, err := config.ClientKey.Get(ctx, c, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client key: %w", err)
+		}
+		keyPair, err := tls.X509KeyPair(certificate, key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{keyPair}
+	}
+	return tlsConfig, nil
+}
+
+// httpHealthcheck sends a request to the health check endpoint of a provider and checks that the
+// provider responds with an expected status code.
+func httpHealthcheck(ctx context.Context, host string, healthcheck *etosv1alpha1.Healthcheck, tlsConfig *tls.Config, token string) error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	httpClient := &http.Client{Transport: transport}
+	method := healthcheck.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	request, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", host, healthcheck.Endpoint), nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not communicate with host: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	expected, err := isExpectedStatus(healthcheck.ExpectedStatus, resp.StatusCode)
+	if err != nil {
+		return err
+	}
+	if !expected {
+		return fmt.Errorf("wrong status code (%d) from health check endpoint", resp.StatusCode)
+	}
+	return nil
+}
+
+// isExpectedStatus checks if a status code is one of the expected status codes, or ranges of
+// status codes such as "200-299". 204 is expected if no status codes are.
+func isExpectedStatus(expected []string, statusCode int) (bool, error) {
+	if len(expected) == 0 {
+		return statusCode == http.StatusNoContent, nil
+	}
+	for _, status := range expected {
+		low, high, isRange := strings.Cut(status, "-")
+		if !isRange {
+			high = low
+		}
+		first, err := strconv.Atoi(strings.TrimSpace(low))
+		if err != nil {
+			return false, fmt.Errorf("invalid expected status %q", status)
+		}
+		last, err := strconv.Atoi(strings.TrimSpace(high))
+		if err != nil {
+			return false, fmt.Errorf("invalid expected status %q", status)
+		}
+		if statusCode >= first && statusCode <= last {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// grpcHealthcheck checks the health of a provider with the gRPC health checking protocol.
+func grpcHealthcheck(ctx context.Context, host string, healthcheck *etosv1alpha1.Healthcheck, tlsConfig *tls.Config, token string) error {
+	target, secure := grpcTarget(host)
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	} else if secure {
+		transportCredentials = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	response, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: healthcheck.Service})
+	if err != nil {
+		return fmt.Errorf("could not communicate with host: %w", err)
+	}
+	if response.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("provider is %s", response.GetStatus())
+	}
+	return nil
+}
+
+// grpcTarget returns the gRPC target of a host and whether TLS shall be used. The host can
+// either be an address, I.e. "provider:8080", or a URL, I.e. "https://provider:8080".
+func grpcTarget(host string) (string, bool) {
+	u, err := url.Parse(host)
+	if err != nil || u.Host == "" {
+		return host, false
+	}
+	return u.Host, u.Scheme == "https" || u.Scheme == "grpcs"
+}
+
+// execHealthcheck checks the health of a provider by running its image with the -healthcheck flag in a Job.
+//
+// The first call creates the Job and returns errHealthcheckRunning, the Job is then polled until it has finished.
+func (r *ProviderReconciler) execHealthcheck(ctx context.Context, provider *etosv1alpha1.Provider, healthcheck *etosv1alpha1.Healthcheck) error {
+	jobManager := jobs.NewJob(r.Client, ProviderOwnerKey, provider.Name, provider.Namespace)
+	jobStatus, err := jobManager.Status(ctx)
+	if err != nil {
+		return err
+	}
+	switch jobStatus {
+	case jobs.StatusActive:
+		return errHealthcheckRunning
+	case jobs.StatusSuccessful, jobs.StatusFailed:
+		result := jobManager.Result(ctx, healthcheckContainerName)
+		if err := jobManager.Delete(ctx); err != nil {
+			return err
+		}
+		if jobStatus == jobs.StatusFailed || result.Conclusion == jobs.ConclusionFailed {
+			return errors.New(result.Description)
+		}
+		return nil
+	default:
+		if err := jobManager.Create(ctx, provider, func(ctx context.Context, obj client.Object) (*batchv1.Job, error) {
+			return r.healthcheckJob(obj, healthcheck)
+		}); err != nil {
+			return err
+		}
+		return errHealthcheckRunning
+	}
+}
+
+// healthcheckJob is the job definition for an 'exec' health check of a provider.
+func (r *ProviderReconciler) healthcheckJob(obj client.Object, healthcheck *etosv1alpha1.Healthcheck) (*batchv1.Job, error) {
+	provider, ok := obj.(*etosv1alpha1.Provider)
+	if !ok {
+		return nil, errors.New("object received from job manager is not a Provider")
+	}
+	if provider.Spec.Image == "" {
+		return nil, errors.New("the provider must have an image for 'exec' health checks")
+	}
+	ttl := int32(300)
+	grace := int64(30)
+	backoff := int32(0)
+	deadline := int64((healthcheckTimeout(healthcheck) + healthcheckJobStartup).Seconds())
+	labels := map[string]string{
+		"app.kubernetes.io/name":                   "provider-healthcheck",
+		"app.kubernetes.io/part-of":                "etos",
+		"etos.eiffel-community.github.io/provider": provider.Name,
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:       labels,
+			GenerateName: fmt.Sprintf("%s-healthcheck-", provider.Name),
+			Namespace:    provider.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			TTLSecondsAfterFinished: &ttl,
+			BackoffLimit:            &backoff,
+			ActiveDeadlineSeconds:   &deadline,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					TerminationGracePeriodSeconds: &grace,
+					RestartPolicy:                 corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:            healthcheckContainerName,
+							Image:           provider.Spec.Image,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Env:             provider.Spec.Env,
+							EnvFrom:         provider.Spec.EnvFrom,
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("256Mi"),
+									corev1.ResourceCPU:    resource.MustParse("250m"),
+								},
+								Requests: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("128Mi"),
+									corev1.ResourceCPU:    resource.MustParse("100m"),
+								},
+							},
+							Args: []string{
+								"-healthcheck",
+								fmt.Sprintf("-healthcheck-timeout=%s", healthcheckTimeout(healthcheck)),
+								fmt.Sprintf("-namespace=%s", provider.Namespace),
+								fmt.Sprintf("-provider=%s", provider.Name),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	provider.Spec.ApplyToContainer(&job.Spec.Template.Spec.Containers[0])
+	provider.Spec.ApplyToPod(&job.Spec.Template.Spec)
+	return job, ctrl.SetControllerReference(provider, job, r.Scheme)
+}
@@ -0,0 +1,152 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/controller/status"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+var _ = Describe("Provider health checks", func() {
+	DescribeTable("expected status codes",
+		func(expected []string, statusCode int, want bool) {
+			ok, err := isExpectedStatus(expected, statusCode)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(Equal(want))
+		},
+		Entry("204 by default", nil, http.StatusNoContent, true),
+		Entry("not 200 by default", nil, http.StatusOK, false),
+		Entry("a single status code", []string{"200"}, http.StatusOK, true),
+		Entry("another status code", []string{"200"}, http.StatusNoContent, false),
+		Entry("the first in a range", []string{"200-299"}, http.StatusOK, true),
+		Entry("the last in a range", []string{"200-299"}, 299, true),
+		Entry("outside of a range", []string{"200-299"}, http.StatusMultipleChoices, false),
+		Entry("one of several", []string{"200", "300-399"}, http.StatusFound, true),
+		Entry("whitespace around a range", []string{"200 - 204"}, http.StatusNoContent, true),
+	)
+
+	DescribeTable("invalid expected status codes",
+		func(expected []string) {
+			_, err := isExpectedStatus(expected, http.StatusOK)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("not a number", []string{"ok"}),
+		Entry("not a range", []string{"200-ok"}),
+	)
+
+	It("should give an 'exec' health check Job time to start", func() {
+		reconciler := &ProviderReconciler{Client: providertest.NewFakeClient(), Scheme: providertest.NewFakeClient().Scheme()}
+		provider := providertest.NewProvider("provider", "default", "iut").WithImage("provider:latest").Build()
+		healthcheck := &etosv1alpha1.Healthcheck{Protocol: "exec", TimeoutSeconds: 10}
+		job, err := reconciler.healthcheckJob(provider, healthcheck)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*job.Spec.ActiveDeadlineSeconds).To(Equal(int64((10*time.Second + healthcheckJobStartup).Seconds())))
+		Expect(job.Spec.Template.Spec.Containers[0].Args).To(ContainElement("-healthcheck-timeout=10s"))
+	})
+
+	Context("with a failure threshold", func() {
+		const namespace = "default"
+		var (
+			ctx        context.Context
+			cli        client.Client
+			reconciler *ProviderReconciler
+			provider   *etosv1alpha1.Provider
+			healthy    atomic.Bool
+		)
+
+		// check runs a health check and returns the number of consecutive failures and whether the
+		// provider is available.
+		check := func() (int, bool) {
+			Expect(cli.Get(ctx, client.ObjectKeyFromObject(provider), provider)).To(Succeed())
+			// Run the health check now, instead of waiting for the interval.
+			provider.Status.LastHealthCheckTime = nil
+			Expect(cli.Status().Update(ctx, provider)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(provider)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cli.Get(ctx, client.ObjectKeyFromObject(provider), provider)).To(Succeed())
+			available := meta.FindStatusCondition(provider.Status.Conditions, status.StatusAvailable)
+			Expect(available).NotTo(BeNil())
+			return provider.Status.ConsecutiveFailures, available.Status == metav1.ConditionTrue
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if healthy.Load() {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			DeferCleanup(server.Close)
+			provider = providertest.NewProvider("provider", namespace, "iut").Build()
+			provider.Spec.Host = server.URL
+			provider.Spec.Healthcheck = &etosv1alpha1.Healthcheck{
+				Endpoint:         "selftest/ping",
+				IntervalSeconds:  30,
+				Protocol:         "http",
+				FailureThreshold: 2,
+			}
+			cli = providertest.NewFakeClient(provider)
+			reconciler = &ProviderReconciler{Client: cli, Scheme: cli.Scheme()}
+		})
+
+		It("should only make an available provider unavailable when the threshold is reached", func() {
+			By("not giving a provider that has never been available the benefit of the threshold")
+			healthy.Store(false)
+			failures, available := check()
+			Expect(failures).To(Equal(1))
+			Expect(available).To(BeFalse())
+
+			By("making the provider available when a health check passes")
+			healthy.Store(true)
+			failures, available = check()
+			Expect(failures).To(Equal(0))
+			Expect(available).To(BeTrue())
+
+			By("keeping the provider available below the threshold")
+			healthy.Store(false)
+			failures, available = check()
+			Expect(failures).To(Equal(1))
+			Expect(available).To(BeTrue())
+
+			By("making the provider unavailable at the threshold")
+			failures, available = check()
+			Expect(failures).To(Equal(2))
+			Expect(available).To(BeFalse())
+
+			By("resetting the failures when a health check passes")
+			healthy.Store(true)
+			failures, available = check()
+			Expect(failures).To(Equal(0))
+			Expect(available).To(BeTrue())
+		})
+	})
+})
@@ -19,19 +19,20 @@ package controller
 import (
 	"context"
 	"errors"
+	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
-	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
 	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
 	"github.com/eiffel-community/etos/internal/controller/jobs"
 	"github.com/eiffel-community/etos/internal/controller/status"
@@ -41,7 +42,8 @@ import (
 // IutReconciler reconciles a Iut object
 type IutReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder events.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=iuts,verbs=get;list;watch;create;update;patch;delete
@@ -112,7 +114,13 @@ func (r *IutReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 			}
 		}
 		logger.Info("Iut is being managed by Environment", "iut", iut.Name)
-		return ctrl.Result{}, nil
+		return expiryResult(reconcileLease(
+			ctx, r.Client, iut, iut.Spec.Lease, &iut.Status.RenewTime, &iut.Status.Conditions,
+		))
+	}
+	// An administrator can remove a resource that cannot be released, e.g. after it has leaked.
+	if finalized, err := forceFinalize(ctx, r.Client, r.Recorder, iut, providerFinalizer); finalized || err != nil {
+		return expiryResult(0, err)
 	}
 	// If the IUT is considered 'Completed', it has been released. Check that the object is
 	// being deleted and contains the finalizer and remove the finalizer.
@@ -129,21 +137,36 @@ func (r *IutReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 			}
 		}
 		// Delete job after the IUT has completed.
-		jobManager := jobs.NewJob(r.Client, IutOwnerKey, iut.GetName(), iut.GetNamespace())
+		jobManager := newReleaseManager(ctx, r.Client, IutOwnerKey, iut, iut.Spec.ProviderID)
 		_ = jobManager.Delete(ctx)
 		return ctrl.Result{}, nil
 	}
-	if err := r.reconcile(ctx, iut); err != nil {
+	// Release the IUT if it has passed its deadline or has been orphaned.
+	deadline, reaped, err := reap(ctx, r.Client, r.Recorder, standaloneIut(iut))
+	if reaped || err != nil {
+		return expiryResult(0, err)
+	}
+	retryAfter, err := r.reconcile(ctx, iut)
+	if err != nil {
 		if apierrors.IsConflict(err) {
 			return ctrl.Result{Requeue: true}, nil
 		}
 		return ctrl.Result{}, err
 	}
-	return ctrl.Result{}, nil
+	// Retry a failed release when its backoff has passed.
+	if retryAfter > 0 {
+		return ctrl.Result{RequeueAfter: retryAfter}, nil
+	}
+	// Releases by remote providers cannot be watched like release jobs, poll them until done.
+	if !iut.DeletionTimestamp.IsZero() && isStatusReason(iut.Status.Conditions, status.StatusActive, status.ReasonPending) {
+		return ctrl.Result{RequeueAfter: remotePollInterval}, nil
+	}
+	lease, err := reconcileLease(ctx, r.Client, iut, iut.Spec.Lease, &iut.Status.RenewTime, &iut.Status.Conditions)
+	return expiryResult(earliest(deadline, lease), err)
 }
 
 // reconcile an IUT resource to its desired state.
-func (r *IutReconciler) reconcile(ctx context.Context, iut *etosv1alpha2.Iut) error {
+func (r *IutReconciler) reconcile(ctx context.Context, iut *etosv1alpha2.Iut) (time.Duration, error) {
 	logger := logf.FromContext(ctx)
 
 	// Set initial statuses if not set.
@@ -155,68 +178,52 @@ func (r *IutReconciler) reconcile(ctx context.Context, iut *etosv1alpha2.Iut) er
 				Reason:  status.ReasonPending,
 				Message: "Waiting for environment",
 			})
-		return r.Status().Update(ctx, iut)
-	} else if active.Reason == status.ReasonFailed {
+		return 0, r.Status().Update(ctx, iut)
+	} else if active.Reason == status.ReasonFailed || active.Reason == status.ReasonLeaked {
 		logger.Info("IUT failed, reconciliation canceled")
-		return nil
+		return 0, nil
 	}
 	if iut.DeletionTimestamp.IsZero() {
 		if !controllerutil.ContainsFinalizer(iut, providerFinalizer) {
 			controllerutil.AddFinalizer(iut, providerFinalizer)
 			logger.Info("Iut is being managed by Iut controller", "iut", iut.Name)
-			return r.Update(ctx, iut)
+			return 0, r.Update(ctx, iut)
 		}
 	}
 
 	if !iut.DeletionTimestamp.IsZero() {
 		return r.reconcileIutReleaser(ctx, iut)
 	}
-	return nil
+	return 0, nil
 }
 
 // reconcileIutReleaser gets the status of a release job, creating a new release job if necessary.
-func (r *IutReconciler) reconcileIutReleaser(ctx context.Context, iut *etosv1alpha2.Iut) error {
+func (r *IutReconciler) reconcileIutReleaser(ctx context.Context, iut *etosv1alpha2.Iut) (time.Duration, error) {
 	conditions := &iut.Status.Conditions
-	jobManager := jobs.NewJob(r.Client, IutOwnerKey, iut.GetName(), iut.GetNamespace())
+	jobManager := newReleaseManager(ctx, r.Client, IutOwnerKey, iut, iut.Spec.ProviderID)
 	jobStatus, err := jobManager.Status(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	switch jobStatus {
-	case jobs.StatusFailed:
+	case jobs.StatusFailed, jobs.StatusSuccessful:
+		// A release job may be shared by several resources, the result is the result of this resource.
 		result := jobManager.Result(ctx, release.IutReleaserName)
-		if meta.SetStatusCondition(conditions,
-			metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  status.ReasonFailed,
-				Message: result.Description,
-			}) {
-			return r.Status().Update(ctx, iut)
-		}
-	case jobs.StatusSuccessful:
-		result := jobManager.Result(ctx, release.IutReleaserName)
-		var condition metav1.Condition
 		if result.Conclusion == jobs.ConclusionFailed {
-			condition = metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  status.ReasonFailed,
-				Message: result.Description,
-			}
-		} else {
-			condition = metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  status.ReasonCompleted,
-				Message: result.Description,
-			}
+			return standaloneIut(iut).releaseFailed(ctx, r.Client, r.Recorder, jobManager, result.Description)
+		}
+		condition := metav1.Condition{
+			Type:    status.StatusActive,
+			Status:  metav1.ConditionFalse,
+			Reason:  status.ReasonCompleted,
+			Message: result.Description,
 		}
 		iutCondition := meta.FindStatusCondition(*conditions, status.StatusActive)
 		iut.Status.CompletionTime = &iutCondition.LastTransitionTime
 		if meta.SetStatusCondition(conditions, condition) {
+			recordReleased(ctx, "Iut", status.ReasonCompleted)
 			// Update status only; job deletion is deferred to the next reconcile.
-			return r.Status().Update(ctx, iut)
+			return 0, r.Status().Update(ctx, iut)
 		}
 	case jobs.StatusActive:
 		if meta.SetStatusCondition(conditions,
@@ -226,12 +233,32 @@ func (r *IutReconciler) reconcileIutReleaser(ctx context.Context, iut *etosv1alp
 				Reason:  status.ReasonPending,
 				Message: "Releasing IUT",
 			}) {
-			return r.Status().Update(ctx, iut)
+			return 0, r.Status().Update(ctx, iut)
 		}
 	default:
 		// Since this is a release job, we don't want to release if we are not deleting.
 		if iut.GetDeletionTimestamp().IsZero() {
-			return nil
+			return 0, nil
+		}
+		// Wait for the backoff of a failed release to pass before retrying it.
+		if retrying(iut.Status.Release) {
+			return retryRemaining(iut.Status.Release), nil
+		}
+		// Wait for the EnvironmentRequest to release this resource together with its other resources.
+		batched, err := standaloneIut(iut).awaitsBatchRelease(ctx, r.Client)
+		if err != nil {
+			return 0, err
+		}
+		if batched {
+			if meta.SetStatusCondition(conditions, metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Type:    status.StatusActive,
+				Reason:  status.ReasonPending,
+				Message: "Waiting for batch release",
+			}) {
+				return 0, r.Status().Update(ctx, iut)
+			}
+			return 0, nil
 		}
 		if err := jobManager.Create(ctx, iut, r.releaseJob); err != nil {
 			// When we create a job the job gets a unique name. If there's an error for that unique name the error
@@ -245,9 +272,9 @@ func (r *IutReconciler) reconcileIutReleaser(ctx context.Context, iut *etosv1alp
 					Reason:  status.ReasonFailed,
 					Message: err.Error(),
 				}) {
-				return r.Status().Update(ctx, iut)
+				return 0, r.Status().Update(ctx, iut)
 			}
-			return err
+			return 0, err
 		}
 		if meta.SetStatusCondition(conditions, metav1.Condition{
 			Status:  metav1.ConditionFalse,
@@ -255,10 +282,27 @@ func (r *IutReconciler) reconcileIutReleaser(ctx context.Context, iut *etosv1alp
 			Reason:  status.ReasonPending,
 			Message: "Releasing IUT",
 		}) {
-			return r.Status().Update(ctx, iut)
+			return 0, r.Status().Update(ctx, iut)
 		}
 	}
-	return nil
+	return 0, nil
+}
+
+// standaloneIut returns the IUT as a resource that is not owned by an Environment.
+func standaloneIut(iut *etosv1alpha2.Iut) standaloneResource {
+	return standaloneResource{
+		obj:                iut,
+		kind:               "Iut",
+		ownerKey:           IutOwnerKey,
+		releaserName:       release.IutReleaserName,
+		deadline:           iut.Spec.Deadline,
+		lease:              iut.Spec.Lease,
+		environmentRequest: iut.Spec.EnvironmentRequest,
+		provider:           iut.Spec.ProviderID,
+		conditions:         &iut.Status.Conditions,
+		completionTime:     &iut.Status.CompletionTime,
+		release:            &iut.Status.Release,
+	}
 }
 
 // releaseJob is the job definition for an IUT releaser.
@@ -272,8 +316,8 @@ func (r IutReconciler) releaseJob(ctx context.Context, obj client.Object) (*batc
 	if err != nil {
 		return nil, err
 	}
-	environmentrequest := &etosv1alpha1.EnvironmentRequest{}
-	if err := r.Get(ctx, types.NamespacedName{Name: iut.Spec.EnvironmentRequest, Namespace: iut.Namespace}, environmentrequest); err != nil {
+	environmentrequest, err := releaseEnvironmentRequest(ctx, r, iut, iut.Spec.EnvironmentRequest)
+	if err != nil {
 		return nil, err
 	}
 
@@ -288,15 +332,14 @@ func (r IutReconciler) releaseJob(ctx context.Context, obj client.Object) (*batc
 func (r *IutReconciler) registerOwnerIndexForJob(mgr ctrl.Manager) error {
 	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &batchv1.Job{}, IutOwnerKey, func(rawObj client.Object) []string {
 		job := rawObj.(*batchv1.Job)
-		owner := metav1.GetControllerOf(job)
-		if owner == nil {
-			return nil
-		}
-		if owner.APIVersion != APIv2GroupVersionString || owner.Kind != "Iut" {
-			return nil
+		// Jobs that release several resources in a batch are owned by all of them.
+		var owners []string
+		for _, owner := range job.GetOwnerReferences() {
+			if owner.APIVersion == APIv2GroupVersionString && owner.Kind == "Iut" {
+				owners = append(owners, owner.Name)
+			}
 		}
-
-		return []string{owner.Name}
+		return owners
 	}); err != nil {
 		return err
 	}
@@ -312,6 +355,6 @@ func (r *IutReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&etosv1alpha2.Iut{}).
 		Named("iut").
-		Owns(&batchv1.Job{}). // Release job
-		Complete(r)
+		Owns(&batchv1.Job{}, builder.MatchEveryOwner). // Release jobs, which may be shared
+		Complete(traced(r.Client, &etosv1alpha2.Iut{}, r))
 }
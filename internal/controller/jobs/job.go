@@ -27,6 +27,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/eiffel-community/etos/pkg/opentelemetry"
 )
 
 // job helps manage jobs for an owner
@@ -122,6 +124,12 @@ func (j *job) Result(ctx context.Context, containerName string, containerNames .
 			if jobResult.Conclusion == ConclusionFailed && result.Conclusion != ConclusionFailed {
 				result.Conclusion = ConclusionFailed
 			}
+			for name, description := range jobResult.FailedResources {
+				if result.FailedResources == nil {
+					result.FailedResources = make(map[string]string)
+				}
+				result.FailedResources[name] = description
+			}
 			if jobResult.Verdict == VerdictFailed && result.Verdict != VerdictFailed {
 				result.Verdict = jobResult.Verdict
 			} else if result.Verdict == VerdictNone {
@@ -141,9 +149,23 @@ func (j job) Create(ctx context.Context, obj client.Object, jobSpecFunc JobSpecF
 	if err != nil {
 		return fmt.Errorf("failed to create job spec: %v", err)
 	}
+	InjectTraceContext(ctx, jobSpec)
 	return j.Client.Create(ctx, jobSpec)
 }
 
+// InjectTraceContext sets the TRACEPARENT, TRACESTATE and BAGGAGE environment variables of all
+// containers in a job to the span context of ctx, so that the job continues the trace of the
+// reconcile that created it.
+func InjectTraceContext(ctx context.Context, jobSpec *batchv1.Job) {
+	podSpec := &jobSpec.Spec.Template.Spec
+	for i := range podSpec.InitContainers {
+		opentelemetry.InjectEnv(ctx, &podSpec.InitContainers[i])
+	}
+	for i := range podSpec.Containers {
+		opentelemetry.InjectEnv(ctx, &podSpec.Containers[i])
+	}
+}
+
 // Delete all owned jobs
 func (j job) Delete(ctx context.Context) error {
 	logger := log.FromContext(ctx)
@@ -0,0 +1,112 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// sharedJob helps manage jobs that are shared by several owners, I.e. a job that releases
+// several resources at once.
+//
+// The result of a shared job is the result of its owner, and deleting it only removes the
+// owner from the job, unless the owner is the last one.
+type sharedJob struct {
+	*job
+	owner client.Object
+}
+
+// NewSharedJob creates a new job manager for jobs that may be owned by several objects.
+//
+// The ownerKey index must list all owners of a job, not only its controller.
+func NewSharedJob(c client.Client, ownerKey string, owner client.Object) Job {
+	return &sharedJob{
+		job:   &job{Client: c, ownerKey: ownerKey, name: owner.GetName(), namespace: owner.GetNamespace()},
+		owner: owner,
+	}
+}
+
+// Result returns the result of the owner in the jobs.
+//
+// If the jobs report failed resources, the owner has failed only if it is one of them,
+// otherwise the result is the result of the jobs as a whole.
+func (j *sharedJob) Result(ctx context.Context, containerName string, containerNames ...string) Result {
+	result := j.job.Result(ctx, containerName, containerNames...)
+	if len(result.FailedResources) == 0 {
+		// A failed job that does not report which resources failed has failed for all of them.
+		if !j.successful() && j.failed() {
+			result.Conclusion = ConclusionFailed
+		}
+		return result
+	}
+	if description, ok := result.FailedResources[j.owner.GetName()]; ok {
+		return Result{Conclusion: ConclusionFailed, Verdict: result.Verdict, Description: description}
+	}
+	return Result{
+		Conclusion:  ConclusionSuccessful,
+		Verdict:     VerdictNone,
+		Description: fmt.Sprintf("Successfully released %s", j.owner.GetName()),
+	}
+}
+
+// Delete removes the owner from all its jobs, deleting the jobs that have no other owners.
+func (j *sharedJob) Delete(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	var multiErr error
+	for _, job := range j.all() {
+		if !job.DeletionTimestamp.IsZero() {
+			continue
+		}
+		references := j.otherOwners(job)
+		if len(references) == 0 {
+			logger.Info("Deleting job", "name", job.Name)
+			if err := j.Client.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+				if !apierrors.IsNotFound(err) {
+					multiErr = errors.Join(multiErr, err)
+				}
+			}
+			continue
+		}
+		logger.Info("Removing owner from shared job", "name", job.Name, "owner", j.owner.GetName())
+		patch := client.MergeFromWithOptions(job.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		job.SetOwnerReferences(references)
+		if err := j.Client.Patch(ctx, job, patch); err != nil {
+			if !apierrors.IsNotFound(err) {
+				multiErr = errors.Join(multiErr, err)
+			}
+		}
+	}
+	return multiErr
+}
+
+// otherOwners returns the owner references of a job, except the one of the owner of this job manager.
+func (j *sharedJob) otherOwners(job *batchv1.Job) []metav1.OwnerReference {
+	var references []metav1.OwnerReference
+	for _, reference := range job.GetOwnerReferences() {
+		if reference.UID != j.owner.GetUID() {
+			references = append(references, reference)
+		}
+	}
+	return references
+}
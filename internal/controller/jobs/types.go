@@ -55,6 +55,9 @@ type Result struct {
 	Conclusion  Conclusion `json:"conclusion"`
 	Verdict     Verdict    `json:"verdict,omitempty"`
 	Description string     `json:"description,omitempty"`
+	// FailedResources maps the names of resources that failed in a job releasing several
+	// resources to a description of the failure.
+	FailedResources map[string]string `json:"failedResources,omitempty"`
 }
 
 type JobSpecFunc func(context.Context, client.Object) (*batchv1.Job, error)
@@ -0,0 +1,156 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/status"
+)
+
+// leaseRenewTime returns the time that the lease of a resource was last renewed. A lease that has never
+// been renewed, or that has an invalid renew time annotation, was renewed when the resource was created.
+func leaseRenewTime(obj client.Object) metav1.Time {
+	renewTime := obj.GetCreationTimestamp()
+	annotation, ok := obj.GetAnnotations()[etosv1alpha2.LeaseRenewTimeAnnotation]
+	if !ok {
+		return renewTime
+	}
+	renewed, err := time.Parse(time.RFC3339, annotation)
+	if err != nil || renewed.Before(renewTime.Time) {
+		return renewTime
+	}
+	// Times are stored with a precision of seconds in the status of the resource.
+	return metav1.NewTime(renewed.Truncate(time.Second))
+}
+
+// leaseExpiry returns the time that the lease of a resource lapses, unless it is renewed.
+func leaseExpiry(obj client.Object, lease *etosv1alpha2.Lease) time.Time {
+	return leaseRenewTime(obj).Add(time.Duration(lease.DurationSeconds) * time.Second)
+}
+
+// environmentLeaseRemaining returns the time left until the first of the leases of the resources used by an
+// Environment lapses, or zero if none of the resources has a lease that has not lapsed.
+func environmentLeaseRemaining(ctx context.Context, c client.Reader, environment *etosv1alpha1.Environment) (time.Duration, error) {
+	if environment.Spec.Providers == nil {
+		return 0, nil
+	}
+	namespace := environment.Namespace
+	var remaining []time.Duration
+	iut := &etosv1alpha2.Iut{}
+	if err := c.Get(ctx, types.NamespacedName{Name: environment.Spec.Providers.IUT, Namespace: namespace}, iut); err == nil {
+		if iut.Spec.Lease != nil {
+			remaining = append(remaining, time.Until(leaseExpiry(iut, iut.Spec.Lease)))
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return 0, err
+	}
+	executionSpace := &etosv1alpha2.ExecutionSpace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: environment.Spec.Providers.ExecutionSpace, Namespace: namespace}, executionSpace); err == nil {
+		if executionSpace.Spec.Lease != nil {
+			remaining = append(remaining, time.Until(leaseExpiry(executionSpace, executionSpace.Spec.Lease)))
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return 0, err
+	}
+	logArea := &etosv1alpha2.LogArea{}
+	if err := c.Get(ctx, types.NamespacedName{Name: environment.Spec.Providers.LogArea, Namespace: namespace}, logArea); err == nil {
+		if logArea.Spec.Lease != nil {
+			remaining = append(remaining, time.Until(leaseExpiry(logArea, logArea.Spec.Lease)))
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return 0, err
+	}
+	return earliest(remaining...), nil
+}
+
+// reconcileLease releases a resource when its lease has lapsed. A resource that is used by an Environment
+// is released by deleting the Environment, any other resource is deleted. The renew time in the status of
+// the resource is updated when the lease has been renewed.
+//
+// Returns the time left of the lease, which is zero if the resource has no lease or if the lease has lapsed.
+func reconcileLease(
+	ctx context.Context,
+	c client.Client,
+	obj client.Object,
+	lease *etosv1alpha2.Lease,
+	renewTime **metav1.Time,
+	conditions *[]metav1.Condition,
+) (time.Duration, error) {
+	if lease == nil || !obj.GetDeletionTimestamp().IsZero() {
+		return 0, nil
+	}
+	logger := logf.FromContext(ctx)
+	renewed := leaseRenewTime(obj)
+	if *renewTime == nil || !(*renewTime).Equal(&renewed) {
+		*renewTime = &renewed
+		return 0, c.Status().Update(ctx, obj)
+	}
+	expiry := leaseExpiry(obj, lease)
+	if remaining := time.Until(expiry); remaining > 0 {
+		return remaining, nil
+	}
+
+	for _, owner := range obj.GetOwnerReferences() {
+		if owner.Kind != "Environment" {
+			continue
+		}
+		logger.Info("Lease has lapsed, releasing environment", "environment", owner.Name, "expiry", expiry)
+		environment := &etosv1alpha1.Environment{}
+		environment.Name = owner.Name
+		environment.Namespace = obj.GetNamespace()
+		return 0, client.IgnoreNotFound(c.Delete(ctx, environment))
+	}
+	logger.Info("Lease has lapsed, releasing resource", "expiry", expiry)
+	if meta.SetStatusCondition(conditions,
+		metav1.Condition{
+			Type:    status.StatusActive,
+			Status:  metav1.ConditionFalse,
+			Reason:  status.ReasonTimedOut,
+			Message: fmt.Sprintf("Lease lapsed at %s", expiry),
+		}) {
+		return 0, c.Status().Update(ctx, obj)
+	}
+	return 0, client.IgnoreNotFound(c.Delete(ctx, obj))
+}
+
+// expiryResult returns the reconciliation result of a resource that expires, requeueing the resource
+// when it expires.
+func expiryResult(remaining time.Duration, err error) (ctrl.Result, error) {
+	if err != nil {
+		if apierrors.IsConflict(err) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+	return ctrl.Result{}, nil
+}
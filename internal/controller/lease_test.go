@@ -0,0 +1,152 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/status"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+var _ = Describe("Leases", func() {
+	const namespace = "default"
+	var (
+		ctx context.Context
+		cli client.Client
+		iut *etosv1alpha2.Iut
+	)
+
+	// newIut creates an IUT, created some time ago, with a lease and a deadline.
+	newIut := func(created time.Duration, lease *etosv1alpha2.Lease, deadline time.Time) {
+		iut = &etosv1alpha2.Iut{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "iut",
+				Namespace:         namespace,
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-created).Truncate(time.Second)),
+				Finalizers:        []string{providerFinalizer},
+			},
+			Spec: etosv1alpha2.IutSpec{
+				ID:                 uuid.NewString(),
+				EnvironmentRequest: "environment-request",
+				ProviderID:         "iut-provider",
+				Lease:              lease,
+				Deadline:           deadline.Unix(),
+			},
+		}
+		Expect(cli.Create(ctx, iut)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+	}
+
+	// renew renews the lease of the IUT, as the user of the IUT does.
+	renew := func(at time.Time) {
+		iut.Annotations = map[string]string{etosv1alpha2.LeaseRenewTimeAnnotation: at.UTC().Format(time.RFC3339)}
+		Expect(cli.Update(ctx, iut)).To(Succeed())
+	}
+
+	// reconcile runs reconcileLease for the IUT until the renew time in its status is up to date.
+	reconcile := func() time.Duration {
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+		remaining, err := reconcileLease(ctx, cli, iut, iut.Spec.Lease, &iut.Status.RenewTime, &iut.Status.Conditions)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+		if remaining == 0 && !isStatusReason(iut.Status.Conditions, status.StatusActive, status.ReasonTimedOut) {
+			remaining, err = reconcileLease(ctx, cli, iut, iut.Spec.Lease, &iut.Status.RenewTime, &iut.Status.Conditions)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		return remaining
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		cli = providertest.NewFakeClient(
+			providertest.NewEnvironmentRequest("environment-request", namespace).Build(),
+			providertest.NewProvider("iut-provider", namespace, "iut").Build(),
+		)
+	})
+
+	It("should keep a resource while its lease is renewed", func() {
+		newIut(30*time.Second, &etosv1alpha2.Lease{DurationSeconds: 60}, time.Now().Add(time.Hour))
+		Expect(reconcile()).To(BeNumerically("~", 30*time.Second, 2*time.Second))
+		Expect(iut.Status.RenewTime.Time).To(Equal(iut.CreationTimestamp.Time))
+
+		By("extending the lease when it is renewed")
+		renewed := time.Now().Truncate(time.Second)
+		renew(renewed)
+		Expect(reconcile()).To(BeNumerically("~", time.Minute, 2*time.Second))
+		Expect(iut.Status.RenewTime.Time).To(BeTemporally("==", renewed))
+	})
+
+	It("should release a resource when its lease lapses", func() {
+		newIut(2*time.Minute, &etosv1alpha2.Lease{DurationSeconds: 60}, time.Now().Add(time.Hour))
+		Expect(reconcile()).To(BeZero())
+		Expect(isStatusReason(iut.Status.Conditions, status.StatusActive, status.ReasonTimedOut)).To(BeTrue())
+
+		remaining, err := reconcileLease(ctx, cli, iut, iut.Spec.Lease, &iut.Status.RenewTime, &iut.Status.Conditions)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(BeZero())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+		Expect(iut.DeletionTimestamp.IsZero()).To(BeFalse())
+	})
+
+	It("should not release a resource with a renewed lease at its deadline", func() {
+		newIut(2*time.Minute, &etosv1alpha2.Lease{DurationSeconds: 60}, time.Now().Add(-time.Minute))
+		renew(time.Now())
+		remaining, reaped, err := reap(ctx, cli, nil, standaloneIut(iut))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reaped).To(BeFalse())
+		Expect(remaining).To(BeZero())
+	})
+
+	It("should release a resource with a lapsed lease at its deadline", func() {
+		newIut(2*time.Minute, &etosv1alpha2.Lease{DurationSeconds: 60}, time.Now().Add(-time.Minute))
+		_, reaped, err := reap(ctx, cli, nil, standaloneIut(iut))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reaped).To(BeTrue())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+		Expect(isStatusReason(iut.Status.Conditions, status.StatusActive, status.ReasonTimedOut)).To(BeTrue())
+	})
+
+	It("should keep an Environment past its deadline while the leases of its resources are renewed", func() {
+		newIut(30*time.Second, &etosv1alpha2.Lease{DurationSeconds: 60}, time.Now().Add(-time.Minute))
+		environment := &etosv1alpha1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "environment", Namespace: namespace},
+			Spec: etosv1alpha1.EnvironmentSpec{
+				Deadline:  time.Now().Add(-time.Minute).Unix(),
+				Providers: &etosv1alpha1.Providers{IUT: iut.Name, ExecutionSpace: "missing", LogArea: "missing"},
+			},
+		}
+		remaining, err := environmentLeaseRemaining(ctx, cli, environment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(BeNumerically("~", 30*time.Second, 2*time.Second))
+
+		By("not keeping the Environment when the lease has lapsed")
+		iut.Spec.Lease.DurationSeconds = 10
+		Expect(cli.Update(ctx, iut)).To(Succeed())
+		remaining, err = environmentLeaseRemaining(ctx, cli, environment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(BeZero())
+	})
+})
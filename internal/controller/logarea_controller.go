@@ -19,19 +19,20 @@ package controller
 import (
 	"context"
 	"errors"
+	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
-	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
 	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
 	"github.com/eiffel-community/etos/internal/controller/jobs"
 	"github.com/eiffel-community/etos/internal/controller/status"
@@ -41,7 +42,8 @@ import (
 // LogAreaReconciler reconciles a LogArea object
 type LogAreaReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder events.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=logarea,verbs=get;list;watch;create;update;patch;delete
@@ -110,7 +112,13 @@ func (r *LogAreaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 			}
 		}
 		logger.Info("LogArea is being managed by Environment", "logarea", logarea.Name)
-		return ctrl.Result{}, nil
+		return expiryResult(reconcileLease(
+			ctx, r.Client, logarea, logarea.Spec.Lease, &logarea.Status.RenewTime, &logarea.Status.Conditions,
+		))
+	}
+	// An administrator can remove a resource that cannot be released, e.g. after it has leaked.
+	if finalized, err := forceFinalize(ctx, r.Client, r.Recorder, logarea, providerFinalizer); finalized || err != nil {
+		return expiryResult(0, err)
 	}
 	// If the LogArea is considered 'Completed', it has been released. Check that the object is
 	// being deleted and contains the finalizer and remove the finalizer.
@@ -127,21 +135,36 @@ func (r *LogAreaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 			}
 		}
 		// Delete job after the log area has completed.
-		jobManager := jobs.NewJob(r.Client, LogAreaOwnerKey, logarea.GetName(), logarea.GetNamespace())
+		jobManager := newReleaseManager(ctx, r.Client, LogAreaOwnerKey, logarea, logarea.Spec.ProviderID)
 		_ = jobManager.Delete(ctx)
 		return ctrl.Result{}, nil
 	}
-	if err := r.reconcile(ctx, logarea); err != nil {
+	// Release the LogArea if it has passed its deadline or has been orphaned.
+	deadline, reaped, err := reap(ctx, r.Client, r.Recorder, standaloneLogArea(logarea))
+	if reaped || err != nil {
+		return expiryResult(0, err)
+	}
+	retryAfter, err := r.reconcile(ctx, logarea)
+	if err != nil {
 		if apierrors.IsConflict(err) {
 			return ctrl.Result{Requeue: true}, nil
 		}
 		return ctrl.Result{}, err
 	}
-	return ctrl.Result{}, nil
+	// Retry a failed release when its backoff has passed.
+	if retryAfter > 0 {
+		return ctrl.Result{RequeueAfter: retryAfter}, nil
+	}
+	// Releases by remote providers cannot be watched like release jobs, poll them until done.
+	if !logarea.DeletionTimestamp.IsZero() && isStatusReason(logarea.Status.Conditions, status.StatusActive, status.ReasonPending) {
+		return ctrl.Result{RequeueAfter: remotePollInterval}, nil
+	}
+	lease, err := reconcileLease(ctx, r.Client, logarea, logarea.Spec.Lease, &logarea.Status.RenewTime, &logarea.Status.Conditions)
+	return expiryResult(earliest(deadline, lease), err)
 }
 
 // reconcile a logarea resource to its desired state.
-func (r *LogAreaReconciler) reconcile(ctx context.Context, logarea *etosv1alpha2.LogArea) error {
+func (r *LogAreaReconciler) reconcile(ctx context.Context, logarea *etosv1alpha2.LogArea) (time.Duration, error) {
 	logger := logf.FromContext(ctx)
 
 	// Set initial statuses if not set.
@@ -153,68 +176,52 @@ func (r *LogAreaReconciler) reconcile(ctx context.Context, logarea *etosv1alpha2
 				Reason:  status.ReasonPending,
 				Message: "Waiting for environment",
 			})
-		return r.Status().Update(ctx, logarea)
-	} else if active.Reason == status.ReasonFailed {
+		return 0, r.Status().Update(ctx, logarea)
+	} else if active.Reason == status.ReasonFailed || active.Reason == status.ReasonLeaked {
 		logger.Info("LogArea failed, reconciliation canceled")
-		return nil
+		return 0, nil
 	}
 	if logarea.DeletionTimestamp.IsZero() {
 		if !controllerutil.ContainsFinalizer(logarea, providerFinalizer) {
 			controllerutil.AddFinalizer(logarea, providerFinalizer)
 			logger.Info("LogArea is being managed by LogArea controller", "logarea", logarea.Name)
-			return r.Update(ctx, logarea)
+			return 0, r.Update(ctx, logarea)
 		}
 	}
 
 	if !logarea.DeletionTimestamp.IsZero() {
 		return r.reconcileLogAreaReleaser(ctx, logarea)
 	}
-	return nil
+	return 0, nil
 }
 
 // reconcileLogAreaReleaser gets the status of a release job, creating a new release job if necessary.
-func (r *LogAreaReconciler) reconcileLogAreaReleaser(ctx context.Context, logarea *etosv1alpha2.LogArea) error {
+func (r *LogAreaReconciler) reconcileLogAreaReleaser(ctx context.Context, logarea *etosv1alpha2.LogArea) (time.Duration, error) {
 	conditions := &logarea.Status.Conditions
-	jobManager := jobs.NewJob(r.Client, LogAreaOwnerKey, logarea.GetName(), logarea.GetNamespace())
+	jobManager := newReleaseManager(ctx, r.Client, LogAreaOwnerKey, logarea, logarea.Spec.ProviderID)
 	jobStatus, err := jobManager.Status(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	switch jobStatus {
-	case jobs.StatusFailed:
+	case jobs.StatusFailed, jobs.StatusSuccessful:
+		// A release job may be shared by several resources, the result is the result of this resource.
 		result := jobManager.Result(ctx, release.LogAreaReleaserName)
-		if meta.SetStatusCondition(conditions,
-			metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  status.ReasonFailed,
-				Message: result.Description,
-			}) {
-			return r.Status().Update(ctx, logarea)
-		}
-	case jobs.StatusSuccessful:
-		result := jobManager.Result(ctx, release.LogAreaReleaserName)
-		var condition metav1.Condition
 		if result.Conclusion == jobs.ConclusionFailed {
-			condition = metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  status.ReasonFailed,
-				Message: result.Description,
-			}
-		} else {
-			condition = metav1.Condition{
-				Type:    status.StatusActive,
-				Status:  metav1.ConditionFalse,
-				Reason:  status.ReasonCompleted,
-				Message: result.Description,
-			}
+			return standaloneLogArea(logarea).releaseFailed(ctx, r.Client, r.Recorder, jobManager, result.Description)
+		}
+		condition := metav1.Condition{
+			Type:    status.StatusActive,
+			Status:  metav1.ConditionFalse,
+			Reason:  status.ReasonCompleted,
+			Message: result.Description,
 		}
 		now := metav1.Now()
 		logarea.Status.CompletionTime = &now
 		if meta.SetStatusCondition(conditions, condition) {
+			recordReleased(ctx, "LogArea", status.ReasonCompleted)
 			// Update status only; job deletion is deferred to the next reconcile.
-			return r.Status().Update(ctx, logarea)
+			return 0, r.Status().Update(ctx, logarea)
 		}
 	case jobs.StatusActive:
 		if meta.SetStatusCondition(conditions,
@@ -224,12 +231,32 @@ func (r *LogAreaReconciler) reconcileLogAreaReleaser(ctx context.Context, logare
 				Reason:  status.ReasonPending,
 				Message: "Releasing LogArea",
 			}) {
-			return r.Status().Update(ctx, logarea)
+			return 0, r.Status().Update(ctx, logarea)
 		}
 	default:
 		// Since this is a release job, we don't want to release if we are not deleting.
 		if logarea.GetDeletionTimestamp().IsZero() {
-			return nil
+			return 0, nil
+		}
+		// Wait for the backoff of a failed release to pass before retrying it.
+		if retrying(logarea.Status.Release) {
+			return retryRemaining(logarea.Status.Release), nil
+		}
+		// Wait for the EnvironmentRequest to release this resource together with its other resources.
+		batched, err := standaloneLogArea(logarea).awaitsBatchRelease(ctx, r.Client)
+		if err != nil {
+			return 0, err
+		}
+		if batched {
+			if meta.SetStatusCondition(conditions, metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Type:    status.StatusActive,
+				Reason:  status.ReasonPending,
+				Message: "Waiting for batch release",
+			}) {
+				return 0, r.Status().Update(ctx, logarea)
+			}
+			return 0, nil
 		}
 		if err := jobManager.Create(ctx, logarea, r.releaseJob); err != nil {
 			// When we create a job the job gets a unique name. If there's an error for that unique name the error
@@ -243,9 +270,9 @@ func (r *LogAreaReconciler) reconcileLogAreaReleaser(ctx context.Context, logare
 					Reason:  status.ReasonFailed,
 					Message: err.Error(),
 				}) {
-				return r.Status().Update(ctx, logarea)
+				return 0, r.Status().Update(ctx, logarea)
 			}
-			return err
+			return 0, err
 		}
 		if meta.SetStatusCondition(conditions, metav1.Condition{
 			Status:  metav1.ConditionFalse,
@@ -253,10 +280,27 @@ func (r *LogAreaReconciler) reconcileLogAreaReleaser(ctx context.Context, logare
 			Reason:  status.ReasonPending,
 			Message: "Releasing LogArea",
 		}) {
-			return r.Status().Update(ctx, logarea)
+			return 0, r.Status().Update(ctx, logarea)
 		}
 	}
-	return nil
+	return 0, nil
+}
+
+// standaloneLogArea returns the LogArea as a resource that is not owned by an Environment.
+func standaloneLogArea(logarea *etosv1alpha2.LogArea) standaloneResource {
+	return standaloneResource{
+		obj:                logarea,
+		kind:               "LogArea",
+		ownerKey:           LogAreaOwnerKey,
+		releaserName:       release.LogAreaReleaserName,
+		deadline:           logarea.Spec.Deadline,
+		lease:              logarea.Spec.Lease,
+		environmentRequest: logarea.Spec.EnvironmentRequest,
+		provider:           logarea.Spec.ProviderID,
+		conditions:         &logarea.Status.Conditions,
+		completionTime:     &logarea.Status.CompletionTime,
+		release:            &logarea.Status.Release,
+	}
 }
 
 // releaseJob is the job definition for a log area releaser.
@@ -270,8 +314,8 @@ func (r LogAreaReconciler) releaseJob(ctx context.Context, obj client.Object) (*
 	if err != nil {
 		return nil, err
 	}
-	environmentrequest := &etosv1alpha1.EnvironmentRequest{}
-	if err := r.Get(ctx, types.NamespacedName{Name: logarea.Spec.EnvironmentRequest, Namespace: logarea.Namespace}, environmentrequest); err != nil {
+	environmentrequest, err := releaseEnvironmentRequest(ctx, r, logarea, logarea.Spec.EnvironmentRequest)
+	if err != nil {
 		return nil, err
 	}
 
@@ -286,15 +330,14 @@ func (r LogAreaReconciler) releaseJob(ctx context.Context, obj client.Object) (*
 func (r *LogAreaReconciler) registerOwnerIndexForJob(mgr ctrl.Manager) error {
 	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &batchv1.Job{}, LogAreaOwnerKey, func(rawObj client.Object) []string {
 		job := rawObj.(*batchv1.Job)
-		owner := metav1.GetControllerOf(job)
-		if owner == nil {
-			return nil
-		}
-		if owner.APIVersion != APIv2GroupVersionString || owner.Kind != "LogArea" {
-			return nil
+		// Jobs that release several resources in a batch are owned by all of them.
+		var owners []string
+		for _, owner := range job.GetOwnerReferences() {
+			if owner.APIVersion == APIv2GroupVersionString && owner.Kind == "LogArea" {
+				owners = append(owners, owner.Name)
+			}
 		}
-
-		return []string{owner.Name}
+		return owners
 	}); err != nil {
 		return err
 	}
@@ -310,6 +353,6 @@ func (r *LogAreaReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&etosv1alpha2.LogArea{}).
 		Named("logarea").
-		Owns(&batchv1.Job{}). // Release job
-		Complete(r)
+		Owns(&batchv1.Job{}, builder.MatchEveryOwner). // Release jobs, which may be shared
+		Complete(traced(r.Client, &etosv1alpha2.LogArea{}, r))
 }
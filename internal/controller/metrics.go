@@ -0,0 +1,75 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/metric"
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/controller/status"
+	"github.com/eiffel-community/etos/pkg/opentelemetry"
+	"github.com/eiffel-community/etos/pkg/opentelemetry/semconv"
+)
+
+// meter is the OpenTelemetry meter of the controllers.
+var meter = opentelemetry.NewMeter(tracerName)
+
+var (
+	// provisioningDuration records the time from the creation of an EnvironmentRequest until its
+	// provisioning has completed or failed.
+	provisioningDuration = meter.Float64Histogram(
+		"etos.environment_request.provisioning.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of the provisioning of an EnvironmentRequest"),
+	)
+	// releasedResources counts the IUTs, execution spaces and log areas that have been released, or
+	// that have leaked because all attempts to release them failed.
+	releasedResources = meter.Int64Counter(
+		"etos.resources.released",
+		metric.WithDescription("Number of IUTs, execution spaces and log areas released or leaked"),
+	)
+	// reapedResourcesCounter counts the IUTs, execution spaces and log areas that have been released
+	// because they were past their deadline or orphaned, like the reapedResources Prometheus metric.
+	reapedResourcesCounter = meter.Int64Counter(
+		"etos.resources.reaped",
+		metric.WithDescription("Number of IUTs, execution spaces and log areas released because they were past their deadline or orphaned"),
+	)
+)
+
+// recordProvisioned records the provisioning duration of an EnvironmentRequest that has completed.
+func recordProvisioned(ctx context.Context, environmentrequest *etosv1alpha1.EnvironmentRequest) {
+	if environmentrequest.Status.CompletionTime == nil {
+		return
+	}
+	var reason string
+	if condition := meta.FindStatusCondition(environmentrequest.Status.Conditions, status.StatusReady); condition != nil {
+		reason = condition.Reason
+	}
+	duration := environmentrequest.Status.CompletionTime.Sub(environmentrequest.CreationTimestamp.Time)
+	provisioningDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(semconv.ETOSControllerReason(reason)))
+}
+
+// recordReleased counts a released, or leaked, resource of a kind, I.e. "Iut".
+func recordReleased(ctx context.Context, kind, reason string) {
+	releasedResources.Add(ctx, 1, metric.WithAttributes(
+		semconv.ETOSControllerKind(kind),
+		semconv.ETOSControllerReason(reason),
+	))
+}
@@ -18,10 +18,11 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/http"
 	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -43,6 +44,8 @@ type ProviderReconciler struct {
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=providers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=providers/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=etos.eiffel-community.github.io,resources=providers/finalizers,verbs=update
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=get
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -63,13 +66,14 @@ func (r *ProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
-	interval := time.Duration(provider.Spec.Healthcheck.IntervalSeconds) * time.Second
-	lastHealthCheckTime := metav1.NewTime(time.Now())
+	healthcheck := provider.Spec.Healthcheck
+	if healthcheck == nil {
+		// Providers with a JSONTas source get their health check removed by the webhook.
+		healthcheck = &etosv1alpha1.Healthcheck{IntervalSeconds: 30}
+	}
+	interval := time.Duration(healthcheck.IntervalSeconds) * time.Second
 
-	if provider.Status.LastHealthCheckTime == nil {
-		// run healthcheck on first reconciliation and update status after that
-		provider.Status.LastHealthCheckTime = &lastHealthCheckTime
-	} else {
+	if provider.Status.LastHealthCheckTime != nil {
 		next := provider.Status.LastHealthCheckTime.Add(interval)
 		if time.Until(next) > 0 {
 			// postpone healthcheck if it is too early to do it now
@@ -77,40 +81,48 @@ func (r *ProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}
 	}
 
-	// We don't check the availability of JSONTas as it is not yet running as a service we can check.
-	if provider.Spec.JSONTas == nil {
-		logger.Info("Healthcheck", "endpoint", fmt.Sprintf("%s/%s", provider.Spec.Host, provider.Spec.Healthcheck.Endpoint))
-		resp, err := http.Get(fmt.Sprintf("%s/%s", provider.Spec.Host, provider.Spec.Healthcheck.Endpoint))
+	// We don't check the availability of JSONTas as it is not yet running as a service we can check,
+	// unless the health check runs the provider image.
+	if provider.Spec.JSONTas == nil || healthcheck.Protocol == "exec" {
+		logger.Info("Healthcheck", "protocol", healthcheck.Protocol, "endpoint", fmt.Sprintf("%s/%s", provider.Spec.Host, healthcheck.Endpoint))
+		err := r.checkHealth(ctx, provider, healthcheck)
+		if errors.Is(err, errHealthcheckRunning) {
+			return ctrl.Result{RequeueAfter: healthcheckPollInterval}, nil
+		}
+		lastHealthCheckTime := metav1.NewTime(time.Now())
+		provider.Status.LastHealthCheckTime = &lastHealthCheckTime
 		if err != nil {
-			meta.SetStatusCondition(&provider.Status.Conditions,
-				metav1.Condition{
-					Type:    status.StatusAvailable,
-					Status:  metav1.ConditionFalse,
-					Reason:  status.ReasonFailed,
-					Message: "Could not communicate with host",
-				})
-			if err = r.Status().Update(ctx, provider); err != nil {
-				logger.Error(err, "failed to update provider status")
-				return ctrl.Result{}, err
+			provider.Status.ConsecutiveFailures++
+			threshold := healthcheckThreshold(healthcheck)
+			// A provider that is not yet available does not get the benefit of the failure threshold.
+			if provider.Status.ConsecutiveFailures >= threshold ||
+				!meta.IsStatusConditionPresentAndEqual(provider.Status.Conditions, status.StatusAvailable, metav1.ConditionTrue) {
+				meta.SetStatusCondition(&provider.Status.Conditions,
+					metav1.Condition{
+						Type:    status.StatusAvailable,
+						Status:  metav1.ConditionFalse,
+						Reason:  status.ReasonFailed,
+						Message: fmt.Sprintf("Health check failed: %s", err.Error()),
+					})
 			}
-			logger.Info("Provider did not respond", "provider", req.NamespacedName)
-			return ctrl.Result{RequeueAfter: interval}, nil
-		}
-		if resp.StatusCode != 204 {
-			meta.SetStatusCondition(&provider.Status.Conditions,
-				metav1.Condition{
-					Type:    status.StatusAvailable,
-					Status:  metav1.ConditionFalse,
-					Reason:  status.ReasonFailed,
-					Message: fmt.Sprintf("Wrong status code (%d) from health check endpoint", resp.StatusCode),
-				})
-			if err = r.Status().Update(ctx, provider); err != nil {
-				logger.Error(err, "failed to update provider status")
-				return ctrl.Result{}, err
+			if updateErr := r.Status().Update(ctx, provider); updateErr != nil {
+				logger.Error(updateErr, "failed to update provider status")
+				return ctrl.Result{}, updateErr
 			}
-			logger.Info("Provider responded with a bad status code", "provider", req.NamespacedName, "status", resp.StatusCode)
+			logger.Info("Provider health check failed", "provider", req.NamespacedName, "error", err.Error(),
+				"failures", provider.Status.ConsecutiveFailures, "threshold", threshold)
 			return ctrl.Result{RequeueAfter: interval}, nil
 		}
+	} else {
+		lastHealthCheckTime := metav1.NewTime(time.Now())
+		provider.Status.LastHealthCheckTime = &lastHealthCheckTime
+	}
+	provider.Status.ConsecutiveFailures = 0
+	if provider.Spec.API != "" {
+		if err := setRemoteCapabilities(ctx, r.Client, provider); err != nil {
+			// The provider is still available, but the operator can't tell how much it can provide.
+			logger.Error(err, "failed to get capabilities of remote provider", "provider", req.NamespacedName)
+		}
 	}
 	meta.SetStatusCondition(&provider.Status.Conditions,
 		metav1.Condition{
@@ -127,10 +139,34 @@ func (r *ProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	return ctrl.Result{RequeueAfter: interval}, nil
 }
 
+// registerOwnerIndexForJob will set an index of the jobs that a provider owns.
+func (r *ProviderReconciler) registerOwnerIndexForJob(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &batchv1.Job{}, ProviderOwnerKey, func(rawObj client.Object) []string {
+		job := rawObj.(*batchv1.Job)
+		owner := metav1.GetControllerOf(job)
+		if owner == nil {
+			return nil
+		}
+		if owner.APIVersion != APIGroupVersionString || owner.Kind != "Provider" {
+			return nil
+		}
+
+		return []string{owner.Name}
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ProviderReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Register indexes for faster lookups
+	if err := r.registerOwnerIndexForJob(mgr); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&etosv1alpha1.Provider{}).
 		Named("provider").
+		Owns(&batchv1.Job{}). // Health check job
 		Complete(r)
 }
@@ -17,33 +17,289 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
 	"github.com/eiffel-community/etos/internal/controller/status"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// checkProviders checks if all providers for this environment are available.
-func checkProviders(ctx context.Context, c client.Reader, namespace string, providers etosv1alpha1.Providers) error {
-	err := checkProvider(ctx, c, providers.IUT, namespace, &etosv1alpha1.Provider{})
-	if err != nil {
-		return err
+// defaultCapacityWaitTimeout is how long to wait for providers to have enough available capacity
+// when no wait timeout is set.
+const defaultCapacityWaitTimeout = time.Hour
+
+// errNoProviderLeft is returned when all providers for a type of resource have failed.
+var errNoProviderLeft = errors.New("no provider left to fall back to")
+
+// failoverSelectorIndexValue is indexed, together with the names of the providers, for the
+// provider choices that select providers to fall back to with a label selector. It contains a
+// colon so that it never is the name of a Provider.
+const failoverSelectorIndexValue = "failover:selector"
+
+// providerChoice is the provider, and the providers to fall back to, for one type of resource.
+type providerChoice struct {
+	// providerType is the type of the Provider kinds, as set in the type field of their spec.
+	providerType string
+	// index is the field index of the choice, I.e. iutProvider.
+	index    string
+	id       *string
+	failover *etosv1alpha1.ProviderFailover
+}
+
+// testRunProviderChoices returns the provider choices of a testrun in the order that they provision:
+// IUT, log area and execution space.
+func testRunProviderChoices(providers *etosv1alpha1.Providers) []providerChoice {
+	failover := providers.Failover
+	if failover == nil {
+		failover = &etosv1alpha1.ProvidersFailover{}
 	}
-	err = checkProvider(ctx, c, providers.ExecutionSpace, namespace, &etosv1alpha1.Provider{})
+	return []providerChoice{
+		{providerType: "iut", index: iutProvider, id: &providers.IUT, failover: failover.IUT},
+		{providerType: "log-area", index: logAreaProvider, id: &providers.LogArea, failover: failover.LogArea},
+		{
+			providerType: "execution-space",
+			index:        executionSpaceProvider,
+			id:           &providers.ExecutionSpace,
+			failover:     failover.ExecutionSpace,
+		},
+	}
+}
+
+// environmentProviderChoices returns the provider choices of an environment request in the order that
+// they provision: IUT, log area and execution space.
+func environmentProviderChoices(providers *etosv1alpha1.EnvironmentProviders) []providerChoice {
+	return []providerChoice{
+		{providerType: "iut", index: iutProvider, id: &providers.IUT.ID, failover: providers.IUT.Failover},
+		{providerType: "log-area", index: logAreaProvider, id: &providers.LogArea.ID, failover: providers.LogArea.Failover},
+		{
+			providerType: "execution-space",
+			index:        executionSpaceProvider,
+			id:           &providers.ExecutionSpace.ID,
+			failover:     providers.ExecutionSpace.Failover,
+		},
+	}
+}
+
+// providerChoiceFor returns the provider choice with a field index.
+func providerChoiceFor(choices []providerChoice, index string) (providerChoice, bool) {
+	for _, choice := range choices {
+		if choice.index == index {
+			return choice, true
+		}
+	}
+	return providerChoice{}, false
+}
+
+// indexValues returns the values to index the provider choice by: the provider, the providers to
+// fall back to and failoverSelectorIndexValue if the providers to fall back to are selected by labels.
+func (p providerChoice) indexValues() []string {
+	values := []string{*p.id}
+	if p.failover == nil {
+		return values
+	}
+	values = append(values, p.failover.Providers...)
+	if p.failover.Selector != nil {
+		values = append(values, failoverSelectorIndexValue)
+	}
+	return values
+}
+
+// selects checks if the failover selector of the provider choice selects a Provider.
+func (p providerChoice) selects(provider client.Object) bool {
+	if p.failover == nil || p.failover.Selector == nil {
+		return false
+	}
+	if provider, ok := provider.(*etosv1alpha1.Provider); ok && provider.Spec.Type != p.providerType {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(p.failover.Selector)
 	if err != nil {
-		return err
+		return false
 	}
-	err = checkProvider(ctx, c, providers.LogArea, namespace, &etosv1alpha1.Provider{})
+	return selector.Matches(labels.Set(provider.GetLabels()))
+}
+
+// candidates returns the names of the providers to try, in order. The provider itself is tried first,
+// then the providers of the failover and last the providers selected by the failover selector.
+func (p providerChoice) candidates(ctx context.Context, c client.Reader, namespace string) ([]string, error) {
+	candidates := []string{*p.id}
+	if p.failover == nil {
+		return candidates, nil
+	}
+	candidates = append(candidates, p.failover.Providers...)
+	if p.failover.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(p.failover.Selector)
+		if err != nil {
+			return nil, err
+		}
+		var providers etosv1alpha1.ProviderList
+		if err := c.List(ctx, &providers, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, err
+		}
+		var selected []string
+		for _, provider := range providers.Items {
+			if provider.Spec.Type == p.providerType {
+				selected = append(selected, provider.Name)
+			}
+		}
+		slices.Sort(selected)
+		candidates = append(candidates, selected...)
+	}
+	var unique []string
+	for _, candidate := range candidates {
+		if candidate != "" && !slices.Contains(unique, candidate) {
+			unique = append(unique, candidate)
+		}
+	}
+	return unique, nil
+}
+
+// selectProvider returns the first candidate that is available and has a large enough total capacity
+// to provide an amount of resources. Providers in exclude are never selected.
+func (p providerChoice) selectProvider(ctx context.Context, c client.Reader, namespace string, exclude []string, amount int) (string, error) {
+	candidates, err := p.candidates(ctx, c, namespace)
 	if err != nil {
-		return err
+		return "", err
+	}
+	var errs error
+	for _, name := range candidates {
+		if slices.Contains(exclude, name) {
+			continue
+		}
+		provider := &etosv1alpha1.Provider{}
+		if err := checkProvider(ctx, c, name, namespace, provider); err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if provider.Status.Capacity != nil && provider.Status.Capacity.Total < amount {
+			errs = errors.Join(errs, fmt.Errorf(
+				"provider '%s' has a total capacity of %d, %d is required", name, provider.Status.Capacity.Total, amount,
+			))
+			continue
+		}
+		return name, nil
+	}
+	if errs == nil {
+		errs = fmt.Errorf("all %s providers have failed, %w", p.providerType, errNoProviderLeft)
+	}
+	return "", errs
+}
+
+// checkProviders checks that a provider, or a provider to fall back to, is available for each type of resource.
+func checkProviders(ctx context.Context, c client.Reader, namespace string, providers etosv1alpha1.Providers) error {
+	for _, choice := range testRunProviderChoices(&providers) {
+		if _, err := choice.selectProvider(ctx, c, namespace, nil, 0); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// selectProviders selects, for each type of resource, the first provider that is available, able to provide
+// an amount of resources and that has not failed before. The IDs of the environment providers are changed to
+// the selected providers and true is returned if any ID was changed.
+func selectProviders(
+	ctx context.Context,
+	c client.Reader,
+	namespace string,
+	providers *etosv1alpha1.EnvironmentProviders,
+	failed []string,
+	amount int,
+) (bool, error) {
+	changed := false
+	for _, choice := range environmentProviderChoices(providers) {
+		name, err := choice.selectProvider(ctx, c, namespace, failed, amount)
+		if err != nil {
+			return false, err
+		}
+		if name != *choice.id {
+			*choice.id = name
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// hasFailover returns true if there is a provider, that has not failed, to fall back to for the provider
+// with the given ID. The provider with the ID is expected to be added to failed by the caller.
+func hasFailover(ctx context.Context, c client.Reader, namespace string, providers *etosv1alpha1.EnvironmentProviders, id string, failed []string) bool {
+	for _, choice := range environmentProviderChoices(providers) {
+		if *choice.id != id {
+			continue
+		}
+		_, err := choice.selectProvider(ctx, c, namespace, failed, 0)
+		return err == nil
+	}
+	return false
+}
+
+// holdForProviders sets the 'Providers' condition to waiting if the resource has a wait timeout and the
+// provider check error is one that a provider can recover from. Returns true if the resource shall keep
+// waiting for its providers, i.e. the wait timeout has not yet been reached, and true if the conditions
+// were changed.
+func holdForProviders(conditions *[]metav1.Condition, waitTimeout *metav1.Duration, err error) (bool, bool) {
+	if waitTimeout == nil || errors.Is(err, errNoProviderLeft) {
+		return false, false
+	}
+	changed := meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:    status.StatusProviders,
+		Status:  metav1.ConditionFalse,
+		Reason:  status.ReasonWaitingForProvider,
+		Message: fmt.Sprintf("Waiting for provider: %s", err.Error()),
+	})
+	return providerWaitRemaining(*conditions, waitTimeout) > 0, changed
+}
+
+// holdForCapacity sets the 'Providers' condition to waiting for capacity. Returns whether to keep waiting
+// for the providers to have enough available capacity and whether the conditions were changed.
+func holdForCapacity(conditions *[]metav1.Condition, waitTimeout *metav1.Duration, message string) (bool, bool) {
+	changed := meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:    status.StatusProviders,
+		Status:  metav1.ConditionFalse,
+		Reason:  status.ReasonWaitingForCapacity,
+		Message: message,
+	})
+	return providerWaitRemaining(*conditions, waitTimeout) > 0, changed
+}
+
+// providerWaitRemaining returns how much longer to wait for providers to become available. Zero or less
+// is returned if the resource is not waiting for providers or the wait timeout has been reached.
+// A resource waiting for capacity waits for defaultCapacityWaitTimeout if no wait timeout is set.
+func providerWaitRemaining(conditions []metav1.Condition, waitTimeout *metav1.Duration) time.Duration {
+	condition := meta.FindStatusCondition(conditions, status.StatusProviders)
+	if condition == nil || condition.Status != metav1.ConditionFalse {
+		return 0
+	}
+	if waitTimeout == nil && condition.Reason == status.ReasonWaitingForCapacity {
+		waitTimeout = &metav1.Duration{Duration: defaultCapacityWaitTimeout}
+	}
+	if waitTimeout == nil {
+		return 0
+	}
+	return time.Until(condition.LastTransitionTime.Add(waitTimeout.Duration))
+}
+
+// releaseProviderHold sets the 'Providers' condition to available if the resource has been waiting for
+// its providers. Returns true if the conditions were changed.
+func releaseProviderHold(conditions *[]metav1.Condition) bool {
+	if meta.FindStatusCondition(*conditions, status.StatusProviders) == nil {
+		return false
+	}
+	return meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:    status.StatusProviders,
+		Status:  metav1.ConditionTrue,
+		Reason:  status.ReasonActive,
+		Message: "All providers are available",
+	})
+}
+
 // checkProvider checks if the provider condition 'Available' is set to True.
 func checkProvider(ctx context.Context, c client.Reader, name string, namespace string, provider *etosv1alpha1.Provider) error {
 	err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, provider)
@@ -61,3 +317,27 @@ func getProvider(ctx context.Context, c client.Reader, name, namespace string) (
 	var provider etosv1alpha1.Provider
 	return &provider, c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, &provider)
 }
+
+// checkProviderCapacity checks that the providers which advertise their capacity can provide an amount of resources.
+//
+// An error is returned if a provider can never provide the amount, I.e. the total capacity of the provider is
+// too small. A non-empty message is returned if a provider does not have enough available resources right now.
+func checkProviderCapacity(ctx context.Context, c client.Reader, namespace string, providers etosv1alpha1.Providers, amount int) (string, error) {
+	for _, name := range []string{providers.IUT, providers.LogArea, providers.ExecutionSpace} {
+		provider, err := getProvider(ctx, c, name, namespace)
+		if err != nil {
+			return "", err
+		}
+		capacity := provider.Status.Capacity
+		if capacity == nil {
+			continue
+		}
+		if capacity.Total < amount {
+			return "", fmt.Errorf("provider '%s' has a total capacity of %d, %d is required", name, capacity.Total, amount)
+		}
+		if capacity.Available < amount {
+			return fmt.Sprintf("Waiting for provider '%s' to have %d available, it has %d", name, amount, capacity.Available), nil
+		}
+	}
+	return "", nil
+}
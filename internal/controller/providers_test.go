@@ -0,0 +1,292 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/controller/status"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+var _ = Describe("Provider capacity", func() {
+	const namespace = "default"
+	var (
+		ctx                context.Context
+		cli                client.Client
+		reconciler         *EnvironmentRequestReconciler
+		environmentRequest *etosv1alpha1.EnvironmentRequest
+	)
+
+	// waitingSince sets the conditions of the EnvironmentRequest as if it has waited for capacity since a time.
+	waitingSince := func(since time.Time) {
+		environmentRequest.Status.Conditions = []metav1.Condition{
+			{
+				Type:               status.StatusReady,
+				Status:             metav1.ConditionFalse,
+				Reason:             status.ReasonPending,
+				LastTransitionTime: metav1.NewTime(since),
+			},
+			{
+				Type:               status.StatusProviders,
+				Status:             metav1.ConditionFalse,
+				Reason:             status.ReasonWaitingForCapacity,
+				LastTransitionTime: metav1.NewTime(since),
+			},
+		}
+		Expect(cli.Status().Update(ctx, environmentRequest)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		environmentRequest = providertest.NewEnvironmentRequest("environment-request", namespace).
+			WithAmount(2, 2).
+			WithIutProvider("iut").
+			WithLogAreaProvider("log-area").
+			WithExecutionSpaceProvider("execution-space", "1.0.0").
+			Build()
+		cli = providertest.NewFakeClient(
+			environmentRequest,
+			providertest.NewProvider("iut", namespace, "iut").WithAvailable().WithCapacity(4, 1).Build(),
+			providertest.NewProvider("log-area", namespace, "log-area").WithAvailable().Build(),
+			providertest.NewProvider("execution-space", namespace, "execution-space").WithAvailable().Build(),
+		)
+		reconciler = &EnvironmentRequestReconciler{Client: cli, Scheme: cli.Scheme()}
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(environmentRequest), environmentRequest)).To(Succeed())
+	})
+
+	It("should fail when a provider can never provide the amount", func() {
+		message, err := checkProviderCapacity(ctx, cli, namespace, etosv1alpha1.Providers{
+			IUT: "iut", LogArea: "log-area", ExecutionSpace: "execution-space",
+		}, 5)
+		Expect(err).To(HaveOccurred())
+		Expect(message).To(BeEmpty())
+	})
+
+	It("should wait for capacity for an hour when no wait timeout is set", func() {
+		conditions := []metav1.Condition{}
+		held, changed := holdForCapacity(&conditions, nil, "Waiting for capacity")
+		Expect(held).To(BeTrue())
+		Expect(changed).To(BeTrue())
+		Expect(providerWaitRemaining(conditions, nil)).To(BeNumerically("~", defaultCapacityWaitTimeout, time.Minute))
+
+		By("not waiting for unavailable providers when no wait timeout is set")
+		held, _ = holdForProviders(&conditions, nil, errNoProviderLeft)
+		Expect(held).To(BeFalse())
+	})
+
+	It("should wait for capacity for the wait timeout", func() {
+		conditions := []metav1.Condition{}
+		waitTimeout := &metav1.Duration{Duration: time.Minute}
+		held, _ := holdForCapacity(&conditions, waitTimeout, "Waiting for capacity")
+		Expect(held).To(BeTrue())
+		Expect(providerWaitRemaining(conditions, waitTimeout)).To(BeNumerically("~", time.Minute, time.Second))
+	})
+
+	It("should keep an EnvironmentRequest pending while it waits for capacity", func() {
+		waitingSince(time.Now().Add(-time.Minute))
+		Expect(reconciler.reconcile(ctx, environmentRequest)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(environmentRequest), environmentRequest)).To(Succeed())
+		Expect(isStatusReason(environmentRequest.Status.Conditions, status.StatusReady, status.ReasonPending)).To(BeTrue())
+		Expect(isStatusReason(
+			environmentRequest.Status.Conditions, status.StatusProviders, status.ReasonWaitingForCapacity,
+		)).To(BeTrue())
+		Expect(providerWaitRemaining(environmentRequest.Status.Conditions, nil)).To(BeNumerically(">", 0))
+	})
+
+	It("should fail an EnvironmentRequest that has waited for capacity for too long", func() {
+		waitingSince(time.Now().Add(-defaultCapacityWaitTimeout - time.Minute))
+		Expect(reconciler.reconcile(ctx, environmentRequest)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(environmentRequest), environmentRequest)).To(Succeed())
+		ready := meta.FindStatusCondition(environmentRequest.Status.Conditions, status.StatusReady)
+		Expect(ready.Reason).To(Equal(status.ReasonFailed))
+		Expect(ready.Message).To(ContainSubstring("timed out"))
+	})
+
+	It("should fail an EnvironmentRequest that has waited for capacity longer than its wait timeout", func() {
+		environmentRequest.Spec.Providers.WaitTimeout = &metav1.Duration{Duration: 30 * time.Second}
+		Expect(cli.Update(ctx, environmentRequest)).To(Succeed())
+		waitingSince(time.Now().Add(-time.Minute))
+		Expect(reconciler.reconcile(ctx, environmentRequest)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(environmentRequest), environmentRequest)).To(Succeed())
+		Expect(isStatusReason(environmentRequest.Status.Conditions, status.StatusReady, status.ReasonFailed)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Provider selection", func() {
+	const namespace = "default"
+	var (
+		ctx       context.Context
+		cli       client.Client
+		providers *etosv1alpha1.EnvironmentProviders
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		providers = &etosv1alpha1.EnvironmentProviders{
+			IUT: etosv1alpha1.IutProvider{
+				ID:       "iut",
+				Failover: &etosv1alpha1.ProviderFailover{Providers: []string{"iut-fallback"}},
+			},
+			LogArea:        etosv1alpha1.LogAreaProvider{ID: "log-area"},
+			ExecutionSpace: etosv1alpha1.ExecutionSpaceProvider{ID: "execution-space"},
+		}
+	})
+
+	It("should keep the providers when they are available", func() {
+		cli = providertest.NewFakeClient(
+			providertest.NewProvider("iut", namespace, "iut").WithAvailable().Build(),
+			providertest.NewProvider("iut-fallback", namespace, "iut").WithAvailable().Build(),
+			providertest.NewProvider("log-area", namespace, "log-area").WithAvailable().Build(),
+			providertest.NewProvider("execution-space", namespace, "execution-space").WithAvailable().Build(),
+		)
+		changed, err := selectProviders(ctx, cli, namespace, providers, nil, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+		Expect(providers.IUT.ID).To(Equal("iut"))
+	})
+
+	It("should fall back from an unavailable provider", func() {
+		cli = providertest.NewFakeClient(
+			providertest.NewProvider("iut", namespace, "iut").Build(),
+			providertest.NewProvider("iut-fallback", namespace, "iut").WithAvailable().Build(),
+			providertest.NewProvider("log-area", namespace, "log-area").WithAvailable().Build(),
+			providertest.NewProvider("execution-space", namespace, "execution-space").WithAvailable().Build(),
+		)
+		changed, err := selectProviders(ctx, cli, namespace, providers, nil, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(providers.IUT.ID).To(Equal("iut-fallback"))
+	})
+
+	It("should fall back from a provider that has failed or is too small", func() {
+		cli = providertest.NewFakeClient(
+			providertest.NewProvider("iut", namespace, "iut").WithAvailable().Build(),
+			providertest.NewProvider("iut-fallback", namespace, "iut").WithAvailable().Build(),
+			providertest.NewProvider("log-area", namespace, "log-area").WithAvailable().Build(),
+			providertest.NewProvider("execution-space", namespace, "execution-space").WithAvailable().Build(),
+		)
+		changed, err := selectProviders(ctx, cli, namespace, providers, []string{"iut"}, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(providers.IUT.ID).To(Equal("iut-fallback"))
+
+		By("not selecting a provider with a too small total capacity")
+		providers.IUT.ID = "iut"
+		cli = providertest.NewFakeClient(
+			providertest.NewProvider("iut", namespace, "iut").WithAvailable().WithCapacity(1, 1).Build(),
+			providertest.NewProvider("iut-fallback", namespace, "iut").WithAvailable().Build(),
+			providertest.NewProvider("log-area", namespace, "log-area").WithAvailable().Build(),
+			providertest.NewProvider("execution-space", namespace, "execution-space").WithAvailable().Build(),
+		)
+		_, err = selectProviders(ctx, cli, namespace, providers, nil, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(providers.IUT.ID).To(Equal("iut-fallback"))
+	})
+
+	It("should return an error when there is no provider left", func() {
+		cli = providertest.NewFakeClient(
+			providertest.NewProvider("iut", namespace, "iut").WithAvailable().Build(),
+			providertest.NewProvider("iut-fallback", namespace, "iut").WithAvailable().Build(),
+			providertest.NewProvider("log-area", namespace, "log-area").WithAvailable().Build(),
+			providertest.NewProvider("execution-space", namespace, "execution-space").WithAvailable().Build(),
+		)
+		_, err := selectProviders(ctx, cli, namespace, providers, []string{"iut", "iut-fallback"}, 1)
+		Expect(err).To(MatchError(errNoProviderLeft))
+		Expect(providers.IUT.ID).To(Equal("iut"))
+	})
+})
+
+var _ = Describe("Provider watches", func() {
+	const namespace = "default"
+	var (
+		ctx context.Context
+		cli client.Client
+	)
+
+	// requestsFor returns the names of the reconcile requests.
+	requestsFor := func(requests []reconcile.Request) []string {
+		names := make([]string, 0, len(requests))
+		for _, request := range requests {
+			names = append(names, request.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		failover := &etosv1alpha1.ProviderFailover{
+			Providers: []string{"iut-fallback"},
+			Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"lab": "spare"}},
+		}
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", namespace).
+			WithIutProvider("iut").
+			Build()
+		environmentRequest.Spec.Providers.IUT.Failover = failover
+		testrun := &etosv1alpha1.TestRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "testrun", Namespace: namespace},
+			Spec: etosv1alpha1.TestRunSpec{Providers: etosv1alpha1.Providers{
+				IUT:      "iut",
+				Failover: &etosv1alpha1.ProvidersFailover{IUT: failover},
+			}},
+		}
+		cli = fake.NewClientBuilder().
+			WithScheme(providertest.NewFakeClient().Scheme()).
+			WithIndex(&etosv1alpha1.EnvironmentRequest{}, iutProvider, environmentRequestProviderIndex(iutProvider)).
+			WithIndex(&etosv1alpha1.TestRun{}, iutProvider, testRunProviderIndex(iutProvider)).
+			WithObjects(environmentRequest, testrun).
+			Build()
+	})
+
+	It("should reconcile for the provider and the providers to fall back to", func() {
+		environmentRequests := &EnvironmentRequestReconciler{Client: cli, Scheme: cli.Scheme()}
+		testruns := &TestRunReconciler{Client: cli, Scheme: cli.Scheme()}
+		for _, name := range []string{"iut", "iut-fallback"} {
+			provider := providertest.NewProvider(name, namespace, "iut").Build()
+			Expect(requestsFor(environmentRequests.findEnvironmentRequestsForIUTProvider(ctx, provider))).
+				To(Equal([]string{"environment-request"}))
+			Expect(requestsFor(testruns.findTestrunsForIUTProvider(ctx, provider))).To(Equal([]string{"testrun"}))
+		}
+		provider := providertest.NewProvider("other", namespace, "iut").Build()
+		Expect(environmentRequests.findEnvironmentRequestsForIUTProvider(ctx, provider)).To(BeEmpty())
+		Expect(testruns.findTestrunsForIUTProvider(ctx, provider)).To(BeEmpty())
+	})
+
+	It("should reconcile for the providers selected by the failover selector", func() {
+		environmentRequests := &EnvironmentRequestReconciler{Client: cli, Scheme: cli.Scheme()}
+		testruns := &TestRunReconciler{Client: cli, Scheme: cli.Scheme()}
+		provider := providertest.NewProvider("spare", namespace, "iut").Build()
+		provider.Labels = map[string]string{"lab": "spare"}
+		Expect(requestsFor(environmentRequests.findEnvironmentRequestsForIUTProvider(ctx, provider))).
+			To(Equal([]string{"environment-request"}))
+		Expect(requestsFor(testruns.findTestrunsForIUTProvider(ctx, provider))).To(Equal([]string{"testrun"}))
+
+		By("not reconciling for selected providers of another type")
+		provider.Spec.Type = "log-area"
+		Expect(environmentRequests.findEnvironmentRequestsForIUTProvider(ctx, provider)).To(BeEmpty())
+		Expect(testruns.findTestrunsForIUTProvider(ctx, provider)).To(BeEmpty())
+	})
+})
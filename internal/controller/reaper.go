@@ -0,0 +1,214 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/status"
+	"github.com/eiffel-community/etos/pkg/opentelemetry/semconv"
+)
+
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+
+// reapedResources counts the IUTs, execution spaces and log areas that have been released because
+// they were past their deadline or orphaned.
+var reapedResources = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "etos_reaped_resources_total",
+		Help: "Number of IUTs, execution spaces and log areas released because they were past their deadline or orphaned",
+	},
+	[]string{"kind", "reason"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(reapedResources)
+}
+
+// standaloneResource is an Iut, ExecutionSpace or LogArea that is not owned by an Environment.
+type standaloneResource struct {
+	obj                client.Object
+	kind               string
+	ownerKey           string
+	releaserName       string
+	deadline           int64
+	lease              *etosv1alpha2.Lease
+	environmentRequest string
+	provider           string
+	conditions         *[]metav1.Condition
+	completionTime     **metav1.Time
+	release            **etosv1alpha2.ReleaseStatus
+}
+
+// orphaned returns why a resource is orphaned, or an empty string if it is not, and whether the
+// resource can still be released. A resource is orphaned when the EnvironmentRequest that requested it,
+// or the Provider that created it, has been deleted. Only the Provider is needed for a release.
+func (s standaloneResource) orphaned(ctx context.Context, c client.Reader) (string, bool, error) {
+	namespace := s.obj.GetNamespace()
+	provider := &etosv1alpha1.Provider{}
+	if err := c.Get(ctx, types.NamespacedName{Name: s.provider, Namespace: namespace}, provider); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return "", false, err
+		}
+		return fmt.Sprintf("Provider '%s' has been deleted", s.provider), false, nil
+	}
+	environmentrequest := &etosv1alpha1.EnvironmentRequest{}
+	if err := c.Get(ctx, types.NamespacedName{Name: s.environmentRequest, Namespace: namespace}, environmentrequest); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return "", false, err
+		}
+		return fmt.Sprintf("EnvironmentRequest '%s' has been deleted", s.environmentRequest), true, nil
+	}
+	return "", true, nil
+}
+
+// releaseEnvironmentRequest gets the EnvironmentRequest that a release job of a resource runs for.
+//
+// The resources of a deleted EnvironmentRequest are released for a stand-in EnvironmentRequest, with the
+// name, ID and cluster that the resource was labeled with.
+func releaseEnvironmentRequest(ctx context.Context, c client.Reader, obj client.Object, name string) (*etosv1alpha1.EnvironmentRequest, error) {
+	environmentrequest := &etosv1alpha1.EnvironmentRequest{}
+	err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: obj.GetNamespace()}, environmentrequest)
+	if !apierrors.IsNotFound(err) {
+		return environmentrequest, err
+	}
+	labels := obj.GetLabels()
+	environmentrequest = &etosv1alpha1.EnvironmentRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: obj.GetNamespace()},
+		Spec: etosv1alpha1.EnvironmentRequestSpec{
+			ID: labels["etos.eiffel-community.github.io/environment-request-id"],
+		},
+	}
+	if cluster := labels["etos.eiffel-community.github.io/cluster"]; cluster != "" {
+		environmentrequest.Labels = map[string]string{"etos.eiffel-community.github.io/cluster": cluster}
+		environmentrequest.Spec.ServiceAccountName = fmt.Sprintf("%s-provider", cluster)
+	}
+	return environmentrequest, nil
+}
+
+// reap releases a standalone resource that has passed its deadline, or that has been orphaned. A resource
+// with a lease that has not lapsed is kept past its deadline.
+//
+// Orphaned resources are deleted, and released like any other resource as long as their Provider exists.
+// Without a Provider the resource cannot be released, it has then leaked and is kept until an administrator
+// force-finalizes it.
+//
+// Returns true if the resource is being reaped, in which case the reconciliation shall stop. Otherwise the time
+// left until the deadline is returned, which is zero if the resource has no deadline.
+func reap(ctx context.Context, c client.Client, recorder events.EventRecorder, s standaloneResource) (time.Duration, bool, error) {
+	// Resources are not reaped before the finalizer, which guarantees that they are released, has been added.
+	if !controllerutil.ContainsFinalizer(s.obj, providerFinalizer) {
+		return 0, false, nil
+	}
+	// Leaked resources are kept until an administrator force-finalizes them.
+	if isStatusReason(*s.conditions, status.StatusActive, status.ReasonLeaked) {
+		return 0, false, nil
+	}
+	logger := logf.FromContext(ctx)
+	message, releasable, err := s.orphaned(ctx, c)
+	if err != nil {
+		return 0, false, err
+	}
+	if message != "" {
+		if s.obj.GetDeletionTimestamp().IsZero() {
+			logger.Info("Resource is orphaned, releasing it", "reason", message)
+			recordReaped(ctx, recorder, s, status.ReasonOrphaned, message)
+			return 0, true, client.IgnoreNotFound(c.Delete(ctx, s.obj))
+		}
+		if !releasable {
+			logger.Info("Resource is orphaned and cannot be released, resource has leaked", "reason", message)
+			meta.SetStatusCondition(s.conditions,
+				metav1.Condition{
+					Type:    status.StatusActive,
+					Status:  metav1.ConditionFalse,
+					Reason:  status.ReasonLeaked,
+					Message: fmt.Sprintf("%s, the %s cannot be released", message, s.kind),
+				})
+			recordReleased(ctx, s.kind, status.ReasonLeaked)
+			if recorder != nil {
+				recorder.Eventf(s.obj, nil, corev1.EventTypeWarning, status.ReasonLeaked, "Release",
+					"%s, the %s cannot be released", message, s.kind)
+			}
+			return 0, true, c.Status().Update(ctx, s.obj)
+		}
+	}
+
+	if s.deadline == 0 || !s.obj.GetDeletionTimestamp().IsZero() {
+		return 0, false, nil
+	}
+	// The deadline defers to a lease that is renewed, the resource is released when the lease lapses.
+	if s.lease != nil && time.Until(leaseExpiry(s.obj, s.lease)) > 0 {
+		return 0, false, nil
+	}
+	deadline := time.Unix(s.deadline, 0)
+	if remaining := time.Until(deadline); remaining > 0 {
+		return remaining, false, nil
+	}
+	message = fmt.Sprintf("Deadline of %s exceeded", deadline)
+	if meta.SetStatusCondition(s.conditions,
+		metav1.Condition{
+			Type:    status.StatusActive,
+			Status:  metav1.ConditionFalse,
+			Reason:  status.ReasonTimedOut,
+			Message: message,
+		}) {
+		return 0, true, c.Status().Update(ctx, s.obj)
+	}
+	logger.Info("Deadline exceeded, releasing resource", "deadline", deadline)
+	recordReaped(ctx, recorder, s, status.ReasonTimedOut, message)
+	return 0, true, client.IgnoreNotFound(c.Delete(ctx, s.obj))
+}
+
+// recordReaped counts a reaped resource and records an event for it, if there is an event recorder.
+func recordReaped(ctx context.Context, recorder events.EventRecorder, s standaloneResource, reason, message string) {
+	reapedResources.WithLabelValues(s.kind, reason).Inc()
+	reapedResourcesCounter.Add(ctx, 1, metric.WithAttributes(
+		semconv.ETOSControllerKind(s.kind),
+		semconv.ETOSControllerReason(reason),
+	))
+	if recorder != nil {
+		recorder.Eventf(s.obj, nil, corev1.EventTypeWarning, reason, "Reap", message)
+	}
+}
+
+// earliest returns the shortest of the positive durations, or zero if there are none.
+func earliest(durations ...time.Duration) time.Duration {
+	var shortest time.Duration
+	for _, duration := range durations {
+		if duration > 0 && (shortest == 0 || duration < shortest) {
+			shortest = duration
+		}
+	}
+	return shortest
+}
@@ -0,0 +1,160 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/status"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+var _ = Describe("Reaper", func() {
+	const namespace = "default"
+	var (
+		ctx context.Context
+		cli client.Client
+		iut *etosv1alpha2.Iut
+	)
+
+	// newIut creates an IUT, with a deadline, for an EnvironmentRequest and a Provider.
+	newIut := func(deadline time.Time) {
+		iut = &etosv1alpha2.Iut{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "iut",
+				Namespace:  namespace,
+				Finalizers: []string{providerFinalizer},
+				Labels: map[string]string{
+					"etos.eiffel-community.github.io/environment-request-id": "environment-request-id",
+					"etos.eiffel-community.github.io/cluster":                "cluster",
+				},
+			},
+			Spec: etosv1alpha2.IutSpec{
+				ID:                 uuid.NewString(),
+				EnvironmentRequest: "environment-request",
+				ProviderID:         "iut-provider",
+				Deadline:           deadline.Unix(),
+			},
+		}
+		Expect(cli.Create(ctx, iut)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+	}
+
+	// reap reaps the IUT and gets it again.
+	reapIut := func() (time.Duration, bool) {
+		remaining, reaped, err := reap(ctx, cli, nil, standaloneIut(iut))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+		return remaining, reaped
+	}
+
+	// deleteObject deletes an object that the IUT depends on.
+	deleteObject := func(obj client.Object) {
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(obj), obj)).To(Succeed())
+		Expect(cli.Delete(ctx, obj)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		cli = providertest.NewFakeClient(
+			providertest.NewEnvironmentRequest("environment-request", namespace).Build(),
+			providertest.NewProvider("iut-provider", namespace, "iut").WithImage("iut-provider:latest").Build(),
+		)
+	})
+
+	It("should not reap a resource before its deadline", func() {
+		newIut(time.Now().Add(time.Hour))
+		remaining, reaped := reapIut()
+		Expect(reaped).To(BeFalse())
+		Expect(remaining).To(BeNumerically("~", time.Hour, 2*time.Second))
+		Expect(iut.DeletionTimestamp.IsZero()).To(BeTrue())
+	})
+
+	It("should not reap a resource without a finalizer", func() {
+		newIut(time.Now().Add(-time.Minute))
+		controllerutil.RemoveFinalizer(iut, providerFinalizer)
+		Expect(cli.Update(ctx, iut)).To(Succeed())
+		_, reaped := reapIut()
+		Expect(reaped).To(BeFalse())
+		Expect(iut.DeletionTimestamp.IsZero()).To(BeTrue())
+	})
+
+	It("should release a resource that has passed its deadline", func() {
+		newIut(time.Now().Add(-time.Minute))
+		_, reaped := reapIut()
+		Expect(reaped).To(BeTrue())
+		Expect(isStatusReason(iut.Status.Conditions, status.StatusActive, status.ReasonTimedOut)).To(BeTrue())
+		Expect(iut.DeletionTimestamp.IsZero()).To(BeTrue())
+
+		By("deleting the resource once the reason is set")
+		_, reaped = reapIut()
+		Expect(reaped).To(BeTrue())
+		Expect(iut.DeletionTimestamp.IsZero()).To(BeFalse())
+
+		By("leaving the release of the deleted resource to the controller")
+		_, reaped = reapIut()
+		Expect(reaped).To(BeFalse())
+	})
+
+	It("should release an orphaned resource when its Provider exists", func() {
+		newIut(time.Now().Add(time.Hour))
+		deleteObject(providertest.NewEnvironmentRequest("environment-request", namespace).Build())
+		_, reaped := reapIut()
+		Expect(reaped).To(BeTrue())
+		Expect(iut.DeletionTimestamp.IsZero()).To(BeFalse())
+		Expect(iut.Status.CompletionTime).To(BeNil())
+
+		By("leaving the release of the deleted resource to the controller")
+		_, reaped = reapIut()
+		Expect(reaped).To(BeFalse())
+		Expect(controllerutil.ContainsFinalizer(iut, providerFinalizer)).To(BeTrue())
+
+		By("releasing the resource for a stand-in EnvironmentRequest")
+		reconciler := &IutReconciler{Client: cli, Scheme: cli.Scheme()}
+		job, err := reconciler.releaseJob(ctx, iut)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Spec.Template.Spec.ServiceAccountName).To(Equal("cluster-provider"))
+		Expect(job.Labels).To(HaveKeyWithValue("etos.eiffel-community.github.io/environment-request-id", "environment-request-id"))
+		Expect(job.Spec.Template.Spec.Containers[0].Args).To(ContainElement("-environment-request=environment-request"))
+	})
+
+	It("should leak an orphaned resource when its Provider has been deleted", func() {
+		newIut(time.Now().Add(time.Hour))
+		deleteObject(providertest.NewProvider("iut-provider", namespace, "iut").Build())
+		_, reaped := reapIut()
+		Expect(reaped).To(BeTrue())
+		Expect(iut.DeletionTimestamp.IsZero()).To(BeFalse())
+
+		_, reaped = reapIut()
+		Expect(reaped).To(BeTrue())
+		Expect(isStatusReason(iut.Status.Conditions, status.StatusActive, status.ReasonLeaked)).To(BeTrue())
+		Expect(iut.Status.CompletionTime).To(BeNil())
+		Expect(controllerutil.ContainsFinalizer(iut, providerFinalizer)).To(BeTrue())
+
+		By("keeping the leaked resource until it is force-finalized")
+		_, reaped = reapIut()
+		Expect(reaped).To(BeFalse())
+	})
+})
@@ -0,0 +1,186 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/internal/controller/status"
+)
+
+// maxReleaseBackoff is the longest time to wait before retrying a failed release.
+const maxReleaseBackoff = time.Hour
+
+// defaultReleasePolicy is the release policy of providers that do not have one, failed releases are not retried.
+var defaultReleasePolicy = etosv1alpha1.ReleasePolicy{BackoffSeconds: 10}
+
+// releasePolicy returns the release policy of a provider. Failed releases are not retried if the provider
+// cannot be fetched or does not have a release policy.
+func releasePolicy(ctx context.Context, c client.Reader, name, namespace string) etosv1alpha1.ReleasePolicy {
+	provider, err := getProvider(ctx, c, name, namespace)
+	if err != nil || provider.Spec.Release == nil {
+		return defaultReleasePolicy
+	}
+	return *provider.Spec.Release
+}
+
+// releaseBackoff returns how long to wait before retrying a release after a number of failed attempts.
+func releaseBackoff(policy etosv1alpha1.ReleasePolicy, attempts int32) time.Duration {
+	backoff := time.Duration(policy.BackoffSeconds) * time.Second
+	for i := int32(1); i < attempts && backoff < maxReleaseBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxReleaseBackoff)
+}
+
+// retrying returns true if a failed release is waiting for its backoff to pass before it is retried.
+func retrying(release *etosv1alpha2.ReleaseStatus) bool {
+	return retryRemaining(release) > 0
+}
+
+// retryRemaining returns the time that remains of the backoff of a failed release, or 0 if there is none.
+func retryRemaining(release *etosv1alpha2.ReleaseStatus) time.Duration {
+	if release == nil || release.RetryTime == nil {
+		return 0
+	}
+	return max(time.Until(release.RetryTime.Time), 0)
+}
+
+// releaseFailed retries a failed release of a resource, after a backoff, until the retries of the release
+// policy of its provider are exhausted. The resource has then leaked and is kept, with the description of
+// the last failed release, until an administrator force-finalizes it. Returns the backoff to wait for before
+// the release is retried, or 0 if it will not be retried.
+func (s standaloneResource) releaseFailed(
+	ctx context.Context,
+	c client.Client,
+	recorder events.EventRecorder,
+	jobManager jobs.Job,
+	description string,
+) (time.Duration, error) {
+	attempt := releaseAttempt{
+		obj:        s.obj,
+		kind:       s.kind,
+		conditions: s.conditions,
+		release:    s.release,
+	}
+	return attempt.failed(ctx, c, recorder, jobManager, releasePolicy(ctx, c, s.provider, s.obj.GetNamespace()), description)
+}
+
+// releaseAttempt is a release of a resource, or an Environment, that can be retried when it fails.
+type releaseAttempt struct {
+	obj        client.Object
+	kind       string
+	conditions *[]metav1.Condition
+	release    **etosv1alpha2.ReleaseStatus
+}
+
+// failed retries a failed release, after a backoff, until the retries of the release policy are exhausted.
+// The resource has then leaked. Returns the remaining backoff before the release is retried, which is 0 once
+// the resource has leaked.
+func (a releaseAttempt) failed(
+	ctx context.Context,
+	c client.Client,
+	recorder events.EventRecorder,
+	jobManager jobs.Job,
+	policy etosv1alpha1.ReleasePolicy,
+	description string,
+) (time.Duration, error) {
+	logger := logf.FromContext(ctx)
+	if retrying(*a.release) {
+		// The failure has already been handled, the release job was not deleted.
+		return retryRemaining(*a.release), jobManager.Delete(ctx)
+	}
+	if *a.release == nil {
+		*a.release = &etosv1alpha2.ReleaseStatus{}
+	}
+	release := *a.release
+	release.Attempts++
+
+	if release.Attempts > policy.Retries {
+		logger.Info("Release failed and all retries are exhausted, resource has leaked", "attempts", release.Attempts)
+		release.RetryTime = nil
+		meta.SetStatusCondition(a.conditions,
+			metav1.Condition{
+				Type:    status.StatusActive,
+				Status:  metav1.ConditionFalse,
+				Reason:  status.ReasonLeaked,
+				Message: description,
+			})
+		recordReleased(ctx, a.kind, status.ReasonLeaked)
+		if recorder != nil {
+			recorder.Eventf(a.obj, nil, corev1.EventTypeWarning, status.ReasonLeaked, "Release",
+				"Release of the %s failed %d times: %s", a.kind, release.Attempts, description)
+		}
+		return 0, c.Status().Update(ctx, a.obj)
+	}
+
+	backoff := releaseBackoff(policy, release.Attempts)
+	retryTime := metav1.NewTime(time.Now().Add(backoff))
+	release.RetryTime = &retryTime
+	logger.Info("Release failed, retrying", "attempts", release.Attempts, "retryTime", retryTime)
+	meta.SetStatusCondition(a.conditions,
+		metav1.Condition{
+			Type:    status.StatusActive,
+			Status:  metav1.ConditionFalse,
+			Reason:  status.ReasonPending,
+			Message: fmt.Sprintf("Release attempt %d failed, retrying at %s: %s", release.Attempts, retryTime, description),
+		})
+	if err := c.Status().Update(ctx, a.obj); err != nil {
+		return 0, err
+	}
+	return backoff, jobManager.Delete(ctx)
+}
+
+// forceFinalize removes the finalizer of a resource that is being deleted, without releasing it, if an
+// administrator has set the force-finalize annotation. Returns true if the finalizer was removed.
+func forceFinalize(
+	ctx context.Context,
+	c client.Client,
+	recorder events.EventRecorder,
+	obj client.Object,
+	finalizer string,
+) (bool, error) {
+	if obj.GetDeletionTimestamp().IsZero() || obj.GetAnnotations()[etosv1alpha2.ForceFinalizeAnnotation] != "true" {
+		return false, nil
+	}
+	if !controllerutil.ContainsFinalizer(obj, finalizer) {
+		return false, nil
+	}
+	logf.FromContext(ctx).Info("Force-finalizing resource, it will not be released")
+	controllerutil.RemoveFinalizer(obj, finalizer)
+	if err := c.Update(ctx, obj); err != nil {
+		return false, err
+	}
+	if recorder != nil {
+		recorder.Eventf(obj, nil, corev1.EventTypeWarning, "ForceFinalized", "Finalize",
+			"The resource was removed without being released")
+	}
+	return true, nil
+}
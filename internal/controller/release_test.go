@@ -0,0 +1,223 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/internal/controller/status"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+// failedJob is a release job that has failed.
+type failedJob struct {
+	deleted int
+}
+
+func (j *failedJob) Create(context.Context, client.Object, jobs.JobSpecFunc) error { return nil }
+func (j *failedJob) Delete(context.Context) error                                  { j.deleted++; return nil }
+func (j *failedJob) Status(context.Context) (jobs.Status, error)                   { return jobs.StatusFailed, nil }
+func (j *failedJob) Result(context.Context, string, ...string) jobs.Result {
+	return jobs.Result{Conclusion: jobs.ConclusionFailed, Description: "release failed"}
+}
+
+var _ = Describe("Release retries", func() {
+	const namespace = "default"
+	var (
+		ctx context.Context
+		cli client.Client
+		job *failedJob
+	)
+
+	// newProvider creates a provider with a release policy.
+	newProvider := func(name, providerType string, retries, backoffSeconds int32) {
+		provider := providertest.NewProvider(name, namespace, providerType).Build()
+		provider.Spec.Release = &etosv1alpha1.ReleasePolicy{Retries: retries, BackoffSeconds: backoffSeconds}
+		Expect(cli.Create(ctx, provider)).To(Succeed())
+	}
+
+	// newIut creates an IUT, that is being released, from a provider.
+	newIut := func(name, provider string) *etosv1alpha2.Iut {
+		iut := &etosv1alpha2.Iut{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Finalizers: []string{providerFinalizer}},
+			Spec: etosv1alpha2.IutSpec{
+				ID:                 uuid.NewString(),
+				EnvironmentRequest: "environment-request",
+				ProviderID:         provider,
+			},
+		}
+		Expect(cli.Create(ctx, iut)).To(Succeed())
+		Expect(cli.Delete(ctx, iut)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+		return iut
+	}
+
+	// elapse makes the backoff of a failed release pass.
+	elapse := func(release *etosv1alpha2.ReleaseStatus) {
+		past := metav1.NewTime(time.Now().Add(-time.Second))
+		release.RetryTime = &past
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		cli = providertest.NewFakeClient()
+		job = &failedJob{}
+	})
+
+	It("should double the backoff for every failed attempt, up to an hour", func() {
+		policy := etosv1alpha1.ReleasePolicy{BackoffSeconds: 10}
+		Expect(releaseBackoff(policy, 1)).To(Equal(10 * time.Second))
+		Expect(releaseBackoff(policy, 2)).To(Equal(20 * time.Second))
+		Expect(releaseBackoff(policy, 4)).To(Equal(80 * time.Second))
+		Expect(releaseBackoff(policy, 100)).To(Equal(maxReleaseBackoff))
+		Expect(releaseBackoff(etosv1alpha1.ReleasePolicy{BackoffSeconds: 7200}, 1)).To(Equal(maxReleaseBackoff))
+	})
+
+	It("should retry a failed release until the retries are exhausted and the resource has leaked", func() {
+		newProvider("iut-provider", "iut", 1, 30)
+		iut := newIut("iut", "iut-provider")
+
+		retryAfter, err := standaloneIut(iut).releaseFailed(ctx, cli, nil, job, "release failed")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retryAfter).To(Equal(30 * time.Second))
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+		Expect(iut.Status.Release.Attempts).To(BeEquivalentTo(1))
+		Expect(iut.Status.Release.RetryTime.Time).To(BeTemporally("~", time.Now().Add(30*time.Second), 2*time.Second))
+		Expect(isStatusReason(iut.Status.Conditions, status.StatusActive, status.ReasonPending)).To(BeTrue())
+		Expect(retrying(iut.Status.Release)).To(BeTrue())
+		Expect(job.deleted).To(Equal(1))
+
+		By("returning the remaining backoff when the failure has already been handled")
+		retryAfter, err = standaloneIut(iut).releaseFailed(ctx, cli, nil, job, "release failed")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retryAfter).To(BeNumerically("~", 30*time.Second, 2*time.Second))
+		Expect(iut.Status.Release.Attempts).To(BeEquivalentTo(1))
+
+		By("leaking the resource when the retry fails")
+		elapse(iut.Status.Release)
+		retryAfter, err = standaloneIut(iut).releaseFailed(ctx, cli, nil, job, "release failed again")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retryAfter).To(BeZero())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+		Expect(iut.Status.Release.Attempts).To(BeEquivalentTo(2))
+		Expect(iut.Status.Release.RetryTime).To(BeNil())
+		Expect(isStatusReason(iut.Status.Conditions, status.StatusActive, status.ReasonLeaked)).To(BeTrue())
+		Expect(meta.FindStatusCondition(iut.Status.Conditions, status.StatusActive).Message).To(Equal("release failed again"))
+	})
+
+	It("should retry a failed Environment release with the most lenient policy of its providers", func() {
+		newProvider("iut-provider", "iut", 0, 10)
+		newProvider("log-area-provider", "log-area", 1, 60)
+		iut := newIut("iut", "iut-provider")
+		logArea := &etosv1alpha2.LogArea{
+			ObjectMeta: metav1.ObjectMeta{Name: "log-area", Namespace: namespace},
+			Spec:       etosv1alpha2.LogAreaSpec{ID: uuid.NewString(), ProviderID: "log-area-provider"},
+		}
+		Expect(cli.Create(ctx, logArea)).To(Succeed())
+		environment := &etosv1alpha1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "environment", Namespace: namespace, Finalizers: []string{releaseFinalizer}},
+			Spec: etosv1alpha1.EnvironmentSpec{
+				Providers: &etosv1alpha1.Providers{IUT: iut.Name, ExecutionSpace: "missing", LogArea: logArea.Name},
+			},
+		}
+		Expect(cli.Create(ctx, environment)).To(Succeed())
+		Expect(cli.Delete(ctx, environment)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(environment), environment)).To(Succeed())
+
+		reconciler := &EnvironmentReconciler{Client: cli, Scheme: cli.Scheme()}
+		Expect(reconciler.releasePolicy(ctx, environment)).To(Equal(etosv1alpha1.ReleasePolicy{Retries: 1, BackoffSeconds: 60}))
+
+		Expect(reconciler.releaseFailed(ctx, environment, job, "release failed")).To(Equal(60 * time.Second))
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(environment), environment)).To(Succeed())
+		Expect(environment.Status.Release.Attempts).To(BeEquivalentTo(1))
+		Expect(retrying(environment.Status.Release)).To(BeTrue())
+		Expect(job.deleted).To(Equal(1))
+
+		By("leaking the environment when the retry fails")
+		elapse(environment.Status.Release)
+		Expect(reconciler.releaseFailed(ctx, environment, job, "release failed again")).To(BeZero())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(environment), environment)).To(Succeed())
+		Expect(isStatusReason(environment.Status.Conditions, status.StatusActive, status.ReasonLeaked)).To(BeTrue())
+		Expect(environment.Status.CompletionTime).To(BeNil())
+		Expect(environment.Finalizers).To(ContainElement(releaseFinalizer))
+	})
+
+	It("should retry a failed Environment release job after the backoff", func() {
+		cli = fake.NewClientBuilder().
+			WithScheme(cli.Scheme()).
+			WithStatusSubresource(&etosv1alpha1.Environment{}).
+			WithIndex(&batchv1.Job{}, EnvironmentOwnerKey, func(obj client.Object) []string {
+				if owner := metav1.GetControllerOf(obj); owner != nil {
+					return []string{owner.Name}
+				}
+				return nil
+			}).
+			Build()
+		newProvider("iut-provider", "iut", 2, 10)
+		iut := newIut("iut", "iut-provider")
+		environment := &etosv1alpha1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "environment", Namespace: namespace, Finalizers: []string{releaseFinalizer}},
+			Spec:       etosv1alpha1.EnvironmentSpec{Providers: &etosv1alpha1.Providers{IUT: iut.Name}},
+		}
+		Expect(cli.Create(ctx, environment)).To(Succeed())
+		meta.SetStatusCondition(&environment.Status.Conditions, metav1.Condition{
+			Type:   status.StatusActive,
+			Status: metav1.ConditionTrue,
+			Reason: status.ReasonCompleted,
+		})
+		Expect(cli.Status().Update(ctx, environment)).To(Succeed())
+		releaser := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: environment.Name, Namespace: namespace},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}},
+			},
+		}
+		Expect(controllerutil.SetControllerReference(environment, releaser, cli.Scheme())).To(Succeed())
+		Expect(cli.Create(ctx, releaser)).To(Succeed())
+		Expect(cli.Delete(ctx, environment)).To(Succeed())
+
+		reconciler := &EnvironmentReconciler{Client: cli, Scheme: cli.Scheme()}
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(environment)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", 10*time.Second, 2*time.Second))
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(environment), environment)).To(Succeed())
+		Expect(environment.Status.Release.Attempts).To(BeEquivalentTo(1))
+		Expect(isStatusReason(environment.Status.Conditions, status.StatusActive, status.ReasonPending)).To(BeTrue())
+		Expect(apierrors.IsNotFound(cli.Get(ctx, client.ObjectKeyFromObject(releaser), releaser))).To(BeTrue())
+
+		By("not creating a new release job during the backoff")
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(environment)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apierrors.IsNotFound(cli.Get(ctx, client.ObjectKeyFromObject(releaser), releaser))).To(BeTrue())
+	})
+})
@@ -0,0 +1,200 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/pkg/provider"
+)
+
+// remotePollInterval is how often operations on remote providers are polled. Unlike Jobs
+// they cannot be watched.
+const remotePollInterval = 5 * time.Second
+
+// remoteJob manages an operation on a provider that serves the remote provider API, the same
+// way that jobs.Job manages a Kubernetes Job.
+type remoteJob struct {
+	client    *provider.RemoteClient
+	id        string
+	start     func(context.Context, *provider.RemoteClient, string) (provider.Operation, error)
+	operation provider.Operation
+	// err is returned by Create, Delete and Status if the client could not be created.
+	err error
+}
+
+// Create starts the operation on the remote provider. The JobSpecFunc is not used.
+func (j *remoteJob) Create(ctx context.Context, _ client.Object, _ jobs.JobSpecFunc) error {
+	if j.err != nil {
+		return j.err
+	}
+	operation, err := j.start(ctx, j.client, j.id)
+	if err != nil {
+		return err
+	}
+	j.operation = operation
+	return nil
+}
+
+// Delete makes the remote provider forget the operation.
+func (j *remoteJob) Delete(ctx context.Context) error {
+	if j.err != nil {
+		return j.err
+	}
+	return j.client.Forget(ctx, j.id)
+}
+
+// Result returns the result of the operation, as fetched by Status.
+func (j *remoteJob) Result(_ context.Context, _ string, _ ...string) jobs.Result {
+	result := j.operation.Result
+	if result.Conclusion == "" {
+		result.Conclusion = jobs.ConclusionFailed
+		result.Description = fmt.Sprintf("No result from remote provider for operation %s", j.id)
+	}
+	return result
+}
+
+// Status gets the status of the operation from the remote provider.
+func (j *remoteJob) Status(ctx context.Context) (jobs.Status, error) {
+	if j.err != nil {
+		return jobs.StatusNone, j.err
+	}
+	operation, err := j.client.Status(ctx, j.id)
+	if err != nil {
+		return jobs.StatusNone, err
+	}
+	j.operation = operation
+	return operation.Status, nil
+}
+
+// newReleaseManager returns a jobs.Job that releases a resource with a provider.
+//
+// Providers that serve the remote provider API are called directly, all other providers are
+// run in a Kubernetes Job, which may be shared with other resources that are released in the same
+// batch. If the provider cannot be fetched, a Kubernetes Job is used and the
+// error will surface when that Job is created.
+func newReleaseManager(ctx context.Context, c client.Client, ownerKey string, obj client.Object, providerName string) jobs.Job {
+	p, err := getProvider(ctx, c, providerName, obj.GetNamespace())
+	if err != nil || p.Spec.API == "" {
+		return jobs.NewSharedJob(c, ownerKey, obj)
+	}
+	remote, err := newRemoteClient(ctx, c, p)
+	return &remoteJob{
+		client: remote,
+		err:    err,
+		id:     fmt.Sprintf("release-%s", obj.GetUID()),
+		start: func(ctx context.Context, remote *provider.RemoteClient, id string) (provider.Operation, error) {
+			// The resource is deleted by its controller once released, just like with release Jobs.
+			return remote.Release(ctx, id, provider.ReleaseRequest{
+				Name:      obj.GetName(),
+				Namespace: obj.GetNamespace(),
+				NoDelete:  true,
+			})
+		},
+	}
+}
+
+// remoteProvisioner is a jobs.Job that provisions resources with a remote provider.
+type remoteProvisioner struct {
+	jobs.Job
+	name string
+}
+
+// remoteProvisioners returns the providers of an EnvironmentRequest that serve the remote provider
+// API, in the order that they shall provision: IUT, log area and execution space.
+func remoteProvisioners(
+	ctx context.Context,
+	c client.Client,
+	environmentrequest *etosv1alpha1.EnvironmentRequest,
+) ([]remoteProvisioner, error) {
+	var provisioners []remoteProvisioner
+	for _, name := range []string{
+		environmentrequest.Spec.Providers.IUT.ID,
+		environmentrequest.Spec.Providers.LogArea.ID,
+		environmentrequest.Spec.Providers.ExecutionSpace.ID,
+	} {
+		p, err := getProvider(ctx, c, name, environmentrequest.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if p.Spec.API == "" {
+			continue
+		}
+		remote, err := newRemoteClient(ctx, c, p)
+		if err != nil {
+			return nil, err
+		}
+		provisioners = append(provisioners, remoteProvisioner{
+			name: name,
+			Job: &remoteJob{
+				client: remote,
+				id:     fmt.Sprintf("provision-%s-%s", environmentrequest.GetUID(), name),
+				start: func(ctx context.Context, remote *provider.RemoteClient, id string) (provider.Operation, error) {
+					return remote.Provision(ctx, id, provider.ProvisionRequest{
+						EnvironmentRequest: environmentrequest.Name,
+						Namespace:          environmentrequest.Namespace,
+					})
+				},
+			},
+		})
+	}
+	return provisioners, nil
+}
+
+// setRemoteCapabilities gets the capabilities of a provider that serves the remote provider API and
+// sets the capacity and features that it advertises in its status.
+func setRemoteCapabilities(ctx context.Context, c client.Client, p *etosv1alpha1.Provider) error {
+	remote, err := newRemoteClient(ctx, c, p)
+	if err != nil {
+		return err
+	}
+	capabilities, err := remote.Capabilities(ctx)
+	if err != nil {
+		p.Status.Capacity = nil
+		p.Status.Capabilities = nil
+		return err
+	}
+	p.Status.Capabilities = capabilities.Features
+	p.Status.Capacity = nil
+	if capabilities.Capacity != nil {
+		p.Status.Capacity = &etosv1alpha1.ProviderCapacity{
+			Total:     capabilities.Capacity.Total,
+			Available: capabilities.Capacity.Available,
+			Reserved:  capabilities.Capacity.Reserved,
+		}
+	}
+	return nil
+}
+
+// newRemoteClient creates a client for a provider that serves the remote provider API, which
+// authenticates with the token of the provider.
+func newRemoteClient(ctx context.Context, c client.Client, p *etosv1alpha1.Provider) (*provider.RemoteClient, error) {
+	if p.Spec.Token == nil {
+		return nil, fmt.Errorf("provider %s serves the remote provider API but has no token", p.Name)
+	}
+	token, err := p.Spec.Token.Get(ctx, c, p.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the token of provider %s: %w", p.Name, err)
+	}
+	return provider.NewRemoteClient(p.Spec.Host, strings.TrimSpace(string(token))), nil
+}
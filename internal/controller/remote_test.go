@@ -0,0 +1,177 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+var _ = Describe("Remote provider jobs", func() {
+	const namespace = "default"
+	var (
+		ctx                context.Context
+		cli                client.Client
+		environmentRequest *etosv1alpha1.EnvironmentRequest
+		handler            atomic.Pointer[http.Handler]
+	)
+
+	// startRemoteProvider starts a new remote IUT provider, which does not know about any
+	// operations started before it, the same as when a remote provider restarts.
+	startRemoteProvider := func() {
+		remote := provider.NewRemoteHandler(
+			provider.WithKubernetesClient(ctx, cli), providertest.IutProvider{}, provider.ProviderTypeIut,
+			provider.RemoteOptions{Token: "token"},
+		)
+		handler.Store(&remote)
+	}
+
+	// statusOf polls the status of a remote job.
+	statusOf := func(job jobs.Job) func() jobs.Status {
+		return func() jobs.Status {
+			jobStatus, err := job.Status(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			return jobStatus
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			(*handler.Load()).ServeHTTP(w, r)
+		}))
+		DeferCleanup(server.Close)
+		environmentRequest = providertest.NewEnvironmentRequest("environment-request", namespace).
+			WithAmount(2, 2).
+			WithIutProvider("remote-iut").
+			WithLogAreaProvider("log-area").
+			WithExecutionSpaceProvider("execution-space", "1.0.0").
+			Build()
+		remoteProvider := providertest.NewProvider("remote-iut", namespace, "iut").Build()
+		remoteProvider.Spec.API = provider.RemoteAPIVersion
+		remoteProvider.Spec.Host = server.URL
+		remoteProvider.Spec.Token = &etosv1alpha1.Var{ValueFrom: etosv1alpha1.VarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "remote-iut"},
+				Key:                  "token",
+			},
+		}}
+		cli = providertest.NewFakeClient(
+			environmentRequest,
+			remoteProvider,
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "remote-iut", Namespace: namespace},
+				Data:       map[string][]byte{"token": []byte("token\n")},
+			},
+			providertest.NewProvider("log-area", namespace, "log-area").Build(),
+			providertest.NewProvider("execution-space", namespace, "execution-space").Build(),
+		)
+		startRemoteProvider()
+	})
+
+	It("should only provision with the providers that serve the remote provider API", func() {
+		provisioners, err := remoteProvisioners(ctx, cli, environmentRequest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(provisioners).To(HaveLen(1))
+		Expect(provisioners[0].name).To(Equal("remote-iut"))
+	})
+
+	It("should provision with a remote provider, and not provision twice if it restarts", func() {
+		provisioners, err := remoteProvisioners(ctx, cli, environmentRequest)
+		Expect(err).NotTo(HaveOccurred())
+		provisioner := provisioners[0]
+		Expect(statusOf(provisioner)()).To(Equal(jobs.StatusNone))
+
+		Expect(provisioner.Create(ctx, environmentRequest, nil)).To(Succeed())
+		Eventually(statusOf(provisioner)).Should(Equal(jobs.StatusSuccessful))
+		Expect(provisioner.Result(ctx, provisioner.name).Conclusion).To(Equal(jobs.ConclusionSuccessful))
+		var iuts etosv1alpha2.IutList
+		Expect(cli.List(ctx, &iuts, client.InNamespace(namespace))).To(Succeed())
+		Expect(iuts.Items).To(HaveLen(2))
+
+		By("starting the provision again when the remote provider has forgotten it")
+		startRemoteProvider()
+		Expect(statusOf(provisioner)()).To(Equal(jobs.StatusNone))
+		Expect(provisioner.Create(ctx, environmentRequest, nil)).To(Succeed())
+		Eventually(statusOf(provisioner)).Should(Equal(jobs.StatusSuccessful))
+		Expect(cli.List(ctx, &iuts, client.InNamespace(namespace))).To(Succeed())
+		Expect(iuts.Items).To(HaveLen(2))
+
+		By("forgetting the operation when deleted")
+		Expect(provisioner.Delete(ctx)).To(Succeed())
+		Expect(statusOf(provisioner)()).To(Equal(jobs.StatusNone))
+	})
+
+	It("should release with a remote provider without deleting the resource", func() {
+		iut, err := provider.CreateIUT(
+			provider.WithKubernetesClient(ctx, cli), environmentRequest, namespace, "iut", etosv1alpha2.IutSpec{},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		job := newReleaseManager(ctx, cli, IutOwnerKey, iut, "remote-iut")
+		Expect(job).To(BeAssignableToTypeOf(&remoteJob{}))
+		Expect(job.Create(ctx, iut, nil)).To(Succeed())
+		Eventually(statusOf(job)).Should(Equal(jobs.StatusSuccessful))
+		Expect(job.Result(ctx, iut.Name).Conclusion).To(Equal(jobs.ConclusionSuccessful))
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), iut)).To(Succeed())
+	})
+
+	It("should release with a Kubernetes Job when the provider does not serve the remote provider API", func() {
+		iut := &etosv1alpha2.Iut{}
+		iut.Name = "iut"
+		iut.Namespace = namespace
+		Expect(newReleaseManager(ctx, cli, IutOwnerKey, iut, "log-area")).NotTo(BeAssignableToTypeOf(&remoteJob{}))
+		Expect(newReleaseManager(ctx, cli, IutOwnerKey, iut, "missing")).NotTo(BeAssignableToTypeOf(&remoteJob{}))
+	})
+
+	It("should not call a remote provider without its token", func() {
+		var remoteProvider etosv1alpha1.Provider
+		Expect(cli.Get(ctx, client.ObjectKey{Name: "remote-iut", Namespace: namespace}, &remoteProvider)).To(Succeed())
+		remoteProvider.Spec.Token.ValueFrom.SecretKeyRef.Key = "wrong"
+		Expect(cli.Update(ctx, &remoteProvider)).To(Succeed())
+		_, err := remoteProvisioners(ctx, cli, environmentRequest)
+		Expect(err).To(MatchError(ContainSubstring("failed to get the token of provider remote-iut")))
+
+		remoteProvider.Spec.Token = nil
+		Expect(cli.Update(ctx, &remoteProvider)).To(Succeed())
+		iut := &etosv1alpha2.Iut{}
+		iut.Name = "iut"
+		iut.Namespace = namespace
+		job := newReleaseManager(ctx, cli, IutOwnerKey, iut, "remote-iut")
+		Expect(job.Create(ctx, iut, nil)).To(MatchError(ContainSubstring("has no token")))
+	})
+
+	It("should return a failed result when the remote provider has no result", func() {
+		job := &remoteJob{client: provider.NewRemoteClient("http://localhost", ""), id: "provision-1"}
+		result := job.Result(ctx, "environment-request")
+		Expect(result.Conclusion).To(Equal(jobs.ConclusionFailed))
+		Expect(result.Description).To(ContainSubstring("provision-1"))
+	})
+})
@@ -26,6 +26,7 @@ const (
 	StatusActive      = "Active"
 	StatusEnvironment = "Environment"
 	StatusSuiteRunner = "SuiteRunner"
+	StatusProviders   = "Providers"
 )
 
 const (
@@ -35,6 +36,14 @@ const (
 	ReasonFailed    = "Failed"
 	ReasonTimedOut  = "DeadlineExceeded"
 	ReasonCompleted = "Completed"
+	// ReasonWaitingForProvider is set when a provider is unavailable and the resource waits for it.
+	ReasonWaitingForProvider = "WaitingForProvider"
+	// ReasonWaitingForCapacity is set when a provider does not have enough available capacity and the resource waits for it.
+	ReasonWaitingForCapacity = "WaitingForCapacity"
+	// ReasonOrphaned is the reason that a resource is reaped for when its EnvironmentRequest or Provider is gone.
+	ReasonOrphaned = "Orphaned"
+	// ReasonLeaked is set when a resource could not be released, and all retries have been exhausted.
+	ReasonLeaked = "Leaked"
 )
 
 // NotReadyError is returned by sub-reconcilers when their resources have been
@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"time"
 
@@ -46,6 +47,7 @@ import (
 	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
 	"github.com/eiffel-community/etos/internal/controller/jobs"
 	"github.com/eiffel-community/etos/internal/controller/status"
+	"github.com/eiffel-community/etos/pkg/opentelemetry"
 )
 
 const testRunKind = "TestRun"
@@ -150,6 +152,10 @@ func (r *TestRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		logger.Error(err, "Reconciliation failed for testrun", "namespace", req.Namespace, "name", req.Name)
 		return ctrl.Result{}, err
 	}
+	// Providers are watched, but the wait for them must time out even if they never change.
+	if remaining := providerWaitRemaining(testrun.Status.Conditions, testrun.Spec.Providers.WaitTimeout); remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
 
 	return ctrl.Result{}, nil
 }
@@ -157,6 +163,13 @@ func (r *TestRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 func (r *TestRunReconciler) reconcile(ctx context.Context, cluster *etosv1alpha1.Cluster, testrun *etosv1alpha1.TestRun) error {
 	// Check providers availability
 	if err := checkProviders(ctx, r, testrun.Namespace, testrun.Spec.Providers); err != nil {
+		if held, changed := holdForProviders(&testrun.Status.Conditions, testrun.Spec.Providers.WaitTimeout, err); held {
+			logf.FromContext(ctx).Info("Waiting for providers to become available", "reason", err.Error())
+			if changed {
+				return r.Status().Update(ctx, testrun)
+			}
+			return nil
+		}
 		if meta.SetStatusCondition(&testrun.Status.Conditions, metav1.Condition{
 			Type:    status.StatusActive,
 			Status:  metav1.ConditionFalse,
@@ -167,6 +180,9 @@ func (r *TestRunReconciler) reconcile(ctx context.Context, cluster *etosv1alpha1
 		}
 		return err
 	}
+	if releaseProviderHold(&testrun.Status.Conditions) {
+		return r.Status().Update(ctx, testrun)
+	}
 
 	// Create environment request
 	if updated, err := r.reconcileEnvironmentRequest(ctx, cluster, testrun); updated || err != nil {
@@ -568,6 +584,8 @@ func (r TestRunReconciler) environmentRequest(ctx context.Context, name string,
 	if ok {
 		annotations["etos.eiffel-community.github.io/baggage"] = baggage
 	}
+	// The EnvironmentRequest continues the trace from this reconcile of the TestRun.
+	opentelemetry.InjectAnnotations(ctx, annotations)
 	// Using ParseInt directly instead of Atoi since Atoi returns int, not int64
 	environmentTimeout, err := strconv.ParseInt(cluster.Spec.ETOS.Config.EnvironmentTimeout, 10, 0)
 	var deadline int64
@@ -578,6 +596,21 @@ func (r TestRunReconciler) environmentRequest(ctx context.Context, name string,
 		deadline = time.Now().Unix() + environmentTimeout
 	}
 
+	failover := testrun.Spec.Providers.Failover
+	if failover == nil {
+		failover = &etosv1alpha1.ProvidersFailover{}
+	}
+
+	// The level of the testrun takes precedence over the level of the cluster, and debugging a
+	// testrun shows all logs.
+	userLogLevel := testrun.Spec.UserLogLevel
+	if userLogLevel == "" {
+		userLogLevel = cluster.Spec.ETOS.Config.UserLogLevel
+	}
+	if testrun.Spec.Debug {
+		userLogLevel = etosv1alpha1.UserLogLevelDebug
+	}
+
 	return &etosv1alpha1.EnvironmentRequest{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels: map[string]string{
@@ -601,23 +634,31 @@ func (r TestRunReconciler) environmentRequest(ctx context.Context, name string,
 			Dataset:       dataset,
 			Providers: etosv1alpha1.EnvironmentProviders{
 				IUT: etosv1alpha1.IutProvider{
-					ID: testrun.Spec.Providers.IUT,
+					ID:       testrun.Spec.Providers.IUT,
+					Failover: failover.IUT,
 				},
 				ExecutionSpace: etosv1alpha1.ExecutionSpaceProvider{
 					ID:              testrun.Spec.Providers.ExecutionSpace,
+					Failover:        failover.ExecutionSpace,
 					TestRunner:      testrun.Spec.TestRunner.Version,
 					TestRunnerImage: "",
 				},
 				LogArea: etosv1alpha1.LogAreaProvider{
-					ID: testrun.Spec.Providers.LogArea,
+					ID:       testrun.Spec.Providers.LogArea,
+					Failover: failover.LogArea,
 				},
+				WaitTimeout:   testrun.Spec.Providers.WaitTimeout,
+				LeaseDuration: testrun.Spec.Providers.LeaseDuration,
 			},
 			Splitter: etosv1alpha1.Splitter{
 				Tests: tests,
 			},
 			Image:              testrun.Spec.EnvironmentProvider.Image,
+			JobSettings:        testrun.Spec.EnvironmentProvider.JobSettings,
 			ServiceAccountName: fmt.Sprintf("%s-provider", testrun.Spec.Cluster),
 			Deadline:           deadline,
+			UserLogLevel:       userLogLevel,
+			Debug:              testrun.Spec.Debug,
 			Config: etosv1alpha1.EnvironmentProviderJobConfig{
 				EiffelMessageBus:                    eiffelMessageBus,
 				EtosMessageBus:                      etosMessageBus,
@@ -904,22 +945,13 @@ func (r *TestRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	if err := r.registerOwnerIndexForEnvironmentRequest(mgr); err != nil {
 		return err
 	}
-	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.TestRun{}, iutProvider, func(rawObj client.Object) []string {
-		testrun := rawObj.(*etosv1alpha1.TestRun)
-		return []string{testrun.Spec.Providers.IUT}
-	}); err != nil {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.TestRun{}, iutProvider, testRunProviderIndex(iutProvider)); err != nil {
 		return err
 	}
-	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.TestRun{}, logAreaProvider, func(rawObj client.Object) []string {
-		testrun := rawObj.(*etosv1alpha1.TestRun)
-		return []string{testrun.Spec.Providers.LogArea}
-	}); err != nil {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.TestRun{}, logAreaProvider, testRunProviderIndex(logAreaProvider)); err != nil {
 		return err
 	}
-	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.TestRun{}, executionSpaceProvider, func(rawObj client.Object) []string {
-		testrun := rawObj.(*etosv1alpha1.TestRun)
-		return []string{testrun.Spec.Providers.ExecutionSpace}
-	}); err != nil {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &etosv1alpha1.TestRun{}, executionSpaceProvider, testRunProviderIndex(executionSpaceProvider)); err != nil {
 		return err
 	}
 	return ctrl.NewControllerManagedBy(mgr).
@@ -942,7 +974,7 @@ func (r *TestRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			handler.TypedEnqueueRequestsFromMapFunc(r.findTestrunsForLogAreaProvider),
 			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
 		).
-		Complete(r)
+		Complete(traced(r.Client, &etosv1alpha1.TestRun{}, r))
 }
 
 // registerOwnerIndexForJob will set an index of the suite runner jobs that a testrun owns.
@@ -1001,26 +1033,56 @@ func (r *TestRunReconciler) findTestrunsForLogAreaProvider(ctx context.Context,
 	return r.findTestrunsForProvider(ctx, logAreaProvider, provider)
 }
 
-// findTestrunsForProvider will find testruns for a providerName.
-func (r *TestRunReconciler) findTestrunsForProvider(ctx context.Context, providerName string, provider client.Object) []reconcile.Request {
+// findTestrunsForProvider will find testruns that use, or fall back to, a provider. The index is the
+// field index of the type of provider, I.e. iutProvider.
+func (r *TestRunReconciler) findTestrunsForProvider(ctx context.Context, index string, provider client.Object) []reconcile.Request {
 	testrunList := &etosv1alpha1.TestRunList{}
 	listOps := &client.ListOptions{
-		FieldSelector: fields.OneTermEqualSelector(providerName, provider.GetName()),
+		FieldSelector: fields.OneTermEqualSelector(index, provider.GetName()),
 		Namespace:     provider.GetNamespace(),
 	}
 	err := r.List(ctx, testrunList, listOps)
 	if err != nil {
 		return []reconcile.Request{}
 	}
+	testruns := testrunList.Items
 
-	requests := make([]reconcile.Request, len(testrunList.Items))
-	for i, item := range testrunList.Items {
-		requests[i] = reconcile.Request{
+	// Providers to fall back to can also be selected by their labels, which cannot be indexed.
+	selectorList := &etosv1alpha1.TestRunList{}
+	listOps = &client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(index, failoverSelectorIndexValue),
+		Namespace:     provider.GetNamespace(),
+	}
+	if err := r.List(ctx, selectorList, listOps); err == nil {
+		for _, testrun := range selectorList.Items {
+			choice, _ := providerChoiceFor(testRunProviderChoices(&testrun.Spec.Providers), index)
+			if choice.selects(provider) {
+				testruns = append(testruns, testrun)
+			}
+		}
+	}
+
+	requests := make([]reconcile.Request, 0, len(testruns))
+	for _, item := range testruns {
+		request := reconcile.Request{
 			NamespacedName: types.NamespacedName{
 				Name:      item.GetName(),
 				Namespace: item.GetNamespace(),
 			},
 		}
+		if !slices.Contains(requests, request) {
+			requests = append(requests, request)
+		}
 	}
 	return requests
 }
+
+// testRunProviderIndex indexes testruns by the provider, and the providers to fall back to, of the
+// type of provider with a field index, I.e. iutProvider.
+func testRunProviderIndex(index string) client.IndexerFunc {
+	return func(rawObj client.Object) []string {
+		testrun := rawObj.(*etosv1alpha1.TestRun)
+		choice, _ := providerChoiceFor(testRunProviderChoices(&testrun.Spec.Providers), index)
+		return choice.indexValues()
+	}
+}
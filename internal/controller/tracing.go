@@ -0,0 +1,127 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"reflect"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/pkg/opentelemetry"
+	"github.com/eiffel-community/etos/pkg/opentelemetry/semconv"
+)
+
+// tracerName is the name of the OpenTelemetry tracer used for the spans of the controllers.
+const tracerName = "github.com/eiffel-community/etos/internal/controller"
+
+// tracedReconciler runs each reconcile of a reconciler in an OpenTelemetry span, parented on the
+// trace context of the reconciled resource.
+type tracedReconciler struct {
+	client.Reader
+	reconciler reconcile.Reconciler
+	object     client.Object
+	kind       string
+}
+
+// traced wraps a reconciler of a kind of resource, I.e. &etosv1alpha1.TestRun{}, in a tracedReconciler.
+func traced(reader client.Reader, object client.Object, reconciler reconcile.Reconciler) reconcile.Reconciler {
+	return tracedReconciler{
+		Reader:     reader,
+		reconciler: reconciler,
+		object:     object,
+		kind:       reflect.TypeOf(object).Elem().Name(),
+	}
+}
+
+// Reconcile runs the reconcile of the wrapped reconciler in a span.
+//
+// Resources that cannot be fetched, I.e. because they have been removed, are reconciled without a span
+// since there is no trace context to continue.
+func (r tracedReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	obj := r.object.DeepCopyObject().(client.Object)
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		return r.reconciler.Reconcile(ctx, req)
+	}
+	ctx = opentelemetry.ContextFromAnnotations(ctx, r.traceAnnotations(ctx, obj))
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "reconcile "+r.kind,
+		trace.WithAttributes(r.attributes(obj)...),
+	)
+	defer span.End()
+
+	result, err := r.reconciler.Reconcile(ctx, req)
+	if result.RequeueAfter > 0 {
+		span.SetAttributes(semconv.ETOSControllerRequeueAfter(result.RequeueAfter.Seconds()))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return result, err
+}
+
+// traceAnnotations returns the annotations that carry the trace context of a resource.
+//
+// Resources created by providers, I.e. IUTs, and Environments carry no trace context of their own,
+// they continue the trace of the EnvironmentRequest that owns them.
+func (r tracedReconciler) traceAnnotations(ctx context.Context, obj client.Object) map[string]string {
+	if opentelemetry.HasTraceContext(obj.GetAnnotations()) {
+		return obj.GetAnnotations()
+	}
+	for _, owner := range obj.GetOwnerReferences() {
+		if owner.Kind != "EnvironmentRequest" {
+			continue
+		}
+		var environmentRequest etosv1alpha1.EnvironmentRequest
+		if err := r.Get(ctx, types.NamespacedName{Name: owner.Name, Namespace: obj.GetNamespace()}, &environmentRequest); err != nil {
+			return nil
+		}
+		return environmentRequest.Annotations
+	}
+	return nil
+}
+
+// attributes returns the span attributes of a resource.
+func (r tracedReconciler) attributes(obj client.Object) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		semconv.ETOSControllerKind(r.kind),
+		semconv.ETOSControllerName(obj.GetName()),
+		semconv.ETOSControllerNamespace(obj.GetNamespace()),
+	}
+	id := obj.GetLabels()["etos.eiffel-community.github.io/id"]
+	switch obj := obj.(type) {
+	case *etosv1alpha1.TestRun:
+		id = obj.Spec.ID
+	case *etosv1alpha1.EnvironmentRequest:
+		id = obj.Spec.Identifier
+	}
+	if id != "" {
+		attributes = append(attributes, semconv.ETOSTestRunID(id))
+	}
+	if name := obj.GetLabels()["etos.eiffel-community.github.io/environment-request"]; name != "" {
+		attributes = append(attributes, semconv.ETOSProviderEnvironmentRequest(name))
+	}
+	return attributes
+}
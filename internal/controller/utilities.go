@@ -34,6 +34,7 @@ const (
 	LogAreaOwnerKey            = ".metadata.controller.log-area-provider"
 	ExecutionSpaceOwnerKey     = ".metadata.controller.execution-space-provider"
 	IutOwnerKey                = ".metadata.controller.iut-provider"
+	ProviderOwnerKey           = ".metadata.controller.provider"
 )
 
 const (
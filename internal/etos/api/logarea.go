@@ -43,6 +43,9 @@ var (
 	LogAreaServicePort int32 = 80
 )
 
+// logAreaStoragePath is where the log area stores uploaded logs. The storage lives as long as the pod.
+const logAreaStoragePath = "/data"
+
 type ETOSLogAreaDeployment struct {
 	etosv1alpha1.ETOSLogArea
 	client.Client
@@ -175,6 +178,12 @@ func (r *ETOSLogAreaDeployment) deployment(name types.NamespacedName, cluster *e
 				Spec: corev1.PodSpec{
 					ServiceAccountName: name.Name,
 					Containers:         []corev1.Container{r.container(name, cluster)},
+					Volumes: []corev1.Volume{
+						{
+							Name:         "logs",
+							VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+						},
+					},
 				},
 			},
 		},
@@ -234,7 +243,13 @@ func (r *ETOSLogAreaDeployment) container(name types.NamespacedName, cluster *et
 		},
 		LivenessProbe:  probe,
 		ReadinessProbe: probe,
-		Env:            r.environment(cluster),
+		Env:            r.environment(),
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "logs",
+				MountPath: logAreaStoragePath,
+			},
+		},
 		EnvFrom: []corev1.EnvFromSource{
 			{
 				SecretRef: &corev1.SecretEnvSource{
@@ -248,19 +263,15 @@ func (r *ETOSLogAreaDeployment) container(name types.NamespacedName, cluster *et
 }
 
 // environment creates the environment resource for the ETOS logarea deployment.
-func (r *ETOSLogAreaDeployment) environment(cluster *etosv1alpha1.Cluster) []corev1.EnvVar {
+func (r *ETOSLogAreaDeployment) environment() []corev1.EnvVar {
 	return []corev1.EnvVar{
 		{
 			Name:  "SERVICE_HOST",
 			Value: "0.0.0.0",
 		},
 		{
-			Name:  "ETOS_ETCD_HOST",
-			Value: cluster.Spec.Database.Etcd.Host,
-		},
-		{
-			Name:  "ETOS_ETCD_PORT",
-			Value: cluster.Spec.Database.Etcd.Port,
+			Name:  "LOGAREA_STORAGE_PATH",
+			Value: logAreaStoragePath,
 		},
 	}
 }
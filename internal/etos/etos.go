@@ -433,6 +433,9 @@ func (r *ETOSDeployment) config(name types.NamespacedName, cluster *etosv1alpha1
 	if cluster.Spec.OpenTelemetry.Enabled {
 		data["OTEL_EXPORTER_OTLP_ENDPOINT"] = []byte(cluster.Spec.OpenTelemetry.Endpoint)
 		data["OTEL_EXPORTER_OTLP_INSECURE"] = []byte(cluster.Spec.OpenTelemetry.Insecure)
+		if cluster.Spec.OpenTelemetry.MetricExportInterval != "" {
+			data["OTEL_METRIC_EXPORT_INTERVAL"] = []byte(cluster.Spec.OpenTelemetry.MetricExportInterval)
+		}
 	}
 	if r.Config.Timezone != "" {
 		data["TZ"] = []byte(r.Config.Timezone)
@@ -572,6 +575,15 @@ func (r *ETOSDeployment) role(name types.NamespacedName, labelName, clusterName
 					"get", "list", "watch",
 				},
 			},
+			{
+				APIGroups: []string{"coordination.k8s.io"},
+				Resources: []string{
+					"leases",
+				},
+				Verbs: []string{
+					"create", "get", "list", "watch", "delete",
+				},
+			},
 		},
 	}
 }
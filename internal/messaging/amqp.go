@@ -0,0 +1,259 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	amqp091 "github.com/rabbitmq/amqp091-go"
+	"github.com/rabbitmq/rabbitmq-stream-go-client/pkg/message"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// amqpProducer is a producer which publishes messages to a classic RabbitMQ exchange, with the
+// filter of the message, "identifier.type.meta", as routing key. Messages are confirmed with
+// RabbitMQ publisher confirms.
+type amqpProducer struct {
+	mutex      sync.Mutex
+	url        string
+	config     amqp091.Config
+	exchange   string
+	connection *amqp091.Connection
+	channel    *amqp091.Channel
+	confirm    confirmFunc
+}
+
+// connect opens a connection and a channel in confirm mode to RabbitMQ.
+func (p *amqpProducer) connect() error {
+	if p.connection != nil && !p.connection.IsClosed() {
+		_ = p.connection.Close()
+	}
+	connection, err := amqp091.DialConfig(p.url, p.config)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	channel, err := connection.Channel()
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to open a RabbitMQ channel: %w", err), connection.Close())
+	}
+	if err := channel.Confirm(false); err != nil {
+		return errors.Join(fmt.Errorf("failed to enable publisher confirms: %w", err), connection.Close())
+	}
+	p.connection = connection
+	p.channel = channel
+	return nil
+}
+
+// Send publishes a message to the exchange, reconnecting to RabbitMQ if the connection was lost.
+func (p *amqpProducer) Send(msg message.StreamMessage) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.channel == nil || p.channel.IsClosed() {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	routingKey := messageFilter(msg)
+	filter := Filter{}.FromString(routingKey)
+	confirmation, err := p.channel.PublishWithDeferredConfirm(
+		p.exchange,
+		routingKey,
+		false,
+		false,
+		amqp091.Publishing{
+			Headers: amqp091.Table{
+				"identifier": filter.Identifier,
+				"type":       filter.Type,
+				"meta":       filter.Meta,
+			},
+			DeliveryMode: amqp091.Persistent,
+			Body:         messageData(msg),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	go func() {
+		// Confirmations are negative acknowledgements if the channel is closed before RabbitMQ
+		// has confirmed the message.
+		if confirmation.Wait() {
+			p.confirm(msg, nil)
+		} else {
+			p.confirm(msg, errUnconfirmed)
+		}
+	}()
+	return nil
+}
+
+// Close the channel and the connection to RabbitMQ.
+func (p *amqpProducer) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.connection == nil || p.connection.IsClosed() {
+		return nil
+	}
+	return p.connection.Close()
+}
+
+// amqpConnectionConfig returns the URL and the configuration of a connection, named name, to RabbitMQ.
+func amqpConnectionConfig(
+	ctx context.Context,
+	name string,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+) (string, amqp091.Config, error) {
+	password, err := messageBusPassword(ctx, config, cli, namespace)
+	if err != nil {
+		return "", amqp091.Config{}, fmt.Errorf("failed to get RabbitMQ password: %w", err)
+	}
+	scheme := "amqp"
+	if config.SSL == "true" {
+		scheme = "amqps"
+	}
+	amqpConfig := amqp091.Config{
+		SASL:       []amqp091.Authentication{&amqp091.PlainAuth{Username: config.Username, Password: string(password)}},
+		Vhost:      config.Vhost,
+		Properties: amqp091.NewConnectionProperties(),
+	}
+	amqpConfig.Properties.SetClientConnectionName(name)
+	return fmt.Sprintf("%s://%s:%s", scheme, config.Host, config.Port), amqpConfig, nil
+}
+
+// newAMQPPublisher creates a publisher to the classic RabbitMQ exchange Exchange in the message bus
+// configuration.
+func newAMQPPublisher(
+	ctx context.Context,
+	name string,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options PublisherOptions,
+) (Publisher, error) {
+	url, amqpConfig, err := amqpConnectionConfig(ctx, name, config, cli, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return newBufferedPublisher(
+		semconv.MessagingSystemRabbitMQ,
+		config.Exchange,
+		options,
+		func(confirm confirmFunc) (producer, error) {
+			p := &amqpProducer{
+				url:      url,
+				config:   amqpConfig,
+				exchange: config.Exchange,
+				confirm:  confirm,
+			}
+			if err := p.connect(); err != nil {
+				return nil, err
+			}
+			return p, nil
+		},
+	)
+}
+
+// newAMQPSubscriber creates a subscriber to the classic RabbitMQ exchange Exchange in the message bus
+// configuration. The messages are received on an exclusive queue, bound to the exchange with the
+// filters as binding keys, so only new messages can be received.
+func newAMQPSubscriber(
+	ctx context.Context,
+	name string,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options SubscriberOptions,
+) (Subscriber, error) {
+	if options.Offset.kind != offsetNext {
+		return nil, errOffsetNotSupported
+	}
+	url, amqpConfig, err := amqpConnectionConfig(ctx, name, config, cli, namespace)
+	if err != nil {
+		return nil, err
+	}
+	connection, err := amqp091.DialConfig(url, amqpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	deliveries, err := amqpConsume(connection, name, config.Exchange, options.Filters)
+	if err != nil {
+		return nil, errors.Join(err, connection.Close())
+	}
+	subscription := newSubscription(options.BufferSize)
+	subscription.stop = connection.Close
+	go func() {
+		for delivery := range deliveries {
+			if !options.match(delivery.RoutingKey) {
+				continue
+			}
+			subscription.deliver(newEvent(0, delivery.RoutingKey, delivery.Body))
+		}
+		subscription.fail(errors.New("the connection to RabbitMQ was closed"))
+	}()
+	return subscription, nil
+}
+
+// amqpConsume declares an exclusive queue, bound to an exchange with the filters as binding keys,
+// and starts consuming it.
+func amqpConsume(
+	connection *amqp091.Connection,
+	name string,
+	exchange string,
+	filters []Filter,
+) (<-chan amqp091.Delivery, error) {
+	channel, err := connection.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a RabbitMQ channel: %w", err)
+	}
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare a RabbitMQ queue: %w", err)
+	}
+	keys := []string{"#"}
+	if len(filters) > 0 {
+		keys = make([]string, 0, len(filters))
+		for _, filter := range filters {
+			keys = append(keys, amqpBindingKey(filter))
+		}
+	}
+	for _, key := range keys {
+		if err := channel.QueueBind(queue.Name, key, exchange, false, nil); err != nil {
+			return nil, fmt.Errorf("failed to bind the RabbitMQ queue to %q: %w", exchange, err)
+		}
+	}
+	return channel.Consume(queue.Name, name, true, true, false, false, nil)
+}
+
+// amqpBindingKey returns the binding key of a topic exchange for a filter. Empty parts of the filter
+// and "*" match any word, or any number of words for the meta, which may contain dots.
+func amqpBindingKey(filter Filter) string {
+	wildcard := func(part, any string) string {
+		if part == "" || part == "*" {
+			return any
+		}
+		return part
+	}
+	return fmt.Sprintf("%s.%s.%s",
+		wildcard(filter.Identifier, "*"),
+		wildcard(filter.Type, "*"),
+		wildcard(filter.Meta, "#"),
+	)
+}
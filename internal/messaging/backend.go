@@ -0,0 +1,90 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/pkg/redact"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Backend creates a Publisher to a message bus, named name, from the message bus configuration of an
+// EnvironmentRequest or a Cluster in namespace.
+type Backend func(
+	ctx context.Context,
+	name string,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options PublisherOptions,
+) (Publisher, error)
+
+var (
+	backendsMutex sync.RWMutex
+	// backends are the message bus backends that NewPublisher selects from, by the Backend field of
+	// the message bus configuration.
+	backends = map[v1alpha1.MessageBusBackend]Backend{
+		v1alpha1.MessageBusBackendStream: newRabbitMQStreamPublisher,
+		v1alpha1.MessageBusBackendAMQP:   newAMQPPublisher,
+		v1alpha1.MessageBusBackendNATS:   newNATSPublisher,
+		v1alpha1.MessageBusBackendFile:   newFilePublisher,
+	}
+)
+
+// RegisterBackend registers a message bus backend, replacing any backend already registered with
+// the same name.
+func RegisterBackend(name v1alpha1.MessageBusBackend, backend Backend) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	backends[name] = backend
+}
+
+// NewPublisher creates a new Publisher instance, to the backend of the message bus configuration.
+// The backend defaults to a RabbitMQ stream.
+func NewPublisher(
+	ctx context.Context,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options PublisherOptions,
+) (Publisher, error) {
+	name := config.Backend
+	if name == "" {
+		name = v1alpha1.MessageBusBackendStream
+	}
+	backendsMutex.RLock()
+	backend, ok := backends[name]
+	backendsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown message bus backend %q", name)
+	}
+	return backend(ctx, "provider", config, cli, namespace, options)
+}
+
+// messageBusPassword gets the password of a message bus configuration and registers it, so that it is redacted
+// from logs.
+func messageBusPassword(ctx context.Context, config v1alpha1.RabbitMQ, cli client.Client, namespace string) ([]byte, error) {
+	value, err := config.Password.Get(ctx, cli, namespace)
+	if err != nil {
+		return nil, err
+	}
+	redact.Register(string(value))
+	return value, nil
+}
@@ -0,0 +1,121 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/pkg/redact"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewPublisher", func() {
+	ctx := context.Background()
+
+	It("should fail for an unknown backend", func() {
+		_, err := NewPublisher(ctx, v1alpha1.RabbitMQ{Backend: "carrier-pigeon"}, nil, "default", PublisherOptions{})
+		Expect(err).To(MatchError(ContainSubstring("unknown message bus backend")))
+	})
+
+	It("should redact the password of the message bus from logs", func() {
+		const password = "message-bus-password"
+		_, err := NewPublisher(ctx, v1alpha1.RabbitMQ{
+			Backend:  v1alpha1.MessageBusBackendNATS,
+			Host:     "127.0.0.1",
+			Port:     "1",
+			Username: "etos",
+			Password: &v1alpha1.Var{Value: password},
+		}, nil, "default", PublisherOptions{})
+		Expect(err).To(HaveOccurred())
+		Expect(redact.String("connecting with " + password)).NotTo(ContainSubstring(password))
+	})
+
+	It("should publish messages to a file with the file backend", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "messages")
+		publisher, err := NewPublisher(ctx, v1alpha1.RabbitMQ{
+			Backend: v1alpha1.MessageBusBackendFile,
+			Path:    path,
+		}, nil, "default", PublisherOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(publisher.Publish([]byte(`{"message":"first"}`), "id.message")).To(Succeed())
+		Expect(publisher.Publish([]byte(`{"message":"second"}`), "id.message.info")).To(Succeed())
+		Expect(publisher.Close()).To(Succeed())
+
+		file, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close() // nolint:errcheck
+		var messages []fileMessage
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var msg fileMessage
+			Expect(json.Unmarshal(scanner.Bytes(), &msg)).To(Succeed())
+			Expect(msg.Time).NotTo(BeZero())
+			msg.Time = time.Time{}
+			messages = append(messages, msg)
+		}
+		Expect(messages).To(Equal([]fileMessage{
+			{Data: []byte(`{"message":"first"}`), Filter: "id.message.*"},
+			{Data: []byte(`{"message":"second"}`), Filter: "id.message.info"},
+		}))
+	})
+
+	It("should fail without a path with the file backend", func() {
+		_, err := NewPublisher(ctx, v1alpha1.RabbitMQ{Backend: v1alpha1.MessageBusBackendFile}, nil, "default", PublisherOptions{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should use a registered backend", func() {
+		memory := NewMemoryPublisher()
+		RegisterBackend("memory", func(
+			context.Context, string, v1alpha1.RabbitMQ, client.Client, string, PublisherOptions,
+		) (Publisher, error) {
+			return memory, nil
+		})
+		DeferCleanup(func() {
+			backendsMutex.Lock()
+			defer backendsMutex.Unlock()
+			delete(backends, "memory")
+		})
+		publisher, err := NewPublisher(ctx, v1alpha1.RabbitMQ{Backend: "memory"}, nil, "default", PublisherOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(publisher.Publish([]byte("message"), "id.type")).To(Succeed())
+		Expect(publisher.Close()).To(Succeed())
+		Expect(publisher.Publish([]byte("message"), "id.type")).NotTo(Succeed())
+		Expect(memory.Messages()).To(Equal([]Message{
+			{Data: []byte("message"), Filter: Filter{Identifier: "id", Type: "type", Meta: "*"}},
+		}))
+	})
+})
+
+var _ = Describe("natsSubject", func() {
+	It("should keep the filter as the tokens of the subject", func() {
+		Expect(natsSubject("etos", Filter{Identifier: "id", Type: "message", Meta: "info"})).
+			To(Equal("etos.id.message.info"))
+	})
+
+	It("should replace empty tokens and wildcards", func() {
+		Expect(natsSubject("etos", Filter{Identifier: "id", Meta: "*"})).To(Equal("etos.id._._"))
+	})
+})
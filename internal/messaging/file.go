@@ -0,0 +1,270 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/rabbitmq/rabbitmq-stream-go-client/pkg/message"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// filePollInterval is how often the file backend checks for new messages to subscribers.
+var filePollInterval = 100 * time.Millisecond
+
+// fileMessage is a message written to a messageFile.
+type fileMessage struct {
+	Data   []byte    `json:"data"`
+	Filter string    `json:"filter"`
+	Time   time.Time `json:"time"`
+}
+
+// messageFile stores messages in a local file, one JSON encoded message per line. It is used by
+// publishers to spill messages that did not fit in their buffer, and by the file backend.
+type messageFile struct {
+	mutex sync.Mutex
+	path  string
+	count int
+}
+
+// write appends a message to the file.
+func (f *messageFile) write(msg message.StreamMessage) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	line, err := json.Marshal(fileMessage{Data: messageData(msg), Filter: messageFilter(msg), Time: time.Now()})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return errors.Join(err, file.Close())
+	}
+	f.count++
+	return file.Close()
+}
+
+// len returns the number of messages written to the file since it was last drained.
+func (f *messageFile) len() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.count
+}
+
+// drain reads all messages from the file and removes it.
+func (f *messageFile) drain() ([]message.StreamMessage, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.count == 0 {
+		return nil, nil
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() // nolint:errcheck
+	var messages []message.StreamMessage
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var line fileMessage
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("failed to read message: %w", err)
+		}
+		messages = append(messages, newMessage(line.Data, line.Filter))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(f.path); err != nil {
+		return nil, err
+	}
+	f.count = 0
+	return messages, nil
+}
+
+// fileProducer is a producer which appends messages to a messageFile. Messages are confirmed once
+// they have been written.
+type fileProducer struct {
+	file    *messageFile
+	confirm confirmFunc
+}
+
+// Send appends a message to the file.
+func (p *fileProducer) Send(msg message.StreamMessage) error {
+	if err := p.file.write(msg); err != nil {
+		return err
+	}
+	p.confirm(msg, nil)
+	return nil
+}
+
+// Close does nothing, the file is closed after each message.
+func (p *fileProducer) Close() error {
+	return nil
+}
+
+// newFilePublisher creates a publisher which appends messages to the file Path in the message bus
+// configuration, for single-node setups without a message bus.
+func newFilePublisher(
+	_ context.Context,
+	_ string,
+	config v1alpha1.RabbitMQ,
+	_ client.Client,
+	_ string,
+	options PublisherOptions,
+) (Publisher, error) {
+	if config.Path == "" {
+		return nil, errors.New("no path set for the file message bus backend")
+	}
+	return newBufferedPublisher(
+		semconv.MessagingSystemKey.String(string(v1alpha1.MessageBusBackendFile)),
+		config.Path,
+		options,
+		func(confirm confirmFunc) (producer, error) {
+			return &fileProducer{file: &messageFile{path: config.Path}, confirm: confirm}, nil
+		},
+	)
+}
+
+// newFileSubscriber creates a subscriber to the file Path in the message bus configuration. The
+// offset of a message is its line in the file, starting at 0.
+func newFileSubscriber(
+	_ context.Context,
+	_ string,
+	config v1alpha1.RabbitMQ,
+	_ client.Client,
+	_ string,
+	options SubscriberOptions,
+) (Subscriber, error) {
+	if config.Path == "" {
+		return nil, errors.New("no path set for the file message bus backend")
+	}
+	var start int64
+	switch options.Offset.kind {
+	case offsetAt:
+		start = options.Offset.offset
+	case offsetNext:
+		// Messages written before the subscriber was created are skipped.
+		lines, err := countLines(config.Path)
+		if err != nil {
+			return nil, err
+		}
+		start = lines
+	}
+	subscription := newSubscription(options.BufferSize)
+	go tailMessageFile(config.Path, start, options, subscription)
+	return subscription, nil
+}
+
+// tailMessageFile delivers the messages in a file from the line start, and the messages appended to
+// it, until the subscription is closed.
+func tailMessageFile(path string, start int64, options SubscriberOptions, subscription *subscription) {
+	ticker := time.NewTicker(filePollInterval)
+	defer ticker.Stop()
+	var file *os.File
+	defer func() {
+		if file != nil {
+			_ = file.Close()
+		}
+	}()
+	var reader *bufio.Reader
+	var line []byte
+	var offset int64
+	for {
+		if file == nil {
+			var err error
+			file, err = os.Open(path)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				subscription.fail(err)
+				return
+			}
+			if file != nil {
+				reader = bufio.NewReader(file)
+			}
+		}
+		for reader != nil {
+			data, err := reader.ReadBytes('\n')
+			// A line is only complete once its newline has been written.
+			line = append(line, data...)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				subscription.fail(err)
+				return
+			}
+			var msg fileMessage
+			if err := json.Unmarshal(line, &msg); err != nil {
+				subscription.fail(fmt.Errorf("failed to read message: %w", err))
+				return
+			}
+			line = line[:0]
+			offset++
+			if offset-1 < start || !options.match(msg.Filter) {
+				continue
+			}
+			if options.Offset.kind == offsetTime && msg.Time.Before(options.Offset.time) {
+				continue
+			}
+			if !subscription.deliver(newEvent(offset-1, msg.Filter, msg.Data)) {
+				return
+			}
+		}
+		select {
+		case <-subscription.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// countLines returns the number of lines in a file, 0 if it does not exist.
+func countLines(path string) (int64, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close() // nolint:errcheck
+	var lines int64
+	reader := bufio.NewReader(file)
+	for {
+		_, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return lines, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		lines++
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+// Message is a message published to a MemoryPublisher.
+type Message struct {
+	Data   []byte
+	Filter Filter
+}
+
+// MemoryPublisher is a Publisher which keeps the published messages in memory, for tests.
+type MemoryPublisher struct {
+	mutex    sync.Mutex
+	messages []Message
+	closed   bool
+}
+
+// NewMemoryPublisher creates a new MemoryPublisher.
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+// Publish stores a message with a filter in the format "identifier.type.meta".
+func (p *MemoryPublisher) Publish(b []byte, filterString string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return errors.New("Publisher closed")
+	}
+	filter := Filter{}.FromString(filterString)
+	if filter.Meta == "" {
+		filter.Meta = "*"
+	}
+	p.messages = append(p.messages, Message{Data: b, Filter: filter})
+	return nil
+}
+
+// AddLogger does nothing, the MemoryPublisher does not log.
+func (p *MemoryPublisher) AddLogger(logr.Logger) {}
+
+// Close the MemoryPublisher. Messages cannot be published after it has been closed.
+func (p *MemoryPublisher) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	return nil
+}
+
+// Messages returns the messages that have been published.
+func (p *MemoryPublisher) Messages() []Message {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]Message(nil), p.messages...)
+}
@@ -0,0 +1,247 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rabbitmq/rabbitmq-stream-go-client/pkg/message"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// natsProducer is a producer which publishes messages to a NATS JetStream stream, on the subject
+// "<stream>.<identifier>.<type>.<meta>". Messages are confirmed by the acknowledgements of JetStream.
+type natsProducer struct {
+	connection *nats.Conn
+	jetStream  jetstream.JetStream
+	stream     string
+	confirm    confirmFunc
+}
+
+// Send publishes a message to the stream asynchronously.
+func (p *natsProducer) Send(msg message.StreamMessage) error {
+	filter := Filter{}.FromString(messageFilter(msg))
+	natsMsg := nats.NewMsg(natsSubject(p.stream, filter))
+	natsMsg.Data = messageData(msg)
+	natsMsg.Header.Set("identifier", filter.Identifier)
+	natsMsg.Header.Set("type", filter.Type)
+	natsMsg.Header.Set("meta", filter.Meta)
+	future, err := p.jetStream.PublishMsgAsync(natsMsg)
+	if err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-future.Ok():
+			p.confirm(msg, nil)
+		case err := <-future.Err():
+			p.confirm(msg, errors.Join(errUnconfirmed, err))
+		}
+	}()
+	return nil
+}
+
+// Close the connection to NATS, waiting for messages that are being published.
+func (p *natsProducer) Close() error {
+	return p.connection.Drain()
+}
+
+// natsSubject returns the subject of a message with a filter in a stream.
+//
+// NATS does not allow empty tokens or wildcards in the subjects of messages, so empty parts of the
+// filter and the "*" meta, which is used when no meta is set, are replaced by "_". Subscribers use
+// the wildcard "*" for any part of the filter, as with the other backends.
+func natsSubject(stream string, filter Filter) string {
+	tokens := []string{stream}
+	for _, token := range []string{filter.Identifier, filter.Type, filter.Meta} {
+		if token == "" || token == "*" {
+			token = "_"
+		}
+		tokens = append(tokens, token)
+	}
+	return strings.Join(tokens, ".")
+}
+
+// natsConnect connects, named name, to NATS JetStream and checks if the stream exists.
+func natsConnect(
+	ctx context.Context,
+	name string,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options ...nats.Option,
+) (*nats.Conn, jetstream.JetStream, error) {
+	password, err := messageBusPassword(ctx, config, cli, namespace)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get NATS password: %w", err)
+	}
+	scheme := "nats"
+	if config.SSL == "true" {
+		scheme = "tls"
+	}
+	connection, err := nats.Connect(
+		fmt.Sprintf("%s://%s:%s", scheme, config.Host, config.Port),
+		append(options, nats.Name(name), nats.UserInfo(config.Username, string(password)))...,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	jetStream, err := jetstream.New(connection)
+	if err != nil {
+		connection.Close()
+		return nil, nil, err
+	}
+	if _, err := jetStream.Stream(ctx, config.StreamName); err != nil {
+		connection.Close()
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			return nil, nil, errors.New("no stream exists, cannot stream events")
+		}
+		return nil, nil, err
+	}
+	return connection, jetStream, nil
+}
+
+// newNATSPublisher creates a publisher to the NATS JetStream stream StreamName on Host and Port in
+// the message bus configuration. The stream must exist and capture the subjects "<StreamName>.>".
+func newNATSPublisher(
+	ctx context.Context,
+	name string,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options PublisherOptions,
+) (Publisher, error) {
+	return newBufferedPublisher(
+		semconv.MessagingSystemKey.String(string(v1alpha1.MessageBusBackendNATS)),
+		config.StreamName,
+		options,
+		func(confirm confirmFunc) (producer, error) {
+			connection, jetStream, err := natsConnect(ctx, name, config, cli, namespace)
+			if err != nil {
+				return nil, err
+			}
+			return &natsProducer{
+				connection: connection,
+				jetStream:  jetStream,
+				stream:     config.StreamName,
+				confirm:    confirm,
+			}, nil
+		},
+	)
+}
+
+// newNATSSubscriber creates a subscriber to the NATS JetStream stream StreamName on Host and Port in
+// the message bus configuration. The filters are applied by NATS as the filter subjects of an
+// ordered consumer.
+func newNATSSubscriber(
+	ctx context.Context,
+	name string,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options SubscriberOptions,
+) (Subscriber, error) {
+	subscription := newSubscription(options.BufferSize)
+	connection, jetStream, err := natsConnect(ctx, name, config, cli, namespace,
+		nats.ClosedHandler(func(*nats.Conn) {
+			subscription.fail(errors.New("the connection to NATS was closed"))
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	consumerConfig := jetstream.OrderedConsumerConfig{
+		FilterSubjects: natsFilterSubjects(config.StreamName, options.Filters),
+		DeliverPolicy:  jetstream.DeliverNewPolicy,
+	}
+	switch options.Offset.kind {
+	case offsetFirst:
+		consumerConfig.DeliverPolicy = jetstream.DeliverAllPolicy
+	case offsetAt:
+		// The sequence numbers of a JetStream stream start at 1.
+		consumerConfig.DeliverPolicy = jetstream.DeliverAllPolicy
+		if options.Offset.offset > 0 {
+			consumerConfig.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+			consumerConfig.OptStartSeq = uint64(options.Offset.offset)
+		}
+	case offsetTime:
+		consumerConfig.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+		consumerConfig.OptStartTime = &options.Offset.time
+	}
+	consumer, err := jetStream.OrderedConsumer(ctx, config.StreamName, consumerConfig)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	consumeContext, err := consumer.Consume(func(msg jetstream.Msg) {
+		filter := Filter{
+			Identifier: msg.Headers().Get("identifier"),
+			Type:       msg.Headers().Get("type"),
+			Meta:       msg.Headers().Get("meta"),
+		}
+		filterString := fmt.Sprintf("%s.%s.%s", filter.Identifier, filter.Type, filter.Meta)
+		if !options.match(filterString) {
+			return
+		}
+		var offset int64
+		if metadata, err := msg.Metadata(); err == nil {
+			offset = int64(metadata.Sequence.Stream)
+		}
+		subscription.deliver(newEvent(offset, filterString, msg.Data()))
+	})
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	subscription.stop = func() error {
+		consumeContext.Stop()
+		connection.Close()
+		return nil
+	}
+	return subscription, nil
+}
+
+// natsFilterSubjects returns the filter subjects of the filters in a stream, all subjects in the
+// stream if there are no filters. Empty parts of the filters and "*" match any token, or any number
+// of tokens for the meta, which may contain dots.
+func natsFilterSubjects(stream string, filters []Filter) []string {
+	if len(filters) == 0 {
+		return []string{stream + ".>"}
+	}
+	subjects := make([]string, 0, len(filters))
+	for _, filter := range filters {
+		wildcard := func(part, any string) string {
+			if part == "" || part == "*" {
+				return any
+			}
+			return part
+		}
+		subjects = append(subjects, strings.Join([]string{
+			stream,
+			wildcard(filter.Identifier, "*"),
+			wildcard(filter.Type, "*"),
+			wildcard(filter.Meta, ">"),
+		}, "."))
+	}
+	return subjects
+}
@@ -0,0 +1,113 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OverflowPolicy decides what happens to a message that is published when the buffer of a
+// Publisher is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDrop drops the message. Dropped messages are counted in etos.messaging.dropped.
+	OverflowDrop OverflowPolicy = "drop"
+	// OverflowBlock blocks Publish until there is room in the buffer.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowSpill writes the message to a local file. Spilled messages are published again when
+	// there is room in the buffer, or when the Publisher is closed.
+	OverflowSpill OverflowPolicy = "spill"
+)
+
+// The defaults of PublisherOptions.
+const (
+	DefaultBufferSize   = 1000
+	DefaultMaxRetries   = 5
+	DefaultRetryBackoff = 500 * time.Millisecond
+	DefaultFlushTimeout = 10 * time.Second
+)
+
+// PublisherOptions configures how a Publisher buffers messages. Zero values are replaced by the
+// defaults.
+type PublisherOptions struct {
+	// BufferSize is the number of messages that can wait to be sent to RabbitMQ.
+	BufferSize int
+	// Overflow is what happens to messages that are published when the buffer is full.
+	Overflow OverflowPolicy
+	// SpillFile is the file that messages are written to with the OverflowSpill policy.
+	SpillFile string
+	// MaxRetries is the number of times a message that RabbitMQ did not confirm is sent again before
+	// it is dropped.
+	MaxRetries int
+	// RetryBackoff is how long to wait before a message is sent again the first time. The wait is
+	// doubled for every following retry.
+	RetryBackoff time.Duration
+	// FlushTimeout is how long Close waits for messages to be confirmed by RabbitMQ.
+	FlushTimeout time.Duration
+}
+
+// BindFlags binds the publisher options to command line flags.
+func (o *PublisherOptions) BindFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.BufferSize, "publisher-buffer-size", DefaultBufferSize,
+		"The number of messages to the ETOS message bus that can wait to be sent.")
+	fs.Func("publisher-overflow",
+		"What to do with messages to the ETOS message bus when the buffer is full, 'drop', 'block' or 'spill'.",
+		func(value string) error {
+			policy := OverflowPolicy(value)
+			switch policy {
+			case OverflowDrop, OverflowBlock, OverflowSpill:
+				o.Overflow = policy
+				return nil
+			}
+			return fmt.Errorf("unknown overflow policy %q", value)
+		})
+	fs.StringVar(&o.SpillFile, "publisher-spill-file", "",
+		"The file to spill messages to the ETOS message bus to, with the 'spill' overflow policy.")
+	fs.IntVar(&o.MaxRetries, "publisher-max-retries", DefaultMaxRetries,
+		"The number of times a message to the ETOS message bus is sent again if it is not confirmed.")
+	fs.DurationVar(&o.RetryBackoff, "publisher-retry-backoff", DefaultRetryBackoff,
+		"How long to wait before a message to the ETOS message bus is sent again, doubled for every retry.")
+	fs.DurationVar(&o.FlushTimeout, "publisher-flush-timeout", DefaultFlushTimeout,
+		"How long to wait for messages to the ETOS message bus to be confirmed when closing.")
+}
+
+// withDefaults returns a copy of the options with zero values replaced by the defaults.
+func (o PublisherOptions) withDefaults() PublisherOptions {
+	if o.BufferSize <= 0 {
+		o.BufferSize = DefaultBufferSize
+	}
+	if o.Overflow == "" {
+		o.Overflow = OverflowDrop
+	}
+	if o.Overflow == OverflowSpill && o.SpillFile == "" {
+		o.SpillFile = filepath.Join(os.TempDir(), fmt.Sprintf("etos-publisher-%d.spill", os.Getpid()))
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = DefaultMaxRetries
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = DefaultRetryBackoff
+	}
+	if o.FlushTimeout <= 0 {
+		o.FlushTimeout = DefaultFlushTimeout
+	}
+	return o
+}
@@ -0,0 +1,418 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eiffel-community/etos/pkg/opentelemetry"
+	"github.com/go-logr/logr"
+	"github.com/rabbitmq/rabbitmq-stream-go-client/pkg/amqp"
+	"github.com/rabbitmq/rabbitmq-stream-go-client/pkg/message"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+)
+
+type Publisher interface {
+	Publish([]byte, string) error
+	AddLogger(logr.Logger)
+	Close() error
+}
+
+// spillReplayInterval is how often spilled messages are published again, if there is room in the
+// buffer.
+var spillReplayInterval = time.Second
+
+// maxRetryBackoff is the longest wait before a message is sent again.
+const maxRetryBackoff = 30 * time.Second
+
+// errUnconfirmed is the error of messages that the message bus did not confirm.
+var errUnconfirmed = errors.New("message was not confirmed by the message bus")
+
+// The metrics of the publishers.
+var (
+	meter = opentelemetry.NewMeter("github.com/eiffel-community/etos/internal/messaging")
+	// publishFailures counts the messages that could not be sent, or that were not confirmed by the
+	// message bus.
+	publishFailures = meter.Int64Counter(
+		"etos.messaging.publish.failures",
+		metric.WithDescription("Number of messages that failed to be published to the ETOS message bus"),
+	)
+	// droppedMessages counts the messages that were never published.
+	droppedMessages = meter.Int64Counter(
+		"etos.messaging.dropped",
+		metric.WithDescription("Number of messages to the ETOS message bus that were dropped"),
+	)
+	// spilledMessages counts the messages that were written to a spill file.
+	spilledMessages = meter.Int64Counter(
+		"etos.messaging.spilled",
+		metric.WithDescription("Number of messages to the ETOS message bus that were spilled to a local file"),
+	)
+)
+
+type Filter struct {
+	Identifier string
+	Type       string
+	Meta       string
+}
+
+// FromString creates a Filter struct from a string in the format "identifier.type.meta".
+// If the string does not have three parts, the missing parts will be set to an empty string.
+func (f Filter) FromString(s string) Filter {
+	parts := make([]string, 3)
+	copy(parts, strings.SplitN(s, ".", 3))
+	return Filter{
+		Identifier: parts[0],
+		Type:       parts[1],
+		Meta:       parts[2],
+	}
+}
+
+// confirmFunc is called by a producer when the message bus has received a message, with a nil
+// error, or when it failed to receive it.
+type confirmFunc func(msg message.StreamMessage, err error)
+
+// producer sends messages to a message bus. Whether a message was received is reported
+// asynchronously, by the confirmFunc that the producer was created with.
+type producer interface {
+	Send(message.StreamMessage) error
+	Close() error
+}
+
+// bufferedPublisher is a structure implementing the Publisher interface. Used to publish events to a
+// message bus with a producer.
+//
+// Published messages are buffered and sent by a goroutine, so that a slow message bus does not block
+// the publisher. What happens when the buffer is full is decided by the overflow policy in the
+// PublisherOptions.
+type bufferedPublisher struct {
+	logger      logr.Logger
+	system      attribute.KeyValue
+	destination string
+	options     PublisherOptions
+	producer    producer
+	queue       chan message.StreamMessage
+	spill       *messageFile
+
+	// unConfirmed tracks the messages that have been published but not yet confirmed, or dropped.
+	unConfirmed *sync.WaitGroup
+	inFlight    atomic.Int64
+	// attempts is the number of times a message has been sent, guarded by mutex.
+	attempts map[message.StreamMessage]int
+	mutex    sync.Mutex
+
+	done     chan struct{}
+	shutdown atomic.Bool
+}
+
+// newBufferedPublisher creates a publisher to the destination of a message bus, I.e. a stream or an
+// exchange, and starts sending messages with the producer created by newProducer, non blocking.
+func newBufferedPublisher(
+	system attribute.KeyValue,
+	destination string,
+	options PublisherOptions,
+	newProducer func(confirmFunc) (producer, error),
+) (*bufferedPublisher, error) {
+	publisher := &bufferedPublisher{
+		logger:      logr.Discard(),
+		system:      system,
+		destination: destination,
+		options:     options.withDefaults(),
+		unConfirmed: &sync.WaitGroup{},
+	}
+	producer, err := newProducer(publisher.confirm)
+	if err != nil {
+		return nil, err
+	}
+	publisher.start(producer)
+	return publisher, nil
+}
+
+// start starts sending the buffered messages with a producer, non blocking.
+func (s *bufferedPublisher) start(producer producer) {
+	s.queue = make(chan message.StreamMessage, s.options.BufferSize)
+	s.attempts = make(map[message.StreamMessage]int)
+	if s.options.Overflow == OverflowSpill {
+		s.spill = &messageFile{path: s.options.SpillFile}
+	}
+	s.producer = producer
+	s.done = make(chan struct{})
+	go s.publish(time.NewTicker(spillReplayInterval), s.done)
+}
+
+func (s *bufferedPublisher) AddLogger(logger logr.Logger) {
+	logger = logger.WithValues("disableUserLog", true)
+	s.logger = logger
+}
+
+// Publish an event to the message bus.
+//
+// The event is buffered and Publish only blocks if the buffer is full and the overflow policy is
+// OverflowBlock.
+func (s *bufferedPublisher) Publish(b []byte, filterString string) error {
+	if s.shutdown.Load() || s.producer == nil {
+		err := errors.New("Publisher closed")
+		s.logger.Error(err, "Publisher is closed")
+		s.recordFailure("closed")
+		return err
+	}
+	s.track()
+	s.enqueue(newMessage(b, filterString), s.options.Overflow == OverflowBlock)
+	s.logger.Info("Message published to unconfirmed channel")
+	return nil
+}
+
+// enqueue adds a tracked message to the buffer. If the buffer is full, the message is spilled with
+// the OverflowSpill policy and dropped otherwise, unless block is set, then enqueue blocks until there
+// is room in the buffer or the publisher is closed.
+func (s *bufferedPublisher) enqueue(msg message.StreamMessage, block bool) {
+	select {
+	case s.queue <- msg:
+		return
+	default:
+	}
+	switch {
+	case block:
+		select {
+		case s.queue <- msg:
+		case <-s.done:
+			s.drop(msg, "closed")
+		}
+	case s.spill != nil:
+		if err := s.spill.write(msg); err != nil {
+			s.logger.Error(err, "Failed to spill message to file", "file", s.spill.path)
+			s.drop(msg, "overflow")
+			return
+		}
+		s.forget(msg)
+		spilledMessages.Add(context.Background(), 1, metric.WithAttributes(s.attributes()...))
+	default:
+		s.drop(msg, "overflow")
+	}
+}
+
+// publish the messages in the buffer to the message bus, until done is closed.
+func (s *bufferedPublisher) publish(ticker *time.Ticker, done chan struct{}) {
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-s.queue:
+			s.logger.Info("Publishing message to the message bus")
+			if err := s.producer.Send(msg); err != nil {
+				s.logger.Error(err, "Failed to send message")
+				s.recordFailure("send")
+				s.retry(msg)
+				continue
+			}
+			s.logger.Info("Published")
+		case <-ticker.C:
+			// Spilled messages are only published again when the buffer is at most half full, so
+			// that they are not spilled again right away.
+			if len(s.queue) <= cap(s.queue)/2 {
+				s.replaySpill()
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// replaySpill moves the messages in the spill file, if any, back into the buffer.
+func (s *bufferedPublisher) replaySpill() {
+	if s.spill == nil || s.spill.len() == 0 {
+		return
+	}
+	messages, err := s.spill.drain()
+	if err != nil {
+		s.logger.Error(err, "Failed to read spilled messages", "file", s.spill.path)
+		return
+	}
+	for _, msg := range messages {
+		s.track()
+		s.enqueue(msg, false)
+	}
+}
+
+// confirm stops tracking a message that the message bus has received, or sends it again if the
+// message bus failed to receive it.
+func (s *bufferedPublisher) confirm(msg message.StreamMessage, err error) {
+	if err != nil {
+		s.logger.Error(err, "Unconfirmed message")
+		s.recordFailure("unconfirmed")
+		s.retry(msg)
+		return
+	}
+	s.logger.Info("Message confirmed")
+	s.forget(msg)
+}
+
+// retry sends a message again after a backoff, unless it has been sent MaxRetries times already,
+// then it is dropped.
+func (s *bufferedPublisher) retry(msg message.StreamMessage) {
+	s.mutex.Lock()
+	s.attempts[msg]++
+	attempts := s.attempts[msg]
+	s.mutex.Unlock()
+	if attempts > s.options.MaxRetries {
+		s.logger.Info("Message was not published after all retries, dropping it", "attempts", attempts)
+		s.drop(msg, "retries_exhausted")
+		return
+	}
+	done := s.done
+	time.AfterFunc(s.retryBackoff(attempts), func() {
+		select {
+		case <-done:
+			// Close has given up on the message already.
+			return
+		default:
+		}
+		// Never block here, the goroutine that sends messages retries them too.
+		s.enqueue(msg, false)
+	})
+}
+
+// retryBackoff returns how long to wait before a message is sent again, after it has failed to be
+// published a number of times. The backoff is doubled for every attempt, up to maxRetryBackoff.
+func (s *bufferedPublisher) retryBackoff(attempts int) time.Duration {
+	backoff := s.options.RetryBackoff
+	for range attempts - 1 {
+		if backoff >= maxRetryBackoff {
+			break
+		}
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
+
+// drop stops tracking a message that will never be published.
+func (s *bufferedPublisher) drop(msg message.StreamMessage, reason string) {
+	s.forget(msg)
+	droppedMessages.Add(context.Background(), 1, metric.WithAttributes(
+		append(s.attributes(), semconv.ErrorTypeKey.String(reason))...,
+	))
+}
+
+// track starts tracking a message until it is confirmed or dropped.
+func (s *bufferedPublisher) track() {
+	s.inFlight.Add(1)
+	s.unConfirmed.Add(1)
+}
+
+// forget stops tracking a message.
+func (s *bufferedPublisher) forget(msg message.StreamMessage) {
+	s.mutex.Lock()
+	delete(s.attempts, msg)
+	s.mutex.Unlock()
+	s.inFlight.Add(-1)
+	s.unConfirmed.Done()
+}
+
+// recordFailure counts a message that failed to be published, with the reason it failed.
+func (s *bufferedPublisher) recordFailure(reason string) {
+	publishFailures.Add(context.Background(), 1, metric.WithAttributes(
+		append(s.attributes(), semconv.ErrorTypeKey.String(reason))...,
+	))
+}
+
+// attributes returns the metric attributes of the publisher.
+func (s *bufferedPublisher) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		s.system,
+		semconv.MessagingDestinationName(s.destination),
+	}
+}
+
+// Close the publisher.
+//
+// Close waits at most FlushTimeout for the published messages to be confirmed, the messages that
+// are not confirmed by then are dropped. Spilled messages that could not be published are left in
+// the spill file.
+func (s *bufferedPublisher) Close() error {
+	if s.producer == nil || s.shutdown.Swap(true) {
+		return nil
+	}
+	s.logger.Info("Stopping publisher")
+	s.replaySpill()
+
+	s.logger.Info("Wait for unconfirmed messages")
+	flushed := make(chan struct{})
+	go func() {
+		s.unConfirmed.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(s.options.FlushTimeout):
+		remaining := s.inFlight.Load()
+		s.logger.Info("Timed out waiting for messages to be confirmed, dropping them",
+			"messages", remaining, "timeout", s.options.FlushTimeout)
+		droppedMessages.Add(context.Background(), remaining, metric.WithAttributes(
+			append(s.attributes(), semconv.ErrorTypeKey.String("flush_timeout"))...,
+		))
+	}
+	if s.spill != nil && s.spill.len() > 0 {
+		s.logger.Info("Spilled messages were not published", "messages", s.spill.len(), "file", s.spill.path)
+	}
+	close(s.done)
+	s.logger.Info("Done, closing down")
+	if err := s.producer.Close(); err != nil {
+		s.logger.Error(err, "Failed to close publisher")
+	}
+	return nil
+}
+
+// newMessage creates a message to the message bus, with a filter in the format
+// "identifier.type.meta".
+func newMessage(b []byte, filterString string) message.StreamMessage {
+	filter := Filter{}.FromString(filterString)
+	msg := amqp.NewMessage(b)
+	if filter.Meta == "" {
+		filter.Meta = "*"
+	}
+	msg.ApplicationProperties = map[string]any{
+		"identifier": filter.Identifier,
+		"type":       filter.Type,
+		"meta":       filter.Meta,
+	}
+	return msg
+}
+
+// messageFilter returns the filter of a message, in the format "identifier.type.meta".
+func messageFilter(msg message.StreamMessage) string {
+	return filterFromProperties(msg.GetApplicationProperties())
+}
+
+// filterFromProperties returns the filter in the application properties of a message, in the format
+// "identifier.type.meta".
+func filterFromProperties(p map[string]any) string {
+	return fmt.Sprintf("%s.%s.%s", p["identifier"], p["type"], p["meta"])
+}
+
+// messageData returns the body of a message.
+func messageData(msg message.StreamMessage) []byte {
+	data := msg.GetData()
+	if len(data) == 0 {
+		return nil
+	}
+	return data[0]
+}
@@ -0,0 +1,227 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/rabbitmq-stream-go-client/pkg/message"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeProducer is a producer which calls send for each message.
+type fakeProducer struct {
+	mutex sync.Mutex
+	sent  []message.StreamMessage
+	send  func(message.StreamMessage) error
+}
+
+func (p *fakeProducer) Send(msg message.StreamMessage) error {
+	p.mutex.Lock()
+	p.sent = append(p.sent, msg)
+	send := p.send
+	p.mutex.Unlock()
+	if send == nil {
+		return nil
+	}
+	return send(msg)
+}
+
+func (p *fakeProducer) Close() error {
+	return nil
+}
+
+// sentCount returns the number of times Send has been called.
+func (p *fakeProducer) sentCount() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.sent)
+}
+
+// newTestPublisher creates a bufferedPublisher which sends messages with a fake producer.
+func newTestPublisher(options PublisherOptions, fake *fakeProducer) *bufferedPublisher {
+	publisher, err := newBufferedPublisher(
+		semconv.MessagingSystemRabbitMQ,
+		"test",
+		options,
+		func(confirmFunc) (producer, error) { return fake, nil },
+	)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(publisher.Close)
+	return publisher
+}
+
+var _ = Describe("bufferedPublisher", func() {
+	var (
+		producer *fakeProducer
+		// unblock releases the messages that the producer is sending.
+		unblock chan struct{}
+	)
+
+	BeforeEach(func() {
+		spillReplayInterval = 10 * time.Millisecond
+		gate := make(chan struct{})
+		unblock = gate
+		producer = &fakeProducer{}
+		producer.send = func(message.StreamMessage) error {
+			<-gate
+			return nil
+		}
+	})
+
+	It("should not block Publish when the buffer is full with the drop policy", func() {
+		publisher := newTestPublisher(PublisherOptions{
+			BufferSize:   1,
+			Overflow:     OverflowDrop,
+			FlushTimeout: 100 * time.Millisecond,
+		}, producer)
+		DeferCleanup(func() { close(unblock) })
+		Expect(publisher.Publish([]byte("message"), "id.type.meta")).To(Succeed())
+		Eventually(producer.sentCount).Should(Equal(1))
+		for range 4 {
+			Expect(publisher.Publish([]byte("message"), "id.type.meta")).To(Succeed())
+		}
+		// One message is being sent and one is buffered, the rest are dropped.
+		Eventually(publisher.inFlight.Load).Should(BeEquivalentTo(2))
+	})
+
+	It("should block Publish until there is room in the buffer with the block policy", func() {
+		publisher := newTestPublisher(PublisherOptions{
+			BufferSize:   1,
+			Overflow:     OverflowBlock,
+			FlushTimeout: 100 * time.Millisecond,
+		}, producer)
+		Expect(publisher.Publish([]byte("first"), "id.type.meta")).To(Succeed())
+		Eventually(producer.sentCount).Should(Equal(1))
+		Expect(publisher.Publish([]byte("second"), "id.type.meta")).To(Succeed())
+
+		published := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(publisher.Publish([]byte("third"), "id.type.meta")).To(Succeed())
+			close(published)
+		}()
+		Consistently(published, 100*time.Millisecond).ShouldNot(BeClosed())
+		close(unblock)
+		Eventually(published).Should(BeClosed())
+	})
+
+	It("should spill messages to a file and publish them when there is room in the buffer", func() {
+		spill := filepath.Join(GinkgoT().TempDir(), "publisher.spill")
+		publisher := newTestPublisher(PublisherOptions{
+			BufferSize: 1,
+			Overflow:   OverflowSpill,
+			SpillFile:  spill,
+		}, producer)
+		Expect(publisher.Publish([]byte("first"), "id.type.meta")).To(Succeed())
+		Eventually(producer.sentCount).Should(Equal(1))
+		Expect(publisher.Publish([]byte("second"), "id.type.meta")).To(Succeed())
+		Expect(publisher.Publish([]byte("third"), "id.type.meta")).To(Succeed())
+		Expect(publisher.spill.len()).To(Equal(1))
+		Expect(spill).To(BeAnExistingFile())
+
+		producer.mutex.Lock()
+		producer.send = func(msg message.StreamMessage) error {
+			go publisher.confirm(msg, nil)
+			return nil
+		}
+		first := producer.sent[0]
+		producer.mutex.Unlock()
+		close(unblock)
+		// The first message was sent before the producer confirmed messages.
+		go publisher.confirm(first, nil)
+
+		Eventually(producer.sentCount).Should(Equal(3))
+		Expect(publisher.Close()).To(Succeed())
+		Expect(spill).NotTo(BeAnExistingFile())
+		producer.mutex.Lock()
+		defer producer.mutex.Unlock()
+		Expect(messageData(producer.sent[2])).To(Equal([]byte("third")))
+		Expect(messageFilter(producer.sent[2])).To(Equal("id.type.meta"))
+	})
+
+	It("should drop a message after the maximum number of retries", func() {
+		producer.send = func(message.StreamMessage) error {
+			return errors.New("failed to send")
+		}
+		publisher := newTestPublisher(PublisherOptions{MaxRetries: 2, RetryBackoff: 10 * time.Millisecond}, producer)
+		Expect(publisher.Publish([]byte("message"), "id.type.meta")).To(Succeed())
+		Eventually(publisher.inFlight.Load).Should(BeZero())
+		Expect(producer.sentCount()).To(Equal(3))
+		Expect(publisher.Close()).To(Succeed())
+	})
+
+	It("should wait for a backoff before sending a failed message again", func() {
+		const backoff = 50 * time.Millisecond
+		var mutex sync.Mutex
+		var sendTimes []time.Time
+		var publisher *bufferedPublisher
+		producer.send = func(msg message.StreamMessage) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			sendTimes = append(sendTimes, time.Now())
+			if len(sendTimes) <= 3 {
+				return errors.New("failed to send")
+			}
+			go publisher.confirm(msg, nil)
+			return nil
+		}
+		publisher = newTestPublisher(PublisherOptions{MaxRetries: 5, RetryBackoff: backoff}, producer)
+		Expect(publisher.Publish([]byte("message"), "id.type.meta")).To(Succeed())
+
+		Eventually(publisher.inFlight.Load, 2*time.Second).Should(BeZero())
+		Expect(producer.sentCount()).To(Equal(4))
+		mutex.Lock()
+		defer mutex.Unlock()
+		for i := 1; i < len(sendTimes); i++ {
+			// The backoff is doubled for every retry.
+			Expect(sendTimes[i].Sub(sendTimes[i-1])).To(BeNumerically(">=", backoff<<(i-1)))
+		}
+	})
+
+	It("should return from Close when messages are not confirmed within the flush timeout", func() {
+		DeferCleanup(func() { close(unblock) })
+		publisher := newTestPublisher(PublisherOptions{FlushTimeout: 100 * time.Millisecond}, producer)
+		Expect(publisher.Publish([]byte("message"), "id.type.meta")).To(Succeed())
+
+		closed := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(publisher.Close()).To(Succeed())
+			close(closed)
+		}()
+		Eventually(closed, time.Second).Should(BeClosed())
+		Expect(publisher.Publish([]byte("message"), "id.type.meta")).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("PublisherOptions", func() {
+	It("should default the spill file to a temporary file", func() {
+		options := PublisherOptions{Overflow: OverflowSpill}.withDefaults()
+		Expect(filepath.Dir(options.SpillFile)).To(Equal(os.TempDir()))
+		Expect(options.BufferSize).To(Equal(DefaultBufferSize))
+		Expect(options.MaxRetries).To(Equal(DefaultMaxRetries))
+		Expect(options.RetryBackoff).To(Equal(DefaultRetryBackoff))
+		Expect(options.FlushTimeout).To(Equal(DefaultFlushTimeout))
+	})
+})
@@ -19,76 +19,28 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
-	"sync"
 	"time"
 
 	"github.com/eiffel-community/etos/api/v1alpha1"
-	"github.com/go-logr/logr"
 	"github.com/rabbitmq/rabbitmq-stream-go-client/pkg/amqp"
 	"github.com/rabbitmq/rabbitmq-stream-go-client/pkg/ha"
-	"github.com/rabbitmq/rabbitmq-stream-go-client/pkg/message"
 	"github.com/rabbitmq/rabbitmq-stream-go-client/pkg/stream"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-type Publisher interface {
-	Publish([]byte, string) error
-	AddLogger(logr.Logger)
-	Close() error
-}
-
 const (
 	ConfirmationTimeout = 2 * time.Second
 )
 
-// NewPublisher creates a new Publisher instance.
-func NewPublisher(ctx context.Context, config v1alpha1.RabbitMQ, cli client.Client, namespace string) (Publisher, error) {
-	return newRabbitMQStreamPublisher(ctx, "provider", config, cli, namespace)
-}
-
-// RabbitMQStreamPublisher is a structure implementing the Publisher interface. Used to publish events
-// to a RabbitMQ stream.
-type rabbitMQStreamPublisher struct {
-	logger              logr.Logger
-	streamName          string
-	environment         *stream.Environment
-	options             *stream.ProducerOptions
-	producer            *ha.ReliableProducer
-	unConfirmedMessages chan message.StreamMessage
-	unConfirmed         *sync.WaitGroup
-	done                chan struct{}
-	shutdown            bool
-}
-
-type Filter struct {
-	Identifier string
-	Type       string
-	Meta       string
-}
-
-// FromString creates a Filter struct from a string in the format "identifier.type.meta".
-// If the string does not have three parts, the missing parts will be set to an empty string.
-func (f Filter) FromString(s string) Filter {
-	parts := make([]string, 3)
-	copy(parts, strings.SplitN(s, ".", 3))
-	return Filter{
-		Identifier: parts[0],
-		Type:       parts[1],
-		Meta:       parts[2],
-	}
-}
-
-// newRabbitMQStreamPublisher creates a new RabbitMQ stream publisher. It connects to the
-// RabbitMQ stream and checks if the stream exists. If it does, it starts the publisher.
-func newRabbitMQStreamPublisher(
+// newStreamEnvironment connects to RabbitMQ streams and checks if the stream exists.
+func newStreamEnvironment(
 	ctx context.Context,
-	name string,
 	config v1alpha1.RabbitMQ,
 	cli client.Client,
 	namespace string,
-) (*rabbitMQStreamPublisher, error) {
-	password, err := config.Password.Get(ctx, cli, namespace)
+) (*stream.Environment, error) {
+	password, err := messageBusPassword(ctx, config, cli, namespace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get RabbitMQ password: %w", err)
 	}
@@ -112,117 +64,132 @@ func newRabbitMQStreamPublisher(
 
 	exists, err := env.StreamExists(config.StreamName)
 	if err != nil {
-		return nil, err
+		return nil, errors.Join(err, env.Close())
 	}
 	if !exists {
-		return nil, errors.New("no stream exists, cannot stream events")
-	}
-	options := stream.NewProducerOptions().
-		SetClientProvidedName(name).
-		SetProducerName(name).
-		SetConfirmationTimeOut(ConfirmationTimeout)
-	publisher := &rabbitMQStreamPublisher{
-		logger:      logr.Discard(),
-		streamName:  config.StreamName,
-		environment: env,
-		options:     options,
-		unConfirmed: &sync.WaitGroup{},
+		return nil, errors.Join(errors.New("no stream exists, cannot stream events"), env.Close())
 	}
-	return publisher, publisher.Start()
+	return env, nil
 }
 
-// Start will start the RabbitMQ stream publisher, non blocking.
-func (s *rabbitMQStreamPublisher) Start() error {
-	s.unConfirmedMessages = make(chan message.StreamMessage)
-	s.options.SetFilter(stream.NewProducerFilter(func(message message.StreamMessage) string {
-		p := message.GetApplicationProperties()
-		return fmt.Sprintf("%s.%s.%s", p["identifier"], p["type"], p["meta"])
-	}))
-	producer, err := ha.NewReliableProducer(
-		s.environment,
-		s.streamName,
-		s.options,
-		func(messageStatus []*stream.ConfirmationStatus) {
-			go func() {
-				for _, msgStatus := range messageStatus {
-					if msgStatus.IsConfirmed() {
-						s.logger.Info("Message confirmed")
-						s.unConfirmed.Done()
-					} else {
-						s.logger.Error(msgStatus.GetError(), "Unconfirmed message")
-						s.unConfirmedMessages <- msgStatus.GetMessage()
-					}
-				}
-			}()
-		})
+// newRabbitMQStreamPublisher creates a new RabbitMQ stream publisher. It connects to the
+// RabbitMQ stream and checks if the stream exists. If it does, it starts the publisher.
+func newRabbitMQStreamPublisher(
+	ctx context.Context,
+	name string,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options PublisherOptions,
+) (Publisher, error) {
+	env, err := newStreamEnvironment(ctx, config, cli, namespace)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	s.producer = producer
-	s.done = make(chan struct{})
-	go s.publish(s.done)
-	return nil
-}
-
-func (s *rabbitMQStreamPublisher) AddLogger(logger logr.Logger) {
-	logger = logger.WithValues("disableUserLog", true)
-	s.logger = logger
+	producerOptions := stream.NewProducerOptions().
+		SetClientProvidedName(name).
+		SetProducerName(name).
+		SetConfirmationTimeOut(ConfirmationTimeout).
+		SetFilter(stream.NewProducerFilter(messageFilter))
+	return newBufferedPublisher(
+		semconv.MessagingSystemRabbitMQ,
+		config.StreamName,
+		options,
+		func(confirm confirmFunc) (producer, error) {
+			return ha.NewReliableProducer(
+				env,
+				config.StreamName,
+				producerOptions,
+				func(messageStatus []*stream.ConfirmationStatus) {
+					go func() {
+						for _, msgStatus := range messageStatus {
+							var err error
+							if !msgStatus.IsConfirmed() {
+								err = errors.Join(errUnconfirmed, msgStatus.GetError())
+							}
+							confirm(msgStatus.GetMessage(), err)
+						}
+					}()
+				})
+		},
+	)
 }
 
-// Publish an event to the RabbitMQ stream.
-func (s *rabbitMQStreamPublisher) Publish(b []byte, filterString string) error {
-	filter := Filter{}.FromString(filterString)
-	if s.shutdown || s.producer == nil {
-		err := errors.New("Publisher closed")
-		s.logger.Error(err, "Publisher is closed")
-		return err
+// newRabbitMQStreamSubscriber creates a new RabbitMQ stream subscriber. Filters without wildcards
+// are applied by RabbitMQ, so that only the chunks of the stream with matching messages are sent to
+// the subscriber.
+func newRabbitMQStreamSubscriber(
+	ctx context.Context,
+	name string,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options SubscriberOptions,
+) (Subscriber, error) {
+	env, err := newStreamEnvironment(ctx, config, cli, namespace)
+	if err != nil {
+		return nil, err
 	}
-	s.unConfirmed.Add(1)
-	msg := amqp.NewMessage(b)
-	if filter.Meta == "" {
-		filter.Meta = "*"
+	var offset stream.OffsetSpecification
+	switch options.Offset.kind {
+	case offsetFirst:
+		offset = offset.First()
+	case offsetAt:
+		offset = offset.Offset(options.Offset.offset)
+	case offsetTime:
+		offset = offset.Timestamp(options.Offset.time.UnixMilli())
+	default:
+		offset = offset.Next()
 	}
-	msg.ApplicationProperties = map[string]any{
-		"identifier": filter.Identifier,
-		"type":       filter.Type,
-		"meta":       filter.Meta,
+	consumerOptions := stream.NewConsumerOptions().
+		SetClientProvidedName(name).
+		SetOffset(offset)
+	postFilter := func(msg *amqp.Message) bool {
+		return options.match(filterFromProperties(msg.ApplicationProperties))
+	}
+	if values := streamFilterValues(options.Filters); len(values) > 0 {
+		consumerOptions.SetFilter(stream.NewConsumerFilter(values, false, postFilter))
 	}
-	s.unConfirmedMessages <- msg
-	s.logger.Info("Message published to unconfirmed channel")
-	return nil
-}
 
-// publish a message from unconfirmed messages to RabbitMQ.
-func (s *rabbitMQStreamPublisher) publish(done chan struct{}) {
-	for {
-		select {
-		case msg := <-s.unConfirmedMessages:
-			s.logger.Info("Publishing message to RabbitMQ stream")
-			if err := s.producer.Send(msg); err != nil {
-				s.logger.Error(err, "Failed to send message")
-				s.unConfirmed.Done()
-				continue
+	subscription := newSubscription(options.BufferSize)
+	consumer, err := env.NewConsumer(
+		config.StreamName,
+		func(consumerContext stream.ConsumerContext, msg *amqp.Message) {
+			if !postFilter(msg) {
+				return
 			}
-			s.logger.Info("Published")
-		case <-done:
-			return
-		}
+			subscription.deliver(newEvent(
+				consumerContext.Consumer.GetOffset(),
+				filterFromProperties(msg.ApplicationProperties),
+				msg.GetData(),
+			))
+		},
+		consumerOptions,
+	)
+	if err != nil {
+		return nil, errors.Join(err, env.Close())
+	}
+	subscription.stop = func() error {
+		return errors.Join(consumer.Close(), env.Close())
 	}
+	closed := consumer.NotifyClose()
+	go func() {
+		if event, ok := <-closed; ok && event.Reason != stream.UnSubscribe {
+			subscription.fail(fmt.Errorf("RabbitMQ stream consumer closed: %s: %w", event.Reason, event.Err))
+		}
+	}()
+	return subscription, nil
 }
 
-// Close the RabbitMQ stream publisher.
-func (s *rabbitMQStreamPublisher) Close() error {
-	if s.producer != nil {
-		s.logger.Info("Stopping publisher")
-		s.shutdown = true
-		s.logger.Info("Wait for unconfirmed messages")
-		s.unConfirmed.Wait()
-		s.done <- struct{}{}
-		s.logger.Info("Done, closing down")
-		if err := s.producer.Close(); err != nil {
-			s.logger.Error(err, "Failed to close rabbitmq publisher")
+// streamFilterValues returns the values of the stream filters, as published by the producers, if
+// none of the filters have wildcards. RabbitMQ only filters on exact values.
+func streamFilterValues(filters []Filter) []string {
+	values := make([]string, 0, len(filters))
+	for _, filter := range filters {
+		if filter.wildcard() {
+			return nil
 		}
-		close(s.unConfirmedMessages)
+		values = append(values, fmt.Sprintf("%s.%s.%s", filter.Identifier, filter.Type, filter.Meta))
 	}
-	return nil
+	return values
 }
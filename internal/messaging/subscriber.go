@@ -0,0 +1,318 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/pkg/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultSubscriberBufferSize is the number of events a Subscriber buffers by default.
+const DefaultSubscriberBufferSize = 100
+
+// Subscriber receives events from the ETOS message bus.
+type Subscriber interface {
+	// Events returns the channel that events are delivered on. The channel is closed when the
+	// Subscriber is closed, or when it fails, then Err returns the error.
+	Events() <-chan Event
+	// Err returns the error that the Subscriber failed with, if any.
+	Err() error
+	// Close stops the Subscriber.
+	Close() error
+}
+
+// Event is a message received from the ETOS message bus.
+type Event struct {
+	// Offset is the position of the event in the message bus. A subscription resumes after the event
+	// with OffsetAt(Offset + 1). Only the stream, nats and file backends have offsets.
+	Offset int64
+	// Filter is the filter that the event was published with.
+	Filter Filter
+	// Type is the type of the event, I.e. "message" for user logs. Empty if the message is not an
+	// ETOS event.
+	Type string
+	// Version is the version of the event schema that the event was published with. Empty if the
+	// message is not an ETOS event or if it was published before the schema was versioned.
+	Version string
+	// Data is the JSON encoded data of the event, or the message if it is not an ETOS event.
+	Data json.RawMessage
+}
+
+// UserLog is the data of an event of the type "message", a log entry that is shown to users.
+type UserLog = events.Message
+
+// UserLog returns the data of an event of the type "message".
+func (e Event) UserLog() (UserLog, error) {
+	var log UserLog
+	if e.Type != string(events.TypeMessage) {
+		return log, fmt.Errorf("event of type %q is not a user log", e.Type)
+	}
+	err := json.Unmarshal(e.Data, &log)
+	return log, err
+}
+
+// Decode decodes the data of the event into the data of its type in the event schema, I.e. a
+// *events.Message for user logs.
+func (e Event) Decode() (events.Data, error) {
+	if e.Type == "" {
+		return nil, errors.New("message is not an ETOS event")
+	}
+	return events.Event{Version: e.Version, Event: events.Type(e.Type), Data: e.Data}.Decode()
+}
+
+// newEvent creates an event from the body of a message.
+func newEvent(offset int64, filter string, body []byte) Event {
+	event := Event{Offset: offset, Filter: Filter{}.FromString(filter), Data: body}
+	var envelope events.Event
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Event != "" {
+		event.Version = envelope.Version
+		event.Type = string(envelope.Event)
+		event.Data = envelope.Data
+	}
+	return event
+}
+
+// Match returns whether a message published with filter matches a subscription filter. Empty parts
+// and "*" in the subscription filter match any value.
+func (f Filter) Match(filter Filter) bool {
+	match := func(want, got string) bool {
+		return want == "" || want == "*" || want == got
+	}
+	return match(f.Identifier, filter.Identifier) && match(f.Type, filter.Type) && match(f.Meta, filter.Meta)
+}
+
+// wildcard returns whether any part of a subscription filter matches any value.
+func (f Filter) wildcard() bool {
+	for _, part := range []string{f.Identifier, f.Type, f.Meta} {
+		if part == "" || part == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+type offsetKind int
+
+const (
+	offsetNext offsetKind = iota
+	offsetFirst
+	offsetAt
+	offsetTime
+)
+
+// OffsetSpecification is the position in the ETOS message bus that a subscription starts from. The
+// zero value starts from the next message published.
+type OffsetSpecification struct {
+	kind   offsetKind
+	offset int64
+	time   time.Time
+}
+
+// OffsetNext starts a subscription from the next message published.
+func OffsetNext() OffsetSpecification {
+	return OffsetSpecification{kind: offsetNext}
+}
+
+// OffsetFirst starts a subscription from the first message in the message bus.
+func OffsetFirst() OffsetSpecification {
+	return OffsetSpecification{kind: offsetFirst}
+}
+
+// OffsetAt starts a subscription from the message at offset.
+func OffsetAt(offset int64) OffsetSpecification {
+	return OffsetSpecification{kind: offsetAt, offset: offset}
+}
+
+// OffsetTime starts a subscription from the first message published at or after t.
+func OffsetTime(t time.Time) OffsetSpecification {
+	return OffsetSpecification{kind: offsetTime, time: t}
+}
+
+// SubscriberOptions configures a Subscriber.
+type SubscriberOptions struct {
+	// Name is the name of the subscriber, shown in the connections of the message bus.
+	Name string
+	// Filters selects the messages to receive, all messages are received if empty.
+	Filters []Filter
+	// Offset is where in the message bus to start receiving messages.
+	Offset OffsetSpecification
+	// BufferSize is the number of events that are buffered before the Subscriber stops receiving
+	// messages from the message bus. Defaults to DefaultSubscriberBufferSize.
+	BufferSize int
+}
+
+// match returns whether a message published with filter matches any of the filters of the options.
+func (o SubscriberOptions) match(filter string) bool {
+	if len(o.Filters) == 0 {
+		return true
+	}
+	published := Filter{}.FromString(filter)
+	for _, f := range o.Filters {
+		if f.Match(published) {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscriberBackend creates a Subscriber to a message bus, named name, from the message bus
+// configuration of an EnvironmentRequest or a Cluster in namespace.
+type SubscriberBackend func(
+	ctx context.Context,
+	name string,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options SubscriberOptions,
+) (Subscriber, error)
+
+// subscriberBackends are the message bus backends that NewSubscriber selects from, guarded by
+// backendsMutex.
+var subscriberBackends = map[v1alpha1.MessageBusBackend]SubscriberBackend{
+	v1alpha1.MessageBusBackendStream: newRabbitMQStreamSubscriber,
+	v1alpha1.MessageBusBackendAMQP:   newAMQPSubscriber,
+	v1alpha1.MessageBusBackendNATS:   newNATSSubscriber,
+	v1alpha1.MessageBusBackendFile:   newFileSubscriber,
+}
+
+// RegisterSubscriberBackend registers a message bus backend for subscribers, replacing any backend
+// already registered with the same name.
+func RegisterSubscriberBackend(name v1alpha1.MessageBusBackend, backend SubscriberBackend) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	subscriberBackends[name] = backend
+}
+
+// NewSubscriber creates a new Subscriber to the backend of the message bus configuration. The
+// backend defaults to a RabbitMQ stream.
+func NewSubscriber(
+	ctx context.Context,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options SubscriberOptions,
+) (Subscriber, error) {
+	name := config.Backend
+	if name == "" {
+		name = v1alpha1.MessageBusBackendStream
+	}
+	backendsMutex.RLock()
+	backend, ok := subscriberBackends[name]
+	backendsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown message bus backend %q", name)
+	}
+	if options.Name == "" {
+		options.Name = "subscriber"
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = DefaultSubscriberBufferSize
+	}
+	return backend(ctx, options.Name, config, cli, namespace, options)
+}
+
+// subscription delivers the events of a Subscriber. The backends embed it and stop receiving
+// messages from the message bus with stop.
+type subscription struct {
+	events chan Event
+	done   chan struct{}
+	stop   func() error
+	once   sync.Once
+	mutex  sync.Mutex
+	err    error
+	// closing guards events, so that it is not closed while an event is being delivered.
+	closing sync.RWMutex
+	closed  bool
+}
+
+// newSubscription creates a subscription which buffers bufferSize events.
+func newSubscription(bufferSize int) *subscription {
+	return &subscription{
+		events: make(chan Event, bufferSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// Events returns the channel that events are delivered on.
+func (s *subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err returns the error that the subscription failed with, if any.
+func (s *subscription) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+// deliver an event, blocking until there is room in the buffer. Returns false if the subscription
+// has been closed.
+func (s *subscription) deliver(event Event) bool {
+	s.closing.RLock()
+	defer s.closing.RUnlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.events <- event:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// fail closes the subscription with an error, unless it has already been closed.
+func (s *subscription) fail(err error) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	s.mutex.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mutex.Unlock()
+	_ = s.Close()
+}
+
+// Close stops receiving messages and closes the events channel.
+func (s *subscription) Close() error {
+	var err error
+	s.once.Do(func() {
+		// Events that are being delivered return once done is closed.
+		close(s.done)
+		if s.stop != nil {
+			err = s.stop()
+		}
+		s.closing.Lock()
+		defer s.closing.Unlock()
+		s.closed = true
+		close(s.events)
+	})
+	return err
+}
+
+// errOffsetNotSupported is returned by backends that cannot start subscriptions from an offset.
+var errOffsetNotSupported = errors.New("the message bus backend only supports subscribing to the next message")
@@ -0,0 +1,74 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Filter", func() {
+	DescribeTable("Match",
+		func(filter Filter, published string, match bool) {
+			Expect(filter.Match(Filter{}.FromString(published))).To(Equal(match))
+		},
+		Entry("exact", Filter{Identifier: "id", Type: "message", Meta: "info"}, "id.message.info", true),
+		Entry("other meta", Filter{Identifier: "id", Type: "message", Meta: "info"}, "id.message.debug", false),
+		Entry("wildcard meta", Filter{Identifier: "id", Type: "message", Meta: "*"}, "id.message.debug", true),
+		Entry("empty parts", Filter{Identifier: "id"}, "id.message.info", true),
+		Entry("other identifier", Filter{Identifier: "id"}, "other.message.info", false),
+	)
+})
+
+var _ = Describe("newEvent", func() {
+	It("should unwrap ETOS events", func() {
+		event := newEvent(3, "id.message.info", []byte(`{"event":"message","data":{"message":"hello"}}`))
+		Expect(event.Offset).To(BeEquivalentTo(3))
+		Expect(event.Type).To(Equal("message"))
+		Expect(event.Data).To(MatchJSON(`{"message":"hello"}`))
+	})
+
+	It("should keep messages that are not ETOS events", func() {
+		event := newEvent(0, "id.other.*", []byte("not an event"))
+		Expect(event.Type).To(BeEmpty())
+		Expect(string(event.Data)).To(Equal("not an event"))
+		_, err := event.UserLog()
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("server-side filters", func() {
+	filters := []Filter{
+		{Identifier: "id", Type: "message", Meta: "info"},
+		{Identifier: "id", Type: "message"},
+	}
+
+	It("should only filter RabbitMQ streams on exact values", func() {
+		Expect(streamFilterValues(filters[:1])).To(Equal([]string{"id.message.info"}))
+		Expect(streamFilterValues(filters)).To(BeEmpty())
+	})
+
+	It("should bind AMQP queues with wildcards", func() {
+		Expect(amqpBindingKey(filters[0])).To(Equal("id.message.info"))
+		Expect(amqpBindingKey(filters[1])).To(Equal("id.message.#"))
+		Expect(amqpBindingKey(Filter{Meta: "info"})).To(Equal("*.*.info"))
+	})
+
+	It("should filter NATS subjects with wildcards", func() {
+		Expect(natsFilterSubjects("etos", filters)).To(Equal([]string{"etos.id.message.info", "etos.id.message.>"}))
+		Expect(natsFilterSubjects("etos", nil)).To(Equal([]string{"etos.>"}))
+	})
+})
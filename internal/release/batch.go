@@ -0,0 +1,49 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package release
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// BatchReleaser returns a job specification that releases several resources of the same provider
+// in one pod, instead of running one job for each resource.
+//
+// The containerName must be the releaser name of the kind of resource, I.e. IutReleaserName, so
+// that the controllers of the resources can read the result of the job.
+//
+// Only providers that declare BatchRelease release every name they are given, other providers
+// release only one of them and must get a job for each resource.
+func BatchReleaser(jobName, containerName string, names []string, namespace string, environmentrequest *v1alpha1.EnvironmentRequest, provider *v1alpha1.Provider) (*batchv1.Job, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no resources to release")
+	}
+	if len(names) > 1 && !provider.Spec.BatchRelease {
+		return nil, fmt.Errorf("provider %s does not support batch release", provider.Name)
+	}
+	container, err := ReleaseContainer(names[0], containerName, namespace, provider, environmentrequest, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names[1:] {
+		container.Args = append(container.Args, fmt.Sprintf("-name=%s", name))
+	}
+	return ReleaseJob(jobName, containerName, namespace, environmentrequest, provider, container), nil
+}
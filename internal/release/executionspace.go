@@ -35,6 +35,7 @@ func ExecutionSpaceReleaser(executionSpace *v1alpha2.ExecutionSpace, environment
 		ExecutionSpaceReleaserName,
 		executionSpace.Namespace,
 		environmentrequest,
+		provider,
 		container,
 	), nil
 }
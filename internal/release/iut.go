@@ -35,6 +35,7 @@ func IutReleaser(iut *v1alpha2.Iut, environmentrequest *v1alpha1.EnvironmentRequ
 		IutReleaserName,
 		iut.Namespace,
 		environmentrequest,
+		provider,
 		container,
 	), nil
 }
@@ -35,6 +35,7 @@ func LogAreaReleaser(logArea *v1alpha2.LogArea, environmentrequest *v1alpha1.Env
 		LogAreaReleaserName,
 		logArea.Namespace,
 		environmentrequest,
+		provider,
 		container,
 	), nil
 }
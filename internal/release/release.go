@@ -17,6 +17,7 @@ package release
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/eiffel-community/etos/api/v1alpha1"
 	batchv1 "k8s.io/api/batch/v1"
@@ -26,7 +27,9 @@ import (
 )
 
 // ReleaseJob returns a batchv1.Job schema populated with containers provided.
-func ReleaseJob(jobName, name, namespace string, environmentrequest *v1alpha1.EnvironmentRequest, containers ...corev1.Container) *batchv1.Job {
+//
+// The pod of the job is scheduled according to the provider, I.e. on the nodes of its node selector.
+func ReleaseJob(jobName, name, namespace string, environmentrequest *v1alpha1.EnvironmentRequest, provider *v1alpha1.Provider, containers ...corev1.Container) *batchv1.Job {
 	ttl := int32(300)
 	grace := int64(30)
 	backoff := int32(0)
@@ -43,7 +46,7 @@ func ReleaseJob(jobName, name, namespace string, environmentrequest *v1alpha1.En
 		labels["etos.eiffel-community.github.io/id"] = environmentrequest.Spec.Identifier
 	}
 
-	return &batchv1.Job{
+	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels:      labels,
 			Annotations: make(map[string]string),
@@ -67,6 +70,10 @@ func ReleaseJob(jobName, name, namespace string, environmentrequest *v1alpha1.En
 			},
 		},
 	}
+	if provider != nil {
+		provider.Spec.ApplyToPod(&job.Spec.Template.Spec)
+	}
+	return job
 }
 
 // ReleaseContainer returns a container specification.
@@ -86,13 +93,12 @@ func ReleaseContainer(name, containerName, namespace string, provider *v1alpha1.
 	if noDelete {
 		args = append(args, "-nodelete")
 	}
-	return corev1.Container{
+	container := corev1.Container{
 		Name:            containerName,
 		Image:           provider.Spec.Image,
 		ImagePullPolicy: corev1.PullIfNotPresent,
-		Env:             provider.Spec.Env,
+		Env:             append(slices.Clone(provider.Spec.Env), environmentrequest.Spec.LogEnvironment()...),
 		EnvFrom:         provider.Spec.EnvFrom,
-		// TODO: Verify these resourceclaims
 		Resources: corev1.ResourceRequirements{
 			Limits: corev1.ResourceList{
 				corev1.ResourceMemory: resource.MustParse("256Mi"),
@@ -104,5 +110,7 @@ func ReleaseContainer(name, containerName, namespace string, provider *v1alpha1.
 			},
 		},
 		Args: args,
-	}, nil
+	}
+	provider.Spec.ApplyToContainer(&container)
+	return container, nil
 }
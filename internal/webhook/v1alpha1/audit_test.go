@@ -0,0 +1,159 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/audit"
+)
+
+// auditStore is an audit store that fails to append records if err is set.
+type auditStore struct {
+	records []audit.Record
+	err     error
+}
+
+// Append appends a record, or returns the error of the store.
+func (s *auditStore) Append(_ context.Context, _ string, record audit.Record) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, record)
+	return nil
+}
+
+// List lists the records of the store.
+func (s *auditStore) List(_ context.Context, _, _ string) ([]audit.Record, error) {
+	return s.records, nil
+}
+
+// admissionRequest returns a context with an admission request for an operation on a resource of a
+// kind.
+func admissionRequest(operation admissionv1.Operation, kind string) context.Context {
+	return admission.NewContextWithRequest(ctx, admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       "1",
+			Kind:      metav1.GroupVersionKind{Group: "etos.eiffel-community.github.io", Version: "v1alpha1", Kind: kind},
+			Operation: operation,
+			UserInfo:  authenticationv1.UserInfo{Username: "jane"},
+		},
+	})
+}
+
+var _ = Describe("Audit", func() {
+	var (
+		store    *auditStore
+		recorder *audit.Recorder
+		testrun  *etosv1alpha1.TestRun
+	)
+
+	BeforeEach(func() {
+		store = &auditStore{err: errors.New("configmaps is forbidden")}
+		recorder = audit.NewRecorder(store)
+		image := &etosv1alpha1.Image{Image: "registry.example.com/etos:latest"}
+		testrun = &etosv1alpha1.TestRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "testrun",
+				Namespace: "default",
+				Labels:    map[string]string{"etos.eiffel-community.github.io/id": "fbb4096d-6529-4c39-bac3-08a7e45bf69a"},
+			},
+			Spec: etosv1alpha1.TestRunSpec{
+				Cluster:             "etos",
+				SuiteRunner:         &etosv1alpha1.SuiteRunner{Image: image},
+				LogListener:         &etosv1alpha1.LogListener{Image: image},
+				EnvironmentProvider: &etosv1alpha1.EnvironmentProvider{Image: image},
+				TestRunner:          &etosv1alpha1.TestRunner{Version: "latest"},
+			},
+		}
+	})
+
+	It("should deny launching a TestRun that cannot be recorded", func() {
+		validator := &TestRunCustomValidator{recorder}
+		_, err := validator.ValidateCreate(admissionRequest(admissionv1.Create, "TestRun"), testrun)
+		Expect(err).To(MatchError(ContainSubstring("configmaps is forbidden")))
+	})
+
+	It("should deny aborting a TestRun that cannot be recorded", func() {
+		validator := &TestRunCustomValidator{recorder}
+		_, err := validator.ValidateDelete(admissionRequest(admissionv1.Delete, "TestRun"), testrun)
+		Expect(err).To(MatchError(ContainSubstring("configmaps is forbidden")))
+	})
+
+	It("should allow updating a TestRun that cannot be recorded", func() {
+		validator := &TestRunCustomValidator{recorder}
+		updated := testrun.DeepCopy()
+		updated.Labels["team"] = "a"
+		warnings, err := validator.ValidateUpdate(admissionRequest(admissionv1.Update, "TestRun"), testrun, updated)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf(ContainSubstring("configmaps is forbidden")))
+	})
+
+	It("should allow deleting a finished TestRun that cannot be recorded", func() {
+		testrun.Status.CompletionTime = &metav1.Time{Time: metav1.Now().Time}
+		validator := &TestRunCustomValidator{recorder}
+		warnings, err := validator.ValidateDelete(admissionRequest(admissionv1.Delete, "TestRun"), testrun)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf(ContainSubstring("configmaps is forbidden")))
+	})
+
+	It("should allow the release of an Environment that cannot be recorded", func() {
+		validator := &EnvironmentCustomValidator{recorder}
+		warnings, err := validator.ValidateDelete(
+			admissionRequest(admissionv1.Delete, "Environment"),
+			&etosv1alpha1.Environment{ObjectMeta: testrun.ObjectMeta},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(HaveLen(1))
+	})
+
+	It("should allow changing a Provider that cannot be recorded", func() {
+		validator := &ProviderCustomValidator{recorder}
+		provider := &etosv1alpha1.Provider{
+			ObjectMeta: metav1.ObjectMeta{Name: "provider", Namespace: "default"},
+			Spec: etosv1alpha1.ProviderSpec{
+				Type:        "iut",
+				Host:        "http://iut-provider",
+				Healthcheck: &etosv1alpha1.Healthcheck{},
+			},
+		}
+		warnings, err := validator.ValidateCreate(admissionRequest(admissionv1.Create, "Provider"), provider)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(HaveLen(1))
+		warnings, err = validator.ValidateDelete(admissionRequest(admissionv1.Delete, "Provider"), provider)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(HaveLen(1))
+	})
+
+	It("should record the operations when the audit trail works", func() {
+		store.err = nil
+		Expect((&TestRunCustomValidator{recorder}).ValidateDelete(admissionRequest(admissionv1.Delete, "TestRun"), testrun)).To(BeEmpty())
+		Expect((&EnvironmentCustomValidator{recorder}).ValidateDelete(
+			admissionRequest(admissionv1.Delete, "Environment"),
+			&etosv1alpha1.Environment{ObjectMeta: testrun.ObjectMeta},
+		)).To(BeEmpty())
+		Expect(store.records).To(HaveLen(2))
+	})
+})
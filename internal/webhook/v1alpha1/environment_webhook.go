@@ -0,0 +1,66 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package v1alpha1
+
+import (
+	"context"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/audit"
+)
+
+// nolint:unused
+// environmentlog is for logging in this package.
+var environmentlog = logf.Log.WithName("environment-resource")
+
+// SetupEnvironmentWebhookWithManager registers the webhook for Environment in the manager. The release of
+// Environments is recorded by recorder.
+func SetupEnvironmentWebhookWithManager(mgr ctrl.Manager, recorder *audit.Recorder) error {
+	return ctrl.NewWebhookManagedBy(mgr, &etosv1alpha1.Environment{}).
+		WithValidator(&EnvironmentCustomValidator{recorder}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-etos-eiffel-community-github-io-v1alpha1-environment,mutating=false,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=etos.eiffel-community.github.io,resources=environments,verbs=delete,versions=v1alpha1,name=venvironment-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// EnvironmentCustomValidator struct is responsible for recording the release of an Environment, I.e. when it is
+// deleted, in the audit trail.
+//
+// NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
+// as this struct is used only for temporary operations and does not need to be deeply copied.
+type EnvironmentCustomValidator struct {
+	recorder *audit.Recorder
+}
+
+// ValidateCreate validates the creation of an Environment.
+func (d *EnvironmentCustomValidator) ValidateCreate(_ context.Context, _ *etosv1alpha1.Environment) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateUpdate validates the updates of an Environment.
+func (d *EnvironmentCustomValidator) ValidateUpdate(_ context.Context, _, _ *etosv1alpha1.Environment) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateDelete validates the deletion of an Environment and records it in the audit trail.
+func (d *EnvironmentCustomValidator) ValidateDelete(ctx context.Context, environment *etosv1alpha1.Environment) (admission.Warnings, error) {
+	environmentlog.Info("Validation for Environment upon deletion", "name", environment.GetName())
+	return d.recorder.RecordOrWarn(ctx, environment, nil), nil
+}
@@ -26,6 +26,8 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -34,6 +36,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/audit"
 )
 
 // nolint:unused
@@ -43,13 +46,14 @@ var (
 	cli         client.Client
 )
 
-// SetupProviderWebhookWithManager registers the webhook for Provider in the manager.
-func SetupProviderWebhookWithManager(mgr ctrl.Manager) error {
+// SetupProviderWebhookWithManager registers the webhook for Provider in the manager. The creation, changes
+// and deletion of Providers are recorded by recorder.
+func SetupProviderWebhookWithManager(mgr ctrl.Manager, recorder *audit.Recorder) error {
 	if cli == nil {
 		cli = mgr.GetClient()
 	}
 	return ctrl.NewWebhookManagedBy(mgr, &etosv1alpha1.Provider{}).
-		WithValidator(&ProviderCustomValidator{}).
+		WithValidator(&ProviderCustomValidator{recorder}).
 		WithDefaulter(&ProviderCustomDefaulter{}).
 		Complete()
 }
@@ -163,6 +167,33 @@ func (d *ProviderCustomValidator) validate(provider *etosv1alpha1.Provider) erro
 			provider.Spec.JSONTasSource,
 			"only one of jsonTas and jsonTasSource is allowed"))
 	}
+	if provider.Spec.API != "" && provider.Spec.Host == "" {
+		allErrs = append(allErrs, field.Invalid(
+			field.NewPath("spec").Child("host"),
+			provider.Spec.Host,
+			"host must be set when api is"))
+	}
+	if provider.Spec.API != "" && provider.Spec.Token == nil {
+		allErrs = append(allErrs, field.Required(
+			field.NewPath("spec").Child("token"),
+			"token must be set when api is"))
+	}
+	if healthcheck := provider.Spec.Healthcheck; healthcheck != nil {
+		if healthcheck.Protocol == "exec" && provider.Spec.Image == "" {
+			allErrs = append(allErrs, field.Invalid(
+				field.NewPath("spec").Child("image"),
+				provider.Spec.Image,
+				"image must be set when the healthCheck protocol is exec"))
+		}
+		if healthcheck.TLS != nil && healthcheck.TLS.ClientCertificate != nil && healthcheck.TLS.ClientKey == nil {
+			allErrs = append(allErrs, field.Invalid(
+				field.NewPath("spec").Child("healthCheck").Child("tls").Child("clientKey"),
+				healthcheck.TLS.ClientKey,
+				"clientKey must be set when clientCertificate is"))
+		}
+	}
+	allErrs = append(allErrs, validateJobSettings(provider.Spec.JobSettings, field.NewPath("spec"))...)
+	allErrs = append(allErrs, validateVolumes(provider.Spec, field.NewPath("spec"))...)
 	if provider.Spec.JSONTas == nil && provider.Spec.JSONTasSource == nil {
 		if provider.Spec.Host == "" {
 			allErrs = append(allErrs, field.Invalid(
@@ -187,29 +218,125 @@ func (d *ProviderCustomValidator) validate(provider *etosv1alpha1.Provider) erro
 	return nil
 }
 
-// +kubebuilder:webhook:path=/validate-etos-eiffel-community-github-io-v1alpha1-provider,mutating=false,failurePolicy=fail,sideEffects=None,groups=etos.eiffel-community.github.io,resources=providers,verbs=create;update,versions=v1alpha1,name=vprovider-v1alpha1.kb.io,admissionReviewVersions=v1
+// validateJobSettings validates the settings of the jobs that run the image of a provider or of the
+// environment provider.
+//
+// Only the mistakes that would otherwise surface as failing jobs much later are caught here, the rest
+// is validated by Kubernetes when the jobs are created.
+func validateJobSettings(spec etosv1alpha1.JobSettings, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if spec.Resources != nil {
+		for name, request := range spec.Resources.Requests {
+			limit, ok := spec.Resources.Limits[name]
+			if ok && request.Cmp(limit) > 0 {
+				allErrs = append(allErrs, field.Invalid(
+					path.Child("resources").Child("requests").Key(string(name)),
+					request.String(),
+					fmt.Sprintf("must be less than or equal to the %s limit of %s", name, limit.String())))
+			}
+		}
+	}
+	for i, secret := range spec.ImagePullSecrets {
+		if secret.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("imagePullSecrets").Index(i).Child("name"), ""))
+		}
+	}
+	for key, value := range spec.NodeSelector {
+		for _, msg := range validation.IsQualifiedName(key) {
+			allErrs = append(allErrs, field.Invalid(path.Child("nodeSelector"), key, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(value) {
+			allErrs = append(allErrs, field.Invalid(path.Child("nodeSelector").Key(key), value, msg))
+		}
+	}
+	for i, toleration := range spec.Tolerations {
+		tolerationPath := path.Child("tolerations").Index(i)
+		switch toleration.Operator {
+		case corev1.TolerationOpExists:
+			if toleration.Value != "" {
+				allErrs = append(allErrs, field.Invalid(tolerationPath.Child("value"), toleration.Value,
+					"value must be empty when operator is Exists"))
+			}
+		case corev1.TolerationOpEqual, "":
+			if toleration.Key == "" {
+				allErrs = append(allErrs, field.Invalid(tolerationPath.Child("operator"), toleration.Operator,
+					"operator must be Exists when key is empty"))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(tolerationPath.Child("operator"), toleration.Operator,
+				[]corev1.TolerationOperator{corev1.TolerationOpExists, corev1.TolerationOpEqual}))
+		}
+		switch toleration.Effect {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute, "":
+		default:
+			allErrs = append(allErrs, field.NotSupported(tolerationPath.Child("effect"), toleration.Effect,
+				[]corev1.TaintEffect{corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute}))
+		}
+		if toleration.TolerationSeconds != nil && toleration.Effect != corev1.TaintEffectNoExecute {
+			allErrs = append(allErrs, field.Invalid(tolerationPath.Child("effect"), toleration.Effect,
+				"effect must be NoExecute when tolerationSeconds is set"))
+		}
+	}
+	return allErrs
+}
+
+// validateVolumes validates that the volume mounts of a provider refer to its volumes.
+func validateVolumes(spec etosv1alpha1.ProviderSpec, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	volumes := sets.New[string]()
+	for i, volume := range spec.Volumes {
+		volumePath := path.Child("volumes").Index(i).Child("name")
+		for _, msg := range validation.IsDNS1123Label(volume.Name) {
+			allErrs = append(allErrs, field.Invalid(volumePath, volume.Name, msg))
+		}
+		if volumes.Has(volume.Name) {
+			allErrs = append(allErrs, field.Duplicate(volumePath, volume.Name))
+		}
+		volumes.Insert(volume.Name)
+	}
+	for i, mount := range spec.VolumeMounts {
+		mountPath := path.Child("volumeMounts").Index(i)
+		if !volumes.Has(mount.Name) {
+			allErrs = append(allErrs, field.NotFound(mountPath.Child("name"), mount.Name))
+		}
+		if mount.MountPath == "" {
+			allErrs = append(allErrs, field.Required(mountPath.Child("mountPath"), ""))
+		}
+	}
+	return allErrs
+}
+
+// +kubebuilder:webhook:path=/validate-etos-eiffel-community-github-io-v1alpha1-provider,mutating=false,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=etos.eiffel-community.github.io,resources=providers,verbs=create;update;delete,versions=v1alpha1,name=vprovider-v1alpha1.kb.io,admissionReviewVersions=v1
 
 // ProviderCustomValidator struct is responsible for validating the Provider resource
-// when it is created, updated, or deleted.
+// when it is created, updated, or deleted. Valid operations are recorded in the audit trail.
 //
 // NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
 // as this struct is used only for temporary operations and does not need to be deeply copied.
-type ProviderCustomValidator struct{}
+type ProviderCustomValidator struct {
+	recorder *audit.Recorder
+}
 
 // ValidateCreate validates the creation of a Provider.
-func (d *ProviderCustomValidator) ValidateCreate(_ context.Context, provider *etosv1alpha1.Provider) (admission.Warnings, error) {
+func (d *ProviderCustomValidator) ValidateCreate(ctx context.Context, provider *etosv1alpha1.Provider) (admission.Warnings, error) {
 	providerlog.Info("Validation for Provider upon creation", "name", provider.GetName())
-	return nil, d.validate(provider)
+	if err := d.validate(provider); err != nil {
+		return nil, err
+	}
+	return d.recorder.RecordOrWarn(ctx, provider, nil), nil
 }
 
 // ValidateUpdate validates the updates of a Provider.
-func (d *ProviderCustomValidator) ValidateUpdate(_ context.Context, _, provider *etosv1alpha1.Provider) (admission.Warnings, error) {
+func (d *ProviderCustomValidator) ValidateUpdate(ctx context.Context, old, provider *etosv1alpha1.Provider) (admission.Warnings, error) {
 	providerlog.Info("Validation for Provider upon update", "name", provider.GetName())
-	return nil, d.validate(provider)
+	if err := d.validate(provider); err != nil {
+		return nil, err
+	}
+	return d.recorder.RecordOrWarn(ctx, provider, old), nil
 }
 
 // ValidateDelete validates the deletion of a Provider.
-func (d *ProviderCustomValidator) ValidateDelete(_ context.Context, provider *etosv1alpha1.Provider) (admission.Warnings, error) {
+func (d *ProviderCustomValidator) ValidateDelete(ctx context.Context, provider *etosv1alpha1.Provider) (admission.Warnings, error) {
 	providerlog.Info("Validation for Provider upon deletion", "name", provider.GetName())
-	return nil, nil
+	return d.recorder.RecordOrWarn(ctx, provider, nil), nil
 }
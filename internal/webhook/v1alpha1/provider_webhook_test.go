@@ -19,9 +19,11 @@ package v1alpha1
 import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
-	// TODO (user): Add any additional imports if needed
 )
 
 var _ = Describe("Provider Webhook", func() {
@@ -61,26 +63,110 @@ var _ = Describe("Provider Webhook", func() {
 	})
 
 	Context("When creating or updating Provider under Validating Webhook", func() {
-		// TODO (user): Add logic for validating webhooks
-		// Example:
-		// It("Should deny creation if a required field is missing", func() {
-		//     By("simulating an invalid creation scenario")
-		//     obj.SomeRequiredField = ""
-		//     Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
-		// })
-		//
-		// It("Should admit creation if all required fields are present", func() {
-		//     By("simulating an invalid creation scenario")
-		//     obj.SomeRequiredField = "valid_value"
-		//     Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
-		// })
-		//
-		// It("Should validate updates correctly", func() {
-		//     By("simulating a valid update scenario")
-		//     oldObj.SomeRequiredField = "updated_value"
-		//     obj.SomeRequiredField = "updated_value"
-		//     Expect(validator.ValidateUpdate(ctx, oldObj, obj)).To(BeNil())
-		// })
+		BeforeEach(func() {
+			obj.Spec = etosv1alpha1.ProviderSpec{
+				Type:        "iut",
+				Host:        "http://iut-provider",
+				Healthcheck: &etosv1alpha1.Healthcheck{},
+				Image:       "registry.example.com/iut-provider:latest",
+			}
+		})
+
+		It("Should admit a provider with valid job settings", func() {
+			obj.Spec.Resources = &corev1.ResourceRequirements{
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+			}
+			obj.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
+			obj.Spec.NodeSelector = map[string]string{"kubernetes.io/arch": "amd64"}
+			obj.Spec.Tolerations = []corev1.Toleration{
+				{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "etos", Effect: corev1.TaintEffectNoSchedule},
+				{Operator: corev1.TolerationOpExists},
+			}
+			obj.Spec.Volumes = []corev1.Volume{{Name: "certificates"}}
+			obj.Spec.VolumeMounts = []corev1.VolumeMount{{Name: "certificates", MountPath: "/etc/ssl/certs"}}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+			oldObj.Spec = *obj.Spec.DeepCopy()
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny a provider with a volume mount of a missing volume", func() {
+			obj.Spec.VolumeMounts = []corev1.VolumeMount{{Name: "certificates", MountPath: "/etc/ssl/certs"}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.volumeMounts[0].name")))
+		})
+
+		It("Should deny a provider with invalid job settings", func() {
+			obj.Spec.NodeSelector = map[string]string{"kubernetes.io/arch": "not a label value"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.nodeSelector[kubernetes.io/arch]")))
+		})
+
+		It("Should only admit a remote provider with a token", func() {
+			obj.Spec.API = "v1"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.token")))
+			obj.Spec.Token = &etosv1alpha1.Var{Value: "token"}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
 	})
 
+	DescribeTable("Validating job settings",
+		func(settings etosv1alpha1.JobSettings, paths ...string) {
+			errs := validateJobSettings(settings, field.NewPath("spec"))
+			fields := make([]string, 0, len(errs))
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			Expect(fields).To(ConsistOf(paths))
+		},
+		Entry("with no settings", etosv1alpha1.JobSettings{}),
+		Entry("with requests above the limits", etosv1alpha1.JobSettings{
+			Resources: &corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("250m"),
+					corev1.ResourceMemory: resource.MustParse("256Mi"),
+				},
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("500m"),
+					corev1.ResourceMemory: resource.MustParse("128Mi"),
+				},
+			},
+		}, "spec.resources.requests[cpu]"),
+		Entry("with requests without limits", etosv1alpha1.JobSettings{
+			Resources: &corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+			},
+		}),
+		Entry("with an image pull secret without a name", etosv1alpha1.JobSettings{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}, {}},
+		}, "spec.imagePullSecrets[1].name"),
+		Entry("with an invalid node selector key", etosv1alpha1.JobSettings{
+			NodeSelector: map[string]string{"-arch": "amd64"},
+		}, "spec.nodeSelector"),
+		Entry("with an invalid node selector value", etosv1alpha1.JobSettings{
+			NodeSelector: map[string]string{"arch": "amd64 "},
+		}, "spec.nodeSelector[arch]"),
+		Entry("with a value for the Exists operator", etosv1alpha1.JobSettings{
+			Tolerations: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists, Value: "etos"}},
+		}, "spec.tolerations[0].value"),
+		Entry("with the Equal operator without a key", etosv1alpha1.JobSettings{
+			Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpEqual, Value: "etos"}},
+		}, "spec.tolerations[0].operator"),
+		Entry("with an unknown operator", etosv1alpha1.JobSettings{
+			Tolerations: []corev1.Toleration{{Key: "dedicated", Operator: "Matches"}},
+		}, "spec.tolerations[0].operator"),
+		Entry("with an unknown effect", etosv1alpha1.JobSettings{
+			Tolerations: []corev1.Toleration{{Key: "dedicated", Value: "etos", Effect: "NoRun"}},
+		}, "spec.tolerations[0].effect"),
+		Entry("with tolerationSeconds without the NoExecute effect", etosv1alpha1.JobSettings{
+			Tolerations: []corev1.Toleration{{
+				Key:               "dedicated",
+				Operator:          corev1.TolerationOpExists,
+				Effect:            corev1.TaintEffectNoSchedule,
+				TolerationSeconds: new(int64),
+			}},
+		}, "spec.tolerations[0].effect"),
+	)
+
 })
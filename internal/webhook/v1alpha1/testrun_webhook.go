@@ -30,6 +30,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/audit"
 	"github.com/eiffel-community/etos/internal/config"
 )
 
@@ -37,13 +38,14 @@ import (
 // log is for logging in this package.
 var testrunlog = logf.Log.WithName("testrun-resource")
 
-// SetupTestRunWebhookWithManager registers the webhook for TestRun in the manager.
-func SetupTestRunWebhookWithManager(mgr ctrl.Manager, cfg config.Config) error {
+// SetupTestRunWebhookWithManager registers the webhook for TestRun in the manager. The creation, changes
+// and deletion of TestRuns are recorded by recorder.
+func SetupTestRunWebhookWithManager(mgr ctrl.Manager, cfg config.Config, recorder *audit.Recorder) error {
 	if cli == nil {
 		cli = mgr.GetClient()
 	}
 	return ctrl.NewWebhookManagedBy(mgr, &etosv1alpha1.TestRun{}).
-		WithValidator(&TestRunCustomValidator{}).
+		WithValidator(&TestRunCustomValidator{recorder}).
 		WithDefaulter(&TestRunCustomDefaulter{cfg}).
 		Complete()
 }
@@ -119,13 +121,16 @@ func (d *TestRunCustomDefaulter) Default(ctx context.Context, testrun *etosv1alp
 		testrunlog.Info("Loading log listener image from cluster", "logListener", image)
 		testrun.Spec.LogListener = &etosv1alpha1.LogListener{Image: &image}
 	}
-	if testrun.Spec.EnvironmentProvider == nil && cluster != nil {
+	if (testrun.Spec.EnvironmentProvider == nil || testrun.Spec.EnvironmentProvider.Image == nil) && cluster != nil {
 		image := etosv1alpha1.Image{
 			Image:           config.ImageOrDefault(d.cfg.EnvironmentProvider, cluster.Spec.ETOS.EnvironmentProvider.Image),
 			ImagePullPolicy: config.PullPolicyOrDefault(d.cfg.EnvironmentProvider, cluster.Spec.ETOS.EnvironmentProvider.Image),
 		}
 		testrunlog.Info("Loading environment provider image from cluster", "environmentProvider", image)
-		testrun.Spec.EnvironmentProvider = &etosv1alpha1.EnvironmentProvider{Image: &image}
+		if testrun.Spec.EnvironmentProvider == nil {
+			testrun.Spec.EnvironmentProvider = &etosv1alpha1.EnvironmentProvider{}
+		}
+		testrun.Spec.EnvironmentProvider.Image = &image
 	}
 	if testrun.Spec.TestRunner == nil && cluster != nil {
 		testRunnerVersion := config.VersionOrDefault(d.cfg.TestRunner, cluster.Spec.ETOS.TestRunner.Version)
@@ -152,14 +157,17 @@ func (d *TestRunCustomDefaulter) Default(ctx context.Context, testrun *etosv1alp
 	return nil
 }
 
-// +kubebuilder:webhook:path=/validate-etos-eiffel-community-github-io-v1alpha1-testrun,mutating=false,failurePolicy=fail,sideEffects=None,groups=etos.eiffel-community.github.io,resources=testruns,verbs=create;update,versions=v1alpha1,name=vtestrun-v1alpha1.kb.io,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-etos-eiffel-community-github-io-v1alpha1-testrun,mutating=false,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=etos.eiffel-community.github.io,resources=testruns,verbs=create;update;delete,versions=v1alpha1,name=vtestrun-v1alpha1.kb.io,admissionReviewVersions=v1
 
 // TestRunCustomValidator struct is responsible for validating the TestRun resource
-// when it is created, updated, or deleted.
+// when it is created, updated, or deleted. Valid operations are recorded in the audit trail, so that
+// it can be shown who launched and who aborted a TestRun.
 //
 // NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
 // as this struct is used only for temporary operations and does not need to be deeply copied.
-type TestRunCustomValidator struct{}
+type TestRunCustomValidator struct {
+	recorder *audit.Recorder
+}
 
 // validate that the required parameters are set. This validation is done here instead of directly in the struct since
 // we do mutate the input in the Default function.
@@ -189,12 +197,17 @@ func (d *TestRunCustomValidator) validate(testrun *etosv1alpha1.TestRun) error {
 		))
 	}
 
-	if testrun.Spec.EnvironmentProvider == nil {
+	if testrun.Spec.EnvironmentProvider == nil || testrun.Spec.EnvironmentProvider.Image == nil {
 		allErrs = append(allErrs, field.Invalid(
 			field.NewPath("spec").Child("environmentProvider"),
 			testrun.Spec.EnvironmentProvider,
 			"EnvironmentProvider image information is missing, maybe because cluster is missing?",
 		))
+	} else if testrun.Spec.EnvironmentProvider.JobSettings != nil {
+		allErrs = append(allErrs, validateJobSettings(
+			*testrun.Spec.EnvironmentProvider.JobSettings,
+			field.NewPath("spec").Child("environmentProvider").Child("jobSettings"),
+		)...)
 	}
 
 	if testrun.Spec.TestRunner == nil {
@@ -216,19 +229,31 @@ func (d *TestRunCustomValidator) validate(testrun *etosv1alpha1.TestRun) error {
 }
 
 // ValidateCreate validates the creation of a TestRun.
-func (d *TestRunCustomValidator) ValidateCreate(_ context.Context, testrun *etosv1alpha1.TestRun) (admission.Warnings, error) {
+func (d *TestRunCustomValidator) ValidateCreate(ctx context.Context, testrun *etosv1alpha1.TestRun) (admission.Warnings, error) {
 	testrunlog.Info("Validation for TestRun upon creation", "name", testrun.GetName())
-	return nil, d.validate(testrun)
+	if err := d.validate(testrun); err != nil {
+		return nil, err
+	}
+	return nil, d.recorder.Record(ctx, testrun, nil)
 }
 
-// ValidateUpdate validates the updates of a TestRun.
-func (d *TestRunCustomValidator) ValidateUpdate(_ context.Context, _, testrun *etosv1alpha1.TestRun) (admission.Warnings, error) {
+// ValidateUpdate validates the updates of a TestRun. Updates are allowed even if they cannot be
+// recorded, since ETOS updates TestRuns while they run.
+func (d *TestRunCustomValidator) ValidateUpdate(ctx context.Context, old, testrun *etosv1alpha1.TestRun) (admission.Warnings, error) {
 	testrunlog.Info("Validation for TestRun upon update", "name", testrun.GetName())
-	return nil, d.validate(testrun)
+	if err := d.validate(testrun); err != nil {
+		return nil, err
+	}
+	return d.recorder.RecordOrWarn(ctx, testrun, old), nil
 }
 
-// ValidateDelete validates the deletion of a TestRun.
-func (d *TestRunCustomValidator) ValidateDelete(_ context.Context, testrun *etosv1alpha1.TestRun) (admission.Warnings, error) {
+// ValidateDelete validates the deletion of a TestRun. Deleting a TestRun that has not finished aborts
+// it, and is denied if it cannot be recorded. Finished TestRuns, I.e. those deleted by ETOS when their
+// retention has passed, are deleted even if they cannot be recorded.
+func (d *TestRunCustomValidator) ValidateDelete(ctx context.Context, testrun *etosv1alpha1.TestRun) (admission.Warnings, error) {
 	testrunlog.Info("Validation for TestRun upon deletion", "name", testrun.GetName())
-	return nil, nil
+	if testrun.Status.CompletionTime != nil {
+		return d.recorder.RecordOrWarn(ctx, testrun, nil), nil
+	}
+	return nil, d.recorder.Record(ctx, testrun, nil)
 }
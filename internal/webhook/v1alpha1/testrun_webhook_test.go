@@ -19,9 +19,9 @@ package v1alpha1
 import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 
 	etosv1alpha1 "github.com/eiffel-community/etos/api/v1alpha1"
-	// TODO (user): Add any additional imports if needed
 )
 
 var _ = Describe("TestRun Webhook", func() {
@@ -61,26 +61,35 @@ var _ = Describe("TestRun Webhook", func() {
 	})
 
 	Context("When creating or updating TestRun under Validating Webhook", func() {
-		// TODO (user): Add logic for validating webhooks
-		// Example:
-		// It("Should deny creation if a required field is missing", func() {
-		//     By("simulating an invalid creation scenario")
-		//     obj.SomeRequiredField = ""
-		//     Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
-		// })
-		//
-		// It("Should admit creation if all required fields are present", func() {
-		//     By("simulating an invalid creation scenario")
-		//     obj.SomeRequiredField = "valid_value"
-		//     Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
-		// })
-		//
-		// It("Should validate updates correctly", func() {
-		//     By("simulating a valid update scenario")
-		//     oldObj.SomeRequiredField = "updated_value"
-		//     obj.SomeRequiredField = "updated_value"
-		//     Expect(validator.ValidateUpdate(ctx, oldObj, obj)).To(BeNil())
-		// })
+		BeforeEach(func() {
+			image := &etosv1alpha1.Image{Image: "registry.example.com/etos:latest"}
+			obj.Spec.Cluster = "etos"
+			obj.Spec.SuiteRunner = &etosv1alpha1.SuiteRunner{Image: image}
+			obj.Spec.LogListener = &etosv1alpha1.LogListener{Image: image}
+			obj.Spec.EnvironmentProvider = &etosv1alpha1.EnvironmentProvider{Image: image}
+			obj.Spec.TestRunner = &etosv1alpha1.TestRunner{Version: "latest"}
+		})
+
+		It("Should admit job settings for the environment provider", func() {
+			obj.Spec.EnvironmentProvider.JobSettings = &etosv1alpha1.JobSettings{
+				NodeSelector: map[string]string{"kubernetes.io/arch": "amd64"},
+			}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny invalid job settings for the environment provider", func() {
+			obj.Spec.EnvironmentProvider.JobSettings = &etosv1alpha1.JobSettings{
+				Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpEqual, Value: "etos"}},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.environmentProvider.jobSettings.tolerations[0].operator")))
+		})
+
+		It("Should deny an environment provider without an image", func() {
+			obj.Spec.EnvironmentProvider = &etosv1alpha1.EnvironmentProvider{JobSettings: &etosv1alpha1.JobSettings{}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.environmentProvider")))
+		})
 	})
 
 })
@@ -111,15 +111,18 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 
 	cfg := config.New()
-	err = SetupTestRunWebhookWithManager(mgr, cfg)
+	err = SetupTestRunWebhookWithManager(mgr, cfg, nil)
 	Expect(err).NotTo(HaveOccurred())
 
-	err = SetupProviderWebhookWithManager(mgr)
+	err = SetupProviderWebhookWithManager(mgr, nil)
 	Expect(err).NotTo(HaveOccurred())
 
 	err = SetupEnvironmentRequestWebhookWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = SetupEnvironmentWebhookWithManager(mgr, nil)
+	Expect(err).NotTo(HaveOccurred())
+
 	// +kubebuilder:scaffold:webhook
 
 	go func() {
@@ -0,0 +1,111 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package v1alpha2
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/audit"
+)
+
+// auditStore is an audit store that fails to append records if err is set.
+type auditStore struct {
+	records []audit.Record
+	err     error
+}
+
+// Append appends a record, or returns the error of the store.
+func (s *auditStore) Append(_ context.Context, _ string, record audit.Record) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, record)
+	return nil
+}
+
+// List lists the records of the store.
+func (s *auditStore) List(_ context.Context, _, _ string) ([]audit.Record, error) {
+	return s.records, nil
+}
+
+// deleteRequest returns a context with an admission request, by the controller manager, to delete a
+// resource of a kind.
+func deleteRequest(kind string) context.Context {
+	return admission.NewContextWithRequest(ctx, admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       "1",
+			Kind:      metav1.GroupVersionKind{Group: "etos.eiffel-community.github.io", Version: "v1alpha2", Kind: kind},
+			Operation: admissionv1.Delete,
+			UserInfo:  authenticationv1.UserInfo{Username: "system:serviceaccount:etos:etos-controller-manager"},
+		},
+	})
+}
+
+var _ = Describe("Audit of released resources", func() {
+	var (
+		store    *auditStore
+		recorder *audit.Recorder
+		meta     metav1.ObjectMeta
+	)
+
+	BeforeEach(func() {
+		store = &auditStore{}
+		recorder = audit.NewRecorder(store)
+		meta = metav1.ObjectMeta{
+			Name:      "resource",
+			Namespace: "default",
+			Labels:    map[string]string{"etos.eiffel-community.github.io/id": "fbb4096d-6529-4c39-bac3-08a7e45bf69a"},
+		}
+	})
+
+	It("should record the release of resources", func() {
+		Expect((&IutCustomValidator{recorder}).ValidateDelete(deleteRequest("Iut"), &etosv1alpha2.Iut{ObjectMeta: meta})).To(BeEmpty())
+		Expect((&ExecutionSpaceCustomValidator{recorder}).ValidateDelete(deleteRequest("ExecutionSpace"), &etosv1alpha2.ExecutionSpace{ObjectMeta: meta})).To(BeEmpty())
+		Expect((&LogAreaCustomValidator{recorder}).ValidateDelete(deleteRequest("LogArea"), &etosv1alpha2.LogArea{ObjectMeta: meta})).To(BeEmpty())
+		kinds := make([]string, 0, len(store.records))
+		for _, record := range store.records {
+			Expect(record.Operation).To(Equal(audit.OperationDelete))
+			kinds = append(kinds, record.Kind)
+		}
+		Expect(kinds).To(Equal([]string{"Iut", "ExecutionSpace", "LogArea"}))
+	})
+
+	It("should not block the release of resources when the audit trail fails", func() {
+		store.err = errors.New("configmaps is forbidden")
+
+		warnings, err := (&IutCustomValidator{recorder}).ValidateDelete(deleteRequest("Iut"), &etosv1alpha2.Iut{ObjectMeta: meta})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf(ContainSubstring("configmaps is forbidden")))
+
+		warnings, err = (&ExecutionSpaceCustomValidator{recorder}).ValidateDelete(deleteRequest("ExecutionSpace"), &etosv1alpha2.ExecutionSpace{ObjectMeta: meta})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(HaveLen(1))
+
+		warnings, err = (&LogAreaCustomValidator{recorder}).ValidateDelete(deleteRequest("LogArea"), &etosv1alpha2.LogArea{ObjectMeta: meta})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(HaveLen(1))
+		Expect(store.records).To(BeEmpty())
+	})
+})
@@ -23,9 +23,11 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	"github.com/eiffel-community/etos/api/v1alpha1"
 	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/audit"
 )
 
 // nolint:unused
@@ -34,9 +36,11 @@ var executionspacelog = logf.Log.WithName("executionspace-resource")
 
 const etos = "etos"
 
-// SetupExecutionSpaceWebhookWithManager registers the webhook for ExecutionSpace in the manager.
-func SetupExecutionSpaceWebhookWithManager(mgr ctrl.Manager) error {
+// SetupExecutionSpaceWebhookWithManager registers the webhook for ExecutionSpace in the manager. The release of ExecutionSpaces is
+// recorded by recorder.
+func SetupExecutionSpaceWebhookWithManager(mgr ctrl.Manager, recorder *audit.Recorder) error {
 	return ctrl.NewWebhookManagedBy(mgr, &etosv1alpha2.ExecutionSpace{}).
+		WithValidator(&ExecutionSpaceCustomValidator{recorder}).
 		WithDefaulter(&ExecutionSpaceCustomDefaulter{mgr.GetClient()}).
 		Complete()
 }
@@ -84,3 +88,30 @@ func (d *ExecutionSpaceCustomDefaulter) Default(ctx context.Context, executionsp
 
 	return nil
 }
+
+// +kubebuilder:webhook:path=/validate-etos-eiffel-community-github-io-v1alpha2-executionspace,mutating=false,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=etos.eiffel-community.github.io,resources=executionspaces,verbs=delete,versions=v1alpha2,name=vexecutionspace-v1alpha2.kb.io,admissionReviewVersions=v1
+
+// ExecutionSpaceCustomValidator struct is responsible for recording the release of an ExecutionSpace, I.e. when it is deleted,
+// in the audit trail.
+//
+// NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
+// as this struct is used only for temporary operations and does not need to be deeply copied.
+type ExecutionSpaceCustomValidator struct {
+	recorder *audit.Recorder
+}
+
+// ValidateCreate validates the creation of an ExecutionSpace.
+func (d *ExecutionSpaceCustomValidator) ValidateCreate(_ context.Context, _ *etosv1alpha2.ExecutionSpace) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateUpdate validates the updates of an ExecutionSpace.
+func (d *ExecutionSpaceCustomValidator) ValidateUpdate(_ context.Context, _, _ *etosv1alpha2.ExecutionSpace) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateDelete validates the deletion of an ExecutionSpace and records it in the audit trail.
+func (d *ExecutionSpaceCustomValidator) ValidateDelete(ctx context.Context, executionspace *etosv1alpha2.ExecutionSpace) (admission.Warnings, error) {
+	executionspacelog.Info("Validation for ExecutionSpace upon deletion", "name", executionspace.GetName())
+	return d.recorder.RecordOrWarn(ctx, executionspace, nil), nil
+}
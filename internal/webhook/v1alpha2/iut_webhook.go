@@ -23,18 +23,22 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	"github.com/eiffel-community/etos/api/v1alpha1"
 	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/audit"
 )
 
 // nolint:unused
 // iutlog is for logging in this package.
 var iutlog = logf.Log.WithName("iut-resource")
 
-// SetupIutWebhookWithManager registers the webhook for Iut in the manager.
-func SetupIutWebhookWithManager(mgr ctrl.Manager) error {
+// SetupIutWebhookWithManager registers the webhook for Iut in the manager. The release of IUTs is
+// recorded by recorder.
+func SetupIutWebhookWithManager(mgr ctrl.Manager, recorder *audit.Recorder) error {
 	return ctrl.NewWebhookManagedBy(mgr, &etosv1alpha2.Iut{}).
+		WithValidator(&IutCustomValidator{recorder}).
 		WithDefaulter(&IutCustomDefaulter{mgr.GetClient()}).
 		Complete()
 }
@@ -82,3 +86,30 @@ func (d *IutCustomDefaulter) Default(ctx context.Context, iut *etosv1alpha2.Iut)
 
 	return nil
 }
+
+// +kubebuilder:webhook:path=/validate-etos-eiffel-community-github-io-v1alpha2-iut,mutating=false,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=etos.eiffel-community.github.io,resources=iuts,verbs=delete,versions=v1alpha2,name=viut-v1alpha2.kb.io,admissionReviewVersions=v1
+
+// IutCustomValidator struct is responsible for recording the release of an IUT, I.e. when it is deleted,
+// in the audit trail.
+//
+// NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
+// as this struct is used only for temporary operations and does not need to be deeply copied.
+type IutCustomValidator struct {
+	recorder *audit.Recorder
+}
+
+// ValidateCreate validates the creation of an Iut.
+func (d *IutCustomValidator) ValidateCreate(_ context.Context, _ *etosv1alpha2.Iut) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateUpdate validates the updates of an Iut.
+func (d *IutCustomValidator) ValidateUpdate(_ context.Context, _, _ *etosv1alpha2.Iut) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateDelete validates the deletion of an Iut and records it in the audit trail.
+func (d *IutCustomValidator) ValidateDelete(ctx context.Context, iut *etosv1alpha2.Iut) (admission.Warnings, error) {
+	iutlog.Info("Validation for Iut upon deletion", "name", iut.GetName())
+	return d.recorder.RecordOrWarn(ctx, iut, nil), nil
+}
@@ -23,18 +23,22 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	"github.com/eiffel-community/etos/api/v1alpha1"
 	etosv1alpha2 "github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/audit"
 )
 
 // nolint:unused
 // logarealog is for logging in this package.
 var logarealog = logf.Log.WithName("logarea-resource")
 
-// SetupLogAreaWebhookWithManager registers the webhook for LogArea in the manager.
-func SetupLogAreaWebhookWithManager(mgr ctrl.Manager) error {
+// SetupLogAreaWebhookWithManager registers the webhook for LogArea in the manager. The release of LogAreas is
+// recorded by recorder.
+func SetupLogAreaWebhookWithManager(mgr ctrl.Manager, recorder *audit.Recorder) error {
 	return ctrl.NewWebhookManagedBy(mgr, &etosv1alpha2.LogArea{}).
+		WithValidator(&LogAreaCustomValidator{recorder}).
 		WithDefaulter(&LogAreaCustomDefaulter{mgr.GetClient()}).
 		Complete()
 }
@@ -82,3 +86,30 @@ func (d *LogAreaCustomDefaulter) Default(ctx context.Context, logarea *etosv1alp
 
 	return nil
 }
+
+// +kubebuilder:webhook:path=/validate-etos-eiffel-community-github-io-v1alpha2-logarea,mutating=false,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=etos.eiffel-community.github.io,resources=logarea,verbs=delete,versions=v1alpha2,name=vlogarea-v1alpha2.kb.io,admissionReviewVersions=v1
+
+// LogAreaCustomValidator struct is responsible for recording the release of a LogArea, I.e. when it is deleted,
+// in the audit trail.
+//
+// NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
+// as this struct is used only for temporary operations and does not need to be deeply copied.
+type LogAreaCustomValidator struct {
+	recorder *audit.Recorder
+}
+
+// ValidateCreate validates the creation of a LogArea.
+func (d *LogAreaCustomValidator) ValidateCreate(_ context.Context, _ *etosv1alpha2.LogArea) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateUpdate validates the updates of a LogArea.
+func (d *LogAreaCustomValidator) ValidateUpdate(_ context.Context, _, _ *etosv1alpha2.LogArea) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateDelete validates the deletion of a LogArea and records it in the audit trail.
+func (d *LogAreaCustomValidator) ValidateDelete(ctx context.Context, logarea *etosv1alpha2.LogArea) (admission.Warnings, error) {
+	logarealog.Info("Validation for LogArea upon deletion", "name", logarea.GetName())
+	return d.recorder.RecordOrWarn(ctx, logarea, nil), nil
+}
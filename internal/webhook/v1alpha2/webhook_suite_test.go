@@ -109,13 +109,13 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = SetupIutWebhookWithManager(mgr)
+	err = SetupIutWebhookWithManager(mgr, nil)
 	Expect(err).NotTo(HaveOccurred())
 
-	err = SetupExecutionSpaceWebhookWithManager(mgr)
+	err = SetupExecutionSpaceWebhookWithManager(mgr, nil)
 	Expect(err).NotTo(HaveOccurred())
 
-	err = SetupLogAreaWebhookWithManager(mgr)
+	err = SetupLogAreaWebhookWithManager(mgr, nil)
 	Expect(err).NotTo(HaveOccurred())
 
 	// +kubebuilder:scaffold:webhook
@@ -0,0 +1,163 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package events is the schema of the events that ETOS publishes on the ETOS message bus.
+//
+// Every message on the ETOS message bus is an Event, an envelope with the version of the schema, the
+// type of the event and its data. Publishers create events with New and publish them with Publish,
+// consumers decode them with Parse. The JSON schema of the events is generated by Schema.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Version is the version of the event schema. It is changed when a field is removed or changes
+// meaning, new fields and new types of events are added without changing the version.
+const Version = "v1"
+
+// Type is the type of an event.
+type Type string
+
+const (
+	// TypeMessage is the type of user logs, log entries that are shown to users.
+	TypeMessage Type = "message"
+	// TypeStatusChanged is the type of events that tell that the status of a resource has changed.
+	TypeStatusChanged Type = "status_changed"
+	// TypeEnvironmentCreated is the type of events that tell that an environment has been created.
+	TypeEnvironmentCreated Type = "environment_created"
+	// TypeResourceReleased is the type of events that tell that a resource has been released.
+	TypeResourceReleased Type = "resource_released"
+	// TypeVerdict is the type of events that tell the verdict of a test.
+	TypeVerdict Type = "verdict"
+)
+
+// Data is the data of an event.
+type Data interface {
+	// Type returns the type of the event.
+	Type() Type
+	// Meta returns the last part of the filter that the event is published with, I.e. the level of
+	// a user log. Empty if the event has no meta.
+	Meta() string
+}
+
+// Event is the envelope of all events on the ETOS message bus.
+type Event struct {
+	// Version is the version of the event schema, I.e. "v1". Empty for events published before the
+	// schema was versioned.
+	Version string `json:"version,omitempty"`
+	// Event is the type of the event.
+	Event Type `json:"event"`
+	// Data is the data of the event, which is decoded into the Data of the type of the event.
+	Data json.RawMessage `json:"data"`
+}
+
+// Publisher publishes messages on the ETOS message bus.
+type Publisher interface {
+	Publish(message []byte, filter string) error
+}
+
+// ErrUnknownType is returned by Parse and Decode for events of a type that is not in the schema.
+var ErrUnknownType = errors.New("unknown event type")
+
+// New creates the event envelope of data.
+func New(data Data) (Event, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to marshal %s event: %w", data.Type(), err)
+	}
+	return Event{Version: Version, Event: data.Type(), Data: b}, nil
+}
+
+// Marshal encodes data as an event on the ETOS message bus.
+func Marshal(data Data) ([]byte, error) {
+	event, err := New(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(event)
+}
+
+// Filter returns the filter that an event for the TestRun with identifier is published with, in the
+// format "identifier.type.meta". The meta is "*" if the event has none.
+func Filter(identifier string, data Data) string {
+	meta := data.Meta()
+	if meta == "" {
+		meta = "*"
+	}
+	return fmt.Sprintf("%s.%s.%s", identifier, data.Type(), meta)
+}
+
+// Publish publishes an event for the TestRun with identifier.
+func Publish(publisher Publisher, identifier string, data Data) error {
+	message, err := Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := publisher.Publish(message, Filter(identifier, data)); err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", data.Type(), err)
+	}
+	return nil
+}
+
+// Parse decodes a message from the ETOS message bus into the Data of its type.
+func Parse(message []byte) (Data, error) {
+	var event Event
+	if err := json.Unmarshal(message, &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	return event.Decode()
+}
+
+// Decode decodes the data of an event into the Data of its type.
+func (e Event) Decode() (Data, error) {
+	if e.Version != "" && !strings.EqualFold(e.Version, Version) {
+		return nil, fmt.Errorf("unsupported event schema version %q, want %q", e.Version, Version)
+	}
+	data, ok := newData(e.Event)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownType, e.Event)
+	}
+	if err := json.Unmarshal(e.Data, data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s event: %w", e.Event, err)
+	}
+	return data, nil
+}
+
+// Types returns the types of events in the schema.
+func Types() []Type {
+	return []Type{TypeMessage, TypeStatusChanged, TypeEnvironmentCreated, TypeResourceReleased, TypeVerdict}
+}
+
+// newData returns a pointer to the zero value of the Data of an event type.
+func newData(t Type) (Data, bool) {
+	switch t {
+	case TypeMessage:
+		return &Message{}, true
+	case TypeStatusChanged:
+		return &StatusChanged{}, true
+	case TypeEnvironmentCreated:
+		return &EnvironmentCreated{}, true
+	case TypeResourceReleased:
+		return &ResourceReleased{}, true
+	case TypeVerdict:
+		return &Verdict{}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,151 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package events_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/eiffel-community/etos/pkg/events"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// publisher records the messages published to it.
+type publisher struct {
+	messages []string
+	filters  []string
+	err      error
+}
+
+func (p *publisher) Publish(message []byte, filter string) error {
+	p.messages = append(p.messages, string(message))
+	p.filters = append(p.filters, filter)
+	return p.err
+}
+
+var _ = Describe("Events", func() {
+	It("should publish events in the versioned envelope", func() {
+		p := &publisher{}
+		Expect(events.Publish(p, "testrun", events.Message{
+			Message:    "hello",
+			Level:      "info",
+			Timestamp:  "2025-01-01T00:00:00.000Z",
+			Identifier: "testrun",
+		})).To(Succeed())
+		Expect(p.filters).To(Equal([]string{"testrun.message.info"}))
+		Expect(p.messages).To(ConsistOf(MatchJSON(`{
+			"version": "v1",
+			"event": "message",
+			"data": {
+				"message": "hello",
+				"levelname": "info",
+				"@timestamp": "2025-01-01T00:00:00.000Z",
+				"identifier": "testrun"
+			}
+		}`)))
+	})
+
+	It("should publish events without meta with a wildcard meta", func() {
+		Expect(events.Filter("testrun", events.EnvironmentCreated{})).To(Equal("testrun.environment_created.*"))
+	})
+
+	It("should return the errors of the publisher", func() {
+		p := &publisher{err: errors.New("closed")}
+		err := events.Publish(p, "testrun", events.Verdict{Verdict: "Passed"})
+		Expect(err).To(MatchError(ContainSubstring("closed")))
+	})
+
+	It("should parse every type of event", func() {
+		for _, data := range []events.Data{
+			&events.Message{Message: "hello", Level: "info", Fields: map[string]any{"caller": "main.go:1"}},
+			&events.StatusChanged{Kind: "IUT", Name: "request", Status: "Successful"},
+			&events.EnvironmentCreated{Environment: "environment", Tests: 2},
+			&events.ResourceReleased{Kind: "IUT", Name: "iut"},
+			&events.Verdict{Name: "suite", Verdict: "Passed", Conclusion: "Successful"},
+		} {
+			message, err := events.Marshal(data)
+			Expect(err).NotTo(HaveOccurred())
+			parsed, err := events.Parse(message)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed).To(Equal(data))
+		}
+	})
+
+	It("should keep the fields of a user log next to the other fields of the data", func() {
+		message, err := events.Marshal(&events.Message{
+			Message: "hello",
+			Level:   "info",
+			Fields:  map[string]any{"caller": "main.go:1", "message": "replaced"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(message).To(MatchJSON(`{
+			"version": "v1",
+			"event": "message",
+			"data": {
+				"message": "hello",
+				"levelname": "info",
+				"@timestamp": "",
+				"identifier": "",
+				"caller": "main.go:1"
+			}
+		}`))
+		data, err := events.Parse(message)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(&events.Message{Message: "hello", Level: "info", Fields: map[string]any{"caller": "main.go:1"}}))
+	})
+
+	It("should parse events published before the schema was versioned", func() {
+		data, err := events.Parse([]byte(`{"event":"message","data":{"message":"hello","levelname":"info"}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(&events.Message{Message: "hello", Level: "info"}))
+	})
+
+	It("should not parse events of unknown types or versions", func() {
+		_, err := events.Parse([]byte(`{"version":"v1","event":"unknown","data":{}}`))
+		Expect(err).To(MatchError(events.ErrUnknownType))
+		_, err = events.Parse([]byte(`{"version":"v2","event":"message","data":{}}`))
+		Expect(err).To(MatchError(ContainSubstring("unsupported event schema version")))
+	})
+})
+
+var _ = Describe("Schema", func() {
+	It("should describe every type of event", func() {
+		b, err := events.Schema()
+		Expect(err).NotTo(HaveOccurred())
+		var schema struct {
+			Defs map[string]struct {
+				Required []string `json:"required"`
+			} `json:"$defs"`
+		}
+		Expect(json.Unmarshal(b, &schema)).To(Succeed())
+		for _, t := range events.Types() {
+			Expect(schema.Defs).To(HaveKey(string(t)))
+		}
+		Expect(schema.Defs["message"].Required).To(ConsistOf("message", "levelname", "@timestamp", "identifier"))
+	})
+
+	It("should match the published schema, regenerate it with make event-schema", func() {
+		b, err := events.Schema()
+		Expect(err).NotTo(HaveOccurred())
+		published, err := os.ReadFile(filepath.Join("..", "..", "docs", "schemas", "events", events.Version+".json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(published)).To(Equal(string(b) + "\n"))
+	})
+})
@@ -0,0 +1,140 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// schemaID is the identifier of the JSON schema of the events, which changes with Version.
+const schemaID = "https://github.com/eiffel-community/etos/schemas/events/" + Version + ".json"
+
+// Schema generates the JSON schema, draft 2020-12, of the events on the ETOS message bus.
+func Schema() ([]byte, error) {
+	types := Types()
+	names := make([]string, 0, len(types))
+	definitions := map[string]any{}
+	variants := make([]any, 0, len(types))
+	for _, t := range types {
+		data, _ := newData(t)
+		definition, err := schemaOf(reflect.TypeOf(data).Elem())
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the schema of %s events: %w", t, err)
+		}
+		names = append(names, string(t))
+		definitions[string(t)] = definition
+		variants = append(variants, map[string]any{
+			"if": map[string]any{
+				"properties": map[string]any{"event": map[string]any{"const": t}},
+			},
+			"then": map[string]any{
+				"properties": map[string]any{"data": map[string]any{"$ref": "#/$defs/" + string(t)}},
+			},
+		})
+	}
+	schema := map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         schemaID,
+		"title":       "ETOS event",
+		"description": "An event published by ETOS on the ETOS message bus.",
+		"type":        "object",
+		"required":    []string{"version", "event", "data"},
+		"properties": map[string]any{
+			"version": map[string]any{"const": Version, "description": "The version of the event schema."},
+			"event":   map[string]any{"enum": names, "description": "The type of the event."},
+			"data":    map[string]any{"type": "object", "description": "The data of the event."},
+		},
+		"allOf": variants,
+		"$defs": definitions,
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// schemaOf generates the JSON schema of a Go type.
+func schemaOf(t reflect.Type) (map[string]any, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.Interface:
+		return map[string]any{}, nil
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.Slice, reflect.Array:
+		items, err := schemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key %s", t.Key())
+		}
+		values, err := schemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// structSchema generates the JSON schema of a struct from the json and description tags of its
+// fields. Fields without omitempty are required.
+func structSchema(t reflect.Type) (map[string]any, error) {
+	properties := map[string]any{}
+	required := []string{}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property, err := schemaOf(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if description := field.Tag.Get("description"); description != "" {
+			property["description"] = description
+		}
+		properties[name] = property
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}, nil
+}
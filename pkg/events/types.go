@@ -0,0 +1,164 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package events
+
+import (
+	"encoding/json"
+	"maps"
+)
+
+// Message is a user log, a log entry that is shown to users.
+type Message struct {
+	// Message is the log message.
+	Message string `json:"message" description:"The log message."`
+	// Level is the level of the log entry, I.e. "info".
+	Level string `json:"levelname" description:"The level of the log entry, I.e. info or error."`
+	// Timestamp is the time of the log entry, in ISO 8601.
+	Timestamp string `json:"@timestamp" description:"The time of the log entry, in ISO 8601."`
+	// Name is the name of the logger.
+	Name string `json:"name,omitempty" description:"The name of the logger."`
+	// Identifier is the identifier of the TestRun that the log entry belongs to.
+	Identifier string `json:"identifier" description:"The identifier of the TestRun."`
+	// Fields are the other fields of the log entry, I.e. the values added to the logger. They are
+	// next to the other fields in the JSON of the message, as in the log entry.
+	Fields map[string]any `json:"-"`
+}
+
+// messageKeys are the JSON keys of the fields of a Message, which are not added to its Fields.
+var messageKeys = []string{"message", "levelname", "@timestamp", "name", "identifier"}
+
+// MarshalJSON marshals the message with its Fields next to the other fields. Fields do not replace
+// the other fields of the message.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	data, err := json.Marshal(message(m))
+	if err != nil || len(m.Fields) == 0 {
+		return data, err
+	}
+	fields := maps.Clone(m.Fields)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON unmarshals a message and adds the keys that are not fields of the message to its
+// Fields.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	if err := json.Unmarshal(data, (*message)(m)); err != nil {
+		return err
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, key := range messageKeys {
+		delete(fields, key)
+	}
+	m.Fields = nil
+	if len(fields) > 0 {
+		m.Fields = fields
+	}
+	return nil
+}
+
+// Type returns TypeMessage.
+func (Message) Type() Type { return TypeMessage }
+
+// Meta returns the level of the log entry.
+func (m Message) Meta() string { return m.Level }
+
+// StatusChanged tells that the status of a resource, I.e. an EnvironmentRequest, has changed.
+type StatusChanged struct {
+	// Kind is the kind of resource, I.e. "EnvironmentRequest" or "IUT".
+	Kind string `json:"kind" description:"The kind of resource, I.e. EnvironmentRequest or IUT."`
+	// Name is the name of the resource.
+	Name string `json:"name" description:"The name of the resource."`
+	// Status is the new status of the resource, I.e. "Successful".
+	Status string `json:"status" description:"The new status of the resource."`
+	// Reason is a machine readable reason for the change.
+	Reason string `json:"reason,omitempty" description:"A machine readable reason for the change."`
+	// Message is a human readable description of the change.
+	Message string `json:"message,omitempty" description:"A human readable description of the change."`
+}
+
+// Type returns TypeStatusChanged.
+func (StatusChanged) Type() Type { return TypeStatusChanged }
+
+// Meta returns the kind of resource.
+func (s StatusChanged) Meta() string { return s.Kind }
+
+// EnvironmentCreated tells that an environment, with an IUT, a log area and an execution space, has
+// been created for a sub suite.
+type EnvironmentCreated struct {
+	// EnvironmentRequest is the name of the EnvironmentRequest that the environment was created for.
+	EnvironmentRequest string `json:"environmentRequest" description:"The name of the EnvironmentRequest."`
+	// Environment is the name of the Environment.
+	Environment string `json:"environment" description:"The name of the Environment."`
+	// SubSuiteID is the ID of the sub suite that runs in the environment.
+	SubSuiteID string `json:"subSuiteId" description:"The ID of the sub suite that runs in the environment."`
+	// Name is the name of the sub suite.
+	Name string `json:"name" description:"The name of the sub suite."`
+	// IUT is the name of the IUT in the environment.
+	IUT string `json:"iut" description:"The name of the IUT."`
+	// LogArea is the name of the log area in the environment.
+	LogArea string `json:"logArea" description:"The name of the log area."`
+	// ExecutionSpace is the name of the execution space in the environment.
+	ExecutionSpace string `json:"executionSpace" description:"The name of the execution space."`
+	// Tests is the number of tests in the sub suite.
+	Tests int `json:"tests" description:"The number of tests in the sub suite."`
+}
+
+// Type returns TypeEnvironmentCreated.
+func (EnvironmentCreated) Type() Type { return TypeEnvironmentCreated }
+
+// Meta returns no meta, environments are not filtered on.
+func (EnvironmentCreated) Meta() string { return "" }
+
+// ResourceReleased tells that a resource, I.e. an IUT, has been released.
+type ResourceReleased struct {
+	// Kind is the kind of resource, I.e. "IUT".
+	Kind string `json:"kind" description:"The kind of resource, I.e. IUT."`
+	// Name is the name of the resource.
+	Name string `json:"name" description:"The name of the resource."`
+	// Provider is the name of the provider that released the resource.
+	Provider string `json:"provider,omitempty" description:"The name of the provider that released the resource."`
+}
+
+// Type returns TypeResourceReleased.
+func (ResourceReleased) Type() Type { return TypeResourceReleased }
+
+// Meta returns the kind of resource.
+func (r ResourceReleased) Meta() string { return r.Kind }
+
+// Verdict tells the verdict of a test, a sub suite or a TestRun.
+type Verdict struct {
+	// Name is the name of what the verdict is for, I.e. the name of a sub suite.
+	Name string `json:"name" description:"The name of what the verdict is for, I.e. a sub suite."`
+	// Verdict is the verdict, I.e. "Passed", "Failed" or "Inconclusive".
+	Verdict string `json:"verdict" description:"The verdict, I.e. Passed, Failed or Inconclusive."`
+	// Conclusion is the conclusion, I.e. "Successful" or "Failed".
+	Conclusion string `json:"conclusion" description:"The conclusion, I.e. Successful or Failed."`
+	// Description describes the verdict.
+	Description string `json:"description,omitempty" description:"A description of the verdict."`
+}
+
+// Type returns TypeVerdict.
+func (Verdict) Type() Type { return TypeVerdict }
+
+// Meta returns the verdict.
+func (v Verdict) Meta() string { return v.Verdict }
@@ -0,0 +1,125 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logareatest has helpers for testing log areas against a local object storage.
+package logareatest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// AccessKey is the access key of the root user of a MinIO started by StartMinIO.
+	AccessKey = "etos"
+	// SecretKey is the secret key of the root user of a MinIO started by StartMinIO.
+	SecretKey = "etos-minio-secret"
+)
+
+// ErrNoMinIO is returned by StartMinIO when there is no MinIO server binary to start.
+var ErrNoMinIO = errors.New("no minio binary found, set MINIO_BINARY or add minio to PATH")
+
+// MinIO is a local MinIO server.
+type MinIO struct {
+	// Endpoint is the host and port that the server listens to, without a scheme.
+	Endpoint string
+	cmd      *exec.Cmd
+}
+
+// StartMinIO starts a MinIO server that stores its data in a directory. The server binary is
+// found with the MINIO_BINARY environment variable, or in PATH.
+func StartMinIO(ctx context.Context, dataDir string) (*MinIO, error) {
+	binary := os.Getenv("MINIO_BINARY")
+	if binary == "" {
+		var err error
+		if binary, err = exec.LookPath("minio"); err != nil {
+			return nil, ErrNoMinIO
+		}
+	}
+	address, err := freeAddress()
+	if err != nil {
+		return nil, err
+	}
+	consoleAddress, err := freeAddress()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(binary, "server", dataDir, "--address", address, "--console-address", consoleAddress, "--quiet")
+	cmd.Env = append(os.Environ(), "MINIO_ROOT_USER="+AccessKey, "MINIO_ROOT_PASSWORD="+SecretKey)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	server := &MinIO{Endpoint: address, cmd: cmd}
+	if err := server.waitReady(ctx); err != nil {
+		server.Stop()
+		return nil, err
+	}
+	return server, nil
+}
+
+// Client creates a client of the root user of the server.
+func (m *MinIO) Client() (*minio.Client, error) {
+	return minio.New(m.Endpoint, &minio.Options{Creds: credentials.NewStaticV4(AccessKey, SecretKey, "")})
+}
+
+// Stop stops the server.
+func (m *MinIO) Stop() {
+	_ = m.cmd.Process.Kill()
+	_ = m.cmd.Wait()
+}
+
+// waitReady waits for the server to become ready.
+func (m *MinIO) waitReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	url := fmt.Sprintf("http://%s/minio/health/ready", m.Endpoint)
+	for {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		if response, err := http.DefaultClient.Do(request); err == nil {
+			response.Body.Close() // nolint:errcheck
+			if response.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("minio did not become ready: %w", ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// freeAddress finds a free address on the loopback interface.
+func freeAddress() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close() // nolint:errcheck
+	return listener.Addr().String(), nil
+}
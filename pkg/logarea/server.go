@@ -0,0 +1,152 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package logarea
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fernet/fernet-go"
+	"github.com/go-logr/logr"
+)
+
+// BasePath is the path that the endpoints of the log area server are served under.
+const BasePath = "/logarea/v1alpha"
+
+// listing is the HTML page that shows the files of a directory in a log area.
+var listing = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{ .Path }}</title></head>
+<body>
+<h1>{{ .Path }}</h1>
+<ul>
+{{- range .Entries }}
+<li><a href="{{ $.Base }}/{{ .Name }}{{ if .Dir }}/{{ end }}">{{ .Name }}{{ if .Dir }}/{{ end }}</a>{{ if not .Dir }} ({{ .Size }} bytes){{ end }}</li>
+{{- end }}
+</ul>
+</body>
+</html>
+`))
+
+// Server serves uploads and downloads of log area files.
+type Server struct {
+	storage Storage
+	key     *fernet.Key
+	ttl     time.Duration
+	logger  logr.Logger
+	mux     *http.ServeMux
+}
+
+// NewServer creates a log area server that stores files in a storage and verifies upload tokens
+// with a key. Tokens older than ttl are rejected, unless ttl is 0.
+func NewServer(storage Storage, key *fernet.Key, ttl time.Duration, logger logr.Logger) *Server {
+	server := &Server{storage: storage, key: key, ttl: ttl, logger: logger, mux: http.NewServeMux()}
+	server.mux.HandleFunc("GET "+BasePath+"/selftest/ping", server.ping)
+	server.mux.HandleFunc("PUT "+BasePath+"/upload/{path...}", server.upload)
+	server.mux.HandleFunc("GET "+BasePath+"/logarea/{path...}", server.download)
+	return server
+}
+
+// ServeHTTP serves a request to the log area server.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ping responds with 204 No Content.
+func (s *Server) ping(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// upload stores the body of a request as a file, if the request has a token that allows it.
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	name := cleanPath(r.PathValue("path"))
+	_, token, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="logarea"`)
+		http.Error(w, "authentication is required", http.StatusUnauthorized)
+		return
+	}
+	if err := VerifyToken(s.key, token, s.ttl, name); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := s.storage.Put(r.Context(), name, r.Body, r.ContentLength); err != nil {
+		s.logger.Error(err, "failed to store file", "name", name)
+		http.Error(w, "failed to store file", http.StatusInternalServerError)
+		return
+	}
+	s.logger.Info("Stored file", "name", name, "size", r.ContentLength)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// download responds with the file at a path, or with a listing of the directory at a path. The
+// listing is HTML unless the request accepts JSON.
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	name := cleanPath(r.PathValue("path"))
+	if name != "" && !strings.HasSuffix(r.URL.Path, "/") {
+		file, err := s.storage.Open(r.Context(), name)
+		if err == nil {
+			defer file.Close() // nolint:errcheck
+			if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			} else {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			}
+			if _, err := io.Copy(w, file); err != nil {
+				s.logger.Error(err, "failed to send file", "name", name)
+			}
+			return
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			s.logger.Error(err, "failed to open file", "name", name)
+			http.Error(w, "failed to open file", http.StatusInternalServerError)
+			return
+		}
+	}
+	entries, err := s.storage.List(r.Context(), name)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		s.logger.Error(err, "failed to list directory", "name", name)
+		http.Error(w, "failed to list directory", http.StatusInternalServerError)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			s.logger.Error(err, "failed to send listing", "name", name)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := listing.Execute(w, map[string]any{
+		"Path":    "/" + name,
+		"Base":    strings.TrimSuffix(path.Join(BasePath, "logarea", name), "/"),
+		"Entries": entries,
+	}); err != nil {
+		s.logger.Error(err, "failed to send listing", "name", name)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package logarea_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/eiffel-community/etos/pkg/logarea"
+	"github.com/eiffel-community/etos/pkg/logarea/logareatest"
+	"github.com/fernet/fernet-go"
+	"github.com/go-logr/logr"
+	"github.com/minio/minio-go/v7"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// newKey generates a new encryption key.
+func newKey() *fernet.Key {
+	key := &fernet.Key{}
+	Expect(key.Generate()).To(Succeed())
+	return key
+}
+
+var _ = Describe("Tokens", func() {
+	var key *fernet.Key
+	var token string
+
+	BeforeEach(func() {
+		key = newKey()
+		var err error
+		token, err = logarea.NewToken(key, "testrun/logarea")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	DescribeTable("should only allow uploads below the path of the token",
+		func(uploadPath string, allowed bool) {
+			err := logarea.VerifyToken(key, token, 0, uploadPath)
+			if allowed {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(logarea.ErrInvalidToken))
+			}
+		},
+		Entry("a file in the path", "testrun/logarea/log.txt", true),
+		Entry("a file in a directory in the path", "testrun/logarea/suite/log.txt", true),
+		Entry("a leading slash", "/testrun/logarea/log.txt", true),
+		Entry("the path itself", "testrun/logarea", false),
+		Entry("a sibling with the same prefix", "testrun/logareas/log.txt", false),
+		Entry("a path that traverses out of the path", "testrun/logarea/../other/log.txt", false),
+		Entry("the parent of the path", "testrun/log.txt", false),
+	)
+
+	It("should reject a token of another key", func() {
+		Expect(logarea.VerifyToken(newKey(), token, 0, "testrun/logarea/log.txt")).To(MatchError(logarea.ErrInvalidToken))
+	})
+
+	It("should reject an expired token", func() {
+		old, err := fernet.EncryptAndSignAtTime([]byte("testrun/logarea"), key, time.Now().Add(-2*time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logarea.VerifyToken(key, string(old), time.Hour, "testrun/logarea/log.txt")).To(MatchError(logarea.ErrInvalidToken))
+		Expect(logarea.VerifyToken(key, string(old), 0, "testrun/logarea/log.txt")).To(Succeed())
+	})
+})
+
+// describeServer describes the behavior of the log area server with a storage.
+func describeServer(storageName string, newStorage func() logarea.Storage) {
+	Describe("Server with "+storageName, func() {
+		var key *fernet.Key
+		var server *httptest.Server
+		var token string
+
+		BeforeEach(func() {
+			key = newKey()
+			server = httptest.NewServer(logarea.NewServer(newStorage(), key, 0, logr.Discard()))
+			DeferCleanup(server.Close)
+			var err error
+			token, err = logarea.NewToken(key, "testrun/logarea")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		upload := func(name, password, body string) int {
+			request, err := http.NewRequest(http.MethodPut, server.URL+logarea.BasePath+"/upload/"+name, strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			if password != "" {
+				request.SetBasicAuth("logarea", password)
+			}
+			response, err := http.DefaultClient.Do(request)
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close() // nolint:errcheck
+			return response.StatusCode
+		}
+
+		get := func(name, accept string) (int, string) {
+			request, err := http.NewRequest(http.MethodGet, server.URL+logarea.BasePath+"/logarea/"+name, nil)
+			Expect(err).NotTo(HaveOccurred())
+			if accept != "" {
+				request.Header.Set("Accept", accept)
+			}
+			response, err := http.DefaultClient.Do(request)
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close() // nolint:errcheck
+			body, err := io.ReadAll(response.Body)
+			Expect(err).NotTo(HaveOccurred())
+			return response.StatusCode, string(body)
+		}
+
+		It("should respond to ping", func() {
+			response, err := http.Get(server.URL + logarea.BasePath + "/selftest/ping")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.Body.Close()).To(Succeed())
+			Expect(response.StatusCode).To(Equal(http.StatusNoContent))
+		})
+
+		It("should require a valid token to upload", func() {
+			Expect(upload("testrun/logarea/log.txt", "", "hello")).To(Equal(http.StatusUnauthorized))
+			Expect(upload("testrun/logarea/log.txt", "not-a-token", "hello")).To(Equal(http.StatusForbidden))
+			Expect(upload("testrun/other/log.txt", token, "hello")).To(Equal(http.StatusForbidden))
+			status, _ := get("testrun/logarea/log.txt", "")
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+
+		It("should upload, download and list files", func() {
+			Expect(upload("testrun/logarea/log.txt", token, "hello")).To(Equal(http.StatusCreated))
+			Expect(upload("testrun/logarea/suite/result.json", token, `{"ok":true}`)).To(Equal(http.StatusCreated))
+
+			status, body := get("testrun/logarea/log.txt", "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(Equal("hello"))
+
+			status, body = get("testrun/logarea", "application/json")
+			Expect(status).To(Equal(http.StatusOK))
+			var entries []logarea.Entry
+			Expect(json.Unmarshal([]byte(body), &entries)).To(Succeed())
+			Expect(entries).To(Equal([]logarea.Entry{
+				{Name: "log.txt", Size: 5},
+				{Name: "suite", Dir: true},
+			}))
+
+			status, body = get("testrun/logarea/", "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(ContainSubstring(`href="/logarea/v1alpha/logarea/testrun/logarea/log.txt"`))
+			Expect(body).To(ContainSubstring(`href="/logarea/v1alpha/logarea/testrun/logarea/suite/"`))
+		})
+
+		It("should respond with not found for paths without files", func() {
+			status, _ := get("testrun/missing", "")
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+	})
+}
+
+var _ = Describe("Storage", func() {
+	describeServer("a directory storage", func() logarea.Storage {
+		return logarea.NewDirectoryStorage(GinkgoT().TempDir())
+	})
+
+	describeServer("an S3 storage", func() logarea.Storage {
+		client, bucket := startMinIO()
+		return logarea.NewS3Storage(client, bucket)
+	})
+
+	It("should treat empty objects ending with a slash as directories in an S3 storage", func(ctx context.Context) {
+		client, bucket := startMinIO()
+		storage := logarea.NewS3Storage(client, bucket)
+		_, err := client.PutObject(ctx, bucket, "testrun/logarea/", strings.NewReader(""), 0, minio.PutObjectOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		entries, err := storage.List(ctx, "testrun/logarea")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+		entries, err = storage.List(ctx, "testrun")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(Equal([]logarea.Entry{{Name: "logarea", Dir: true}}))
+
+		_, err = storage.Open(ctx, "testrun/logarea")
+		Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+		_, err = storage.List(ctx, "testrun/missing")
+		Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+	})
+})
+
+// startMinIO starts a MinIO server for the current spec, and creates a bucket in it. The spec is
+// skipped if there is no MinIO server binary.
+func startMinIO() (*minio.Client, string) {
+	server, err := logareatest.StartMinIO(context.Background(), GinkgoT().TempDir())
+	if errors.Is(err, logareatest.ErrNoMinIO) {
+		Skip(err.Error())
+	}
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(server.Stop)
+	client, err := server.Client()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(client.MakeBucket(context.Background(), "etos-logs", minio.MakeBucketOptions{})).To(Succeed())
+	return client, "etos-logs"
+}
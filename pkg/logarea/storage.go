@@ -0,0 +1,196 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package logarea
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// unknownSizePartSize is the size of the parts that files of unknown size are uploaded to an
+// object storage in. The default of the client buffers far too much memory for log files.
+const unknownSizePartSize = 16 * 1024 * 1024
+
+// Entry is a file or a directory in a log area.
+type Entry struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Dir  bool   `json:"dir"`
+}
+
+// Storage stores the files of log areas. Names are slash-separated paths without a leading slash.
+type Storage interface {
+	// Put stores a file. A size of -1 means that the size is unknown.
+	Put(ctx context.Context, name string, body io.Reader, size int64) error
+	// Open opens a file for reading. fs.ErrNotExist is returned if there is no file with the name.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// List lists the files and directories directly under a directory, sorted by name.
+	// fs.ErrNotExist is returned if the directory does not exist.
+	List(ctx context.Context, dir string) ([]Entry, error)
+}
+
+// DirectoryStorage stores the files of log areas in a directory.
+type DirectoryStorage struct {
+	root string
+}
+
+// NewDirectoryStorage creates a storage that stores files under a root directory.
+func NewDirectoryStorage(root string) *DirectoryStorage {
+	return &DirectoryStorage{root: root}
+}
+
+// path returns the path of a file in the root directory.
+func (d *DirectoryStorage) path(name string) string {
+	return filepath.Join(d.root, filepath.FromSlash(cleanPath(name)))
+}
+
+// Put stores a file, and creates the directories of it.
+func (d *DirectoryStorage) Put(_ context.Context, name string, body io.Reader, _ int64) error {
+	filePath := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+	// The file is written next to its destination and renamed when complete, so that a partial
+	// upload never replaces a file.
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint:errcheck
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close() // nolint:errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// Open opens a file for reading.
+func (d *DirectoryStorage) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	filePath := d.path(name)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fs.ErrNotExist
+	}
+	return os.Open(filePath)
+}
+
+// List lists the files and directories directly under a directory.
+func (d *DirectoryStorage) List(_ context.Context, dir string) ([]Entry, error) {
+	dirEntries, err := os.ReadDir(d.path(dir))
+	if err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	for _, dirEntry := range dirEntries {
+		if strings.HasPrefix(dirEntry.Name(), ".upload-") {
+			continue
+		}
+		if dirEntry.IsDir() {
+			entries = append(entries, Entry{Name: dirEntry.Name(), Dir: true})
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{Name: dirEntry.Name(), Size: info.Size()})
+	}
+	return entries, nil
+}
+
+// S3Storage stores the files of log areas as objects in a bucket of an S3-compatible object storage.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Storage creates a storage that stores files as objects in a bucket. The bucket must exist.
+func NewS3Storage(client *minio.Client, bucket string) *S3Storage {
+	return &S3Storage{client: client, bucket: bucket}
+}
+
+// Put uploads a file as an object.
+func (s *S3Storage) Put(ctx context.Context, name string, body io.Reader, size int64) error {
+	options := minio.PutObjectOptions{}
+	if size < 0 {
+		options.PartSize = unknownSizePartSize
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, cleanPath(name), body, size, options)
+	return err
+}
+
+// Open opens an object for reading.
+func (s *S3Storage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, cleanPath(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject does not request the object until it is read, so the object is checked for
+	// existence here instead.
+	if _, err := object.Stat(); err != nil {
+		object.Close() // nolint:errcheck
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, fs.ErrNotExist
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+// List lists the objects and prefixes directly under a prefix. Empty objects whose names end
+// with a slash are treated as markers of a prefix and are not listed.
+func (s *S3Storage) List(ctx context.Context, dir string) ([]Entry, error) {
+	prefix := cleanPath(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+	found := false
+	entries := []Entry{}
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		found = true
+		if object.Key == prefix {
+			continue
+		}
+		name := strings.TrimPrefix(object.Key, prefix)
+		if strings.HasSuffix(name, "/") {
+			entries = append(entries, Entry{Name: strings.TrimSuffix(name, "/"), Dir: true})
+			continue
+		}
+		entries = append(entries, Entry{Name: path.Base(name), Size: object.Size})
+	}
+	if !found {
+		return nil, fs.ErrNotExist
+	}
+	slices.SortFunc(entries, func(a, b Entry) int { return strings.Compare(a.Name, b.Name) })
+	return entries, nil
+}
@@ -0,0 +1,81 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logarea implements the ETOS log area server, which the ETR uploads logs to and which
+// users browse the logs of a testrun in.
+//
+// The server has these endpoints:
+//
+//	GET /logarea/v1alpha/selftest/ping      - Responds with 204 No Content when the server is up.
+//	PUT /logarea/v1alpha/upload/{path...}   - Store the request body as a file at path.
+//	GET /logarea/v1alpha/logarea/{path...}  - List the files under path, or download the file at path.
+//
+// Uploads use basic authentication where the password is a token, created with NewToken, of the
+// path that the uploader is allowed to write under. The username is not checked.
+//
+// Downloads are not authenticated, since users browse the logs through the live logs URLs of a
+// testrun. Access to the logs must be restricted in front of the server if they are not public.
+package logarea
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fernet/fernet-go"
+)
+
+// ErrInvalidToken is returned when a token cannot be verified, has expired or does not allow
+// writing to a path.
+var ErrInvalidToken = errors.New("invalid log area token")
+
+// NewToken creates a token that allows uploads of files below a path, in a log area server that
+// uses the same key.
+func NewToken(key *fernet.Key, logAreaPath string) (string, error) {
+	token, err := fernet.EncryptAndSign([]byte(cleanPath(logAreaPath)), key)
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+// VerifyToken verifies that a token allows uploads to a file path. The file must be below the
+// path of the token. A ttl of 0 means that tokens never expire.
+func VerifyToken(key *fernet.Key, token string, ttl time.Duration, uploadPath string) error {
+	allowed := fernet.VerifyAndDecrypt([]byte(token), ttl, []*fernet.Key{key})
+	if allowed == nil {
+		return ErrInvalidToken
+	}
+	if !isUnder(cleanPath(uploadPath), string(allowed)) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// cleanPath cleans a path and removes any leading slash, so that it cannot reach outside of the
+// storage of the server.
+func cleanPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// isUnder checks if a path is below a parent path.
+func isUnder(p, parent string) bool {
+	if parent == "" {
+		return false
+	}
+	return strings.HasPrefix(p, parent+"/")
+}
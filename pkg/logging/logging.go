@@ -20,9 +20,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/eiffel-community/etos/internal/messaging"
+	"github.com/eiffel-community/etos/pkg/events"
 	"github.com/eiffel-community/etos/pkg/opentelemetry"
+	"github.com/eiffel-community/etos/pkg/redact"
 	"github.com/go-logr/logr"
 	"go.opentelemetry.io/contrib/bridges/otelzap"
 	"go.opentelemetry.io/otel/trace"
@@ -42,15 +45,23 @@ func FromContextOrDiscard(ctx context.Context) logr.Logger {
 }
 
 type ETOSLogger struct {
-	logger   logr.Logger
-	opts     zap.Options
-	logcores []zapcore.Core
+	logger       logr.Logger
+	opts         zap.Options
+	logcores     []zapcore.Core
+	userLogLevel _zap.AtomicLevel
 }
 
 // New creates a new ETOSLogger with the provided zap.Options. It adds default values to the
 // options if they are not already set.
 func New(opts zap.Options) *ETOSLogger {
-	return &ETOSLogger{opts: addDefaults(opts)}
+	return &ETOSLogger{opts: addDefaults(opts), userLogLevel: _zap.NewAtomicLevelAt(_zap.DebugLevel)}
+}
+
+// SetUserLogLevel sets the minimum level of the log entries that are published as user logs.
+// All levels are published unless it is set.
+func (l *ETOSLogger) SetUserLogLevel(level zapcore.Level) *ETOSLogger {
+	l.userLogLevel.SetLevel(level)
+	return l
 }
 
 // WithOtel adds an OpenTelemetry core to the logger if the provided tracer has a LoggerProvider.
@@ -65,25 +76,27 @@ func (l *ETOSLogger) WithOtel(tracer *opentelemetry.ETOSTracer) *ETOSLogger {
 }
 
 // WithConsole adds a console core to the logger that writes to the destination writer specified in the options.
+// Secrets are redacted from the log entries, see the redact package.
 func (l *ETOSLogger) WithConsole() *ETOSLogger {
 	l.logcores = append(l.logcores, zapcore.NewCore(
 		l.opts.Encoder,
-		zapcore.AddSync(l.opts.DestWriter),
+		zapcore.AddSync(redact.Writer(l.opts.DestWriter)),
 		l.opts.Level,
 	))
 	return l
 }
 
 // WithUserLog adds a user log core to the logger that writes to the provided messaging.Publisher.
-// If the publisher is nil, it does not add the user log core.
+// If the publisher is nil, it does not add the user log core. Secrets are redacted from the log
+// entries before they are published, see the redact package.
 func (l *ETOSLogger) WithUserLog(publisher messaging.Publisher) *ETOSLogger {
 	if publisher == nil {
 		return l
 	}
 	l.logcores = append(l.logcores, zapcore.NewCore(
 		l.opts.Encoder,
-		zapcore.AddSync(newUserLogWriter(publisher)),
-		_zap.DebugLevel,
+		zapcore.AddSync(redact.Writer(newUserLogWriter(publisher))),
+		l.userLogLevel,
 	))
 	return l
 }
@@ -99,6 +112,26 @@ func (l *ETOSLogger) Start(ctx context.Context) context.Context {
 	return logr.NewContext(ctx, l.logger)
 }
 
+// ParseLevel parses the level of user logs, as in v1alpha1.UserLogLevel, I.e. "warning". The
+// levels of zap, I.e. "warn", are also accepted.
+func ParseLevel(level string) (zapcore.Level, error) {
+	if strings.EqualFold(level, "warning") {
+		return zapcore.WarnLevel, nil
+	}
+	return zapcore.ParseLevel(strings.ToLower(level))
+}
+
+// Redacted returns a copy of opts which redacts secrets from the log entries written to its
+// destination writer, for loggers that are not created with New. The destination writer defaults to
+// os.Stderr, as in zap.New.
+func Redacted(opts zap.Options) zap.Options {
+	if opts.DestWriter == nil {
+		opts.DestWriter = os.Stderr
+	}
+	opts.DestWriter = redact.Writer(opts.DestWriter)
+	return opts
+}
+
 // carrierFromContext extracts the trace context from the provided context and returns it as a
 // map[string]string.
 func carrierFromContext(ctx context.Context) map[string]string {
@@ -177,20 +210,13 @@ func newUserLogWriter(publisher messaging.Publisher) *userLogs {
 }
 
 type entry struct {
-	Message        string `json:"message"`
-	Level          string `json:"levelname"`
 	Identifier     string `json:"identifier"`
 	DisableUserLog bool   `json:"disableUserLog"`
 }
 
-type event struct {
-	Event string         `json:"event"`
-	Data  map[string]any `json:"data"`
-}
-
 // Write implements the io.Writer interface for userLogs. It unmarshals the log entry and
-// publishes it to the ETOS messagebus if it contains an identifier and is not disabled for
-// user logs.
+// publishes it to the ETOS messagebus as a message event if it contains an identifier and is not
+// disabled for user logs.
 func (u *userLogs) Write(p []byte) (n int, err error) {
 	e := entry{}
 	if err := json.Unmarshal(p, &e); err != nil {
@@ -203,22 +229,42 @@ func (u *userLogs) Write(p []byte) (n int, err error) {
 	if err != nil {
 		return 0, fmt.Errorf("failed to format log entry: %w", err)
 	}
-	routingKey := fmt.Sprintf("%s.message.%s", e.Identifier, e.Level)
-	if err := u.publisher.Publish(message, routingKey); err != nil {
+	if err := events.Publish(u.publisher, e.Identifier, message); err != nil {
 		return 0, fmt.Errorf("failed to publish log entry: %w", err)
 	}
 	return len(p), nil
 }
 
-// formatLog formats the log entry by unmarshaling it into a map and then marshaling it back
-// into JSON with an "event" field.
-func (u *userLogs) formatLog(p []byte) ([]byte, error) {
+// formatLog formats the log entry as a message event. The fields of the message event are taken
+// from the log entry and the rest of the values of the log entry are added to its fields.
+func (u *userLogs) formatLog(p []byte) (events.Message, error) {
 	data := map[string]any{}
 	if err := json.Unmarshal(p, &data); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal log entry into map: %w", err)
+		return events.Message{}, fmt.Errorf("failed to unmarshal log entry into map: %w", err)
+	}
+	take := func(key string) string {
+		value, ok := data[key]
+		if !ok {
+			return ""
+		}
+		delete(data, key)
+		if s, ok := value.(string); ok {
+			return s
+		}
+		return fmt.Sprint(value)
+	}
+	message := events.Message{
+		Message:    take("message"),
+		Level:      take("levelname"),
+		Timestamp:  take("@timestamp"),
+		Name:       take("name"),
+		Identifier: take("identifier"),
+	}
+	delete(data, "disableUserLog")
+	if len(data) > 0 {
+		message.Fields = data
 	}
-	event := event{Event: "message", Data: data}
-	return json.Marshal(event)
+	return message, nil
 }
 
 // shouldLog determines whether a log entry should be published to the ETOS messagebus.
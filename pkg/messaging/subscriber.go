@@ -0,0 +1,82 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/messaging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Filter selects messages on the ETOS message bus, in the format "identifier.type.meta", where the
+// identifier is the identifier of a TestRun and the type is the type of event, I.e. "message" for
+// user logs. Empty parts and "*" match any value.
+type Filter = messaging.Filter
+
+// Event is a message received from the ETOS message bus.
+type Event = messaging.Event
+
+// UserLog is the data of an event of the type "message", a log entry that is shown to users.
+type UserLog = messaging.UserLog
+
+// Subscriber receives events from the ETOS message bus.
+type Subscriber = messaging.Subscriber
+
+// SubscriberOptions configures a Subscriber.
+type SubscriberOptions = messaging.SubscriberOptions
+
+// OffsetSpecification is the position in the ETOS message bus that a subscription starts from.
+type OffsetSpecification = messaging.OffsetSpecification
+
+// OffsetNext starts a subscription from the next message published.
+func OffsetNext() OffsetSpecification {
+	return messaging.OffsetNext()
+}
+
+// OffsetFirst starts a subscription from the first message in the message bus.
+func OffsetFirst() OffsetSpecification {
+	return messaging.OffsetFirst()
+}
+
+// OffsetAt starts a subscription from the message at offset. Subscriptions are resumed from the
+// offset after the last Event received.
+func OffsetAt(offset int64) OffsetSpecification {
+	return messaging.OffsetAt(offset)
+}
+
+// OffsetTime starts a subscription from the first message published at or after t.
+func OffsetTime(t time.Time) OffsetSpecification {
+	return messaging.OffsetTime(t)
+}
+
+// NewSubscriber connects to the ETOS message bus with the message bus configuration of an
+// EnvironmentRequest or a Cluster, I.e. the EtosMessageBus of an EnvironmentRequest, and starts
+// receiving the events that match the filters of the options.
+//
+// The password of the message bus is read from namespace with cli, if it is set from a secret.
+// The subscriber must be closed when it is no longer used.
+func NewSubscriber(
+	ctx context.Context,
+	config v1alpha1.RabbitMQ,
+	cli client.Client,
+	namespace string,
+	options SubscriberOptions,
+) (Subscriber, error) {
+	return messaging.NewSubscriber(ctx, config, cli, namespace, options)
+}
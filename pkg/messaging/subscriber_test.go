@@ -0,0 +1,144 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package messaging_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	internal "github.com/eiffel-community/etos/internal/messaging"
+	"github.com/eiffel-community/etos/pkg/messaging"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Subscriber", func() {
+	var (
+		ctx    context.Context
+		config v1alpha1.RabbitMQ
+	)
+
+	// publish user logs to the file backend.
+	publish := func(messages ...string) {
+		publisher, err := internal.NewPublisher(ctx, config, nil, "default", internal.PublisherOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		for _, message := range messages {
+			data, err := json.Marshal(map[string]any{
+				"event": "message",
+				"data":  map[string]any{"message": message, "levelname": "info", "identifier": "testrun"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(publisher.Publish(data, "testrun.message.info")).To(Succeed())
+		}
+		Expect(publisher.Close()).To(Succeed())
+	}
+
+	// subscribe to the file backend.
+	subscribe := func(options messaging.SubscriberOptions) messaging.Subscriber {
+		subscriber, err := messaging.NewSubscriber(ctx, config, nil, "default", options)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(subscriber.Close)
+		return subscriber
+	}
+
+	// receive the user logs of n events from a subscriber.
+	receive := func(subscriber messaging.Subscriber, n int) []string {
+		var messages []string
+		for range n {
+			var event messaging.Event
+			Eventually(subscriber.Events()).Should(Receive(&event))
+			log, err := event.UserLog()
+			Expect(err).NotTo(HaveOccurred())
+			messages = append(messages, log.Message)
+		}
+		return messages
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = v1alpha1.RabbitMQ{
+			Backend: v1alpha1.MessageBusBackendFile,
+			Path:    filepath.Join(GinkgoT().TempDir(), "messages"),
+		}
+	})
+
+	It("should receive typed events from the first message", func() {
+		publish("first", "second")
+		subscriber := subscribe(messaging.SubscriberOptions{Offset: messaging.OffsetFirst()})
+		var event messaging.Event
+		Eventually(subscriber.Events()).Should(Receive(&event))
+		Expect(event.Offset).To(BeZero())
+		Expect(event.Type).To(Equal("message"))
+		Expect(event.Filter).To(Equal(messaging.Filter{Identifier: "testrun", Type: "message", Meta: "info"}))
+		Expect(event.UserLog()).To(Equal(messaging.UserLog{
+			Message:    "first",
+			Level:      "info",
+			Identifier: "testrun",
+		}))
+		Expect(receive(subscriber, 1)).To(Equal([]string{"second"}))
+	})
+
+	It("should only receive messages published after it was created by default", func() {
+		publish("before")
+		subscriber := subscribe(messaging.SubscriberOptions{})
+		publish("after")
+		Expect(receive(subscriber, 1)).To(Equal([]string{"after"}))
+		Consistently(subscriber.Events(), 200*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should resume from an offset", func() {
+		publish("first", "second", "third")
+		subscriber := subscribe(messaging.SubscriberOptions{Offset: messaging.OffsetAt(1)})
+		Expect(receive(subscriber, 2)).To(Equal([]string{"second", "third"}))
+	})
+
+	It("should resume from a timestamp", func() {
+		publish("before")
+		since := time.Now()
+		publish("after")
+		subscriber := subscribe(messaging.SubscriberOptions{Offset: messaging.OffsetTime(since)})
+		Expect(receive(subscriber, 1)).To(Equal([]string{"after"}))
+	})
+
+	It("should only receive messages that match its filters", func() {
+		publisher, err := internal.NewPublisher(ctx, config, nil, "default", internal.PublisherOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(publisher.Publish([]byte(`{"event":"message","data":{"message":"other"}}`), "other.message.info")).
+			To(Succeed())
+		Expect(publisher.Publish([]byte(`{"event":"message","data":{"message":"debug"}}`), "testrun.message.debug")).
+			To(Succeed())
+		Expect(publisher.Close()).To(Succeed())
+		publish("info")
+
+		subscriber := subscribe(messaging.SubscriberOptions{
+			Offset:  messaging.OffsetFirst(),
+			Filters: []messaging.Filter{{Identifier: "testrun", Type: "message", Meta: "info"}},
+		})
+		Expect(receive(subscriber, 1)).To(Equal([]string{"info"}))
+		Consistently(subscriber.Events(), 200*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should close the events channel when closed", func() {
+		subscriber := subscribe(messaging.SubscriberOptions{})
+		Expect(subscriber.Close()).To(Succeed())
+		Eventually(subscriber.Events()).Should(BeClosed())
+		Expect(subscriber.Err()).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,54 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package opentelemetry
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// Meter creates the metric instruments of a package. The instruments are exported once the global
+// meter provider has been set, I.e. by starting an ETOSTracer, and discarded otherwise.
+//
+// Instruments that fail to be created are replaced by no-op instruments, so that a metric that
+// cannot be exported never stops the program that records it.
+type Meter struct {
+	meter metric.Meter
+}
+
+// NewMeter creates a Meter with the meter of the global meter provider.
+func NewMeter(name string) Meter {
+	return Meter{meter: otel.Meter(name)}
+}
+
+// Int64Counter creates a counter instrument.
+func (m Meter) Int64Counter(name string, options ...metric.Int64CounterOption) metric.Int64Counter {
+	counter, err := m.meter.Int64Counter(name, options...)
+	if err != nil || counter == nil {
+		return noop.Int64Counter{}
+	}
+	return counter
+}
+
+// Float64Histogram creates a histogram instrument.
+func (m Meter) Float64Histogram(name string, options ...metric.Float64HistogramOption) metric.Float64Histogram {
+	histogram, err := m.meter.Float64Histogram(name, options...)
+	if err != nil || histogram == nil {
+		return noop.Float64Histogram{}
+	}
+	return histogram
+}
@@ -0,0 +1,65 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package opentelemetry_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/eiffel-community/etos/pkg/opentelemetry"
+)
+
+var _ = Describe("Meter", func() {
+	var reader *sdkmetric.ManualReader
+
+	BeforeEach(func() {
+		previous := otel.GetMeterProvider()
+		reader = sdkmetric.NewManualReader()
+		otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+		DeferCleanup(func() { otel.SetMeterProvider(previous) })
+	})
+
+	It("should export the instruments of the global meter provider", func() {
+		meter := opentelemetry.NewMeter("test")
+		meter.Int64Counter("etos.test.counter").Add(context.Background(), 2)
+		meter.Float64Histogram("etos.test.histogram").Record(context.Background(), 0.5)
+
+		var metrics metricdata.ResourceMetrics
+		Expect(reader.Collect(context.Background(), &metrics)).To(Succeed())
+		Expect(metrics.ScopeMetrics).To(HaveLen(1))
+		var names []string
+		for _, m := range metrics.ScopeMetrics[0].Metrics {
+			names = append(names, m.Name)
+		}
+		Expect(names).To(ConsistOf("etos.test.counter", "etos.test.histogram"))
+	})
+
+	It("should replace instruments that fail to be created with no-op instruments", func() {
+		meter := opentelemetry.NewMeter("test")
+		counter := meter.Int64Counter("not a valid name")
+		Expect(counter).NotTo(BeNil())
+		counter.Add(context.Background(), 1)
+
+		var metrics metricdata.ResourceMetrics
+		Expect(reader.Collect(context.Background(), &metrics)).To(Succeed())
+		Expect(metrics.ScopeMetrics).To(BeEmpty())
+	})
+})
@@ -25,10 +25,12 @@ import (
 	"github.com/go-logr/logr"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
@@ -40,6 +42,7 @@ type ETOSTracer struct {
 	Name           string
 	providerType   string
 	tracerProvider *trace.TracerProvider
+	meterProvider  *metric.MeterProvider
 	LoggerProvider *log.LoggerProvider
 }
 
@@ -56,7 +59,8 @@ func New(name, providerType string) *ETOSTracer {
 	}
 }
 
-// Start initializes the OpenTelemetry tracer provider and sets it as the global tracer provider.
+// Start initializes the OpenTelemetry tracer and meter providers and sets them as the global tracer
+// and meter providers.
 func (t *ETOSTracer) Start(ctx context.Context) error {
 	logger := logr.FromContextOrDiscard(ctx)
 	if !t.enabled {
@@ -90,9 +94,30 @@ func (t *ETOSTracer) Start(ctx context.Context) error {
 		propagation.TraceContext{},
 		propagation.Baggage{},
 	))
+	if err := t.meter(ctx, res); err != nil {
+		return err
+	}
 	return t.logger(ctx, res)
 }
 
+// meter initializes the OpenTelemetry meter provider and sets it as the global meter provider.
+//
+// Metrics are exported periodically, with the interval set in the OTEL_METRIC_EXPORT_INTERVAL
+// environment variable or every 60 seconds if it is not set.
+func (t *ETOSTracer) meter(ctx context.Context, res *resource.Resource) error {
+	exporter, err := otlpmetricgrpc.New(ctx, t.metricOpts(t.collectorHost)...)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to create OpenTelemetry gRPC metric exporter"))
+	}
+	meterProvider := metric.NewMeterProvider(
+		metric.WithResource(res),
+		metric.WithReader(metric.NewPeriodicReader(exporter)),
+	)
+	t.meterProvider = meterProvider
+	otel.SetMeterProvider(meterProvider)
+	return nil
+}
+
 // logger initializes the OpenTelemetry logger provider and sets it as the global logger provider.
 func (t *ETOSTracer) logger(ctx context.Context, res *resource.Resource) error {
 	exporter, err := otlploggrpc.New(ctx)
@@ -118,17 +143,7 @@ func (t *ETOSTracer) ContextFromEnvironmentRequest(
 	if !t.enabled {
 		return ctx
 	}
-	carrier := carrierFromEnvironmentRequest(environmentRequest)
-	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
-}
-
-// carrierFromEnvironmentRequest extracts the traceparent and baggage from the EnvironmentRequest
-// annotations and returns them as a map.
-func carrierFromEnvironmentRequest(environmentRequest *v1alpha1.EnvironmentRequest) map[string]string {
-	return map[string]string{
-		"traceparent": environmentRequest.Annotations["etos.eiffel-community.github.io/traceparent"],
-		"baggage":     environmentRequest.Annotations["etos.eiffel-community.github.io/baggage"],
-	}
+	return ContextFromAnnotations(ctx, environmentRequest.Annotations)
 }
 
 // Shutdown shuts down the tracer provider, flushing any remaining spans to the collector.
@@ -138,6 +153,7 @@ func (t *ETOSTracer) Shutdown(ctx context.Context) error {
 	}
 	return errors.Join(
 		t.tracerProvider.Shutdown(ctx),
+		t.meterProvider.Shutdown(ctx),
 		t.LoggerProvider.Shutdown(ctx),
 	)
 }
@@ -154,6 +170,19 @@ func (t *ETOSTracer) opts(collector string) []otlptracegrpc.Option {
 	return opts
 }
 
+// metricOpts returns the options for the OpenTelemetry gRPC metric exporter based on the
+// environment variables.
+func (t *ETOSTracer) metricOpts(collector string) []otlpmetricgrpc.Option {
+	var opts []otlpmetricgrpc.Option
+	opts = append(opts, otlpmetricgrpc.WithEndpointURL(collector))
+
+	insecure, isSet := os.LookupEnv("OTEL_EXPORTER_OTLP_INSECURE")
+	if isSet && insecure == "true" {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	return opts
+}
+
 // newOtelResource returns an OpenTelemetry resource with appropriate metadata for the provider.
 func (t *ETOSTracer) newOtelResource(ctx context.Context) (*resource.Resource, error) {
 	hostname, err := os.Hostname()
@@ -0,0 +1,119 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package opentelemetry
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The annotations that carry the trace context of an ETOS resource.
+const (
+	TraceparentAnnotation = "etos.eiffel-community.github.io/traceparent"
+	TracestateAnnotation  = "etos.eiffel-community.github.io/tracestate"
+	BaggageAnnotation     = "etos.eiffel-community.github.io/baggage"
+)
+
+// carrierKeys maps the keys of a W3C trace context carrier to the annotations and the environment
+// variables that carry them.
+var carrierKeys = []struct {
+	key        string
+	annotation string
+	env        string
+}{
+	{key: "traceparent", annotation: TraceparentAnnotation, env: "TRACEPARENT"},
+	{key: "tracestate", annotation: TracestateAnnotation, env: "TRACESTATE"},
+	{key: "baggage", annotation: BaggageAnnotation, env: "BAGGAGE"},
+}
+
+// HasTraceContext returns true if the annotations of a resource carry a trace context.
+func HasTraceContext(annotations map[string]string) bool {
+	return annotations[TraceparentAnnotation] != ""
+}
+
+// ContextFromAnnotations returns a copy of ctx with the trace context from the annotations of a
+// resource. If OpenTelemetry has not been started, ctx is returned without a trace context.
+func ContextFromAnnotations(ctx context.Context, annotations map[string]string) context.Context {
+	carrier := propagation.MapCarrier{}
+	for _, keys := range carrierKeys {
+		if value := annotations[keys.annotation]; value != "" {
+			carrier[keys.key] = value
+		}
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// ContextFromEnv returns a copy of ctx with the trace context from the TRACEPARENT, TRACESTATE and
+// BAGGAGE environment variables, which ETOS sets in the jobs it creates.
+func ContextFromEnv(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{}
+	for _, keys := range carrierKeys {
+		if value := os.Getenv(keys.env); value != "" {
+			carrier[keys.key] = value
+		}
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// InjectAnnotations sets the trace context annotations of a resource to the span context of ctx.
+// The annotations are left as they are if ctx has no span context.
+func InjectAnnotations(ctx context.Context, annotations map[string]string) {
+	for key, value := range inject(ctx) {
+		for _, keys := range carrierKeys {
+			if keys.key == key {
+				annotations[keys.annotation] = value
+			}
+		}
+	}
+}
+
+// InjectEnv sets the TRACEPARENT, TRACESTATE and BAGGAGE environment variables of a container to
+// the span context of ctx. The environment is left as it is if ctx has no span context.
+func InjectEnv(ctx context.Context, container *corev1.Container) {
+	for key, value := range inject(ctx) {
+		for _, keys := range carrierKeys {
+			if keys.key == key {
+				setEnv(container, keys.env, value)
+			}
+		}
+	}
+}
+
+// inject returns the trace context of ctx as a carrier, or nil if ctx has no span context.
+func inject(ctx context.Context) propagation.MapCarrier {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// setEnv sets an environment variable of a container, replacing it if it is already set.
+func setEnv(container *corev1.Container, name, value string) {
+	for i, env := range container.Env {
+		if env.Name == name {
+			container.Env[i] = corev1.EnvVar{Name: name, Value: value}
+			return
+		}
+	}
+	container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: value})
+}
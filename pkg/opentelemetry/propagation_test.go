@@ -0,0 +1,78 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package opentelemetry_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/eiffel-community/etos/pkg/opentelemetry"
+)
+
+var _ = Describe("Trace context propagation", func() {
+	const traceparent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+	BeforeEach(func() {
+		previous := otel.GetTextMapPropagator()
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		DeferCleanup(func() { otel.SetTextMapPropagator(previous) })
+	})
+
+	It("should continue the trace from the annotations of a resource", func() {
+		ctx := opentelemetry.ContextFromAnnotations(context.Background(), map[string]string{
+			opentelemetry.TraceparentAnnotation: traceparent,
+		})
+		spanContext := trace.SpanContextFromContext(ctx)
+		Expect(spanContext.IsValid()).To(BeTrue())
+		Expect(spanContext.TraceID().String()).To(Equal("0af7651916cd43dd8448eb211c80319c"))
+	})
+
+	It("should inject the span context into the environment of a container", func() {
+		ctx := opentelemetry.ContextFromAnnotations(context.Background(), map[string]string{
+			opentelemetry.TraceparentAnnotation: traceparent,
+		})
+		ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(ctx, "reconcile")
+		defer span.End()
+
+		container := corev1.Container{Env: []corev1.EnvVar{{Name: "TRACEPARENT", Value: traceparent}}}
+		opentelemetry.InjectEnv(ctx, &container)
+		Expect(container.Env).To(HaveLen(1))
+		Expect(container.Env[0].Value).To(HavePrefix("00-0af7651916cd43dd8448eb211c80319c-"))
+		Expect(container.Env[0].Value).NotTo(Equal(traceparent))
+	})
+
+	It("should leave the environment as it is without a span context", func() {
+		container := corev1.Container{Env: []corev1.EnvVar{{Name: "TRACEPARENT", Value: traceparent}}}
+		opentelemetry.InjectEnv(context.Background(), &container)
+		Expect(container.Env).To(Equal([]corev1.EnvVar{{Name: "TRACEPARENT", Value: traceparent}}))
+	})
+
+	It("should inject the span context into annotations", func() {
+		ctx := opentelemetry.ContextFromAnnotations(context.Background(), map[string]string{
+			opentelemetry.TraceparentAnnotation: traceparent,
+		})
+		annotations := map[string]string{}
+		opentelemetry.InjectAnnotations(ctx, annotations)
+		Expect(annotations).To(HaveKeyWithValue(opentelemetry.TraceparentAnnotation, traceparent))
+	})
+})
@@ -88,3 +88,51 @@ func ETOSLogAreaProviderLiveLogs(val string) attribute.KeyValue {
 func ETOSLogAreaProviderLogAreaUploadURL(val string) attribute.KeyValue {
 	return attribute.String("etos.provider.log_area.upload.url", val)
 }
+
+// ETOSProviderResource returns an attribute.String with the key
+// "etos.provider.resource" and the provided value.
+func ETOSProviderResource(val string) attribute.KeyValue {
+	return attribute.String("etos.provider.resource", val)
+}
+
+// ETOSControllerKind returns an attribute.String with the key
+// "etos.controller.kind" and the provided value.
+func ETOSControllerKind(val string) attribute.KeyValue {
+	return attribute.String("etos.controller.kind", val)
+}
+
+// ETOSControllerName returns an attribute.String with the key
+// "etos.controller.name" and the provided value.
+func ETOSControllerName(val string) attribute.KeyValue {
+	return attribute.String("etos.controller.name", val)
+}
+
+// ETOSControllerNamespace returns an attribute.String with the key
+// "etos.controller.namespace" and the provided value.
+func ETOSControllerNamespace(val string) attribute.KeyValue {
+	return attribute.String("etos.controller.namespace", val)
+}
+
+// ETOSControllerRequeueAfter returns an attribute.Float64 with the key
+// "etos.controller.requeue_after" and the provided value, in seconds.
+func ETOSControllerRequeueAfter(val float64) attribute.KeyValue {
+	return attribute.Float64("etos.controller.requeue_after", val)
+}
+
+// ETOSTestRunID returns an attribute.String with the key
+// "etos.testrun.id" and the provided value.
+func ETOSTestRunID(val string) attribute.KeyValue {
+	return attribute.String("etos.testrun.id", val)
+}
+
+// ETOSControllerReason returns an attribute.String with the key
+// "etos.controller.reason" and the provided value.
+func ETOSControllerReason(val string) attribute.KeyValue {
+	return attribute.String("etos.controller.reason", val)
+}
+
+// ETOSProviderType returns an attribute.String with the key
+// "etos.provider.type" and the provided value.
+func ETOSProviderType(val string) attribute.KeyValue {
+	return attribute.String("etos.provider.type", val)
+}
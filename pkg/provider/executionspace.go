@@ -17,11 +17,16 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/eiffel-community/etos/api/v1alpha1"
 	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/fernet/fernet-go"
 	"github.com/go-logr/logr"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -34,25 +39,14 @@ import (
 // This function panics on errors, propagating errors back to the controller that executed it.
 func RunExecutionSpaceProvider(provider Provider) {
 	params := ParseParameters()
-	params.providerType = "ExecutionSpace"
+	params.providerType = ProviderTypeExecutionSpace
 	params.amountFunc = GetIUTCount
-
-	ctx := context.TODO()
-	logger := params.logger.WithValues(
-		"providerType", params.providerType,
-		"environmentRequest", params.environmentRequestName,
-		"namespace", params.namespace,
-		"providerName", params.providerName,
-	)
-	ctx = logr.NewContext(ctx, logger)
-	if err := writeTerminationLog(ctx, runProvider, provider, params); err != nil {
-		panic(err)
-	}
+	run(provider, params)
 }
 
 // GetExecutionSpace gets an ExecutionSpace resource by name from Kubernetes.
 func GetExecutionSpace(ctx context.Context, name, namespace string) (*v1alpha2.ExecutionSpace, error) {
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +64,7 @@ func GetExecutionSpaces(
 	namespace string,
 ) (v1alpha2.ExecutionSpaceList, error) {
 	var executionSpaces v1alpha2.ExecutionSpaceList
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return executionSpaces, err
 	}
@@ -100,17 +94,22 @@ func CreateExecutionSpace(
 	var executionSpace v1alpha2.ExecutionSpace
 
 	logger.Info("Getting Kubernetes client")
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	labels := map[string]string{
 		"app.kubernetes.io/name":    "execution-space-provider",
 		"app.kubernetes.io/part-of": "etos",
+		// Also set by the webhook, but provisionedAmount must not depend on the webhook.
+		"etos.eiffel-community.github.io/environment-request-id": environmentrequest.Spec.ID,
 	}
 
 	spec.ProviderID = environmentrequest.Spec.Providers.ExecutionSpace.ID
 	spec.EnvironmentRequest = environmentrequest.Name
+	if spec.Lease == nil {
+		spec.Lease = leaseFor(environmentrequest)
+	}
 
 	var generateName string
 	if name == "" {
@@ -137,14 +136,156 @@ func CreateExecutionSpace(
 		Spec: spec,
 	}
 
-	return &executionSpace, cli.Create(ctx, &executionSpace)
+	if err := cli.Create(ctx, &executionSpace); err != nil {
+		return &executionSpace, err
+	}
+	recordCreated(ctx, ProviderTypeExecutionSpace)
+	return &executionSpace, nil
 }
 
 // DeleteExecutionSpace deletes an ExecutionSpace resource from Kubernetes.
 func DeleteExecutionSpace(ctx context.Context, executionSpace *v1alpha2.ExecutionSpace) error {
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return err
 	}
 	return cli.Delete(ctx, executionSpace)
 }
+
+// TestRunnerEnvironment returns the environment variables that an ETOS test runner requires in
+// order to communicate with ETOS and the message buses.
+//
+// Message bus passwords are encrypted using the encryption key of the EnvironmentRequest, the
+// test runner decrypts them using the same key. The environment also tells the test runner how to
+// log, see v1alpha1.EnvironmentRequestSpec.LogEnvironment.
+func TestRunnerEnvironment(
+	ctx context.Context,
+	environmentRequest *v1alpha1.EnvironmentRequest,
+) (map[string]string, error) {
+	cli, err := KubernetesClientFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := GetSecret(ctx, cli, &environmentRequest.Spec.Config.EncryptionKey, environmentRequest.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	encryptionKey, err := fernet.DecodeKey(string(key))
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	etosMessagebusPassword, err := getAndEncrypt(ctx,
+		cli, environmentRequest.Spec.Config.EtosMessageBus.Password,
+		environmentRequest.Namespace, encryptionKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+	eiffelMessagebusPassword, err := getAndEncrypt(ctx,
+		cli, environmentRequest.Spec.Config.EiffelMessageBus.Password,
+		environmentRequest.Namespace, encryptionKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+	environment := map[string]string{
+		"SOURCE_HOST":            hostname,
+		"ETOS_API":               environmentRequest.Spec.Config.EtosApi,
+		"ETR_VERSION":            environmentRequest.Spec.Providers.ExecutionSpace.TestRunner,
+		"ETOS_GRAPHQL_SERVER":    environmentRequest.Spec.Config.GraphQlServer,
+		"ETOS_RABBITMQ_EXCHANGE": environmentRequest.Spec.Config.EtosMessageBus.Exchange,
+		"ETOS_RABBITMQ_HOST":     environmentRequest.Spec.Config.EtosMessageBus.Host,
+		"ETOS_RABBITMQ_PASSWORD": string(etosMessagebusPassword),
+		"ETOS_RABBITMQ_PORT":     environmentRequest.Spec.Config.EtosMessageBus.Port,
+		"ETOS_RABBITMQ_USERNAME": environmentRequest.Spec.Config.EtosMessageBus.Username,
+		"ETOS_RABBITMQ_VHOST":    environmentRequest.Spec.Config.EtosMessageBus.Vhost,
+		"ETOS_RABBITMQ_SSL":      environmentRequest.Spec.Config.EtosMessageBus.SSL,
+		"RABBITMQ_EXCHANGE":      environmentRequest.Spec.Config.EiffelMessageBus.Exchange,
+		"RABBITMQ_HOST":          environmentRequest.Spec.Config.EiffelMessageBus.Host,
+		"RABBITMQ_PASSWORD":      string(eiffelMessagebusPassword),
+		"RABBITMQ_PORT":          environmentRequest.Spec.Config.EiffelMessageBus.Port,
+		"RABBITMQ_USERNAME":      environmentRequest.Spec.Config.EiffelMessageBus.Username,
+		"RABBITMQ_VHOST":         environmentRequest.Spec.Config.EiffelMessageBus.Vhost,
+		"RABBITMQ_SSL":           environmentRequest.Spec.Config.EiffelMessageBus.SSL,
+	}
+	for _, env := range environmentRequest.Spec.LogEnvironment() {
+		environment[env.Name] = env.Value
+	}
+	return environment, nil
+}
+
+// devDataset is the part of an EnvironmentRequest dataset that controls the ETR development mode.
+type devDataset struct {
+	Dev       *bool  `json:"dev,omitempty"`
+	ETRRepo   string `json:"ETR_REPO,omitempty"`
+	ETRBranch string `json:"ETR_BRANCH,omitempty"`
+}
+
+// TestRunnerDevEnvironment returns the environment variables that control the development mode
+// of the ETOS test runner.
+//
+// The ExecutionSpaceProviderConfig of the Provider is the default and each value can be overridden
+// by the dataset of the EnvironmentRequest using the keys 'dev', 'ETR_BRANCH' and 'ETR_REPO'.
+// A value that is not set in the dataset keeps the value from the Provider, a nil dataset
+// keeps all values from the Provider.
+func TestRunnerDevEnvironment(
+	executionSpaceProvider *v1alpha1.Provider,
+	environmentRequest *v1alpha1.EnvironmentRequest,
+) (map[string]string, error) {
+	var dev bool
+	var branch, repository string
+	if config := executionSpaceProvider.Spec.ExecutionSpaceProviderConfig; config != nil {
+		if config.Dev != "" {
+			var err error
+			if dev, err = strconv.ParseBool(config.Dev); err != nil {
+				return nil, fmt.Errorf("invalid dev value %q in provider %s: %w", config.Dev, executionSpaceProvider.Name, err)
+			}
+		}
+		branch = config.ETRBranch
+		repository = config.ETRRepository
+	}
+	if dataset := environmentRequest.Spec.Dataset; dataset != nil && len(dataset.Raw) > 0 {
+		ds := devDataset{}
+		if err := json.Unmarshal(dataset.Raw, &ds); err != nil {
+			return nil, fmt.Errorf("failed to parse dataset of EnvironmentRequest %s: %w", environmentRequest.Name, err)
+		}
+		if ds.Dev != nil {
+			dev = *ds.Dev
+		}
+		if ds.ETRBranch != "" {
+			branch = ds.ETRBranch
+		}
+		if ds.ETRRepo != "" {
+			repository = ds.ETRRepo
+		}
+	}
+	environment := map[string]string{}
+	if dev {
+		environment["DEV"] = "true"
+	}
+	if branch != "" {
+		environment["ETR_BRANCH"] = branch
+	}
+	if repository != "" {
+		environment["ETR_REPOSITORY"] = repository
+	}
+	return environment, nil
+}
+
+// getAndEncrypt gets a value from a Var struct and encrypts it using the provided Fernet key.
+func getAndEncrypt(
+	ctx context.Context, cli client.Client, s *v1alpha1.Var, namespace string, key *fernet.Key,
+) ([]byte, error) {
+	if s == nil {
+		return nil, errors.New("no value provided")
+	}
+	value, err := GetSecret(ctx, cli, s, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return fernet.EncryptAndSign(value, key)
+}
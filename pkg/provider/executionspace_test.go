@@ -0,0 +1,101 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+var _ = Describe("TestRunnerDevEnvironment", func() {
+	const namespace = "default"
+
+	devProvider := func(config *v1alpha1.ExecutionSpaceProviderConfig) *v1alpha1.Provider {
+		builder := providertest.NewProvider("execution-space-provider", namespace, "execution-space")
+		if config != nil {
+			builder = builder.WithExecutionSpaceProviderConfig(*config)
+		}
+		return builder.Build()
+	}
+	fromProvider := &v1alpha1.ExecutionSpaceProviderConfig{
+		Dev:           "true",
+		ETRBranch:     "provider-branch",
+		ETRRepository: "provider/etos",
+	}
+
+	DescribeTable("overrides",
+		func(config *v1alpha1.ExecutionSpaceProviderConfig, dataset *apiextensionsv1.JSON, expected map[string]string) {
+			environmentRequest := providertest.NewEnvironmentRequest("environment-request", namespace).Build()
+			environmentRequest.Spec.Dataset = dataset
+			environment, err := provider.TestRunnerDevEnvironment(devProvider(config), environmentRequest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(environment).To(Equal(expected))
+		},
+		Entry("no provider config and no dataset",
+			nil, nil,
+			map[string]string{},
+		),
+		Entry("provider config and a nil dataset",
+			fromProvider, nil,
+			map[string]string{"DEV": "true", "ETR_BRANCH": "provider-branch", "ETR_REPOSITORY": "provider/etos"},
+		),
+		Entry("provider config and an empty dataset",
+			fromProvider, &apiextensionsv1.JSON{},
+			map[string]string{"DEV": "true", "ETR_BRANCH": "provider-branch", "ETR_REPOSITORY": "provider/etos"},
+		),
+		Entry("provider config and a dataset without dev keys",
+			fromProvider, &apiextensionsv1.JSON{Raw: []byte(`{"other": "value"}`)},
+			map[string]string{"DEV": "true", "ETR_BRANCH": "provider-branch", "ETR_REPOSITORY": "provider/etos"},
+		),
+		Entry("dataset turning dev off",
+			fromProvider, &apiextensionsv1.JSON{Raw: []byte(`{"dev": false}`)},
+			map[string]string{"ETR_BRANCH": "provider-branch", "ETR_REPOSITORY": "provider/etos"},
+		),
+		Entry("dataset overriding the branch and repository",
+			fromProvider, &apiextensionsv1.JSON{Raw: []byte(`{"ETR_BRANCH": "branch", "ETR_REPO": "fork/etos"}`)},
+			map[string]string{"DEV": "true", "ETR_BRANCH": "branch", "ETR_REPOSITORY": "fork/etos"},
+		),
+		Entry("dataset turning dev on without provider config",
+			nil, &apiextensionsv1.JSON{Raw: []byte(`{"dev": true, "ETR_BRANCH": "branch"}`)},
+			map[string]string{"DEV": "true", "ETR_BRANCH": "branch"},
+		),
+		Entry("empty values in the dataset keeping the provider config",
+			fromProvider, &apiextensionsv1.JSON{Raw: []byte(`{"ETR_BRANCH": "", "ETR_REPO": ""}`)},
+			map[string]string{"DEV": "true", "ETR_BRANCH": "provider-branch", "ETR_REPOSITORY": "provider/etos"},
+		),
+	)
+
+	It("should fail on an invalid dev value in the provider config", func() {
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", namespace).Build()
+		_, err := provider.TestRunnerDevEnvironment(
+			devProvider(&v1alpha1.ExecutionSpaceProviderConfig{Dev: "maybe"}), environmentRequest,
+		)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail on a dataset that is not an object", func() {
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", namespace).
+			WithDataset([]byte(`["not", "an", "object"]`)).
+			Build()
+		_, err := provider.TestRunnerDevEnvironment(devProvider(fromProvider), environmentRequest)
+		Expect(err).To(HaveOccurred())
+	})
+})
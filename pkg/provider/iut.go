@@ -35,27 +35,14 @@ import (
 // This function panics on errors, propagating errors back to the controller that executed it.
 func RunIutProvider(provider Provider) {
 	params := ParseParameters()
-	params.providerType = "Iut"
-	params.amountFunc = func(_ context.Context, environmentRequest *v1alpha1.EnvironmentRequest) (int, error) {
-		return min(environmentRequest.Spec.MaximumAmount, environmentRequest.Spec.MinimumAmount), nil
-	}
-
-	ctx := context.TODO()
-	logger := params.logger.WithValues(
-		"providerType", params.providerType,
-		"environmentRequest", params.environmentRequestName,
-		"namespace", params.namespace,
-		"providerName", params.providerName,
-	)
-	ctx = logr.NewContext(ctx, logger)
-	if err := writeTerminationLog(ctx, runProvider, provider, params); err != nil {
-		panic(err)
-	}
+	params.providerType = ProviderTypeIut
+	params.amountFunc = GetIUTAmount
+	run(provider, params)
 }
 
 // GetIUT gets an IUT resource by name from Kubernetes.
 func GetIUT(ctx context.Context, name, namespace string) (*v1alpha2.Iut, error) {
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -66,6 +53,11 @@ func GetIUT(ctx context.Context, name, namespace string) (*v1alpha2.Iut, error)
 	return &iut, nil
 }
 
+// GetIUTAmount gets the number of IUTs to provision for an environmentRequest.
+func GetIUTAmount(_ context.Context, environmentRequest *v1alpha1.EnvironmentRequest) (int, error) {
+	return min(environmentRequest.Spec.MaximumAmount, environmentRequest.Spec.MinimumAmount), nil
+}
+
 // GetIUTCount gets the number of IUTs for an environmentRequest.
 func GetIUTCount(ctx context.Context, environmentRequest *v1alpha1.EnvironmentRequest) (int, error) {
 	iutList, err := GetIUTs(ctx, environmentRequest.Spec.ID, environmentRequest.Namespace)
@@ -78,7 +70,7 @@ func GetIUTCount(ctx context.Context, environmentRequest *v1alpha1.EnvironmentRe
 // GetIUTs fetches all IUTs for an environmentrequest from Kubernetes.
 func GetIUTs(ctx context.Context, environmentRequestID, namespace string) (v1alpha2.IutList, error) {
 	var iuts v1alpha2.IutList
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return iuts, err
 	}
@@ -108,19 +100,24 @@ func CreateIUT(
 	var iut v1alpha2.Iut
 
 	logger.Info("Getting Kubernetes client")
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	labels := map[string]string{
 		"app.kubernetes.io/name":    "iut-provider",
 		"app.kubernetes.io/part-of": "etos",
+		// Also set by the webhook, but provisionedAmount must not depend on the webhook.
+		"etos.eiffel-community.github.io/environment-request-id": environmentrequest.Spec.ID,
 	}
 
 	spec.ID = uuid.NewString()
 	spec.ProviderID = environmentrequest.Spec.Providers.IUT.ID
 	spec.Identity = environmentrequest.Spec.Identity
 	spec.EnvironmentRequest = environmentrequest.Name
+	if spec.Lease == nil {
+		spec.Lease = leaseFor(environmentrequest)
+	}
 
 	var generateName string
 	if name == "" {
@@ -147,12 +144,16 @@ func CreateIUT(
 		Spec: spec,
 	}
 
-	return &iut, cli.Create(ctx, &iut)
+	if err := cli.Create(ctx, &iut); err != nil {
+		return &iut, err
+	}
+	recordCreated(ctx, ProviderTypeIut)
+	return &iut, nil
 }
 
 // DeleteIUT deletes an IUT resource from Kubernetes.
 func DeleteIUT(ctx context.Context, iut *v1alpha2.Iut) error {
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,52 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// leaseFor returns the lease of the resources provisioned for an EnvironmentRequest, or nil if they
+// are not leased.
+func leaseFor(environmentrequest *v1alpha1.EnvironmentRequest) *v1alpha2.Lease {
+	duration := environmentrequest.Spec.Providers.LeaseDuration
+	if duration == nil {
+		return nil
+	}
+	return &v1alpha2.Lease{DurationSeconds: max(1, int64(duration.Seconds()))}
+}
+
+// RenewLease renews the lease of an Iut, ExecutionSpace or LogArea, keeping the controller from
+// releasing it. The user of a resource with a lease shall renew it regularly while the resource is in use.
+func RenewLease(ctx context.Context, obj client.Object) error {
+	cli, err := KubernetesClientFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[v1alpha2.LeaseRenewTimeAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	obj.SetAnnotations(annotations)
+	return cli.Patch(ctx, obj, patch)
+}
@@ -0,0 +1,93 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+var _ = Describe("Lease", func() {
+	It("should renew the lease of a resource", func() {
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", "default").
+			WithIutProvider("iut-provider").
+			Build()
+		cli := providertest.NewFakeClient(environmentRequest)
+		ctx := provider.WithKubernetesClient(context.Background(), cli)
+		iut, err := provider.CreateIUT(ctx, environmentRequest, "default", "iut", v1alpha2.IutSpec{
+			Lease: &v1alpha2.Lease{DurationSeconds: 60},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(provider.RenewLease(ctx, iut)).To(Succeed())
+		renewed := &v1alpha2.Iut{}
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(iut), renewed)).To(Succeed())
+		renewTime, err := time.Parse(time.RFC3339, renewed.Annotations[v1alpha2.LeaseRenewTimeAnnotation])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(renewTime).To(BeTemporally("~", time.Now(), 5*time.Second))
+		Expect(renewed.Spec.Lease).To(Equal(&v1alpha2.Lease{DurationSeconds: 60}))
+	})
+
+	It("should lease the resources for the lease duration of the EnvironmentRequest", func() {
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", "default").
+			WithIutProvider("iut-provider").
+			WithLogAreaProvider("log-area-provider").
+			WithExecutionSpaceProvider("execution-space-provider", "1.0.0").
+			Build()
+		environmentRequest.Spec.Providers.LeaseDuration = &metav1.Duration{Duration: 15 * time.Minute}
+		cli := providertest.NewFakeClient(environmentRequest)
+		ctx := provider.WithKubernetesClient(context.Background(), cli)
+
+		iut, err := provider.CreateIUT(ctx, environmentRequest, "default", "iut", v1alpha2.IutSpec{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(iut.Spec.Lease).To(Equal(&v1alpha2.Lease{DurationSeconds: 900}))
+		logArea, err := provider.CreateLogArea(ctx, environmentRequest, "default", "log-area", v1alpha2.LogAreaSpec{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logArea.Spec.Lease).To(Equal(&v1alpha2.Lease{DurationSeconds: 900}))
+		executionSpace, err := provider.CreateExecutionSpace(
+			ctx, environmentRequest, "default", "execution-space", v1alpha2.ExecutionSpaceSpec{},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(executionSpace.Spec.Lease).To(Equal(&v1alpha2.Lease{DurationSeconds: 900}))
+
+		By("keeping the lease set by the provider")
+		iut, err = provider.CreateIUT(ctx, environmentRequest, "default", "other-iut", v1alpha2.IutSpec{
+			Lease: &v1alpha2.Lease{DurationSeconds: 60},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(iut.Spec.Lease).To(Equal(&v1alpha2.Lease{DurationSeconds: 60}))
+	})
+
+	It("should not lease the resources when the EnvironmentRequest has no lease duration", func() {
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", "default").
+			WithIutProvider("iut-provider").
+			Build()
+		cli := providertest.NewFakeClient(environmentRequest)
+		ctx := provider.WithKubernetesClient(context.Background(), cli)
+		iut, err := provider.CreateIUT(ctx, environmentRequest, "default", "iut", v1alpha2.IutSpec{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(iut.Spec.Lease).To(BeNil())
+	})
+})
@@ -35,25 +35,14 @@ import (
 // This function panics on errors, propagating errors back to the controller that executed it.
 func RunLogAreaProvider(provider Provider) {
 	params := ParseParameters()
-	params.providerType = "LogArea"
+	params.providerType = ProviderTypeLogArea
 	params.amountFunc = GetIUTCount
-
-	ctx := context.TODO()
-	logger := params.logger.WithValues(
-		"providerType", params.providerType,
-		"environmentRequest", params.environmentRequestName,
-		"namespace", params.namespace,
-		"providerName", params.providerName,
-	)
-	ctx = logr.NewContext(ctx, logger)
-	if err := writeTerminationLog(ctx, runProvider, provider, params); err != nil {
-		panic(err)
-	}
+	run(provider, params)
 }
 
 // GetLogArea gets an LogArea resource by name from Kubernetes.
 func GetLogArea(ctx context.Context, name, namespace string) (*v1alpha2.LogArea, error) {
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +63,7 @@ func GetLogAreas(
 	environmentRequestID, namespace string,
 ) (v1alpha2.LogAreaList, error) {
 	var logAreas v1alpha2.LogAreaList
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return logAreas, err
 	}
@@ -106,18 +95,23 @@ func CreateLogArea(
 	var logArea v1alpha2.LogArea
 
 	logger.Info("Getting Kubernetes client")
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	labels := map[string]string{
 		"app.kubernetes.io/name":    "log-area-provider",
 		"app.kubernetes.io/part-of": "etos",
+		// Also set by the webhook, but provisionedAmount must not depend on the webhook.
+		"etos.eiffel-community.github.io/environment-request-id": environmentrequest.Spec.ID,
 	}
 
 	spec.ID = uuid.NewString()
 	spec.ProviderID = environmentrequest.Spec.Providers.LogArea.ID
 	spec.EnvironmentRequest = environmentrequest.Name
+	if spec.Lease == nil {
+		spec.Lease = leaseFor(environmentrequest)
+	}
 
 	var generateName string
 	if name == "" {
@@ -144,12 +138,16 @@ func CreateLogArea(
 		Spec: spec,
 	}
 
-	return &logArea, cli.Create(ctx, &logArea)
+	if err := cli.Create(ctx, &logArea); err != nil {
+		return &logArea, err
+	}
+	recordCreated(ctx, ProviderTypeLogArea)
+	return &logArea, nil
 }
 
 // DeleteLogArea deletes an LogArea resource from Kubernetes.
 func DeleteLogArea(ctx context.Context, logArea *v1alpha2.LogArea) error {
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,71 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/eiffel-community/etos/pkg/opentelemetry"
+	"github.com/eiffel-community/etos/pkg/opentelemetry/semconv"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// meter is the OpenTelemetry meter of the providers. Its instruments are exported once
+// StartTelemetry has been called.
+var meter = opentelemetry.NewMeter(tracerName)
+
+var (
+	// provisionDuration records how long the Provision function of a provider takes.
+	provisionDuration = meter.Float64Histogram(
+		"etos.provider.provision.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of the provisioning of resources by a provider"),
+	)
+	// createdResources counts the IUTs, execution spaces and log areas created by providers.
+	createdResources = meter.Int64Counter(
+		"etos.provider.resources.created",
+		metric.WithDescription("Number of IUTs, execution spaces and log areas created by providers"),
+	)
+	// releasedResources counts the calls to the Release function of a provider.
+	releasedResources = meter.Int64Counter(
+		"etos.provider.resources.released",
+		metric.WithDescription("Number of IUTs, execution spaces and log areas released by providers"),
+	)
+)
+
+// recordProvisioned records the duration and the conclusion of a call to Provision.
+func recordProvisioned(ctx context.Context, params Parameters, duration time.Duration, err error) {
+	result := Result(params.providerType, false, err)
+	provisionDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(
+		semconv.ETOSProviderType(params.providerType),
+		semconv.ETOSProviderConclusion(string(result.Conclusion)),
+	))
+}
+
+// recordCreated counts a resource created by a provider of a type, I.e. ProviderTypeIut.
+func recordCreated(ctx context.Context, providerType string) {
+	createdResources.Add(ctx, 1, metric.WithAttributes(semconv.ETOSProviderType(providerType)))
+}
+
+// recordReleased counts a call to Release and its conclusion.
+func recordReleased(ctx context.Context, params Parameters, err error) {
+	result := Result(params.providerType, true, err)
+	releasedResources.Add(ctx, 1, metric.WithAttributes(
+		semconv.ETOSProviderType(params.providerType),
+		semconv.ETOSProviderConclusion(string(result.Conclusion)),
+	))
+}
@@ -21,11 +21,19 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/eiffel-community/etos/api/v1alpha1"
 	"github.com/eiffel-community/etos/api/v1alpha2"
 	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/pkg/events"
+	"github.com/eiffel-community/etos/pkg/opentelemetry/semconv"
+	"github.com/eiffel-community/etos/pkg/redact"
+	"github.com/fernet/fernet-go"
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -42,18 +50,121 @@ var (
 	terminationLog = "/dev/termination-log"
 )
 
+// terminationLogSize is the size of the largest termination-log that Kubernetes keeps, longer
+// termination-logs are truncated.
+const terminationLogSize = 4096
+
+// clientKey is the context key for a Kubernetes client.
+type clientKey struct{}
+
+// The provider types, used in the result descriptions of the providers.
+const (
+	ProviderTypeIut            = "Iut"
+	ProviderTypeExecutionSpace = "ExecutionSpace"
+	ProviderTypeLogArea        = "LogArea"
+)
+
 type AmountFunc func(context.Context, *v1alpha1.EnvironmentRequest) (int, error)
 
+// GetAmountFunc gets the AmountFunc for a type of provider, I.e. ProviderTypeIut.
+//
+// IUT providers provision the amount requested in the EnvironmentRequest, all other providers
+// provision one resource for each IUT.
+func GetAmountFunc(providerType string) AmountFunc {
+	if providerType == ProviderTypeIut {
+		return GetIUTAmount
+	}
+	return GetIUTCount
+}
+
+// provisionedAmount counts the resources of a type that the provider of that type in an
+// EnvironmentRequest has already provisioned for it. Resources that are being deleted are not counted.
+func provisionedAmount(ctx context.Context, providerType string, environmentRequest *v1alpha1.EnvironmentRequest) (int, error) {
+	amount := 0
+	switch providerType {
+	case ProviderTypeIut:
+		iuts, err := GetIUTs(ctx, environmentRequest.Spec.ID, environmentRequest.Namespace)
+		if err != nil {
+			return 0, err
+		}
+		for _, iut := range iuts.Items {
+			if iut.Spec.ProviderID == environmentRequest.Spec.Providers.IUT.ID && iut.DeletionTimestamp.IsZero() {
+				amount++
+			}
+		}
+	case ProviderTypeLogArea:
+		logAreas, err := GetLogAreas(ctx, environmentRequest.Spec.ID, environmentRequest.Namespace)
+		if err != nil {
+			return 0, err
+		}
+		for _, logArea := range logAreas.Items {
+			if logArea.Spec.ProviderID == environmentRequest.Spec.Providers.LogArea.ID && logArea.DeletionTimestamp.IsZero() {
+				amount++
+			}
+		}
+	case ProviderTypeExecutionSpace:
+		executionSpaces, err := GetExecutionSpaces(ctx, environmentRequest.Spec.ID, environmentRequest.Namespace)
+		if err != nil {
+			return 0, err
+		}
+		for _, executionSpace := range executionSpaces.Items {
+			if executionSpace.Spec.ProviderID == environmentRequest.Spec.Providers.ExecutionSpace.ID &&
+				executionSpace.DeletionTimestamp.IsZero() {
+				amount++
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unknown provider type %q", providerType)
+	}
+	return amount, nil
+}
+
 type Parameters struct {
 	providerType           string
 	amountFunc             AmountFunc
 	environmentRequestName string
 	namespace              string
-	name                   string
+	names                  nameList
 	providerName           string
 	releaseEnvironment     bool
 	noDelete               bool
-	logger                 logr.Logger
+	healthcheck            bool
+	healthcheckTimeout     time.Duration
+	logOptions             zap.Options
+	// skipProvisioned makes a provision only provision the resources that the provider has not
+	// already provisioned for the EnvironmentRequest, which makes it safe to run it again.
+	skipProvisioned bool
+}
+
+// nameList is a flag that can be set several times, collecting each value.
+type nameList []string
+
+// String returns the names as a comma-separated list.
+func (n *nameList) String() string {
+	return strings.Join(*n, ",")
+}
+
+// Set adds a name to the list.
+func (n *nameList) Set(name string) error {
+	*n = append(*n, name)
+	return nil
+}
+
+// releaseError is returned when the release of one or more of several resources fails.
+type releaseError map[string]error
+
+// Error returns the errors of all resources that failed to release.
+func (e releaseError) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	messages := make([]string, 0, len(names))
+	for _, name := range names {
+		messages = append(messages, fmt.Sprintf("%s: %s", name, e[name]))
+	}
+	return strings.Join(messages, "; ")
 }
 
 type ProvisionConfig struct {
@@ -75,6 +186,16 @@ type Provider interface {
 	Release(ctx context.Context, cfg ReleaseConfig) error
 }
 
+// HealthChecker is an optional interface for a Provider to check its own health, I.e. that the
+// service it provides resources from can be reached.
+//
+// The health check is run when the provider is started with the -healthcheck flag, which ETOS
+// does for providers with the 'exec' health check protocol, and by the healthcheck endpoint of
+// the remote provider API.
+type HealthChecker interface {
+	Healthcheck(ctx context.Context) error
+}
+
 // init sets up the ETOS controller schemes as well as the default schemes from client-go.
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(Scheme))
@@ -92,28 +213,67 @@ func ParseParameters() Parameters {
 	flag.BoolVar(&params.releaseEnvironment, "release", false, "Release instead of creating")
 	flag.BoolVar(&params.noDelete, "nodelete", false, "Don't delete the resource")
 	flag.StringVar(&params.environmentRequestName, "environment-request", "", "The environment request to provision for.")
-	flag.StringVar(&params.name, "name", "", "The name of the resource to release.")
+	flag.Var(&params.names, "name", "The name of a resource to release, can be set several times to release several resources.")
 	flag.StringVar(&params.providerName, "provider", "", "The provider used to release.")
 	flag.StringVar(&params.namespace, "namespace", "", "The namespace of the environment request.")
+	flag.BoolVar(&params.healthcheck, "healthcheck", false, "Check the health of the provider instead of creating")
+	flag.DurationVar(&params.healthcheckTimeout, "healthcheck-timeout", 0, "The time that the health check is allowed to take.")
 	opts.BindFlags(flag.CommandLine)
+	BindTelemetryFlags(flag.CommandLine)
 	flag.Parse()
-	params.logger = zap.New(zap.UseFlagOptions(&opts))
+	params.logOptions = opts
 	return params
 }
 
 // WriteResult writes a job result JSON structure to the termination-log if running in a Kubernetes pod.
+//
+// The descriptions of the result are trimmed so that the result fits in the termination-log.
 func WriteResult(logger logr.Logger, result jobs.Result) error {
 	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
 		logger.Info("Provider is not running in a Kubernetes pod, won't write termination-log")
 		return nil
 	}
-	b, err := json.Marshal(result)
+	b, err := marshalResult(result)
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(terminationLog, b, os.ModePerm)
 }
 
+// marshalResult marshals a result to JSON that fits in the termination-log.
+//
+// Descriptions are trimmed, halving their length until the result fits. If the names of the failed
+// resources do not fit, even without descriptions, they are left out. A failed release without failed
+// resources has failed for all of its resources.
+func marshalResult(result jobs.Result) ([]byte, error) {
+	result.FailedResources = maps.Clone(result.FailedResources)
+	for limit := terminationLogSize; ; limit /= 2 {
+		b, err := json.Marshal(result)
+		if err != nil || len(b) <= terminationLogSize {
+			return b, err
+		}
+		if limit == 0 {
+			result.FailedResources = nil
+			return json.Marshal(result)
+		}
+		result.Description = trim(result.Description, limit)
+		for name, description := range result.FailedResources {
+			result.FailedResources[name] = trim(description, limit/len(result.FailedResources))
+		}
+	}
+}
+
+// trim shortens a description to at most size bytes.
+func trim(description string, size int) string {
+	if len(description) <= size {
+		return description
+	}
+	if size <= len("...") {
+		return ""
+	}
+	return strings.ToValidUTF8(description[:size-len("...")], "") + "..."
+}
+
 // SetKubernetesClient sets up a new Kubernetes client, typically used for special
 // use-cases I.e. adding custom configurations or for testing where a mock client
 // is used.
@@ -121,6 +281,24 @@ func SetKubernetesClient(c client.Client) {
 	cli = c
 }
 
+// WithKubernetesClient returns a copy of ctx which carries a Kubernetes client.
+//
+// All functions in this package that take a context use the client from the context, if there is one,
+// instead of the package-wide client. This makes it possible to run providers against different
+// clusters, I.e. in tests.
+func WithKubernetesClient(ctx context.Context, c client.Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+// KubernetesClientFromContext returns the Kubernetes client from the context, if there is one,
+// otherwise it returns the package-wide client from KubernetesClient.
+func KubernetesClientFromContext(ctx context.Context) (client.Client, error) {
+	if c, ok := ctx.Value(clientKey{}).(client.Client); ok && c != nil {
+		return c, nil
+	}
+	return KubernetesClient()
+}
+
 // KubernetesClient creates a new Kubernetes client or reuses an already created.
 func KubernetesClient() (client.Client, error) {
 	var err error
@@ -138,7 +316,7 @@ func EnvironmentRequest(
 	ctx context.Context,
 	environmentRequestName, namespace string,
 ) (*v1alpha1.EnvironmentRequest, error) {
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -155,7 +333,7 @@ func EnvironmentRequest(
 
 // GetProvider gets a provider from Kubernetes by name and namespace.
 func GetProvider(ctx context.Context, providerName, namespace string) (*v1alpha1.Provider, error) {
-	cli, err := KubernetesClient()
+	cli, err := KubernetesClientFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -170,11 +348,74 @@ func GetProvider(ctx context.Context, providerName, namespace string) (*v1alpha1
 	return &provider, nil
 }
 
+// GetSecret gets the value of a Var that holds a secret, I.e. a key or a password, and registers it
+// so that it is redacted from the logs of the provider.
+func GetSecret(ctx context.Context, cli client.Client, secret *v1alpha1.Var, namespace string) ([]byte, error) {
+	value, err := secret.Get(ctx, cli, namespace)
+	if err != nil {
+		return nil, err
+	}
+	redact.Register(string(value))
+	return value, nil
+}
+
+// Encrypt encrypts a value using the encryption key of an EnvironmentRequest.
+//
+// The encrypted value can be decrypted by the ETR, for example by using a '$decrypt' instruction
+// in the upload instructions of a LogArea.
+func Encrypt(ctx context.Context, environmentRequest *v1alpha1.EnvironmentRequest, value []byte) (string, error) {
+	cli, err := KubernetesClientFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	key, err := GetSecret(ctx, cli, &environmentRequest.Spec.Config.EncryptionKey, environmentRequest.Namespace)
+	if err != nil {
+		return "", err
+	}
+	encryptionKey, err := fernet.DecodeKey(string(key))
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := fernet.EncryptAndSign(value, encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	return string(encrypted), nil
+}
+
+// run runs a provider with a tracer and an ETOS logger, writing its result to the termination-log.
+//
+// This function panics on errors, propagating errors back to the controller that executed it.
+func run(provider Provider, params Parameters) {
+	ctx := context.Background()
+	var environmentRequest *v1alpha1.EnvironmentRequest
+	if params.environmentRequestName != "" && params.namespace != "" {
+		// Errors are returned by runProvider, which gets the EnvironmentRequest again.
+		environmentRequest, _ = EnvironmentRequest(ctx, params.environmentRequestName, params.namespace)
+	}
+	ctx, telemetry := StartTelemetry(ctx, params.logOptions, params.providerType, environmentRequest)
+	defer telemetry.Shutdown(ctx)
+
+	logger := logr.FromContextOrDiscard(ctx).WithValues(
+		"providerType", params.providerType,
+		"environmentRequest", params.environmentRequestName,
+		"namespace", params.namespace,
+		"providerName", params.providerName,
+	)
+	ctx = logr.NewContext(ctx, logger)
+	if err := writeTerminationLog(ctx, runProvider, provider, params); err != nil {
+		panic(err)
+	}
+}
+
 // runProvider runs a provider.
 //
 // If the releaseEnvironment parameter is set then it will run Release
 // If the releaseEnvironment parameter is not set then it will run Provision
 func runProvider(ctx context.Context, provider Provider, params Parameters) error {
+	if params.healthcheck {
+		return runHealthcheck(ctx, provider, params.healthcheckTimeout)
+	}
 	if params.releaseEnvironment {
 		return runReleaser(ctx, provider, params)
 	}
@@ -196,27 +437,134 @@ func runProvider(ctx context.Context, provider Provider, params Parameters) erro
 	if err != nil {
 		return err
 	}
-	return provider.Provision(ctx, ProvisionConfig{
+	if params.skipProvisioned {
+		provisioned, err := provisionedAmount(ctx, params.providerType, environmentRequest)
+		if err != nil {
+			return err
+		}
+		if provisioned > 0 {
+			logr.FromContextOrDiscard(ctx).Info("Resources have already been provisioned for the EnvironmentRequest",
+				"provisioned", provisioned, "minimumAmount", minimumAmount)
+		}
+		if provisioned >= minimumAmount {
+			return nil
+		}
+		minimumAmount -= provisioned
+	}
+	ctx, span := startSpan(ctx, "provision", params,
+		semconv.ETOSProviderMinimumAmount(minimumAmount),
+		semconv.ETOSProviderMaximumAmount(environmentRequest.Spec.MaximumAmount),
+	)
+	start := time.Now()
+	err = provider.Provision(ctx, ProvisionConfig{
 		EnvironmentRequest: environmentRequest,
 		Namespace:          params.namespace,
 		MaximumAmount:      environmentRequest.Spec.MaximumAmount,
 		MinimumAmount:      minimumAmount,
 	})
+	recordProvisioned(ctx, params, time.Since(start), err)
+	endSpan(span, params, err)
+	result := Result(params.providerType, false, err)
+	PublishEvent(ctx, events.StatusChanged{
+		Kind:    params.providerType,
+		Name:    params.environmentRequestName,
+		Status:  string(result.Conclusion),
+		Reason:  "Provision",
+		Message: result.Description,
+	})
+	return err
 }
 
-// runReleaser runs the provision.Release function
+// runReleaser runs the provision.Release function for each resource to release.
+//
+// When several resources are released, all of them are released even if some of them fail, and the
+// failures are returned in a releaseError.
 func runReleaser(ctx context.Context, provider Provider, params Parameters) error {
 	if params.namespace == "" {
 		return errors.New("must set -namespace")
 	}
-	if params.name == "" {
+	if len(params.names) == 0 {
 		return errors.New("must set -name")
 	}
-	return provider.Release(ctx, ReleaseConfig{
-		Name:      params.name,
+	if len(params.names) == 1 {
+		return release(ctx, provider, params, params.names[0])
+	}
+	failed := releaseError{}
+	for _, name := range params.names {
+		if err := release(ctx, provider, params, name); err != nil {
+			failed[name] = err
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// release runs the provision.Release function for a single resource, in a span of its own.
+func release(ctx context.Context, provider Provider, params Parameters, name string) error {
+	ctx, span := startSpan(ctx, "release", params, semconv.ETOSProviderResource(name))
+	err := provider.Release(ctx, ReleaseConfig{
+		Name:      name,
 		Namespace: params.namespace,
 		NoDelete:  params.noDelete,
 	})
+	recordReleased(ctx, params, err)
+	endSpan(span, params, err)
+	if err == nil {
+		PublishEvent(ctx, events.ResourceReleased{Kind: params.providerType, Name: name, Provider: params.providerName})
+	}
+	return err
+}
+
+// runHealthcheck checks the health of a provider, if it implements HealthChecker. The check is
+// canceled after the timeout, if it is set.
+func runHealthcheck(ctx context.Context, provider Provider, timeout time.Duration) error {
+	checker, ok := provider.(HealthChecker)
+	if !ok {
+		return nil
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return checker.Healthcheck(ctx)
+}
+
+// Result creates the result of a provider run, as written to the termination-log.
+//
+// The error is the error returned from Provision or Release, release tells whether it was a
+// Release and providerType is the type of provider that was run, I.e. ProviderTypeIut.
+func Result(providerType string, release bool, err error) jobs.Result {
+	if err != nil {
+		result := jobs.Result{
+			Conclusion:  jobs.ConclusionFailed,
+			Description: err.Error(),
+			Verdict:     jobs.VerdictNone,
+		}
+		var failed releaseError
+		if errors.As(err, &failed) {
+			// The errors are described per resource, they are not repeated in the description.
+			result.Description = fmt.Sprintf("Failed to release %d %s resources", len(failed), providerType)
+			result.FailedResources = make(map[string]string, len(failed))
+			for name, err := range failed {
+				result.FailedResources[name] = err.Error()
+			}
+		}
+		return result
+	}
+	var successMessage string
+	if release {
+		successMessage = fmt.Sprintf("Successfully released %s", providerType)
+	} else {
+		successMessage = fmt.Sprintf("Successfully provisioned %s", providerType)
+	}
+	return jobs.Result{
+		Conclusion:  jobs.ConclusionSuccessful,
+		Description: successMessage,
+		Verdict:     jobs.VerdictNone,
+	}
 }
 
 // writeTerminationLog will run a function and will write the result into a termination log.
@@ -226,32 +574,20 @@ func writeTerminationLog(
 	provider Provider,
 	params Parameters,
 ) error {
+	logger := logr.FromContextOrDiscard(ctx)
 	err := run(ctx, provider, params)
-
+	result := Result(params.providerType, params.releaseEnvironment, err)
+	if params.healthcheck && err == nil {
+		result.Description = fmt.Sprintf("%s provider is healthy", params.providerType)
+	}
 	if err != nil {
-		if writeErr := WriteResult(params.logger,
-			jobs.Result{
-				Conclusion:  jobs.ConclusionFailed,
-				Description: err.Error(),
-				Verdict:     jobs.VerdictNone,
-			}); writeErr != nil {
-			params.logger.Error(writeErr, "failed to write error result to termination-log")
+		if writeErr := WriteResult(logger, result); writeErr != nil {
+			logger.Error(writeErr, "failed to write error result to termination-log")
 		}
 		return err
 	}
-	var successMessage string
-	if params.releaseEnvironment {
-		successMessage = fmt.Sprintf("Successfully released %s", params.providerType)
-	} else {
-		successMessage = fmt.Sprintf("Successfully provisioned %s", params.providerType)
-	}
-	if err := WriteResult(params.logger,
-		jobs.Result{
-			Conclusion:  jobs.ConclusionSuccessful,
-			Description: successMessage,
-			Verdict:     jobs.VerdictNone,
-		}); err != nil {
-		params.logger.Error(err, "failed to write error result to termination-log")
+	if err := WriteResult(logger, result); err != nil {
+		logger.Error(err, "failed to write error result to termination-log")
 		return err
 	}
 	return nil
@@ -0,0 +1,139 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+)
+
+// releaseProvider is a provider that records the resources it releases, and fails to release
+// the resources in failing.
+type releaseProvider struct {
+	released []string
+	failing  map[string]error
+}
+
+func (p *releaseProvider) Provision(context.Context, ProvisionConfig) error {
+	return nil
+}
+
+func (p *releaseProvider) Release(_ context.Context, cfg ReleaseConfig) error {
+	if err, ok := p.failing[cfg.Name]; ok {
+		return err
+	}
+	p.released = append(p.released, cfg.Name)
+	return nil
+}
+
+var _ = Describe("Releaser", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("should release all resources and report the ones that failed", func() {
+		provider := &releaseProvider{failing: map[string]error{"iut-b": errors.New("iut is busy")}}
+		err := runReleaser(ctx, provider, Parameters{
+			providerType: ProviderTypeIut,
+			namespace:    "default",
+			names:        nameList{"iut-a", "iut-b", "iut-c"},
+		})
+		Expect(provider.released).To(Equal([]string{"iut-a", "iut-c"}))
+		var failed releaseError
+		Expect(errors.As(err, &failed)).To(BeTrue())
+		Expect(failed).To(HaveLen(1))
+		Expect(failed).To(HaveKey("iut-b"))
+
+		result := Result(ProviderTypeIut, true, err)
+		Expect(result.Conclusion).To(Equal(jobs.ConclusionFailed))
+		Expect(result.Description).To(Equal("Failed to release 1 Iut resources"))
+		Expect(result.FailedResources).To(Equal(map[string]string{"iut-b": "iut is busy"}))
+	})
+
+	It("should return the error of a single resource as is", func() {
+		provider := &releaseProvider{failing: map[string]error{"iut-a": errors.New("iut is busy")}}
+		err := runReleaser(ctx, provider, Parameters{
+			providerType: ProviderTypeIut,
+			namespace:    "default",
+			names:        nameList{"iut-a"},
+		})
+		Expect(err).To(MatchError("iut is busy"))
+		Expect(Result(ProviderTypeIut, true, err).FailedResources).To(BeEmpty())
+	})
+
+	It("should require a namespace and a name", func() {
+		Expect(runReleaser(ctx, &releaseProvider{}, Parameters{names: nameList{"iut-a"}})).To(MatchError("must set -namespace"))
+		Expect(runReleaser(ctx, &releaseProvider{}, Parameters{namespace: "default"})).To(MatchError("must set -name"))
+	})
+})
+
+var _ = Describe("Termination-log", func() {
+	// failedBatch returns the result of a batch release where every resource failed.
+	failedBatch := func(resources, descriptionSize int) jobs.Result {
+		failed := releaseError{}
+		for i := range resources {
+			failed[fmt.Sprintf("iut-%03d", i)] = errors.New(strings.Repeat("x", descriptionSize))
+		}
+		return Result(ProviderTypeIut, true, failed)
+	}
+
+	It("should not change a result that fits", func() {
+		result := failedBatch(3, 100)
+		b, err := marshalResult(result)
+		Expect(err).NotTo(HaveOccurred())
+		var written jobs.Result
+		Expect(json.Unmarshal(b, &written)).To(Succeed())
+		Expect(written).To(Equal(result))
+	})
+
+	It("should trim the descriptions of a large failed batch and keep every failed resource", func() {
+		result := failedBatch(50, 500)
+		b, err := marshalResult(result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(b)).To(BeNumerically("<=", terminationLogSize))
+
+		var written jobs.Result
+		Expect(json.Unmarshal(b, &written)).To(Succeed())
+		Expect(written.Conclusion).To(Equal(jobs.ConclusionFailed))
+		Expect(written.FailedResources).To(HaveLen(50))
+		for name, description := range written.FailedResources {
+			Expect(result.FailedResources).To(HaveKey(name))
+			Expect(description).To(HaveSuffix("..."))
+		}
+		Expect(result.FailedResources["iut-000"]).To(HaveLen(500), "the result shall not be modified")
+	})
+
+	It("should leave out failed resources whose names do not fit", func() {
+		b, err := marshalResult(failedBatch(1000, 10))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(b)).To(BeNumerically("<=", terminationLogSize))
+
+		var written jobs.Result
+		Expect(json.Unmarshal(b, &written)).To(Succeed())
+		Expect(written.Conclusion).To(Equal(jobs.ConclusionFailed))
+		Expect(written.FailedResources).To(BeEmpty())
+	})
+})
@@ -0,0 +1,176 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package providertest
+
+import (
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/controller/status"
+	"github.com/google/uuid"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// EnvironmentRequestBuilder builds EnvironmentRequests for provider tests.
+type EnvironmentRequestBuilder struct {
+	environmentRequest *v1alpha1.EnvironmentRequest
+}
+
+// NewEnvironmentRequest creates a builder for an EnvironmentRequest, requesting one of each resource.
+func NewEnvironmentRequest(name, namespace string) *EnvironmentRequestBuilder {
+	id := uuid.NewString()
+	return &EnvironmentRequestBuilder{
+		environmentRequest: &v1alpha1.EnvironmentRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				UID:       types.UID(uuid.NewString()),
+			},
+			Spec: v1alpha1.EnvironmentRequestSpec{
+				ID:            id,
+				Name:          name,
+				Identity:      "pkg:testing/etos",
+				MinimumAmount: 1,
+				MaximumAmount: 1,
+				Splitter:      v1alpha1.Splitter{Tests: []v1alpha1.Test{}},
+			},
+		},
+	}
+}
+
+// WithAmount sets the minimum and maximum amount of resources to request.
+func (b *EnvironmentRequestBuilder) WithAmount(minimum, maximum int) *EnvironmentRequestBuilder {
+	b.environmentRequest.Spec.MinimumAmount = minimum
+	b.environmentRequest.Spec.MaximumAmount = maximum
+	return b
+}
+
+// WithIdentity sets the identity, a purl, of the artifact under test.
+func (b *EnvironmentRequestBuilder) WithIdentity(identity string) *EnvironmentRequestBuilder {
+	b.environmentRequest.Spec.Identity = identity
+	return b
+}
+
+// WithIutProvider sets the name of the Provider to use for IUTs.
+func (b *EnvironmentRequestBuilder) WithIutProvider(name string) *EnvironmentRequestBuilder {
+	b.environmentRequest.Spec.Providers.IUT.ID = name
+	return b
+}
+
+// WithExecutionSpaceProvider sets the name of the Provider to use for execution spaces
+// as well as the test runner to run in them.
+func (b *EnvironmentRequestBuilder) WithExecutionSpaceProvider(name, testRunner string) *EnvironmentRequestBuilder {
+	b.environmentRequest.Spec.Providers.ExecutionSpace.ID = name
+	b.environmentRequest.Spec.Providers.ExecutionSpace.TestRunner = testRunner
+	return b
+}
+
+// WithLogAreaProvider sets the name of the Provider to use for log areas.
+func (b *EnvironmentRequestBuilder) WithLogAreaProvider(name string) *EnvironmentRequestBuilder {
+	b.environmentRequest.Spec.Providers.LogArea.ID = name
+	return b
+}
+
+// WithDataset sets the dataset, as raw JSON, of the EnvironmentRequest.
+func (b *EnvironmentRequestBuilder) WithDataset(dataset []byte) *EnvironmentRequestBuilder {
+	b.environmentRequest.Spec.Dataset = &apiextensionsv1.JSON{Raw: dataset}
+	return b
+}
+
+// WithEncryptionKey sets the encryption key used when encrypting values for the ETR.
+func (b *EnvironmentRequestBuilder) WithEncryptionKey(key v1alpha1.Var) *EnvironmentRequestBuilder {
+	b.environmentRequest.Spec.Config.EncryptionKey = key
+	return b
+}
+
+// Build returns a copy of the EnvironmentRequest.
+func (b *EnvironmentRequestBuilder) Build() *v1alpha1.EnvironmentRequest {
+	return b.environmentRequest.DeepCopy()
+}
+
+// ProviderBuilder builds Providers for provider tests.
+type ProviderBuilder struct {
+	provider *v1alpha1.Provider
+}
+
+// NewProvider creates a builder for a Provider of a type, I.e. "iut", "execution-space" or "log-area".
+func NewProvider(name, namespace, providerType string) *ProviderBuilder {
+	return &ProviderBuilder{
+		provider: &v1alpha1.Provider{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Spec: v1alpha1.ProviderSpec{
+				Type: providerType,
+			},
+		},
+	}
+}
+
+// WithImage sets the image that runs the provider.
+func (b *ProviderBuilder) WithImage(image string) *ProviderBuilder {
+	b.provider.Spec.Image = image
+	return b
+}
+
+// WithIutProviderConfig sets the custom configuration, as raw JSON, of an IUT provider.
+func (b *ProviderBuilder) WithIutProviderConfig(custom []byte) *ProviderBuilder {
+	b.provider.Spec.IutProviderConfig = &v1alpha1.IutProviderConfig{
+		Custom: apiextensionsv1.JSON{Raw: custom},
+	}
+	return b
+}
+
+// WithExecutionSpaceProviderConfig sets the configuration of an execution space provider.
+func (b *ProviderBuilder) WithExecutionSpaceProviderConfig(
+	config v1alpha1.ExecutionSpaceProviderConfig,
+) *ProviderBuilder {
+	b.provider.Spec.ExecutionSpaceProviderConfig = &config
+	return b
+}
+
+// WithLogAreaProviderConfig sets the configuration of a log area provider.
+func (b *ProviderBuilder) WithLogAreaProviderConfig(config v1alpha1.LogAreaProviderConfig) *ProviderBuilder {
+	b.provider.Spec.LogAreaProviderConfig = &config
+	return b
+}
+
+// WithAvailable sets the 'Available' condition of the Provider, as if its health check has passed.
+func (b *ProviderBuilder) WithAvailable() *ProviderBuilder {
+	b.provider.Status.Conditions = append(b.provider.Status.Conditions, metav1.Condition{
+		Type:               status.StatusAvailable,
+		Status:             metav1.ConditionTrue,
+		Reason:             status.ReasonActive,
+		LastTransitionTime: metav1.Now(),
+	})
+	return b
+}
+
+// WithCapacity sets the capacity that the Provider has advertised.
+func (b *ProviderBuilder) WithCapacity(total, available int) *ProviderBuilder {
+	b.provider.Status.Capacity = &v1alpha1.ProviderCapacity{
+		Total:     total,
+		Available: available,
+		Reserved:  total - available,
+	}
+	return b
+}
+
+// Build returns a copy of the Provider.
+func (b *ProviderBuilder) Build() *v1alpha1.Provider {
+	return b.provider.DeepCopy()
+}
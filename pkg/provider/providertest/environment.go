@@ -0,0 +1,130 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package providertest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	etos "github.com/eiffel-community/etos"
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/pkg/provider"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// Environment is a Kubernetes API server, started with envtest, that has the ETOS
+// CustomResourceDefinitions installed.
+type Environment struct {
+	// BinaryAssetsDirectory is the directory of the envtest binaries. If empty, the
+	// KUBEBUILDER_ASSETS environment variable is used. Run 'make setup-envtest' to download them.
+	BinaryAssetsDirectory string
+
+	Config *rest.Config
+	Client client.Client
+
+	testEnv *envtest.Environment
+}
+
+// Start starts the Kubernetes API server and creates a client for it.
+func (e *Environment) Start() error {
+	crds, err := CRDs()
+	if err != nil {
+		return err
+	}
+	e.testEnv = &envtest.Environment{
+		CRDInstallOptions: envtest.CRDInstallOptions{
+			CRDs: crds,
+		},
+		BinaryAssetsDirectory: e.BinaryAssetsDirectory,
+	}
+	e.Config, err = e.testEnv.Start()
+	if err != nil {
+		return err
+	}
+	e.Client, err = client.New(e.Config, client.Options{Scheme: provider.Scheme})
+	if err != nil {
+		return errors.Join(err, e.testEnv.Stop())
+	}
+	return nil
+}
+
+// Stop stops the Kubernetes API server.
+func (e *Environment) Stop() error {
+	if e.testEnv == nil {
+		return nil
+	}
+	return e.testEnv.Stop()
+}
+
+// CRDs loads the ETOS CustomResourceDefinitions.
+func CRDs() ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	paths, err := fs.Glob(etos.CRDs, "config/crd/bases/*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	var crds []*apiextensionsv1.CustomResourceDefinition
+	for _, path := range paths {
+		file, err := etos.CRDs.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+		for {
+			crd := &apiextensionsv1.CustomResourceDefinition{}
+			if err = decoder.Decode(crd); err != nil {
+				break
+			}
+			if crd.Name == "" {
+				continue
+			}
+			crds = append(crds, crd)
+		}
+		if closeErr := file.Close(); closeErr != nil {
+			return nil, closeErr
+		}
+		if !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+	}
+	return crds, nil
+}
+
+// NewFakeClient creates a fake Kubernetes client, with the ETOS schemes, that holds the objects.
+//
+// The fake client does not run any webhooks nor validations and is the quicker alternative to
+// an Environment when testing providers.
+func NewFakeClient(objects ...client.Object) client.Client {
+	return fake.NewClientBuilder().
+		WithScheme(provider.Scheme).
+		WithObjects(objects...).
+		WithStatusSubresource(
+			&v1alpha1.EnvironmentRequest{},
+			&v1alpha1.Environment{},
+			&v1alpha1.Provider{},
+			&v1alpha2.Iut{},
+			&v1alpha2.ExecutionSpace{},
+			&v1alpha2.LogArea{},
+		).
+		Build()
+}
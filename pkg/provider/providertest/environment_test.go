@@ -0,0 +1,86 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package providertest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/pkg/provider"
+)
+
+var _ = Describe("Environment", Ordered, func() {
+	const namespace = "default"
+	var env *Environment
+
+	BeforeAll(func() {
+		env = &Environment{BinaryAssetsDirectory: envTestBinaryDir()}
+		if os.Getenv("KUBEBUILDER_ASSETS") == "" && env.BinaryAssetsDirectory == "" {
+			Skip("the envtest binaries are missing, run 'make setup-envtest' to download them")
+		}
+		Expect(env.Start()).To(Succeed())
+		DeferCleanup(env.Stop)
+	})
+
+	It("should provision and release with a provider against the Kubernetes API server", func() {
+		ctx := context.Background()
+		environmentRequest := NewEnvironmentRequest("environment-request", namespace).
+			WithAmount(2, 2).
+			WithIutProvider("iut-provider").
+			Build()
+		Expect(env.Client.Create(ctx, environmentRequest)).To(Succeed())
+		Expect(env.Client.Create(ctx, NewProvider("iut-provider", namespace, "iut").Build())).To(Succeed())
+		runner := Runner{Client: env.Client, ProviderType: provider.ProviderTypeIut}
+
+		result, err := runner.Provision(ctx, IutProvider{}, environmentRequest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Conclusion).To(Equal(jobs.ConclusionSuccessful))
+		var iuts v1alpha2.IutList
+		Expect(env.Client.List(ctx, &iuts, client.InNamespace(namespace))).To(Succeed())
+		Expect(iuts.Items).To(HaveLen(2))
+
+		for _, iut := range iuts.Items {
+			result, err = runner.Release(ctx, IutProvider{}, provider.ReleaseConfig{Name: iut.Name, Namespace: namespace})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Conclusion).To(Equal(jobs.ConclusionSuccessful))
+		}
+		Expect(env.Client.List(ctx, &iuts, client.InNamespace(namespace))).To(Succeed())
+		Expect(iuts.Items).To(BeEmpty())
+	})
+})
+
+// envTestBinaryDir returns the first directory of envtest binaries downloaded by
+// 'make setup-envtest', or an empty string if there is none.
+func envTestBinaryDir() string {
+	basePath := filepath.Join("..", "..", "..", "bin", "k8s")
+	entries, err := os.ReadDir(basePath)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return filepath.Join(basePath, entry.Name())
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package providertest
+
+import (
+	"context"
+
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/pkg/provider"
+)
+
+// IutProvider is a minimal IUT provider for tests. It creates one Iut for each IUT requested and
+// deletes Iuts when they are released.
+type IutProvider struct {
+	// ReleaseErr is returned by Release, without releasing, if set.
+	ReleaseErr error
+}
+
+// Provision creates Iuts for an EnvironmentRequest.
+func (p IutProvider) Provision(ctx context.Context, cfg provider.ProvisionConfig) error {
+	for range cfg.MinimumAmount {
+		if _, err := provider.CreateIUT(ctx, cfg.EnvironmentRequest, cfg.Namespace, "", v1alpha2.IutSpec{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release deletes an Iut, or fails with ReleaseErr.
+func (p IutProvider) Release(ctx context.Context, cfg provider.ReleaseConfig) error {
+	if p.ReleaseErr != nil {
+		return p.ReleaseErr
+	}
+	iut, err := provider.GetIUT(ctx, cfg.Name, cfg.Namespace)
+	if err != nil {
+		return err
+	}
+	if cfg.NoDelete {
+		return nil
+	}
+	return provider.DeleteIUT(ctx, iut)
+}
@@ -0,0 +1,93 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package providertest
+
+import (
+	"context"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Runner runs a provider the same way as the Run* functions in the provider package, but without
+// parsing flags, panicking or writing a termination-log. Instead the result that would have been
+// written to the termination-log is returned.
+type Runner struct {
+	// Client is the Kubernetes client that the provider uses, I.e. the client of an Environment
+	// or a client from NewFakeClient.
+	Client client.Client
+	// ProviderType is the type of provider to run, I.e. provider.ProviderTypeIut.
+	ProviderType string
+	// Logger is the logger passed to the provider. Discards all logs if not set.
+	Logger logr.Logger
+}
+
+// Context returns a copy of ctx which carries the client and logger of the Runner.
+//
+// Use this context when calling the functions of the provider package in tests, for example
+// provider.GetIUTs, so that they use the same client as the provider.
+func (r Runner) Context(ctx context.Context) context.Context {
+	logger := r.Logger
+	if logger.GetSink() == nil {
+		logger = logr.Discard()
+	}
+	return logr.NewContext(provider.WithKubernetesClient(ctx, r.Client), logger)
+}
+
+// Provision calls Provision on a provider for an EnvironmentRequest.
+//
+// The EnvironmentRequest must exist in Kubernetes and the amount to provision is calculated
+// the same way as in the Run* functions.
+func (r Runner) Provision(
+	ctx context.Context,
+	p provider.Provider,
+	environmentRequest *v1alpha1.EnvironmentRequest,
+) (jobs.Result, error) {
+	ctx = r.Context(ctx)
+	err := r.provision(ctx, p, environmentRequest)
+	return provider.Result(r.ProviderType, false, err), err
+}
+
+// provision gets the EnvironmentRequest from Kubernetes and calls Provision on the provider.
+func (r Runner) provision(
+	ctx context.Context,
+	p provider.Provider,
+	environmentRequest *v1alpha1.EnvironmentRequest,
+) error {
+	environmentRequest, err := provider.EnvironmentRequest(ctx, environmentRequest.Name, environmentRequest.Namespace)
+	if err != nil {
+		return err
+	}
+	minimumAmount, err := provider.GetAmountFunc(r.ProviderType)(ctx, environmentRequest)
+	if err != nil {
+		return err
+	}
+	return p.Provision(ctx, provider.ProvisionConfig{
+		EnvironmentRequest: environmentRequest,
+		Namespace:          environmentRequest.Namespace,
+		MaximumAmount:      environmentRequest.Spec.MaximumAmount,
+		MinimumAmount:      minimumAmount,
+	})
+}
+
+// Release calls Release on a provider.
+func (r Runner) Release(ctx context.Context, p provider.Provider, cfg provider.ReleaseConfig) (jobs.Result, error) {
+	err := p.Release(r.Context(ctx), cfg)
+	return provider.Result(r.ProviderType, true, err), err
+}
@@ -0,0 +1,120 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package providertest
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/pkg/provider"
+)
+
+var _ = Describe("Runner", func() {
+	const namespace = "default"
+	var (
+		ctx    context.Context
+		cli    client.Client
+		runner Runner
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		environmentRequest := NewEnvironmentRequest("environment-request", namespace).
+			WithAmount(2, 3).
+			WithIutProvider("iut-provider").
+			Build()
+		cli = NewFakeClient(environmentRequest, NewProvider("iut-provider", namespace, "iut").Build())
+		runner = Runner{Client: cli, ProviderType: provider.ProviderTypeIut}
+	})
+
+	It("should provision with the client of the Runner", func() {
+		environmentRequest, err := provider.EnvironmentRequest(runner.Context(ctx), "environment-request", namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := runner.Provision(ctx, IutProvider{}, environmentRequest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(jobs.Result{
+			Conclusion:  jobs.ConclusionSuccessful,
+			Description: "Successfully provisioned Iut",
+			Verdict:     jobs.VerdictNone,
+		}))
+
+		var iuts v1alpha2.IutList
+		Expect(cli.List(ctx, &iuts, client.InNamespace(namespace))).To(Succeed())
+		Expect(iuts.Items).To(HaveLen(2))
+		for _, iut := range iuts.Items {
+			Expect(iut.Spec.EnvironmentRequest).To(Equal("environment-request"))
+			Expect(iut.Spec.ProviderID).To(Equal("iut-provider"))
+		}
+	})
+
+	It("should release with the client of the Runner", func() {
+		environmentRequest, err := provider.EnvironmentRequest(runner.Context(ctx), "environment-request", namespace)
+		Expect(err).NotTo(HaveOccurred())
+		iut, err := provider.CreateIUT(runner.Context(ctx), environmentRequest, namespace, "iut", v1alpha2.IutSpec{})
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := runner.Release(ctx, IutProvider{}, provider.ReleaseConfig{Name: iut.Name, Namespace: namespace})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Conclusion).To(Equal(jobs.ConclusionSuccessful))
+		Expect(result.Description).To(Equal("Successfully released Iut"))
+
+		var iuts v1alpha2.IutList
+		Expect(cli.List(ctx, &iuts, client.InNamespace(namespace))).To(Succeed())
+		Expect(iuts.Items).To(BeEmpty())
+	})
+
+	It("should return a failed result when the provider fails", func() {
+		releaseErr := errors.New("release failed")
+		result, err := runner.Release(ctx, IutProvider{ReleaseErr: releaseErr}, provider.ReleaseConfig{
+			Name:      "iut",
+			Namespace: namespace,
+		})
+		Expect(err).To(MatchError(releaseErr))
+		Expect(result).To(Equal(jobs.Result{
+			Conclusion:  jobs.ConclusionFailed,
+			Description: "release failed",
+			Verdict:     jobs.VerdictNone,
+		}))
+	})
+
+	It("should fail to provision for an EnvironmentRequest that does not exist", func() {
+		environmentRequest := NewEnvironmentRequest("missing", namespace).Build()
+		result, err := runner.Provision(ctx, IutProvider{}, environmentRequest)
+		Expect(err).To(HaveOccurred())
+		Expect(result.Conclusion).To(Equal(jobs.ConclusionFailed))
+	})
+})
+
+var _ = Describe("CRDs", func() {
+	It("should load all ETOS CustomResourceDefinitions", func() {
+		crds, err := CRDs()
+		Expect(err).NotTo(HaveOccurred())
+		var kinds []string
+		for _, crd := range crds {
+			kinds = append(kinds, crd.Spec.Names.Kind)
+		}
+		Expect(kinds).To(ContainElements(
+			"EnvironmentRequest", "Provider", "Iut", "ExecutionSpace", "LogArea",
+		))
+	})
+})
@@ -0,0 +1,414 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/pkg/logging"
+	"github.com/eiffel-community/etos/pkg/redact"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// RemoteAPIVersion is the version of the remote provider API, as set in the API field of a Provider.
+//
+// The remote provider API is served by long-running providers and has these endpoints:
+//
+//	PUT    /v1/provision/{id} - Start provisioning, with a ProvisionRequest body.
+//	PUT    /v1/release/{id}   - Start releasing, with a ReleaseRequest body.
+//	GET    /v1/status/{id}    - Get the Operation of a provision or release.
+//	DELETE /v1/status/{id}    - Forget a finished Operation.
+//	GET    /v1/capabilities   - Get the Capabilities of the provider.
+//	GET    /v1/healthcheck    - Responds with 204 No Content when the provider is healthy.
+//
+// The ID of an operation is chosen by the caller, which makes it safe to retry a PUT request.
+// Operations are only kept in memory, and a provision that is started again after a restart only
+// provisions the resources that are missing for the EnvironmentRequest. Finished operations that
+// are never forgotten are removed after RemoteOptions.OperationTTL.
+//
+// All requests, except health checks, must have the Token of the Provider as a bearer token in
+// the authorization header.
+const RemoteAPIVersion = "v1"
+
+// RemoteTokenEnv is the environment variable that RunRemoteProvider reads the token, that ETOS
+// authenticates with, from.
+const RemoteTokenEnv = "ETOS_PROVIDER_TOKEN"
+
+// DefaultOperationTTL is how long finished operations are kept, unless RemoteOptions.OperationTTL is set.
+const DefaultOperationTTL = time.Hour
+
+// RemoteOptions configures how a Provider is served over the remote provider API.
+type RemoteOptions struct {
+	// Token is the bearer token that ETOS authenticates with, I.e. the Token of the Provider.
+	// All requests, except health checks, are rejected if it is empty.
+	Token string
+	// OperationTTL is how long a finished operation is kept if ETOS does not forget it.
+	// Defaults to DefaultOperationTTL.
+	OperationTTL time.Duration
+}
+
+// ProvisionRequest is a request to a remote provider to provision resources for an EnvironmentRequest.
+type ProvisionRequest struct {
+	EnvironmentRequest string `json:"environmentRequest"`
+	Namespace          string `json:"namespace"`
+}
+
+// ReleaseRequest is a request to a remote provider to release a resource.
+type ReleaseRequest struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	NoDelete  bool   `json:"noDelete,omitempty"`
+}
+
+// Operation is a provision or release that a remote provider is running, or has run.
+//
+// The Result is the same result that a provider running in a Job writes to its termination-log.
+type Operation struct {
+	ID     string      `json:"id"`
+	Status jobs.Status `json:"status"`
+	Result jobs.Result `json:"result,omitzero"`
+}
+
+// Capabilities describes what a remote provider is able to do.
+//
+// Capacity and Features are only set if the Provider implements CapacityAdvertiser and
+// FeatureAdvertiser respectively.
+type Capabilities struct {
+	API        string    `json:"api"`
+	Type       string    `json:"type"`
+	Operations []string  `json:"operations"`
+	Capacity   *Capacity `json:"capacity,omitempty"`
+	Features   []string  `json:"features,omitempty"`
+}
+
+// Capacity describes the amount of resources that a provider can provide.
+type Capacity struct {
+	Total     int `json:"total"`
+	Available int `json:"available"`
+	Reserved  int `json:"reserved"`
+}
+
+// CapacityAdvertiser is an optional interface for a Provider, served over the remote provider API,
+// to advertise its capacity. ETOS uses the capacity to avoid provisioning when it cannot succeed.
+type CapacityAdvertiser interface {
+	Capacity(ctx context.Context) (Capacity, error)
+}
+
+// FeatureAdvertiser is an optional interface for a Provider, served over the remote provider API,
+// to advertise the features of the resources it provides, I.e. "gpu" or "arm64".
+type FeatureAdvertiser interface {
+	Features(ctx context.Context) []string
+}
+
+// remoteProvider serves a Provider over the remote provider API.
+type remoteProvider struct {
+	ctx          context.Context
+	provider     Provider
+	providerType string
+	token        string
+	operationTTL time.Duration
+
+	mutex      sync.Mutex
+	operations map[string]*remoteOperation
+}
+
+// remoteOperation is an Operation and the time that it finished.
+type remoteOperation struct {
+	Operation
+	finished time.Time
+}
+
+// RunRemoteProvider is the base runner for a remote provider. Serves the remote provider API,
+// calling Provision and Release on a Provider, until the process is interrupted.
+//
+// This function panics on errors.
+func RunRemoteProvider(provider Provider, providerType string) {
+	opts := zap.Options{
+		Development: true,
+	}
+	var address string
+	var operationTTL time.Duration
+	flag.StringVar(&address, "address", ":8080", "The address to serve the remote provider API on.")
+	flag.DurationVar(&operationTTL, "operation-ttl", DefaultOperationTTL,
+		"How long finished operations are kept if ETOS does not forget them.")
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+	opts = logging.Redacted(opts)
+	logger := zap.New(zap.UseFlagOptions(&opts)).WithValues("providerType", providerType)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = logr.NewContext(ctx, logger)
+	token := os.Getenv(RemoteTokenEnv)
+	if token == "" {
+		panic(fmt.Sprintf("%s must be set to the token of the Provider", RemoteTokenEnv))
+	}
+	redact.Register(token)
+	remoteOpts := RemoteOptions{Token: token, OperationTTL: operationTTL}
+	if err := ServeRemoteProvider(ctx, address, provider, providerType, remoteOpts); err != nil {
+		panic(err)
+	}
+}
+
+// ServeRemoteProvider serves the remote provider API on an address until the context is done.
+func ServeRemoteProvider(
+	ctx context.Context,
+	address string,
+	provider Provider,
+	providerType string,
+	opts RemoteOptions,
+) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	server := &http.Server{
+		Addr:              address,
+		Handler:           NewRemoteHandler(ctx, provider, providerType, opts),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error(err, "failed to shut down the remote provider API")
+		}
+	}()
+	logger.Info("Serving the remote provider API", "address", address, "api", RemoteAPIVersion)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NewRemoteHandler creates an http.Handler that serves a Provider over the remote provider API.
+//
+// Provision and Release are run in the background with the context, which means that the
+// context must outlive the handler.
+func NewRemoteHandler(ctx context.Context, provider Provider, providerType string, opts RemoteOptions) http.Handler {
+	if opts.OperationTTL == 0 {
+		opts.OperationTTL = DefaultOperationTTL
+	}
+	remote := &remoteProvider{
+		ctx:          ctx,
+		provider:     provider,
+		providerType: providerType,
+		token:        opts.Token,
+		operationTTL: opts.OperationTTL,
+		operations:   make(map[string]*remoteOperation),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /v1/provision/{id}", remote.authenticated(remote.provision))
+	mux.HandleFunc("PUT /v1/release/{id}", remote.authenticated(remote.release))
+	mux.HandleFunc("GET /v1/status/{id}", remote.authenticated(remote.status))
+	mux.HandleFunc("DELETE /v1/status/{id}", remote.authenticated(remote.forget))
+	mux.HandleFunc("GET /v1/capabilities", remote.authenticated(remote.capabilities))
+	mux.HandleFunc("GET /v1/healthcheck", remote.healthcheck)
+	return mux
+}
+
+// authenticated only calls a handler if the request has the token of the provider as bearer token.
+func (p *remoteProvider) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || p.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(p.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// evict removes the operations that finished longer than the operation TTL ago. The mutex must be held.
+func (p *remoteProvider) evict() {
+	for id, operation := range p.operations {
+		if !operation.finished.IsZero() && time.Since(operation.finished) > p.operationTTL {
+			delete(p.operations, id)
+		}
+	}
+}
+
+// provision starts a Provision operation.
+func (p *remoteProvider) provision(w http.ResponseWriter, r *http.Request) {
+	var request ProvisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.EnvironmentRequest == "" || request.Namespace == "" {
+		http.Error(w, "environmentRequest and namespace are required", http.StatusBadRequest)
+		return
+	}
+	p.start(w, r.PathValue("id"), Parameters{
+		providerType:           p.providerType,
+		amountFunc:             GetAmountFunc(p.providerType),
+		environmentRequestName: request.EnvironmentRequest,
+		namespace:              request.Namespace,
+		// Operations are only kept in memory, so a provision that was started before the provider
+		// restarted is started again. Skipping resources that were already provisioned for the
+		// EnvironmentRequest makes that safe.
+		skipProvisioned: true,
+	})
+}
+
+// release starts a Release operation.
+func (p *remoteProvider) release(w http.ResponseWriter, r *http.Request) {
+	var request ReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Name == "" || request.Namespace == "" {
+		http.Error(w, "name and namespace are required", http.StatusBadRequest)
+		return
+	}
+	p.start(w, r.PathValue("id"), Parameters{
+		providerType:       p.providerType,
+		releaseEnvironment: true,
+		names:              nameList{request.Name},
+		namespace:          request.Namespace,
+		noDelete:           request.NoDelete,
+	})
+}
+
+// start runs an operation in the background, unless an operation with the same ID already exists.
+func (p *remoteProvider) start(w http.ResponseWriter, id string, params Parameters) {
+	p.mutex.Lock()
+	p.evict()
+	operation, ok := p.operations[id]
+	if ok {
+		response := operation.Operation
+		p.mutex.Unlock()
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	operation = &remoteOperation{Operation: Operation{ID: id, Status: jobs.StatusActive}}
+	p.operations[id] = operation
+	response := operation.Operation
+	p.mutex.Unlock()
+
+	logger := logr.FromContextOrDiscard(p.ctx).WithValues(
+		"operation", id,
+		"release", params.releaseEnvironment,
+		"namespace", params.namespace,
+	)
+	go func() {
+		ctx := logr.NewContext(p.ctx, logger)
+		var err error
+		if params.releaseEnvironment {
+			err = runReleaser(ctx, p.provider, params)
+		} else {
+			err = runProvider(ctx, p.provider, params)
+		}
+		if err != nil {
+			logger.Error(err, "operation failed")
+		}
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		operation.Result = Result(params.providerType, params.releaseEnvironment, err)
+		operation.finished = time.Now()
+		if err != nil {
+			operation.Status = jobs.StatusFailed
+		} else {
+			operation.Status = jobs.StatusSuccessful
+		}
+	}()
+	writeJSON(w, http.StatusAccepted, response)
+}
+
+// status responds with an operation.
+func (p *remoteProvider) status(w http.ResponseWriter, r *http.Request) {
+	p.mutex.Lock()
+	p.evict()
+	operation, ok := p.operations[r.PathValue("id")]
+	var response Operation
+	if ok {
+		response = operation.Operation
+	}
+	p.mutex.Unlock()
+	if !ok {
+		http.Error(w, "operation not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// forget removes a finished operation.
+func (p *remoteProvider) forget(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	operation, ok := p.operations[id]
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if operation.Status == jobs.StatusActive {
+		http.Error(w, "operation is still active", http.StatusConflict)
+		return
+	}
+	delete(p.operations, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// healthcheck responds with 204 No Content if the provider is healthy.
+func (p *remoteProvider) healthcheck(w http.ResponseWriter, r *http.Request) {
+	if err := runHealthcheck(r.Context(), p.provider, 0); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// capabilities responds with the capabilities of the provider.
+func (p *remoteProvider) capabilities(w http.ResponseWriter, r *http.Request) {
+	capabilities := Capabilities{
+		API:        RemoteAPIVersion,
+		Type:       p.providerType,
+		Operations: []string{"provision", "release"},
+	}
+	if advertiser, ok := p.provider.(CapacityAdvertiser); ok {
+		capacity, err := advertiser.Capacity(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		capabilities.Capacity = &capacity
+	}
+	if advertiser, ok := p.provider.(FeatureAdvertiser); ok {
+		capabilities.Features = advertiser.Features(r.Context())
+	}
+	writeJSON(w, http.StatusOK, capabilities)
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, statusCode int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,270 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/eiffel-community/etos/api/v1alpha2"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+)
+
+// advertisingProvider is an IUT provider that advertises its capacity and features.
+type advertisingProvider struct {
+	providertest.IutProvider
+}
+
+// Capacity advertises a capacity of 3 IUTs, with 1 reserved.
+func (p advertisingProvider) Capacity(_ context.Context) (provider.Capacity, error) {
+	return provider.Capacity{Total: 3, Available: 2, Reserved: 1}, nil
+}
+
+// Features advertises the features of the IUTs.
+func (p advertisingProvider) Features(_ context.Context) []string {
+	return []string{"arm64"}
+}
+
+// unhealthyProvider is an IUT provider that fails its health check.
+type unhealthyProvider struct {
+	providertest.IutProvider
+}
+
+// Healthcheck fails, the lab is in maintenance.
+func (p unhealthyProvider) Healthcheck(_ context.Context) error {
+	return errors.New("lab is in maintenance")
+}
+
+// remoteOptions are the options of the remote providers in the tests.
+var remoteOptions = provider.RemoteOptions{Token: "token"}
+
+var _ = Describe("Remote provider", func() {
+	const namespace = "default"
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		cli    client.Client
+		server *httptest.Server
+		remote *provider.RemoteClient
+	)
+
+	BeforeEach(func() {
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", namespace).
+			WithAmount(2, 2).
+			WithIutProvider("iut-provider").
+			Build()
+		cli = providertest.NewFakeClient(environmentRequest)
+		ctx, cancel = context.WithCancel(context.Background())
+		ctx = provider.WithKubernetesClient(ctx, cli)
+		server = httptest.NewServer(provider.NewRemoteHandler(ctx, providertest.IutProvider{
+			ReleaseErr: errors.New("release failed"),
+		}, provider.ProviderTypeIut, remoteOptions))
+		remote = provider.NewRemoteClient(server.URL, remoteOptions.Token)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		cancel()
+	})
+
+	It("should advertise its capabilities", func() {
+		capabilities, err := remote.Capabilities(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(capabilities).To(Equal(provider.Capabilities{
+			API:        provider.RemoteAPIVersion,
+			Type:       provider.ProviderTypeIut,
+			Operations: []string{"provision", "release"},
+		}))
+	})
+
+	It("should advertise its capacity and features", func() {
+		advertising := httptest.NewServer(
+			provider.NewRemoteHandler(ctx, advertisingProvider{}, provider.ProviderTypeIut, remoteOptions),
+		)
+		defer advertising.Close()
+		capabilities, err := provider.NewRemoteClient(advertising.URL, remoteOptions.Token).Capabilities(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(capabilities.Capacity).To(Equal(&provider.Capacity{Total: 3, Available: 2, Reserved: 1}))
+		Expect(capabilities.Features).To(Equal([]string{"arm64"}))
+	})
+
+	It("should respond to health checks", func() {
+		resp, err := http.Get(server.URL + "/v1/healthcheck")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+
+		unhealthy := httptest.NewServer(
+			provider.NewRemoteHandler(ctx, unhealthyProvider{}, provider.ProviderTypeIut, remoteOptions),
+		)
+		defer unhealthy.Close()
+		resp, err = http.Get(unhealthy.URL + "/v1/healthcheck")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("should provision in the background", func() {
+		operation, err := remote.Provision(ctx, "provision-1", provider.ProvisionRequest{
+			EnvironmentRequest: "environment-request",
+			Namespace:          namespace,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operation.ID).To(Equal("provision-1"))
+
+		Eventually(func() jobs.Status {
+			operation, err = remote.Status(ctx, "provision-1")
+			Expect(err).NotTo(HaveOccurred())
+			return operation.Status
+		}).Should(Equal(jobs.StatusSuccessful))
+		Expect(operation.Result.Description).To(Equal("Successfully provisioned Iut"))
+
+		By("not starting the same operation twice")
+		_, err = remote.Provision(ctx, "provision-1", provider.ProvisionRequest{
+			EnvironmentRequest: "environment-request",
+			Namespace:          namespace,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		var iuts v1alpha2.IutList
+		Expect(cli.List(ctx, &iuts, client.InNamespace(namespace))).To(Succeed())
+		Expect(iuts.Items).To(HaveLen(2))
+	})
+
+	It("should not provision the same resources again after a restart", func() {
+		provision := func(remote *provider.RemoteClient) {
+			_, err := remote.Provision(ctx, "provision-1", provider.ProvisionRequest{
+				EnvironmentRequest: "environment-request",
+				Namespace:          namespace,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() jobs.Status {
+				operation, err := remote.Status(ctx, "provision-1")
+				Expect(err).NotTo(HaveOccurred())
+				return operation.Status
+			}).Should(Equal(jobs.StatusSuccessful))
+		}
+		// restart starts a new remote provider, which does not know about any operations.
+		restart := func() *provider.RemoteClient {
+			restarted := httptest.NewServer(
+				provider.NewRemoteHandler(ctx, providertest.IutProvider{}, provider.ProviderTypeIut, remoteOptions),
+			)
+			DeferCleanup(restarted.Close)
+			return provider.NewRemoteClient(restarted.URL, remoteOptions.Token)
+		}
+		provision(remote)
+
+		By("provisioning again with a restarted provider")
+		restarted := restart()
+		operation, err := restarted.Status(ctx, "provision-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operation.Status).To(Equal(jobs.StatusNone))
+		provision(restarted)
+		var iuts v1alpha2.IutList
+		Expect(cli.List(ctx, &iuts, client.InNamespace(namespace))).To(Succeed())
+		Expect(iuts.Items).To(HaveLen(2))
+
+		By("only provisioning what is missing after a restart during provisioning")
+		Expect(cli.Delete(ctx, &iuts.Items[0])).To(Succeed())
+		provision(restart())
+		Expect(cli.List(ctx, &iuts, client.InNamespace(namespace))).To(Succeed())
+		Expect(iuts.Items).To(HaveLen(2))
+	})
+
+	It("should report failed releases", func() {
+		_, err := remote.Release(ctx, "release-1", provider.ReleaseRequest{Name: "iut", Namespace: namespace})
+		Expect(err).NotTo(HaveOccurred())
+
+		var operation provider.Operation
+		Eventually(func() jobs.Status {
+			operation, err = remote.Status(ctx, "release-1")
+			Expect(err).NotTo(HaveOccurred())
+			return operation.Status
+		}).Should(Equal(jobs.StatusFailed))
+		Expect(operation.Result.Conclusion).To(Equal(jobs.ConclusionFailed))
+		Expect(operation.Result.Description).To(Equal("release failed"))
+
+		By("forgetting the operation")
+		Expect(remote.Forget(ctx, "release-1")).To(Succeed())
+		operation, err = remote.Status(ctx, "release-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operation.Status).To(Equal(jobs.StatusNone))
+	})
+
+	It("should reject requests without the token of the provider", func() {
+		for _, token := range []string{"", "wrong"} {
+			_, err := provider.NewRemoteClient(server.URL, token).Provision(ctx, "provision-1", provider.ProvisionRequest{
+				EnvironmentRequest: "environment-request",
+				Namespace:          namespace,
+			})
+			var remoteErr *provider.RemoteError
+			Expect(errors.As(err, &remoteErr)).To(BeTrue())
+			Expect(remoteErr.StatusCode).To(Equal(http.StatusUnauthorized))
+		}
+		var iuts v1alpha2.IutList
+		Expect(cli.List(ctx, &iuts, client.InNamespace(namespace))).To(Succeed())
+		Expect(iuts.Items).To(BeEmpty())
+
+		By("rejecting all requests when the provider has no token")
+		unauthenticated := httptest.NewServer(
+			provider.NewRemoteHandler(ctx, providertest.IutProvider{}, provider.ProviderTypeIut, provider.RemoteOptions{}),
+		)
+		defer unauthenticated.Close()
+		_, err := provider.NewRemoteClient(unauthenticated.URL, "").Capabilities(ctx)
+		var remoteErr *provider.RemoteError
+		Expect(errors.As(err, &remoteErr)).To(BeTrue())
+		Expect(remoteErr.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should forget finished operations after the operation TTL", func() {
+		expiring := httptest.NewServer(provider.NewRemoteHandler(ctx, providertest.IutProvider{}, provider.ProviderTypeIut,
+			provider.RemoteOptions{Token: remoteOptions.Token, OperationTTL: 100 * time.Millisecond},
+		))
+		defer expiring.Close()
+		remote := provider.NewRemoteClient(expiring.URL, remoteOptions.Token)
+		_, err := remote.Provision(ctx, "provision-1", provider.ProvisionRequest{
+			EnvironmentRequest: "environment-request",
+			Namespace:          namespace,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() jobs.Status {
+			operation, err := remote.Status(ctx, "provision-1")
+			Expect(err).NotTo(HaveOccurred())
+			return operation.Status
+		}).Should(Equal(jobs.StatusSuccessful))
+
+		Eventually(func() jobs.Status {
+			operation, err := remote.Status(ctx, "provision-1")
+			Expect(err).NotTo(HaveOccurred())
+			return operation.Status
+		}).Should(Equal(jobs.StatusNone))
+	})
+
+	It("should reject invalid requests", func() {
+		_, err := remote.Release(ctx, "release-2", provider.ReleaseRequest{})
+		var remoteErr *provider.RemoteError
+		Expect(errors.As(err, &remoteErr)).To(BeTrue())
+		Expect(remoteErr.StatusCode).To(Equal(400))
+	})
+})
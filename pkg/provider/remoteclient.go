@@ -0,0 +1,144 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+)
+
+// RemoteClient is a client for the remote provider API.
+type RemoteClient struct {
+	host   string
+	token  string
+	client *http.Client
+}
+
+// NewRemoteClient creates a client for the remote provider API served at host, I.e. the Host of a
+// Provider, which authenticates with a bearer token, I.e. the Token of the Provider.
+func NewRemoteClient(host, token string) *RemoteClient {
+	return &RemoteClient{
+		host:   strings.TrimSuffix(host, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Provision starts provisioning resources on the remote provider.
+//
+// If an operation with the same ID already exists, that operation is returned instead.
+func (c *RemoteClient) Provision(ctx context.Context, id string, request ProvisionRequest) (Operation, error) {
+	var operation Operation
+	err := c.do(ctx, http.MethodPut, c.url("provision", id), request, &operation)
+	return operation, err
+}
+
+// Release starts releasing a resource on the remote provider.
+//
+// If an operation with the same ID already exists, that operation is returned instead.
+func (c *RemoteClient) Release(ctx context.Context, id string, request ReleaseRequest) (Operation, error) {
+	var operation Operation
+	err := c.do(ctx, http.MethodPut, c.url("release", id), request, &operation)
+	return operation, err
+}
+
+// Status gets an operation from the remote provider.
+//
+// If the remote provider does not know about the operation, an Operation with jobs.StatusNone is returned.
+func (c *RemoteClient) Status(ctx context.Context, id string) (Operation, error) {
+	var operation Operation
+	err := c.do(ctx, http.MethodGet, c.url("status", id), nil, &operation)
+	var remoteErr *RemoteError
+	if errors.As(err, &remoteErr) && remoteErr.StatusCode == http.StatusNotFound {
+		return Operation{ID: id, Status: jobs.StatusNone}, nil
+	}
+	return operation, err
+}
+
+// Forget removes a finished operation from the remote provider.
+func (c *RemoteClient) Forget(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, c.url("status", id), nil, nil)
+}
+
+// Capabilities gets the capabilities of the remote provider.
+func (c *RemoteClient) Capabilities(ctx context.Context) (Capabilities, error) {
+	var capabilities Capabilities
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/%s/capabilities", c.host, RemoteAPIVersion), nil, &capabilities)
+	return capabilities, err
+}
+
+// RemoteError is returned when the remote provider responds with an unexpected status code.
+type RemoteError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error returns the status code and message of the response from the remote provider.
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote provider responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// url creates the URL of an operation endpoint.
+func (c *RemoteClient) url(endpoint, id string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", c.host, RemoteAPIVersion, endpoint, url.PathEscape(id))
+}
+
+// do sends a request, with body as JSON, to the remote provider and decodes the JSON response into response.
+func (c *RemoteClient) do(ctx context.Context, method, address string, body, response any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, address, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusBadRequest {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &RemoteError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,242 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/messaging"
+	"github.com/eiffel-community/etos/pkg/events"
+	"github.com/eiffel-community/etos/pkg/logging"
+	"github.com/eiffel-community/etos/pkg/opentelemetry"
+	"github.com/eiffel-community/etos/pkg/opentelemetry/semconv"
+	"github.com/eiffel-community/etos/pkg/redact"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	_zap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// tracerName is the name of the OpenTelemetry tracer used for the spans of a provider.
+const tracerName = "github.com/eiffel-community/etos/pkg/provider"
+
+// publisherOptions configures the buffering of the user log publisher, bound to command line flags
+// by BindTelemetryFlags.
+var publisherOptions messaging.PublisherOptions
+
+// redactOptions configures what is redacted from logs, bound to command line flags by
+// BindTelemetryFlags.
+var redactOptions redact.Options
+
+// BindTelemetryFlags binds the options of the telemetry of a provider, such as how user logs are
+// buffered before they are sent to the ETOS message bus and what is redacted from logs, to command
+// line flags.
+func BindTelemetryFlags(fs *flag.FlagSet) {
+	publisherOptions.BindFlags(fs)
+	redactOptions.BindFlags(fs)
+}
+
+// Telemetry is the tracer and the user log publisher of a provider run, started by StartTelemetry.
+type Telemetry struct {
+	tracer     *opentelemetry.ETOSTracer
+	started    bool
+	publisher  messaging.Publisher
+	identifier string
+}
+
+// telemetryKey is the context key of the Telemetry of a provider run.
+type telemetryKey struct{}
+
+// StartTelemetry starts an OpenTelemetry tracer and an ETOS logger for a provider run and returns
+// a copy of ctx which carries the logger.
+//
+// The trace is continued from the TRACEPARENT environment variable, which ETOS sets in the jobs it
+// creates, or from the traceparent annotation of the EnvironmentRequest. If an EnvironmentRequest
+// is provided, user-facing logs are streamed to the ETOS message bus stream of the
+// EnvironmentRequest, keyed by the identifier of the TestRun. Neither the tracer nor the message bus are required for a provider
+// to run, so failures to start them are logged and the provider runs without them.
+//
+// Shutdown must be called when the provider has finished, flushing the spans and the user logs.
+func StartTelemetry(
+	ctx context.Context,
+	opts zap.Options,
+	providerType string,
+	environmentRequest *v1alpha1.EnvironmentRequest,
+) (context.Context, *Telemetry) {
+	redacted := logging.Redacted(opts)
+	ctx = logr.NewContext(ctx, zap.New(zap.UseFlagOptions(&redacted)))
+	logger := logr.FromContextOrDiscard(ctx)
+	if err := redact.Configure(redactOptions); err != nil {
+		logger.Error(err, "failed to configure the redaction of logs, redacting the defaults")
+	}
+
+	telemetry := &Telemetry{
+		tracer: opentelemetry.New(fmt.Sprintf("etos-%s-provider", strings.ToLower(providerType)), providerType),
+	}
+	if err := telemetry.tracer.Start(ctx); err != nil {
+		logger.Error(err, "failed to start the OpenTelemetry tracer, continuing without tracing")
+	} else {
+		telemetry.started = true
+	}
+
+	if os.Getenv("TRACEPARENT") != "" {
+		// Jobs created by ETOS carry the span context of the reconcile that created them.
+		ctx = opentelemetry.ContextFromEnv(ctx)
+	} else if environmentRequest != nil {
+		ctx = telemetry.tracer.ContextFromEnvironmentRequest(ctx, environmentRequest)
+	}
+
+	if environmentRequest != nil && environmentRequest.Spec.Debug {
+		// Debugging a testrun shows the debug logs of its providers, without redeploying them.
+		level := _zap.NewAtomicLevelAt(zapcore.DebugLevel)
+		opts.Level = &level
+	}
+	etosLogger := logging.New(opts).WithConsole().WithOtel(telemetry.tracer)
+	if environmentRequest != nil {
+		etosLogger = etosLogger.SetUserLogLevel(userLogLevel(ctx, environmentRequest))
+		telemetry.identifier = environmentRequest.Spec.Identifier
+		telemetry.publisher = userLogPublisher(ctx, environmentRequest)
+		etosLogger = etosLogger.WithUserLog(telemetry.publisher)
+	}
+	ctx = etosLogger.Start(ctx)
+	logger = logr.FromContextOrDiscard(ctx)
+	if telemetry.publisher != nil {
+		telemetry.publisher.AddLogger(logger)
+	}
+	if environmentRequest != nil && environmentRequest.Spec.Identifier != "" {
+		ctx = logr.NewContext(ctx, logger.WithValues("identifier", environmentRequest.Spec.Identifier))
+	}
+	return context.WithValue(ctx, telemetryKey{}, telemetry), telemetry
+}
+
+// PublishEvent publishes an event for the TestRun of the provider run on the ETOS message bus, using
+// the Telemetry started by StartTelemetry for ctx.
+//
+// Events are not published if there is no Telemetry in ctx or if it has no user log publisher.
+// Failures to publish are logged, as the message bus is not required for a provider to run.
+func PublishEvent(ctx context.Context, data events.Data) {
+	telemetry, ok := ctx.Value(telemetryKey{}).(*Telemetry)
+	if !ok || telemetry.publisher == nil || telemetry.identifier == "" {
+		return
+	}
+	if err := events.Publish(telemetry.publisher, telemetry.identifier, data); err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "failed to publish event", "event", data.Type())
+	}
+}
+
+// Shutdown closes the user log publisher and shuts down the tracer, flushing any remaining user logs
+// and spans.
+func (t *Telemetry) Shutdown(ctx context.Context) {
+	logger := logr.FromContextOrDiscard(ctx)
+	if t.publisher != nil {
+		if err := t.publisher.Close(); err != nil {
+			logger.Error(err, "failed to close the user log publisher")
+		}
+	}
+	if t.started {
+		if err := t.tracer.Shutdown(ctx); err != nil {
+			logger.Error(err, "failed to shut down the OpenTelemetry tracer")
+		}
+	}
+}
+
+// userLogLevel returns the minimum level of the user logs of an EnvironmentRequest. Defaults to
+// info if the EnvironmentRequest has no level, and debug if the EnvironmentRequest is debugged.
+func userLogLevel(ctx context.Context, environmentRequest *v1alpha1.EnvironmentRequest) zapcore.Level {
+	if environmentRequest.Spec.Debug {
+		return zapcore.DebugLevel
+	}
+	if environmentRequest.Spec.UserLogLevel == "" {
+		return zapcore.InfoLevel
+	}
+	level, err := logging.ParseLevel(string(environmentRequest.Spec.UserLogLevel))
+	if err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "invalid user log level, defaulting to info")
+		return zapcore.InfoLevel
+	}
+	return level
+}
+
+// userLogPublisher creates a publisher to the ETOS message bus stream of an EnvironmentRequest.
+//
+// Returns nil if the EnvironmentRequest has no identifier, which user logs are keyed by, or if the
+// publisher could not be created.
+func userLogPublisher(ctx context.Context, environmentRequest *v1alpha1.EnvironmentRequest) messaging.Publisher {
+	logger := logr.FromContextOrDiscard(ctx)
+	if environmentRequest.Spec.Identifier == "" {
+		return nil
+	}
+	cli, err := KubernetesClientFromContext(ctx)
+	if err != nil {
+		logger.Error(err, "failed to get a Kubernetes client, continuing without user logs")
+		return nil
+	}
+	publisher, err := messaging.NewPublisher(
+		ctx,
+		environmentRequest.Spec.Config.EtosMessageBus,
+		cli,
+		environmentRequest.Namespace,
+		publisherOptions,
+	)
+	if err != nil {
+		logger.Error(err, "failed to connect to the ETOS message bus, continuing without user logs")
+		return nil
+	}
+	return publisher
+}
+
+// startSpan starts a span for a provider operation, I.e. "provision" or "release".
+func startSpan(
+	ctx context.Context,
+	operation string,
+	params Parameters,
+	attributes ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	attributes = append(attributes,
+		semconv.ETOSProviderEnvironmentRequest(params.environmentRequestName),
+		semconv.ETOSProviderNamespace(params.namespace),
+		semconv.ETOSProviderName(params.providerName),
+	)
+	return otel.Tracer(tracerName).Start(
+		ctx,
+		fmt.Sprintf("%s %s", operation, params.providerType),
+		trace.WithAttributes(attributes...),
+	)
+}
+
+// endSpan ends a span for a provider operation, recording the result of the operation on it.
+func endSpan(span trace.Span, params Parameters, err error) {
+	result := Result(params.providerType, params.releaseEnvironment, err)
+	span.SetAttributes(
+		semconv.ETOSProviderConclusion(string(result.Conclusion)),
+		semconv.ETOSProviderVerdict(string(result.Verdict)),
+		semconv.ETOSProviderDescription(result.Description),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,266 @@
+// Copyright Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/eiffel-community/etos/api/v1alpha1"
+	"github.com/eiffel-community/etos/internal/controller/jobs"
+	"github.com/eiffel-community/etos/pkg/events"
+	"github.com/eiffel-community/etos/pkg/messaging"
+	"github.com/eiffel-community/etos/pkg/opentelemetry/semconv"
+	"github.com/eiffel-community/etos/pkg/provider"
+	"github.com/eiffel-community/etos/pkg/provider/providertest"
+	"github.com/eiffel-community/etos/pkg/redact"
+)
+
+// metricReader collects the metrics of the providers. The instruments of a package are bound to the
+// first global meter provider, so it is set once for all tests.
+var metricReader = sync.OnceValue(func() *sdkmetric.ManualReader {
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	return reader
+})
+
+// collectMetric collects a metric by name, returning nil if it has not been recorded.
+func collectMetric(ctx context.Context, name string) *metricdata.Metrics {
+	var resourceMetrics metricdata.ResourceMetrics
+	Expect(metricReader().Collect(ctx, &resourceMetrics)).To(Succeed())
+	for _, scope := range resourceMetrics.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name == name {
+				return &m
+			}
+		}
+	}
+	return nil
+}
+
+var _ = Describe("Provider telemetry", func() {
+	const namespace = "default"
+	var (
+		ctx      context.Context
+		cancel   context.CancelFunc
+		recorder *tracetest.SpanRecorder
+		remote   *provider.RemoteClient
+		server   *httptest.Server
+	)
+
+	BeforeEach(func() {
+		metricReader()
+		recorder = tracetest.NewSpanRecorder()
+		previous := otel.GetTracerProvider()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		DeferCleanup(func() { otel.SetTracerProvider(previous) })
+
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", namespace).
+			WithAmount(1, 1).
+			WithIutProvider("iut-provider").
+			Build()
+		ctx, cancel = context.WithCancel(context.Background())
+		ctx = provider.WithKubernetesClient(ctx, providertest.NewFakeClient(environmentRequest))
+		server = httptest.NewServer(provider.NewRemoteHandler(ctx, providertest.IutProvider{
+			ReleaseErr: errors.New("release failed"),
+		}, provider.ProviderTypeIut, remoteOptions))
+		remote = provider.NewRemoteClient(server.URL, remoteOptions.Token)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		cancel()
+	})
+
+	// awaitOperation waits for an operation of the remote provider to finish.
+	awaitOperation := func(id string) {
+		Eventually(func() jobs.Status {
+			operation, err := remote.Status(ctx, id)
+			Expect(err).NotTo(HaveOccurred())
+			return operation.Status
+		}).ShouldNot(Equal(jobs.StatusActive))
+	}
+
+	It("should wrap Provision in a span", func() {
+		_, err := remote.Provision(ctx, "provision-1", provider.ProvisionRequest{
+			EnvironmentRequest: "environment-request",
+			Namespace:          namespace,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		awaitOperation("provision-1")
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name()).To(Equal("provision Iut"))
+		Expect(spans[0].Status().Code).To(Equal(codes.Unset))
+		Expect(spans[0].Attributes()).To(ContainElements(
+			semconv.ETOSProviderEnvironmentRequest("environment-request"),
+			semconv.ETOSProviderMinimumAmount(1),
+			semconv.ETOSProviderConclusion(string(jobs.ConclusionSuccessful)),
+		))
+	})
+
+	It("should record metrics of Provision", func() {
+		_, err := remote.Provision(ctx, "provision-2", provider.ProvisionRequest{
+			EnvironmentRequest: "environment-request",
+			Namespace:          namespace,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		awaitOperation("provision-2")
+
+		duration := collectMetric(ctx, "etos.provider.provision.duration")
+		Expect(duration).NotTo(BeNil())
+		Expect(duration.Data.(metricdata.Histogram[float64]).DataPoints).NotTo(BeEmpty())
+
+		created := collectMetric(ctx, "etos.provider.resources.created")
+		Expect(created).NotTo(BeNil())
+		points := created.Data.(metricdata.Sum[int64]).DataPoints
+		Expect(points).To(HaveLen(1))
+		Expect(points[0].Value).To(BeNumerically(">=", 1))
+	})
+
+	It("should record failed releases on the span", func() {
+		_, err := remote.Release(ctx, "release-1", provider.ReleaseRequest{Name: "iut", Namespace: namespace})
+		Expect(err).NotTo(HaveOccurred())
+		awaitOperation("release-1")
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name()).To(Equal("release Iut"))
+		Expect(spans[0].Status().Code).To(Equal(codes.Error))
+		Expect(spans[0].Status().Description).To(Equal("release failed"))
+		Expect(spans[0].Attributes()).To(ContainElement(semconv.ETOSProviderResource("iut")))
+	})
+
+	It("should run without a tracer or a message bus", func() {
+		telemetryCtx, telemetry := provider.StartTelemetry(ctx, zap.Options{}, provider.ProviderTypeIut, nil)
+		Expect(telemetryCtx).NotTo(BeNil())
+		telemetry.Shutdown(telemetryCtx)
+		provider.PublishEvent(telemetryCtx, events.ResourceReleased{Kind: provider.ProviderTypeIut, Name: "iut"})
+	})
+
+	It("should publish events for the TestRun on the ETOS message bus", func() {
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", namespace).Build()
+		environmentRequest.Spec.Identifier = "testrun"
+		environmentRequest.Spec.Config.EtosMessageBus = v1alpha1.RabbitMQ{
+			Backend: v1alpha1.MessageBusBackendFile,
+			Path:    filepath.Join(GinkgoT().TempDir(), "messages.jsonl"),
+		}
+		telemetryCtx, telemetry := provider.StartTelemetry(ctx, zap.Options{}, provider.ProviderTypeIut, environmentRequest)
+		provider.PublishEvent(telemetryCtx, events.ResourceReleased{Kind: provider.ProviderTypeIut, Name: "iut"})
+		telemetry.Shutdown(telemetryCtx)
+
+		subscriber, err := messaging.NewSubscriber(ctx, environmentRequest.Spec.Config.EtosMessageBus, nil, namespace,
+			messaging.SubscriberOptions{
+				Filters: []messaging.Filter{{Identifier: "testrun", Type: string(events.TypeResourceReleased)}},
+				Offset:  messaging.OffsetFirst(),
+			})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(subscriber.Close)
+		var event messaging.Event
+		Eventually(subscriber.Events()).Should(Receive(&event))
+		Expect(event.Filter.Meta).To(Equal(provider.ProviderTypeIut))
+		Expect(event.Decode()).To(Equal(&events.ResourceReleased{Kind: provider.ProviderTypeIut, Name: "iut"}))
+	})
+
+	// userLogs runs a provider with telemetry for an EnvironmentRequest, logging at the debug, info
+	// and error levels, and returns the messages of the user logs that were published.
+	userLogs := func(environmentRequest *v1alpha1.EnvironmentRequest) []string {
+		environmentRequest.Spec.Identifier = "testrun"
+		environmentRequest.Spec.Config.EtosMessageBus = v1alpha1.RabbitMQ{
+			Backend: v1alpha1.MessageBusBackendFile,
+			Path:    filepath.Join(GinkgoT().TempDir(), "messages.jsonl"),
+		}
+		telemetryCtx, telemetry := provider.StartTelemetry(ctx, zap.Options{}, provider.ProviderTypeIut, environmentRequest)
+		logger := logr.FromContextOrDiscard(telemetryCtx)
+		logger.V(1).Info("debug")
+		logger.Info("info")
+		logger.Error(errors.New("failed"), "error")
+		telemetry.Shutdown(telemetryCtx)
+
+		subscriber, err := messaging.NewSubscriber(ctx, environmentRequest.Spec.Config.EtosMessageBus, nil, namespace,
+			messaging.SubscriberOptions{Offset: messaging.OffsetFirst()})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(subscriber.Close)
+		var messages []string
+		for {
+			select {
+			case event := <-subscriber.Events():
+				log, err := event.UserLog()
+				Expect(err).NotTo(HaveOccurred())
+				messages = append(messages, log.Message)
+			case <-time.After(500 * time.Millisecond):
+				return messages
+			}
+		}
+	}
+
+	It("should publish user logs at or above the level of the EnvironmentRequest", func() {
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", namespace).Build()
+		environmentRequest.Spec.UserLogLevel = v1alpha1.UserLogLevelError
+		Expect(userLogs(environmentRequest)).To(Equal([]string{"error"}))
+	})
+
+	It("should publish user logs at the info level by default", func() {
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", namespace).Build()
+		Expect(userLogs(environmentRequest)).To(Equal([]string{"info", "error"}))
+	})
+
+	It("should publish debug user logs when the EnvironmentRequest is debugged", func() {
+		environmentRequest := providertest.NewEnvironmentRequest("environment-request", namespace).Build()
+		environmentRequest.Spec.UserLogLevel = v1alpha1.UserLogLevelError
+		environmentRequest.Spec.Debug = true
+		Expect(userLogs(environmentRequest)).To(Equal([]string{"debug", "info", "error"}))
+	})
+})
+
+var _ = Describe("GetSecret", func() {
+	It("should redact secrets from the logs of the provider", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("hunter2-correct-horse")},
+		}
+		cli := providertest.NewFakeClient(secret)
+		value, err := provider.GetSecret(context.Background(), cli, &v1alpha1.Var{
+			ValueFrom: v1alpha1.VarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "credentials"},
+					Key:                  "password",
+				},
+			},
+		}, "default")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(value)).To(Equal("hunter2-correct-horse"))
+		Expect(redact.String("connecting with hunter2-correct-horse")).To(Equal("connecting with " + redact.Replacement))
+	})
+})